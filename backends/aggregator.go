@@ -1,6 +1,9 @@
 package backends
 
 import (
+	"context"
+	"sort"
+
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 )
@@ -15,3 +18,122 @@ type Aggregator interface {
 	Average(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error)
 	GroupBy(collection *dal.Collection, fields []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error)
 }
+
+// Describes a grouping aggregation, along with how the resulting groups should be filtered,
+// sorted, and paginated.
+type GroupByQuery struct {
+	Fields     []string           // the fields to group records by
+	Aggregates []filter.Aggregate // the aggregates to calculate for each group
+	Filter     *filter.Filter     // selects the records to group; its sort and limits are ignored
+	Having     *filter.Filter     // if given, only groups matching this filter are returned
+	Sort       []string           // fields (including aggregate names) to sort the groups by
+	Limit      int
+	Offset     int
+}
+
+// Implemented by aggregators that can filter, sort, and paginate groups natively.  Implementations
+// may return NotImplementedError for queries they cannot perform, in which case every group is
+// retrieved and the rest of the query is applied in memory.
+type GroupByQueryAggregator interface {
+	GroupByQuery(ctx context.Context, collection *dal.Collection, query *GroupByQuery) (*dal.RecordSet, error)
+}
+
+// Performs the given grouping aggregation, returning one record per group.
+func GroupByQueryContext(ctx context.Context, aggregator Aggregator, collection *dal.Collection, query *GroupByQuery) (*dal.RecordSet, error) {
+	if ga, ok := aggregator.(GroupByQueryAggregator); ok {
+		if recordset, err := ga.GroupByQuery(ctx, collection, query); err != NotImplementedError {
+			return recordset, err
+		}
+	}
+
+	// sorting and limits apply to the groups, not the records being grouped
+	groups, err := GroupByContext(ctx, aggregator, collection, query.Fields, query.Aggregates, aggregationFilter(query.Filter))
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*dal.Record, 0, len(groups.Records))
+
+	for _, record := range groups.Records {
+		if query.Having == nil || query.Having.IsMatchAll() || query.Having.MatchesRecord(record) {
+			records = append(records, record)
+		}
+	}
+
+	if len(query.Sort) > 0 {
+		sortBy := (&filter.Filter{
+			Sort: query.Sort,
+		}).GetSort()
+
+		sort.SliceStable(records, func(i int, j int) bool {
+			for _, s := range sortBy {
+				if c := memoryCompare(records[i].Get(s.Field), records[j].Get(s.Field)); c != 0 {
+					if s.Descending {
+						return c > 0
+					} else {
+						return c < 0
+					}
+				}
+			}
+
+			return false
+		})
+	}
+
+	total := len(records)
+
+	if query.Offset > 0 {
+		if query.Offset < len(records) {
+			records = records[query.Offset:]
+		} else {
+			records = nil
+		}
+	}
+
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[:query.Limit]
+	}
+
+	recordset := dal.NewRecordSet(records...)
+	recordset.ResultCount = int64(total)
+	recordset.KnownSize = true
+	recordset.RecordsPerPage = query.Limit
+
+	return recordset, nil
+}
+
+// Calculates a single aggregate across all of the records matching the given filter.  This is
+// how aggregations without a dedicated Aggregator method (e.g.: percentiles) are performed.
+func AggregateValue(ctx context.Context, aggregator Aggregator, collection *dal.Collection, aggregate filter.Aggregate, f ...*filter.Filter) (interface{}, error) {
+	aggregate.Name = `value`
+
+	if results, err := GroupByContext(ctx, aggregator, collection, nil, []filter.Aggregate{aggregate}, f...); err == nil {
+		if len(results.Records) > 0 {
+			return results.Records[0].Get(aggregate.Name), nil
+		} else {
+			return newAggregateAccumulator(collection, aggregate).Value(), nil
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// returns a copy of the given filter (or one matching all records, if nil) without any sorting,
+// pagination, or field selection, which apply to the results of an aggregation rather than to the
+// records being aggregated.
+func aggregationFilter(f *filter.Filter) *filter.Filter {
+	if f == nil {
+		return filter.All()
+	}
+
+	flt := filter.Copy(f)
+	flt.Criteria = append([]filter.Criterion{}, flt.Criteria...)
+	flt.Sort = nil
+	flt.Limit = 0
+	flt.Offset = 0
+	flt.Cursor = ``
+	flt.Fields = nil
+
+	return &flt
+}
@@ -21,8 +21,32 @@ const (
 	PartialSearch BackendFeature = iota
 	CompositeKeys
 	Constraints
+	Transactional
 )
 
+func (self BackendFeature) String() string {
+	switch self {
+	case PartialSearch:
+		return `PartialSearch`
+	case CompositeKeys:
+		return `CompositeKeys`
+	case Constraints:
+		return `Constraints`
+	case Transactional:
+		return `Transactional`
+	default:
+		return fmt.Sprintf("BackendFeature(%d)", int(self))
+	}
+}
+
+// All features a backend may claim to support.
+var AllFeatures = []BackendFeature{
+	PartialSearch,
+	CompositeKeys,
+	Constraints,
+	Transactional,
+}
+
 type Backend interface {
 	Initialize() error
 	SetIndexer(dal.ConnectionString) error
@@ -32,6 +56,7 @@ type Backend interface {
 	Retrieve(collection string, id interface{}, fields ...string) (*dal.Record, error)
 	Insert(collection string, records *dal.RecordSet) error
 	Update(collection string, records *dal.RecordSet, target ...string) error
+	Upsert(collection string, records *dal.RecordSet) error
 	Delete(collection string, ids ...interface{}) error
 	CreateCollection(definition *dal.Collection) error
 	DeleteCollection(collection string) error
@@ -53,6 +78,7 @@ var backendMap = map[string]BackendFunc{
 	`dynamodb`:   NewDynamoBackend,
 	`file`:       NewFileBackend,
 	`fs`:         NewFilesystemBackend,
+	`memory`:     NewMemoryBackend,
 	`mongodb`:    NewMongoBackend,
 	`mongo`:      NewMongoBackend,
 	`mysql`:      NewSqlBackend,
@@ -83,6 +109,7 @@ func startPeriodicPinger(interval time.Duration, backend Backend) {
 // Instantiate the appropriate Backend for the given connection string.
 func MakeBackend(connection dal.ConnectionString) (Backend, error) {
 	var autopingInterval time.Duration
+	var autoexpireInterval time.Duration
 
 	backendName := connection.Backend()
 	log.Infof("Creating backend: %v", connection.String())
@@ -92,13 +119,22 @@ func MakeBackend(connection dal.ConnectionString) (Backend, error) {
 			autopingInterval = i
 		}
 
+		if i := connection.OptDuration(`expire`, 0); i > 0 {
+			autoexpireInterval = i
+		}
+
 		connection.ClearOpt(`ping`)
+		connection.ClearOpt(`expire`)
 
 		if backend := fn(connection); backend != nil {
 			if autopingInterval > 0 {
 				go startPeriodicPinger(autopingInterval, backend)
 			}
 
+			if autoexpireInterval > 0 {
+				go startPeriodicExpirer(autoexpireInterval, backend)
+			}
+
 			return backend, nil
 		} else {
 			return nil, fmt.Errorf("Error occurred instantiating backend %q", backendName)
@@ -0,0 +1,588 @@
+// Package backendtest provides a conformance test suite that can be run against any Backend
+// implementation, including third-party backends registered with backends.RegisterBackend.
+//
+// Usage:
+//
+//	func TestMyBackend(t *testing.T) {
+//		backendtest.RunConformance(t, func() backends.Backend {
+//			backend := NewMyBackend(dal.MustParseConnectionString(`mybackend://`))
+//
+//			if err := backend.Initialize(); err != nil {
+//				panic(err.Error())
+//			}
+//
+//			return backend
+//		})
+//	}
+package backendtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/backends"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+// A BackendFactory returns a new, initialized Backend.  It is called once for every test in the
+// suite.  Backends that share state between instances are supported, as every test removes the
+// collections it creates once it completes.
+type BackendFactory func() backends.Backend
+
+// Describes whether a backend claims to support a given feature, and whether it actually behaves
+// as though it does.
+type FeatureReport struct {
+	Feature  backends.BackendFeature
+	Claimed  bool
+	Behaves  bool
+	Messages []string
+}
+
+func (self FeatureReport) String() string {
+	return fmt.Sprintf("%-16v claimed=%-5v behaves=%v", self.Feature, self.Claimed, self.Behaves)
+}
+
+// The result of running the conformance suite against a backend.
+type Report struct {
+	Backend  string
+	Features []FeatureReport
+}
+
+// Returns all features whose claimed support does not match the observed behavior.
+func (self *Report) Mismatches() []FeatureReport {
+	mismatches := make([]FeatureReport, 0)
+
+	for _, feature := range self.Features {
+		if feature.Claimed != feature.Behaves {
+			mismatches = append(mismatches, feature)
+		}
+	}
+
+	return mismatches
+}
+
+func (self *Report) String() string {
+	lines := []string{fmt.Sprintf("feature support for %v:", self.Backend)}
+
+	for _, feature := range self.Features {
+		lines = append(lines, `  `+feature.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type conformanceTest struct {
+	Name string
+	Run  func(t *testing.T, backend backends.Backend)
+}
+
+var conformanceTests = []conformanceTest{
+	{`CollectionManagement`, testCollectionManagement},
+	{`CRUD`, testCRUD},
+	{`CompositeKeys`, testCompositeKeys},
+	{`FilterOperators`, testFilterOperators},
+	{`Pagination`, testPagination},
+	{`ListValues`, testListValues},
+	{`Aggregations`, testAggregations},
+	{`Constraints`, testConstraints},
+	{`EmbeddedRelationships`, testEmbeddedRelationships},
+}
+
+// Run the full conformance suite against backends created by the given factory.  Each part of the
+// suite runs as a subtest against a new backend.  Once complete, the features the backend claims
+// to support (via Supports) are compared against how it actually behaves.  Claiming a feature that
+// does not work fails the test; working features that are not claimed are only logged.
+func RunConformance(t *testing.T, factory BackendFactory) *Report {
+	for _, test := range conformanceTests {
+		test := test
+
+		t.Run(test.Name, func(t *testing.T) {
+			test.Run(t, factory())
+		})
+	}
+
+	backend := factory()
+	report := &Report{
+		Backend: backend.String(),
+	}
+
+	for _, feature := range backends.AllFeatures {
+		result := probeFeature(factory(), feature)
+
+		if result.Claimed && !result.Behaves {
+			t.Errorf("%v: claims to support %v, but does not: %v", backend, feature, strings.Join(result.Messages, `; `))
+		} else if !result.Claimed && result.Behaves {
+			t.Logf("%v: does not claim to support %v, but appears to", backend, feature)
+		}
+
+		report.Features = append(report.Features, result)
+	}
+
+	t.Log(report.String())
+	return report
+}
+
+// create the given collection, returning a function that removes it again.
+func createCollection(t *testing.T, backend backends.Backend, collection *dal.Collection) func() {
+	require.NoError(t, backend.CreateCollection(collection))
+
+	return func() {
+		require.NoError(t, backend.DeleteCollection(collection.Name))
+	}
+}
+
+func queryIds(t *testing.T, indexer backends.Indexer, collection *dal.Collection, spec string) []interface{} {
+	f, err := filter.Parse(spec)
+	require.NoError(t, err, spec)
+
+	recordset, err := indexer.Query(collection, f)
+	require.NoError(t, err, spec)
+
+	ids := make([]interface{}, 0)
+
+	for _, record := range recordset.Records {
+		ids = append(ids, fmt.Sprintf("%v", record.ID))
+	}
+
+	return ids
+}
+
+func testCollectionManagement(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformanceCollections`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	assert.NoError(backend.CreateCollection(collection))
+
+	names, err := backend.ListCollections()
+	assert.NoError(err)
+	assert.Contains(names, collection.Name)
+
+	actual, err := backend.GetCollection(collection.Name)
+	assert.NoError(err)
+	assert.Equal(collection.Name, actual.Name)
+
+	_, ok := actual.GetField(`name`)
+	assert.True(ok)
+
+	assert.NoError(backend.DeleteCollection(collection.Name))
+
+	_, err = backend.GetCollection(collection.Name)
+	assert.True(dal.IsCollectionNotFoundErr(err), "expected CollectionNotFound, got %v", err)
+}
+
+func testCRUD(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformanceCRUD`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `count`,
+		Type: dal.IntType,
+	}, dal.Field{
+		Name:         `created_at`,
+		Type:         dal.TimeType,
+		DefaultValue: func() interface{} { return time.Now() },
+	})
+
+	defer createCollection(t, backend, collection)()
+
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `First`).Set(`count`, 1),
+		dal.NewRecord(2).Set(`name`, `Second`).Set(`count`, 2),
+		dal.NewRecord(3).Set(`name`, `Third`).Set(`count`, 3),
+	)))
+
+	assert.True(backend.Exists(collection.Name, 1))
+	assert.True(backend.Exists(collection.Name, `1`))
+	assert.False(backend.Exists(collection.Name, 99))
+
+	record, err := backend.Retrieve(collection.Name, `1`)
+	assert.NoError(err)
+	assert.EqualValues(1, record.ID)
+	assert.Equal(`First`, record.Get(`name`))
+	assert.EqualValues(1, record.Get(`count`))
+	assert.IsType(time.Time{}, record.Get(`created_at`))
+
+	_, err = backend.Retrieve(collection.Name, 99)
+	assert.Error(err)
+
+	assert.NoError(backend.Update(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(2).Set(`name`, `Second (updated)`).Set(`count`, 22),
+	)))
+
+	record, err = backend.Retrieve(collection.Name, 2)
+	assert.NoError(err)
+	assert.Equal(`Second (updated)`, record.Get(`name`))
+	assert.EqualValues(22, record.Get(`count`))
+
+	assert.NoError(backend.Delete(collection.Name, 3))
+	assert.False(backend.Exists(collection.Name, 3))
+	assert.True(backend.Exists(collection.Name, 1))
+}
+
+func testCompositeKeys(t *testing.T, backend backends.Backend) {
+	if !backend.Supports(backends.CompositeKeys) {
+		t.Skipf("%v does not support composite keys", backend)
+	}
+
+	assert := require.New(t)
+	collection := compositeKeyCollection(`ConformanceCompositeKeys`)
+
+	defer createCollection(t, backend, collection)()
+
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`other_id`, 1).Set(`group`, `first`),
+		dal.NewRecord(`a`).Set(`other_id`, 2).Set(`group`, `second`),
+		dal.NewRecord(`b`).Set(`other_id`, 1).Set(`group`, `third`),
+	)))
+
+	record, err := backend.Retrieve(collection.Name, []interface{}{`a`, 2})
+	assert.NoError(err)
+	assert.Equal(`second`, record.Get(`group`))
+
+	if search := backend.WithSearch(collection); search != nil {
+		assert.Len(queryIds(t, search, collection, `id/a`), 2)
+		assert.Len(queryIds(t, search, collection, `id/a/other_id/1`), 1)
+	}
+
+	assert.NoError(backend.Delete(collection.Name, []interface{}{`a`, 1}))
+	assert.False(backend.Exists(collection.Name, []interface{}{`a`, 1}))
+	assert.True(backend.Exists(collection.Name, []interface{}{`a`, 2}))
+}
+
+func testFilterOperators(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformanceFilterOperators`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `age`,
+		Type: dal.IntType,
+	})
+
+	search := backend.WithSearch(collection)
+
+	if search == nil {
+		t.Skipf("%v does not support searching", backend)
+	}
+
+	defer createCollection(t, backend, collection)()
+
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `alice`).Set(`age`, 25),
+		dal.NewRecord(2).Set(`name`, `bob`).Set(`age`, 30),
+		dal.NewRecord(3).Set(`name`, `carol`).Set(`age`, 35),
+	)))
+
+	cases := map[string][]interface{}{
+		`all`:                                  {`1`, `2`, `3`},
+		`id/2`:                                 {`2`},
+		`name/bob`:                             {`2`},
+		`name/is:bob`:                          {`2`},
+		`name/not:bob`:                         {`1`, `3`},
+		`name/bob|carol`:                       {`2`, `3`},
+		`age/gt:30`:                            {`3`},
+		`age/gte:30`:                           {`2`, `3`},
+		`age/lt:30`:                            {`1`},
+		`age/lte:30`:                           {`1`, `2`},
+		`age/gt:25/age/lt:35`:                  {`2`},
+		`or(/name/alice/age/gt:30/)`:           {`1`, `3`},
+		`age/gte:30/or(/name/bob/name/alice/)`: {`2`},
+	}
+
+	if backend.Supports(backends.PartialSearch) {
+		cases[`name/like:ALICE`] = []interface{}{`1`}
+		cases[`name/unlike:alice`] = []interface{}{`2`, `3`}
+		cases[`name/prefix:car`] = []interface{}{`3`}
+		cases[`name/suffix:ce`] = []interface{}{`1`}
+		cases[`name/contains:o`] = []interface{}{`2`, `3`}
+	}
+
+	for spec, expected := range cases {
+		assert.ElementsMatch(expected, queryIds(t, search, collection, spec), spec)
+	}
+}
+
+func testPagination(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformancePagination`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	search := backend.WithSearch(collection)
+
+	if search == nil {
+		t.Skipf("%v does not support searching", backend)
+	}
+
+	defer createCollection(t, backend, collection)()
+
+	total := 21
+	expected := make([]interface{}, 0)
+	recordset := dal.NewRecordSet()
+
+	for i := 1; i <= total; i++ {
+		recordset.Push(dal.NewRecord(i).Set(`name`, fmt.Sprintf("record-%02d", i)))
+		expected = append(expected, fmt.Sprintf("%v", i))
+	}
+
+	assert.NoError(backend.Insert(collection.Name, recordset))
+
+	seen := make([]interface{}, 0)
+	limit := 5
+
+	for offset := 0; offset < total; offset += limit {
+		f := filter.All()
+		f.Limit = limit
+		f.Offset = offset
+
+		page, err := search.Query(collection, f)
+		assert.NoError(err)
+
+		if remaining := total - offset; remaining < limit {
+			assert.Len(page.Records, remaining, "offset=%d", offset)
+		} else {
+			assert.Len(page.Records, limit, "offset=%d", offset)
+		}
+
+		if page.KnownSize {
+			assert.EqualValues(total, page.ResultCount, "offset=%d", offset)
+		}
+
+		for _, record := range page.Records {
+			seen = append(seen, fmt.Sprintf("%v", record.ID))
+		}
+	}
+
+	// every record should appear on exactly one page
+	assert.ElementsMatch(expected, seen)
+
+	// the same should be true when following cursors instead of offsets
+	seen = make([]interface{}, 0)
+	cursor := filter.CursorStart
+
+	for pages := 0; cursor != ``; pages++ {
+		if pages > total {
+			assert.FailNow("cursor pagination did not terminate")
+		}
+
+		f := filter.All()
+		f.Limit = limit
+		f.Cursor = cursor
+
+		page, err := search.Query(collection, f)
+		assert.NoError(err)
+		assert.True(len(page.Records) <= limit)
+
+		for _, record := range page.Records {
+			seen = append(seen, fmt.Sprintf("%v", record.ID))
+		}
+
+		cursor = page.NextCursor
+	}
+
+	assert.ElementsMatch(expected, seen)
+}
+
+func testListValues(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformanceListValues`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `group`,
+		Type: dal.StringType,
+	})
+
+	search := backend.WithSearch(collection)
+
+	if search == nil {
+		t.Skipf("%v does not support searching", backend)
+	}
+
+	defer createCollection(t, backend, collection)()
+
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `first`).Set(`group`, `reds`),
+		dal.NewRecord(2).Set(`name`, `second`).Set(`group`, `reds`),
+		dal.NewRecord(3).Set(`name`, `third`).Set(`group`, `blues`),
+	)))
+
+	values, err := search.ListValues(collection, []string{`id`, `group`}, filter.All())
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{int64(1), int64(2), int64(3)}, values[`id`])
+	assert.ElementsMatch([]interface{}{`reds`, `blues`}, values[`group`])
+
+	values, err = search.ListValues(collection, []string{`name`}, filter.MustParse(`group/reds`))
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{`first`, `second`}, values[`name`])
+}
+
+func testAggregations(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	collection := dal.NewCollection(`ConformanceAggregations`).AddFields(dal.Field{
+		Name: `color`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `inventory`,
+		Type: dal.IntType,
+	})
+
+	aggregator := backend.WithAggregator(collection)
+
+	if aggregator == nil {
+		t.Skipf("%v does not support aggregation", backend)
+	}
+
+	defer createCollection(t, backend, collection)()
+
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`color`, `red`).Set(`inventory`, 34),
+		dal.NewRecord(2).Set(`color`, `green`).Set(`inventory`, 92),
+		dal.NewRecord(3).Set(`color`, `red`).Set(`inventory`, 0),
+		dal.NewRecord(4).Set(`color`, `blue`).Set(`inventory`, 54),
+	)))
+
+	count, err := aggregator.Count(collection, filter.All())
+	assert.NoError(err)
+	assert.Equal(uint64(4), count)
+
+	count, err = aggregator.Count(collection, filter.MustParse(`color/red`))
+	assert.NoError(err)
+	assert.Equal(uint64(2), count)
+
+	value, err := aggregator.Sum(collection, `inventory`, filter.All())
+	assert.NoError(err)
+	assert.Equal(float64(180), value)
+
+	value, err = aggregator.Minimum(collection, `inventory`, filter.All())
+	assert.NoError(err)
+	assert.Equal(float64(0), value)
+
+	value, err = aggregator.Maximum(collection, `inventory`, filter.All())
+	assert.NoError(err)
+	assert.Equal(float64(92), value)
+
+	value, err = aggregator.Average(collection, `inventory`, filter.All())
+	assert.NoError(err)
+	assert.Equal(float64(45), value)
+
+	if groups, err := aggregator.GroupBy(collection, []string{`color`}, []filter.Aggregate{
+		{Aggregation: filter.Sum, Field: `inventory`},
+	}, filter.All()); err == backends.NotImplementedError {
+		t.Logf("%v does not implement GroupBy", backend)
+	} else {
+		assert.NoError(err)
+		assert.Len(groups.Records, 3)
+
+		sums := make(map[string]float64)
+
+		for _, group := range groups.Records {
+			sums[fmt.Sprintf("%v", group.Get(`color`))] = typeutil.Float(group.Get(`inventory`))
+		}
+
+		assert.Equal(map[string]float64{
+			`red`:   34,
+			`green`: 92,
+			`blue`:  54,
+		}, sums)
+	}
+}
+
+func testConstraints(t *testing.T, backend backends.Backend) {
+	if !backend.Supports(backends.Constraints) {
+		t.Skipf("%v does not support constraints", backend)
+	}
+
+	assert := require.New(t)
+	groups, users := relatedCollections(`ConformanceConstraints`)
+
+	defer createCollection(t, backend, groups)()
+	defer createCollection(t, backend, users)()
+
+	assert.NoError(backend.Insert(groups.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `admins`),
+	)))
+
+	assert.NoError(backend.Insert(users.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `alice`).Set(`group_id`, 1),
+	)))
+
+	assert.Error(backend.Insert(users.Name, dal.NewRecordSet(
+		dal.NewRecord(2).Set(`name`, `bob`).Set(`group_id`, 99),
+	)))
+
+	assert.False(backend.Exists(users.Name, 2))
+}
+
+func testEmbeddedRelationships(t *testing.T, backend backends.Backend) {
+	assert := require.New(t)
+	groups, users := relatedCollections(`ConformanceEmbedded`)
+
+	defer createCollection(t, backend, groups)()
+	defer createCollection(t, backend, users)()
+
+	backend.RegisterCollection(groups)
+	backend.RegisterCollection(users)
+
+	assert.NoError(backend.Insert(groups.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `admins`),
+	)))
+
+	assert.NoError(backend.Insert(users.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `alice`).Set(`group_id`, 1),
+	)))
+
+	embedded := backends.NewEmbeddedRecordBackend(backend)
+
+	record, err := embedded.Retrieve(users.Name, 1)
+	assert.NoError(err)
+
+	group, ok := record.Get(`group_id`).(map[string]interface{})
+	assert.True(ok, "expected group_id to be embedded, got %T", record.Get(`group_id`))
+	assert.Equal(`admins`, group[`name`])
+}
+
+func compositeKeyCollection(name string) *dal.Collection {
+	return &dal.Collection{
+		Name:              name,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `other_id`,
+				Type: dal.IntType,
+				Key:  true,
+			}, {
+				Name: `group`,
+				Type: dal.StringType,
+			},
+		},
+	}
+}
+
+func relatedCollections(prefix string) (*dal.Collection, *dal.Collection) {
+	groups := dal.NewCollection(prefix + `Groups`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	users := dal.NewCollection(prefix+`Users`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name:      `group_id`,
+		Type:      dal.IntType,
+		BelongsTo: groups.Name,
+	})
+
+	return groups, users
+}
@@ -0,0 +1,54 @@
+package backendtest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/backends"
+	"github.com/PerformLine/pivot/v3/dal"
+)
+
+func makeBackend(conn string) backends.Backend {
+	if backend, err := backends.MakeBackend(dal.MustParseConnectionString(conn)); err == nil {
+		if err := backend.Initialize(); err == nil {
+			return backend
+		} else {
+			panic(err.Error())
+		}
+	} else {
+		panic(err.Error())
+	}
+}
+
+func TestMemoryConformance(t *testing.T) {
+	RunConformance(t, func() backends.Backend {
+		return makeBackend(`memory://`)
+	})
+}
+
+func TestSqliteConformance(t *testing.T) {
+	RunConformance(t, func() backends.Backend {
+		return makeBackend(`sqlite://temporary`)
+	})
+}
+
+func TestSqliteForeignKeysConformance(t *testing.T) {
+	RunConformance(t, func() backends.Backend {
+		return makeBackend(`sqlite://temporary?foreign_keys=true`)
+	})
+}
+
+func TestFilesystemConformance(t *testing.T) {
+	root, err := ioutil.TempDir(``, `pivot-conformance-`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	RunConformance(t, func() backends.Backend {
+		return makeBackend(`fs:///` + root)
+	})
+}
@@ -0,0 +1,182 @@
+package backendtest
+
+import (
+	"fmt"
+
+	"github.com/PerformLine/pivot/v3/backends"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+type featureProbe func(backend backends.Backend) error
+
+var featureProbes = map[backends.BackendFeature]featureProbe{
+	backends.PartialSearch: probePartialSearch,
+	backends.CompositeKeys: probeCompositeKeys,
+	backends.Constraints:   probeConstraints,
+	backends.Transactional: probeTransactional,
+}
+
+// determine whether the given backend claims to support a feature, and whether it actually
+// behaves as though it does.  Probes never fail the test; they only record what they observed.
+func probeFeature(backend backends.Backend, feature backends.BackendFeature) FeatureReport {
+	result := FeatureReport{
+		Feature: feature,
+		Claimed: backend.Supports(feature),
+	}
+
+	if probe, ok := featureProbes[feature]; ok {
+		if err := runProbe(probe, backend); err == nil {
+			result.Behaves = true
+		} else {
+			result.Messages = append(result.Messages, err.Error())
+		}
+	} else {
+		result.Messages = append(result.Messages, `no probe available`)
+	}
+
+	return result
+}
+
+// run a probe, converting any panics into errors.
+func runProbe(probe featureProbe, backend backends.Backend) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return probe(backend)
+}
+
+// creates the given collections, runs fn, then removes the collections (in reverse order).
+func withCollections(backend backends.Backend, fn func() error, collections ...*dal.Collection) error {
+	for i, collection := range collections {
+		if err := backend.CreateCollection(collection); err == nil {
+			defer backend.DeleteCollection(collections[i].Name)
+		} else {
+			return err
+		}
+	}
+
+	return fn()
+}
+
+func probePartialSearch(backend backends.Backend) error {
+	collection := dal.NewCollection(`ConformanceProbePartialSearch`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	search := backend.WithSearch(collection)
+
+	if search == nil {
+		return fmt.Errorf("backend does not support searching")
+	}
+
+	return withCollections(backend, func() error {
+		if err := backend.Insert(collection.Name, dal.NewRecordSet(
+			dal.NewRecord(1).Set(`name`, `First`),
+			dal.NewRecord(2).Set(`name`, `Second`),
+			dal.NewRecord(3).Set(`name`, `Third`),
+		)); err != nil {
+			return err
+		}
+
+		for spec, expected := range map[string]int{
+			`name/contains:ir`: 2,
+			`name/prefix:sec`:  1,
+			`name/suffix:d`:    2,
+			`name/like:third`:  1,
+		} {
+			if recordset, err := search.Query(collection, filter.MustParse(spec)); err == nil {
+				if actual := len(recordset.Records); actual != expected {
+					return fmt.Errorf("query %q: expected %d results, got %d", spec, expected, actual)
+				}
+			} else {
+				return fmt.Errorf("query %q: %v", spec, err)
+			}
+		}
+
+		return nil
+	}, collection)
+}
+
+func probeCompositeKeys(backend backends.Backend) error {
+	collection := compositeKeyCollection(`ConformanceProbeCompositeKeys`)
+
+	return withCollections(backend, func() error {
+		if err := backend.Insert(collection.Name, dal.NewRecordSet(
+			dal.NewRecord(`a`).Set(`other_id`, 1).Set(`group`, `first`),
+			dal.NewRecord(`a`).Set(`other_id`, 2).Set(`group`, `second`),
+		)); err != nil {
+			return err
+		}
+
+		if record, err := backend.Retrieve(collection.Name, []interface{}{`a`, 1}); err == nil {
+			if group := record.Get(`group`); group != `first` {
+				return fmt.Errorf("retrieving (a, 1): expected group %q, got %v", `first`, group)
+			}
+		} else {
+			return err
+		}
+
+		if record, err := backend.Retrieve(collection.Name, []interface{}{`a`, 2}); err == nil {
+			if group := record.Get(`group`); group != `second` {
+				return fmt.Errorf("retrieving (a, 2): expected group %q, got %v", `second`, group)
+			}
+		} else {
+			return err
+		}
+
+		return nil
+	}, collection)
+}
+
+func probeConstraints(backend backends.Backend) error {
+	groups, users := relatedCollections(`ConformanceProbeConstraints`)
+
+	return withCollections(backend, func() error {
+		if err := backend.Insert(users.Name, dal.NewRecordSet(
+			dal.NewRecord(1).Set(`name`, `alice`).Set(`group_id`, 99),
+		)); err == nil {
+			return fmt.Errorf("inserting a record that references a nonexistent record succeeded")
+		}
+
+		return nil
+	}, groups, users)
+}
+
+func probeTransactional(backend backends.Backend) error {
+	collection := dal.NewCollection(`ConformanceProbeTransactional`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	if _, ok := backend.(backends.TransactionalBackend); !ok {
+		return fmt.Errorf("backend does not implement TransactionalBackend")
+	}
+
+	return withCollections(backend, func() error {
+		if tx, err := backend.(backends.TransactionalBackend).Begin(); err == nil {
+			if err := tx.Insert(collection.Name, dal.NewRecordSet(
+				dal.NewRecord(1).Set(`name`, `rolled back`),
+			)); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if err := tx.Rollback(); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+
+		if backend.Exists(collection.Name, 1) {
+			return fmt.Errorf("record written inside a rolled-back transaction exists")
+		}
+
+		return nil
+	}, collection)
+}
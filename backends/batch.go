@@ -0,0 +1,33 @@
+package backends
+
+import (
+	"context"
+
+	"github.com/PerformLine/pivot/v3/dal"
+)
+
+// Backends that can retrieve several records in a single request implement this interface.
+type BatchRetriever interface {
+	RetrieveBatch(ctx context.Context, collection string, ids []interface{}, fields ...string) (*dal.RecordSet, error)
+}
+
+// Retrieve the records with the given IDs, in the order the IDs were given.  IDs that do not exist
+// are skipped.  Backends that do not implement BatchRetriever retrieve each record individually.
+func RetrieveBatch(ctx context.Context, backend Backend, collection string, ids []interface{}, fields ...string) (*dal.RecordSet, error) {
+	if br, ok := backend.(BatchRetriever); ok {
+		return br.RetrieveBatch(ctx, collection, ids, fields...)
+	}
+
+	records := dal.NewRecordSet()
+
+	for _, id := range ids {
+		if record, err := RetrieveContext(ctx, backend, collection, id, fields...); err == nil {
+			records.Push(record)
+		} else if !dal.IsNotExistError(err) {
+			return nil, err
+		}
+	}
+
+	records.ResultCount = int64(len(records.Records))
+	return records, nil
+}
@@ -0,0 +1,29 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieveBatch(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	collection, records := testAnalyticsCollection(`TestRetrieveBatch`)
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, records))
+
+	// records come back in the order requested, skipping missing ones
+	recordset, err := RetrieveBatch(context.Background(), backend, collection.Name, []interface{}{5, 42, 1})
+	assert.NoError(err)
+	assert.EqualValues(2, recordset.ResultCount)
+	assert.EqualValues(5, recordset.Records[0].ID)
+	assert.EqualValues(1, recordset.Records[1].ID)
+
+	_, err = RetrieveBatch(context.Background(), backend, `missing`, []interface{}{1})
+	assert.Error(err)
+}
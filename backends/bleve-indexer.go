@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -15,6 +16,7 @@ import (
 	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
 	"github.com/blevesearch/bleve/analysis/char/regexp"
 	"github.com/blevesearch/bleve/analysis/token/lowercase"
 	"github.com/blevesearch/bleve/analysis/tokenizer/single"
@@ -26,6 +28,7 @@ import (
 var BleveBatchFlushCount = 1
 var BleveBatchFlushInterval = 10 * time.Second
 var BleveIdentityField = `_id`
+var BleveFulltextFieldSuffix = `__fulltext`
 
 type bleveDeferredBatch struct {
 	batch     *bleve.Batch
@@ -172,12 +175,18 @@ func (self *BleveIndexer) checkAndFlushBatches(forceFlush bool) {
 }
 
 func (self *BleveIndexer) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, f, resultFn)
+
 	defer stats.NewTiming().Send(`pivot.indexers.bleve.query_time`)
 
 	if f.IdentityField == `` {
 		f.IdentityField = BleveIdentityField
 	}
 
+	if f.UsesCursor() {
+		return fmt.Errorf("%T does not support cursor pagination", self)
+	}
+
 	if index, err := self.getIndexForCollection(collection); err == nil {
 		if bq, err := self.filterToBleveQuery(index, f); err == nil {
 			limit := f.Limit
@@ -221,7 +230,13 @@ func (self *BleveIndexer) QueryFunc(collection *dal.Collection, f *filter.Filter
 
 					// call the resultFn for each hit on this page
 					for _, hit := range results.Hits {
-						if err := resultFn(dal.NewRecord(hit.ID).SetFields(hit.Fields), nil, IndexPage{
+						record := dal.NewRecord(hit.ID).SetFields(hit.Fields)
+
+						if f.UsesFulltext() {
+							record.Set(filter.ScoreField, hit.Score)
+						}
+
+						if err := resultFn(record, nil, IndexPage{
 							Page:         page,
 							TotalPages:   totalPages,
 							Limit:        f.Limit,
@@ -345,6 +360,60 @@ func (self *BleveIndexer) ListValues(collection *dal.Collection, fields []string
 	}
 }
 
+// Facets counts the values of each field using term facets.  As with ListValues, the values are
+// the terms each field was indexed as.
+func (self *BleveIndexer) Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	for _, field := range query.Fields {
+		switch field {
+		case `_id`, `id`, collection.IdentityField:
+			return nil, NotImplementedError
+		}
+	}
+
+	if index, err := self.getIndexForCollection(collection); err == nil {
+		if bq, err := self.filterToBleveQuery(index, aggregationFilter(query.Filter)); err == nil {
+			request := bleve.NewSearchRequestOptions(bq, 0, 0, false)
+			size := query.size()
+
+			// terms come back most common first, so sorting by value requires all of them
+			if query.Sort == FacetSortValue {
+				size = MaxFacetCardinality
+			}
+
+			for _, field := range query.Fields {
+				request.AddFacet(field, bleve.NewFacetRequest(field, size))
+			}
+
+			if results, err := index.SearchInContext(ctx, request); err == nil {
+				facets := make(map[string][]FacetValue)
+
+				for _, field := range query.Fields {
+					values := make([]FacetValue, 0)
+
+					if facet, ok := results.Facets[field]; ok {
+						for _, term := range facet.Terms {
+							values = append(values, FacetValue{
+								Value: term.Term,
+								Count: int64(term.Count),
+							})
+						}
+					}
+
+					facets[field] = query.finalize(values)
+				}
+
+				return facets, nil
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
 func (self *BleveIndexer) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
 	f.Fields = []string{BleveIdentityField}
 	var ids []interface{}
@@ -376,6 +445,7 @@ func (self *BleveIndexer) getIndexForCollection(collection *dal.Collection) (ble
 
 		// setup the mapping and text analysis settings for this index
 		self.useFilterMapping(mapping)
+		self.useFulltextMapping(mapping, collection)
 
 		switch self.conn.Dataset() {
 		case `memory`:
@@ -407,191 +477,224 @@ func (self *BleveIndexer) filterToBleveQuery(index bleve.Index, f *filter.Filter
 
 	if f.MatchAll {
 		return bleve.NewMatchAllQuery(), nil
+	} else if q, err := self.criteriaToBleveQuery(index.Mapping(), f, f.Conjunction, f.Criteria); err == nil {
+		if q != nil {
+			data, _ := json.MarshalIndent(q, ``, `  `)
+			querylog.Debugf("[%T] Query: %v", self, string(data[:]))
+
+			return q, nil
+		} else {
+			return nil, fmt.Errorf("Filter did not produce a valid query")
+		}
 	} else {
-		mapping := index.Mapping()
-		conjunction := bleve.NewConjunctionQuery()
-
-		for _, criterion := range f.Criteria {
-			// map any field called "id" to the identity field name
-			if criterion.Field == `id` {
-				if f.IdentityField == `` {
-					criterion.Field = BleveIdentityField
-				} else {
-					criterion.Field = f.IdentityField
-				}
-			}
+		return nil, err
+	}
+}
 
-			var skipNext bool
-			var disjunction *query.DisjunctionQuery
+// builds a query that combines the given criteria using the given conjunction, recursing
+// into any nested criteria groups.  Returns nil if no queries were produced.
+func (self *BleveIndexer) criteriaToBleveQuery(mapping mapping.IndexMapping, f *filter.Filter, conjunction filter.ConjunctionType, criteria []filter.Criterion) (query.Query, error) {
+	queries := make([]query.Query, 0)
 
-			analyzerName := mapping.AnalyzerNameForPath(criterion.Field)
+	for _, criterion := range criteria {
+		var q query.Query
+		var err error
 
-			// this handles AND (field=a OR b OR ...)
-			if len(criterion.Values) > 1 {
-				disjunction = bleve.NewDisjunctionQuery()
-			}
+		if criterion.IsGroup() {
+			q, err = self.criteriaToBleveQuery(mapping, f, criterion.Conjunction, criterion.Criteria)
+		} else {
+			q, err = self.criterionToBleveQuery(mapping, f, criterion)
+		}
 
-			for _, vI := range criterion.Values {
-				value := fmt.Sprintf("%v", vI)
-				var analyzedValue string
-				var invertQuery bool
+		if err != nil {
+			return nil, err
+		} else if q != nil {
+			queries = append(queries, q)
+		}
+	}
 
-				if az := mapping.AnalyzerNamed(analyzerName); az != nil {
-					for _, token := range az.Analyze([]byte(value[:])) {
-						analyzedValue += string(token.Term[:])
-					}
-				} else {
-					analyzedValue = value
-				}
+	if len(queries) == 0 {
+		return nil, nil
+	} else if conjunction == filter.OrConjunction {
+		return bleve.NewDisjunctionQuery(queries...), nil
+	} else {
+		return bleve.NewConjunctionQuery(queries...), nil
+	}
+}
 
-				var currentQuery query.FieldableQuery
+func (self *BleveIndexer) criterionToBleveQuery(mapping mapping.IndexMapping, f *filter.Filter, criterion filter.Criterion) (query.Query, error) {
+	// map any field called "id" to the identity field name
+	if criterion.Field == `id` {
+		if f.IdentityField == `` {
+			criterion.Field = BleveIdentityField
+		} else {
+			criterion.Field = f.IdentityField
+		}
+	}
 
-				switch criterion.Operator {
-				case `is`, ``, `not`, `like`, `unlike`:
-					switch criterion.Operator {
-					case `not`, `unlike`:
-						invertQuery = true
-					}
+	var result query.Query
+	var disjunction *query.DisjunctionQuery
+	field := criterion.Field
 
-					if criterion.Field == f.IdentityField {
-						q := bleve.NewDocIDQuery(sliceutil.Stringify(criterion.Values))
+	analyzerName := mapping.AnalyzerNameForPath(criterion.Field)
 
-						if invertQuery {
-							bq := bleve.NewBooleanQuery()
-							bq.AddMustNot(q)
-							conjunction.AddQuery(bq)
-						} else {
-							conjunction.AddQuery(q)
-						}
+	// this handles AND (field=a OR b OR ...)
+	if len(criterion.Values) > 1 {
+		disjunction = bleve.NewDisjunctionQuery()
+	}
 
-						skipNext = true
-						break
-					} else {
-						switch analyzedValue {
-						case `null`:
-							currentQuery = bleve.NewTermQuery(``)
-						case `true`:
-							currentQuery = bleve.NewBoolFieldQuery(true)
-						case `false`:
-							currentQuery = bleve.NewBoolFieldQuery(false)
-						default:
-							currentQuery = bleve.NewTermQuery(analyzedValue)
-						}
-					}
+	for _, vI := range criterion.Values {
+		value := fmt.Sprintf("%v", vI)
+		var analyzedValue string
+		var invertQuery bool
 
-				case `prefix`:
-					currentQuery = bleve.NewWildcardQuery(analyzedValue + `*`)
-				case `suffix`:
-					currentQuery = bleve.NewWildcardQuery(`*` + analyzedValue)
-				case `contains`:
-					currentQuery = bleve.NewWildcardQuery(`*` + analyzedValue + `*`)
+		if az := mapping.AnalyzerNamed(analyzerName); az != nil {
+			for _, token := range az.Analyze([]byte(value[:])) {
+				analyzedValue += string(token.Term[:])
+			}
+		} else {
+			analyzedValue = value
+		}
 
-				case `gt`, `lt`, `gte`, `lte`:
-					var minInc, maxInc bool
+		var currentQuery query.FieldableQuery
 
-					if strings.HasPrefix(criterion.Operator, `gt`) {
-						minInc = strings.HasSuffix(criterion.Operator, `e`)
-					} else {
-						maxInc = strings.HasSuffix(criterion.Operator, `e`)
-					}
+		switch criterion.Operator {
+		case `is`, ``, `not`, `like`, `unlike`:
+			switch criterion.Operator {
+			case `not`, `unlike`:
+				invertQuery = true
+			}
 
-					switch criterion.Type {
-					case dal.TimeType:
-						var min, max time.Time
+			if criterion.Field == f.IdentityField {
+				q := bleve.NewDocIDQuery(sliceutil.Stringify(criterion.Values))
 
-						if v, err := stringutil.ConvertToTime(analyzedValue); err == nil {
-							if strings.HasPrefix(criterion.Operator, `gt`) {
-								min = v
-							} else {
-								max = v
-							}
-						} else {
-							return nil, err
-						}
+				if invertQuery {
+					bq := bleve.NewBooleanQuery()
+					bq.AddMustNot(q)
+					return bq, nil
+				} else {
+					return q, nil
+				}
+			} else {
+				switch analyzedValue {
+				case `null`:
+					currentQuery = bleve.NewTermQuery(``)
+				case `true`:
+					currentQuery = bleve.NewBoolFieldQuery(true)
+				case `false`:
+					currentQuery = bleve.NewBoolFieldQuery(false)
+				default:
+					currentQuery = bleve.NewTermQuery(analyzedValue)
+				}
+			}
 
-						currentQuery = query.NewDateRangeInclusiveQuery(min, max, &minInc, &maxInc)
-					default:
-						var min, max *float64
+		case `fulltext`:
+			// full-text queries are matched against the terms in the separately-analyzed copy of the field
+			mq := bleve.NewMatchQuery(value)
+			mq.SetOperator(query.MatchQueryOperatorAnd)
+			field = criterion.Field + BleveFulltextFieldSuffix
+			currentQuery = mq
+
+		case `prefix`:
+			currentQuery = bleve.NewWildcardQuery(analyzedValue + `*`)
+		case `suffix`:
+			currentQuery = bleve.NewWildcardQuery(`*` + analyzedValue)
+		case `contains`:
+			currentQuery = bleve.NewWildcardQuery(`*` + analyzedValue + `*`)
+
+		case `gt`, `lt`, `gte`, `lte`:
+			var minInc, maxInc bool
+
+			if strings.HasPrefix(criterion.Operator, `gt`) {
+				minInc = strings.HasSuffix(criterion.Operator, `e`)
+			} else {
+				maxInc = strings.HasSuffix(criterion.Operator, `e`)
+			}
 
-						if v, err := stringutil.ConvertToFloat(analyzedValue); err == nil {
-							if strings.HasPrefix(criterion.Operator, `gt`) {
-								min = &v
-							} else {
-								max = &v
-							}
-						} else {
-							return nil, err
-						}
+			switch criterion.Type {
+			case dal.TimeType:
+				var min, max time.Time
 
-						currentQuery = bleve.NewNumericRangeInclusiveQuery(min, max, &minInc, &maxInc)
+				if v, err := stringutil.ConvertToTime(analyzedValue); err == nil {
+					if strings.HasPrefix(criterion.Operator, `gt`) {
+						min = v
+					} else {
+						max = v
 					}
+				} else {
+					return nil, err
+				}
 
-				// case `not`:
-				// 	q := bleve.NewBooleanQuery()
-				// 	var subquery query.FieldableQuery
+				currentQuery = query.NewDateRangeInclusiveQuery(min, max, &minInc, &maxInc)
+			default:
+				var min, max *float64
 
-				// 	if analyzedValue == `null` {
-				// 		subquery = bleve.NewTermQuery(``)
-				// 	} else {
-				// 		subquery = bleve.NewTermQuery(analyzedValue)
-				// 	}
+				if v, err := stringutil.ConvertToFloat(analyzedValue); err == nil {
+					if strings.HasPrefix(criterion.Operator, `gt`) {
+						min = &v
+					} else {
+						max = &v
+					}
+				} else {
+					return nil, err
+				}
 
-				// 	subquery.SetField(criterion.Field)
-				// 	q.AddMustNot(subquery)
+				currentQuery = bleve.NewNumericRangeInclusiveQuery(min, max, &minInc, &maxInc)
+			}
 
-				// 	if disjunction != nil {
-				// 		disjunction.AddQuery(q)
-				// 		conjunction.AddQuery(disjunction)
-				// 	}else{
-				// 		conjunction.AddQuery(q)
-				// 	}
+		// case `not`:
+		// 	q := bleve.NewBooleanQuery()
+		// 	var subquery query.FieldableQuery
 
-				// 	continue
+		// 	if analyzedValue == `null` {
+		// 		subquery = bleve.NewTermQuery(``)
+		// 	} else {
+		// 		subquery = bleve.NewTermQuery(analyzedValue)
+		// 	}
 
-				default:
-					return nil, fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
-				}
+		// 	subquery.SetField(criterion.Field)
+		// 	q.AddMustNot(subquery)
 
-				if currentQuery != nil {
-					currentQuery.SetField(criterion.Field)
+		// 	if disjunction != nil {
+		// 		disjunction.AddQuery(q)
+		// 		conjunction.AddQuery(disjunction)
+		// 	}else{
+		// 		conjunction.AddQuery(q)
+		// 	}
 
-					if invertQuery {
-						inversionQuery := bleve.NewBooleanQuery()
-						inversionQuery.AddMustNot(currentQuery)
+		// 	continue
 
-						if disjunction != nil {
-							disjunction.AddQuery(inversionQuery)
-						} else {
-							conjunction.AddQuery(inversionQuery)
-						}
-					} else {
-						if disjunction != nil {
-							disjunction.AddQuery(currentQuery)
-						} else {
-							conjunction.AddQuery(currentQuery)
-						}
-					}
-				}
-			}
+		default:
+			return nil, fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
+		}
 
-			if skipNext {
-				continue
-			}
+		if currentQuery != nil {
+			currentQuery.SetField(field)
+
+			if invertQuery {
+				inversionQuery := bleve.NewBooleanQuery()
+				inversionQuery.AddMustNot(currentQuery)
 
-			if disjunction != nil {
-				conjunction.AddQuery(disjunction)
+				if disjunction != nil {
+					disjunction.AddQuery(inversionQuery)
+				} else {
+					result = inversionQuery
+				}
+			} else {
+				if disjunction != nil {
+					disjunction.AddQuery(currentQuery)
+				} else {
+					result = currentQuery
+				}
 			}
 		}
+	}
 
-		if len(conjunction.Conjuncts) > 0 {
-			data, _ := json.MarshalIndent(conjunction, ``, `  `)
-			querylog.Debugf("[%T] Query: %v", self, string(data[:]))
-
-			return conjunction, nil
-		} else {
-			return nil, fmt.Errorf("Filter did not produce a valid query")
-		}
+	if disjunction != nil {
+		return disjunction, nil
 	}
+
+	return result, nil
 }
 
 func (self *BleveIndexer) useFilterMapping(mappingImpl *mapping.IndexMappingImpl) {
@@ -613,3 +716,24 @@ func (self *BleveIndexer) useFilterMapping(mappingImpl *mapping.IndexMappingImpl
 
 	mappingImpl.DefaultAnalyzer = `pivot_filter`
 }
+
+// string fields are indexed a second time using the standard analyzer so that full-text queries can
+// match the individual terms in them (the filter analyzer treats the whole value as a single term.)
+func (self *BleveIndexer) useFulltextMapping(mappingImpl *mapping.IndexMappingImpl, collection *dal.Collection) {
+	for _, field := range collection.Fields {
+		if field.Type != dal.StringType {
+			continue
+		}
+
+		exact := bleve.NewTextFieldMapping()
+		exact.Analyzer = mappingImpl.DefaultAnalyzer
+
+		fulltext := bleve.NewTextFieldMapping()
+		fulltext.Name = field.Name + BleveFulltextFieldSuffix
+		fulltext.Analyzer = standard.Name
+		fulltext.Store = false
+		fulltext.IncludeInAll = false
+
+		mappingImpl.DefaultMapping.AddFieldMappingsAt(field.Name, exact, fulltext)
+	}
+}
@@ -59,6 +59,10 @@ func (self *CachingBackend) SetIndexer(cs dal.ConnectionString) error {
 	return self.backend.SetIndexer(cs)
 }
 
+func (self *CachingBackend) AttachIndexer(indexer Indexer) error {
+	return AttachIndexer(self.backend, indexer)
+}
+
 func (self *CachingBackend) RegisterCollection(c *dal.Collection) {
 	self.backend.RegisterCollection(c)
 }
@@ -75,6 +79,10 @@ func (self *CachingBackend) Update(collection string, records *dal.RecordSet, ta
 	return self.backend.Update(collection, records, target...)
 }
 
+func (self *CachingBackend) Upsert(collection string, records *dal.RecordSet) error {
+	return self.backend.Upsert(collection, records)
+}
+
 func (self *CachingBackend) Delete(collection string, ids ...interface{}) error {
 	return self.backend.Delete(collection, ids...)
 }
@@ -0,0 +1,131 @@
+package backends
+
+import (
+	"context"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+// Backends that can bound or cancel record operations using a context.Context implement this
+// interface.
+type ContextBackend interface {
+	RetrieveContext(ctx context.Context, collection string, id interface{}, fields ...string) (*dal.Record, error)
+	InsertContext(ctx context.Context, collection string, records *dal.RecordSet) error
+	UpdateContext(ctx context.Context, collection string, records *dal.RecordSet, target ...string) error
+	UpsertContext(ctx context.Context, collection string, records *dal.RecordSet) error
+	DeleteContext(ctx context.Context, collection string, ids ...interface{}) error
+}
+
+// Indexers that can bound or cancel queries using a context.Context implement this interface.
+type ContextIndexer interface {
+	QueryFuncContext(ctx context.Context, collection *dal.Collection, filter *filter.Filter, resultFn IndexResultFunc) error
+	QueryContext(ctx context.Context, collection *dal.Collection, filter *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error)
+}
+
+// Aggregators that can bound or cancel grouping queries using a context.Context implement this
+// interface.
+type ContextAggregator interface {
+	GroupByContext(ctx context.Context, collection *dal.Collection, fields []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error)
+}
+
+// Retrieve a record using the given context.  Backends that do not implement ContextBackend
+// will only have the context checked before the operation begins.
+func RetrieveContext(ctx context.Context, backend Backend, collection string, id interface{}, fields ...string) (*dal.Record, error) {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb.RetrieveContext(ctx, collection, id, fields...)
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return backend.Retrieve(collection, id, fields...)
+}
+
+// Insert records using the given context.  Backends that do not implement ContextBackend
+// will only have the context checked before the operation begins.
+func InsertContext(ctx context.Context, backend Backend, collection string, records *dal.RecordSet) error {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb.InsertContext(ctx, collection, records)
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return backend.Insert(collection, records)
+}
+
+// Update records using the given context.  Backends that do not implement ContextBackend
+// will only have the context checked before the operation begins.
+func UpdateContext(ctx context.Context, backend Backend, collection string, records *dal.RecordSet, target ...string) error {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb.UpdateContext(ctx, collection, records, target...)
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return backend.Update(collection, records, target...)
+}
+
+// Upsert records using the given context.  Backends that do not implement ContextBackend
+// will only have the context checked before the operation begins.
+func UpsertContext(ctx context.Context, backend Backend, collection string, records *dal.RecordSet) error {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb.UpsertContext(ctx, collection, records)
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return backend.Upsert(collection, records)
+}
+
+// Delete records using the given context.  Backends that do not implement ContextBackend
+// will only have the context checked before the operation begins.
+func DeleteContext(ctx context.Context, backend Backend, collection string, ids ...interface{}) error {
+	if cb, ok := backend.(ContextBackend); ok {
+		return cb.DeleteContext(ctx, collection, ids...)
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return backend.Delete(collection, ids...)
+}
+
+// Perform a query using the given context.  For indexers that do not implement ContextIndexer,
+// the context is checked before each result is delivered, stopping iteration once it is done.
+func QueryFuncContext(ctx context.Context, indexer Indexer, collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	if ci, ok := indexer.(ContextIndexer); ok {
+		return ci.QueryFuncContext(ctx, collection, f, resultFn)
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return indexer.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+
+		return resultFn(record, err, page)
+	})
+}
+
+// Perform a query using the given context, returning the results as a RecordSet.
+func QueryContext(ctx context.Context, indexer Indexer, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	if ci, ok := indexer.(ContextIndexer); ok {
+		return ci.QueryContext(ctx, collection, f, resultFns...)
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return indexer.Query(collection, f, resultFns...)
+}
+
+// Perform a grouping aggregation using the given context.  Aggregators that do not implement
+// ContextAggregator will only have the context checked before the operation begins.
+func GroupByContext(ctx context.Context, aggregator Aggregator, collection *dal.Collection, fields []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error) {
+	if ca, ok := aggregator.(ContextAggregator); ok {
+		return ca.GroupByContext(ctx, collection, fields, aggregates, f...)
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return aggregator.GroupBy(collection, fields, aggregates, f...)
+}
@@ -0,0 +1,84 @@
+package backends
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlContextCancellation(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`))
+	assert.NoError(backend.Initialize())
+
+	collection := testTransactionCollection(`TestSqlContextCancellation`)
+	assert.NoError(backend.CreateCollection(collection))
+
+	ctx := context.Background()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	// operations with a live context succeed
+	assert.NoError(InsertContext(ctx, backend, collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `first`),
+	)))
+
+	record, err := RetrieveContext(ctx, backend, collection.Name, `a`)
+	assert.NoError(err)
+	assert.Equal(`first`, record.Get(`name`))
+
+	recordset, err := QueryContext(ctx, backend.WithSearch(collection), collection, filter.All())
+	assert.NoError(err)
+	assert.Equal(int64(1), recordset.ResultCount)
+
+	// operations with a cancelled context fail without side effects
+	assert.Equal(context.Canceled, InsertContext(cancelled, backend, collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`b`).Set(`name`, `second`),
+	)))
+
+	assert.False(backend.Exists(collection.Name, `b`))
+
+	_, err = RetrieveContext(cancelled, backend, collection.Name, `a`)
+	assert.Error(err)
+
+	_, err = QueryContext(cancelled, backend.WithSearch(collection), collection, filter.All())
+	assert.Error(err)
+
+	assert.Error(DeleteContext(cancelled, backend, collection.Name, `a`))
+	assert.True(backend.Exists(collection.Name, `a`))
+}
+
+func TestContextFallback(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-ctx-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	collection := testTransactionCollection(`TestContextFallback`)
+	assert.NoError(backend.CreateCollection(collection))
+
+	_, ok := backend.(ContextBackend)
+	assert.False(ok)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(context.Canceled, InsertContext(cancelled, backend, collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `first`),
+	)))
+
+	assert.False(backend.Exists(collection.Name, `a`))
+	assert.NoError(InsertContext(context.Background(), backend, collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `first`),
+	)))
+
+	assert.True(backend.Exists(collection.Name, `a`))
+}
@@ -1,16 +1,57 @@
 package backends
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 )
 
+// The number of segments that queries which cannot use a key or secondary index are split into,
+// each of which is scanned in parallel.  Can be overridden with the "scanSegments" connection
+// string option.
+var DynamoScanSegments = 1
+
+// Describes how a filter will be executed: as a Query against the table or one of its secondary
+// indexes if the filter pins down a hash key, or as a Scan of the whole table otherwise.
+type dynamoQueryPlan struct {
+	IndexName      string
+	HashKey        string
+	RangeKey       string
+	KeyCriteria    []filter.Criterion
+	FilterCriteria []filter.Criterion
+	Conjunction    filter.ConjunctionType
+}
+
+func (self *dynamoQueryPlan) IsScan() bool {
+	return len(self.KeyCriteria) == 0
+}
+
+// returns the names of the attributes that DynamoDB includes in the LastEvaluatedKey of pages
+// read using this plan.
+func (self *dynamoQueryPlan) CursorKeys(collection *dal.Collection) []string {
+	names := dynamoKeyAttributeNames(collection)
+
+	if self.IndexName != `` {
+		names = sliceutil.UniqueStrings(append(names, self.HashKey))
+
+		if self.RangeKey != `` {
+			names = sliceutil.UniqueStrings(append(names, self.RangeKey))
+		}
+	}
+
+	return names
+}
+
 func (self *DynamoBackend) IndexConnectionString() *dal.ConnectionString {
 	return &self.cs
 }
@@ -40,131 +81,560 @@ func (self *DynamoBackend) Index(collection *dal.Collection, records *dal.Record
 }
 
 func (self *DynamoBackend) QueryFunc(collection *dal.Collection, flt *filter.Filter, resultFn IndexResultFunc) error {
+	return self.QueryFuncContext(aws.BackgroundContext(), collection, flt, resultFn)
+}
+
+func (self *DynamoBackend) QueryFuncContext(ctx context.Context, collection *dal.Collection, flt *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, flt, resultFn)
+
 	if err := self.validateFilter(collection, flt); err != nil {
 		return fmt.Errorf("Cannot validate filter: %v", err)
 	}
 
-	ctx := aws.BackgroundContext()
+	if flt == nil {
+		flt = filter.All()
+	}
+
 	pageNumber := 0
 	var processed int
 
 	// NOTE: we use the DynamoDB table name instead of .GetIndexName() because we only partially
-	// support querying (range scans only), so we're regularly going to be dealing with
-	// external indices with potentially-different names.  If this function is being called, that means
-	// we're using DynamoDB as an indexer and we want the underlying name intact.
+	// support querying (key, secondary index, and scan queries only), so we're regularly going to be
+	// dealing with external indices with potentially-different names.  If this function is being
+	// called, that means we're using DynamoDB as an indexer and we want the underlying name intact.
+	return self.queryPages(ctx, collection, flt, func(plan *dynamoQueryPlan, items []map[string]*dynamodb.AttributeValue, count int64) (bool, error) {
+		pageNumber += 1
+
+		return self.iterResult(
+			collection,
+			flt,
+			plan,
+			items,
+			&processed,
+			count,
+			pageNumber,
+			resultFn,
+		)
+	})
+}
+
+// Executes the given filter as a Query if it can use the table's key or one of its secondary
+// indexes, or as a Scan (split into parallel segments) otherwise, calling pageFn with each page of
+// items that is read.  Criteria that cannot be satisfied by the key are applied as a filter
+// expression.  pageFn is never called concurrently, and returning false from it stops the query.
+func (self *DynamoBackend) queryPages(
+	ctx context.Context,
+	collection *dal.Collection,
+	flt *filter.Filter,
+	pageFn func(plan *dynamoQueryPlan, items []map[string]*dynamodb.AttributeValue, count int64) (bool, error),
+) error {
+	var keyCondition, condition, projection string
+	var startKey map[string]*dynamodb.AttributeValue
+	var err error
+
+	plan := dynamoPlanQuery(collection, flt)
+	expr := newDynamoExpression(collection)
+
+	if keyCondition, err = expr.keyConditions(plan.KeyCriteria); err != nil {
+		return fmt.Errorf("Cannot get DynamoDB expression from filter: %v", err)
+	}
+
+	if condition, err = expr.criteria(plan.Conjunction, plan.FilterCriteria); err != nil {
+		return fmt.Errorf("Cannot get DynamoDB expression from filter: %v", err)
+	}
+
+	if startKey, err = dynamoExclusiveStartKey(flt); err != nil {
+		return err
+	}
 
-	if flt == nil || flt.IsMatchAll() {
+	if flt != nil && len(flt.Fields) > 0 {
+		projection = expr.projection(append(plan.CursorKeys(collection), flt.Fields...))
+	}
+
+	var pageErr error
+	var stopped bool
+	var pageLock sync.Mutex
+
+	// serializes calls to pageFn, and records the first error it returns
+	handlePage := func(items []map[string]*dynamodb.AttributeValue, count *int64) bool {
+		pageLock.Lock()
+		defer pageLock.Unlock()
+
+		if stopped {
+			return false
+		}
+
+		if more, err := pageFn(plan, items, aws.Int64Value(count)); err == nil && more {
+			return true
+		} else {
+			pageErr = err
+			stopped = true
+			return false
+		}
+	}
+
+	querylog.Debugf("[%v] query %v: plan=%+v key=%q filter=%q", self, collection.Name, plan, keyCondition, condition)
+
+	if !plan.IsScan() {
+		query := &dynamodb.QueryInput{
+			TableName:              aws.String(collection.Name),
+			KeyConditionExpression: aws.String(keyCondition),
+			ExclusiveStartKey:      startKey,
+		}
+
+		if plan.IndexName != `` {
+			query.SetIndexName(plan.IndexName)
+		}
+
+		if condition != `` {
+			query.SetFilterExpression(condition)
+		}
+
+		if projection != `` {
+			query.SetProjectionExpression(projection)
+		}
+
+		expr.apply(&query.ExpressionAttributeNames, &query.ExpressionAttributeValues)
+
+		if flt != nil {
+			if flt.Limit > 0 {
+				query.SetLimit(int64(flt.Limit))
+			}
+
+			// results come back in range key order, which can be reversed
+			if sortBy := flt.GetSort(); len(sortBy) == 1 && plan.RangeKey != `` {
+				if dynamoAttributeName(collection, sortBy[0].Field) == plan.RangeKey && sortBy[0].Descending {
+					query.SetScanIndexForward(false)
+				}
+			}
+		}
+
+		if err := self.db.QueryPagesWithContext(ctx, query, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			return handlePage(page.Items, page.Count)
+		}); err != nil {
+			return err
+		}
+
+		return pageErr
+	}
+
+	segments := 1
+
+	// cursors point into a single sequence of pages, so only scans that start from the beginning
+	// can be split up
+	if flt == nil || !flt.UsesCursor() {
+		if n := int(self.cs.OptInt(`scanSegments`, int64(DynamoScanSegments))); n > 1 {
+			segments = n
+		}
+	}
+
+	var scanners sync.WaitGroup
+	errs := make([]error, segments)
+
+	for segment := 0; segment < segments; segment++ {
 		scan := &dynamodb.ScanInput{
-			TableName: aws.String(collection.Name),
-			Select:    aws.String(`ALL_ATTRIBUTES`),
+			TableName:         aws.String(collection.Name),
+			ExclusiveStartKey: startKey,
 		}
 
-		if flt.Limit > 0 {
+		if segments > 1 {
+			scan.SetSegment(int64(segment))
+			scan.SetTotalSegments(int64(segments))
+		}
+
+		if condition != `` {
+			scan.SetFilterExpression(condition)
+		}
+
+		if projection != `` {
+			scan.SetProjectionExpression(projection)
+		}
+
+		expr.apply(&scan.ExpressionAttributeNames, &scan.ExpressionAttributeValues)
+
+		if flt != nil && flt.Limit > 0 {
 			scan.SetLimit(int64(flt.Limit))
 		}
 
-		return self.db.ScanPagesWithContext(ctx, scan, func(page *dynamodb.ScanOutput, lastPage bool) bool {
-			pageNumber += 1
+		scanners.Add(1)
 
-			return self.iterResult(
-				collection,
-				flt,
-				page.Items,
-				processed,
-				*page.Count,
-				pageNumber,
-				lastPage,
-				resultFn,
-			)
-		})
+		go func(segment int, scan *dynamodb.ScanInput) {
+			defer scanners.Done()
 
-	} else {
-		query := &dynamodb.QueryInput{
-			TableName: aws.String(collection.Name),
-			Select:    aws.String(`ALL_ATTRIBUTES`),
-		}
-
-		if kcond, _, attrNames, attrValues, attrFieldMap, err := dynamoExprFromFilter(collection, flt); err == nil {
-			query = query.SetKeyConditionExpression(strings.Join(kcond, ` AND `))
-			query = query.SetExpressionAttributeNames(attrNames)
-			query = query.SetExpressionAttributeValues(
-				dynamoToDynamoAttributes(collection, attrValues, attrFieldMap),
-			)
-
-			return self.db.QueryPagesWithContext(ctx, query, func(page *dynamodb.QueryOutput, lastPage bool) bool {
-				pageNumber += 1
-
-				return self.iterResult(
-					collection,
-					flt,
-					page.Items,
-					processed,
-					*page.Count,
-					pageNumber,
-					lastPage,
-					resultFn,
-				)
+			errs[segment] = self.db.ScanPagesWithContext(ctx, scan, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+				return handlePage(page.Items, page.Count)
 			})
-		} else {
-			return fmt.Errorf("Cannot get DynamoDB expression from filter: %v", err)
+		}(segment, scan)
+	}
+
+	scanners.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
 	}
+
+	return pageErr
 }
 
-func dynamoExprFromFilter(collection *dal.Collection, flt *filter.Filter) ([]string, []string, map[string]*string, map[string]interface{}, map[string]string, error) {
-	fieldId := 0
-	valId := 0
-	keyCondExpr := []string{}
-	condExpr := []string{}
-	attrNames := map[string]*string{}
-	attrValues := map[string]interface{}{}
-	attrFieldMap := map[string]string{}
+// Decides which of the table's key or its secondary indexes (if any) can be used to query for
+// records matching the given filter, preferring whichever can satisfy the most criteria.  A key
+// is usable if the filter matches its hash key against a single value, and its range key can
+// additionally be matched against a single value or range.
+func dynamoPlanQuery(collection *dal.Collection, flt *filter.Filter) *dynamoQueryPlan {
+	plan := new(dynamoQueryPlan)
 
-	if flt != nil {
-		for _, criterion := range flt.Criteria {
-			if op := dynamoToNativeOp(&criterion); op != `` {
-				ors := make([]string, 0)
+	if flt == nil {
+		return plan
+	}
 
-				for _, value := range criterion.Values {
-					ors = append(ors, fmt.Sprintf("#F%d %v :v%d", fieldId, op, valId))
-					attrValues[fmt.Sprintf(":v%d", valId)] = value
-					attrFieldMap[fmt.Sprintf(":v%d", valId)] = criterion.Field
-					valId += 1
-				}
+	plan.FilterCriteria = flt.Criteria
+	plan.Conjunction = flt.Conjunction
 
-				attrNames[fmt.Sprintf("#F%d", fieldId)] = aws.String(criterion.Field)
+	// criteria joined by OR can't be narrowed down to a single key
+	if flt.Conjunction == filter.OrConjunction && len(flt.Criteria) > 1 {
+		return plan
+	}
 
-				// key conditions
-				if collection.IsIdentityField(criterion.Field) || collection.IsKeyField(criterion.Field) {
-					keyCondExpr = append(keyCondExpr, `(`+strings.Join(ors, ` OR `)+`)`)
-				} else {
-					condExpr = append(condExpr, `(`+strings.Join(ors, ` OR `)+`)`)
+	candidates := []dal.SecondaryIndex{{
+		HashKey: collection.GetIdentityFieldName(),
+	}}
+
+	if rangeKey, ok := collection.GetFirstNonIdentityKeyField(); ok {
+		candidates[0].RangeKey = rangeKey.Name
+	}
+
+	candidates = append(candidates, collection.SecondaryIndexes...)
+
+	var best []int
+
+	for _, index := range candidates {
+		if hash := dynamoKeyCriterion(collection, flt.Criteria, index.HashKey, false); hash >= 0 {
+			keys := []int{hash}
+
+			if index.RangeKey != `` {
+				if rng := dynamoKeyCriterion(collection, flt.Criteria, index.RangeKey, true); rng >= 0 {
+					keys = append(keys, rng)
 				}
+			}
+
+			if len(keys) > len(best) {
+				best = keys
+				plan.IndexName = index.Name
+				plan.HashKey = index.HashKey
+				plan.RangeKey = index.RangeKey
+			}
+		}
+	}
+
+	if len(best) > 0 {
+		plan.FilterCriteria = nil
+
+		for i, criterion := range flt.Criteria {
+			if sliceutil.Contains(best, i) {
+				plan.KeyCriteria = append(plan.KeyCriteria, criterion)
+			} else {
+				plan.FilterCriteria = append(plan.FilterCriteria, criterion)
+			}
+		}
+	}
+
+	return plan
+}
+
+// returns the position of the first criterion that can be used as a key condition on the given
+// key attribute, or -1 if there isn't one.
+func dynamoKeyCriterion(collection *dal.Collection, criteria []filter.Criterion, key string, isRange bool) int {
+	for i, criterion := range criteria {
+		if criterion.IsGroup() || len(criterion.Values) != 1 || dynamoIsNull(criterion.Values[0]) {
+			continue
+		} else if dynamoAttributeName(collection, criterion.Field) != key {
+			continue
+		}
+
+		switch criterion.Operator {
+		case `is`, ``:
+			return i
+		case `lt`, `lte`, `gt`, `gte`, `prefix`:
+			if isRange {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// Accumulates the attribute name and value placeholders used by the expressions of a single
+// DynamoDB request.
+type dynamoExpression struct {
+	collection *dal.Collection
+	names      map[string]*string
+	values     map[string]*dynamodb.AttributeValue
+}
+
+func newDynamoExpression(collection *dal.Collection) *dynamoExpression {
+	return &dynamoExpression{
+		collection: collection,
+		names:      make(map[string]*string),
+		values:     make(map[string]*dynamodb.AttributeValue),
+	}
+}
+
+// returns the placeholder for the given field name, adding it if it hasn't been used yet.
+func (self *dynamoExpression) name(field string) string {
+	field = dynamoAttributeName(self.collection, field)
+
+	for placeholder, name := range self.names {
+		if aws.StringValue(name) == field {
+			return placeholder
+		}
+	}
+
+	placeholder := fmt.Sprintf("#F%d", len(self.names))
+	self.names[placeholder] = aws.String(field)
+
+	return placeholder
+}
+
+// returns a new placeholder for the given value, converted according to the type of the field.
+func (self *dynamoExpression) value(field string, value interface{}) string {
+	placeholder := fmt.Sprintf(":v%d", len(self.values))
+	self.values[placeholder] = dynamoToDynamoAttribute(
+		self.collection,
+		dynamoAttributeName(self.collection, field),
+		value,
+	)
+
+	return placeholder
+}
+
+// renders criteria chosen by dynamoPlanQuery as a key condition expression.
+func (self *dynamoExpression) keyConditions(criteria []filter.Criterion) (string, error) {
+	conditions := make([]string, 0)
+
+	for _, criterion := range criteria {
+		field := self.name(criterion.Field)
+		value := self.value(criterion.Field, criterion.Values[0])
+
+		if criterion.Operator == `prefix` {
+			conditions = append(conditions, fmt.Sprintf("begins_with(%s, %s)", field, value))
+		} else if op := dynamoToNativeOp(&criterion); op != `` {
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", field, op, value))
+		} else {
+			return ``, fmt.Errorf("Unsupported key operator '%v'", criterion.Operator)
+		}
+	}
+
+	return strings.Join(conditions, ` AND `), nil
+}
+
+// renders the given criteria as a condition expression, joined together using the conjunction.
+func (self *dynamoExpression) criteria(conjunction filter.ConjunctionType, criteria []filter.Criterion) (string, error) {
+	conditions := make([]string, 0)
+
+	for _, criterion := range criteria {
+		if condition, err := self.criterion(criterion); err == nil {
+			conditions = append(conditions, condition)
+		} else {
+			return ``, err
+		}
+	}
 
-				fieldId += 1
+	if conjunction == filter.OrConjunction {
+		return strings.Join(conditions, ` OR `), nil
+	} else {
+		return strings.Join(conditions, ` AND `), nil
+	}
+}
+
+// renders a single criterion, matching any of its values.  Note that unlike other backends,
+// DynamoDB's prefix and contains comparisons are case-sensitive.
+func (self *dynamoExpression) criterion(criterion filter.Criterion) (string, error) {
+	if criterion.IsGroup() {
+		if condition, err := self.criteria(criterion.Conjunction, criterion.Criteria); err == nil {
+			return `(` + condition + `)`, nil
+		} else {
+			return ``, err
+		}
+	}
+
+	ors := make([]string, 0)
+	field := self.name(criterion.Field)
+
+	for _, value := range criterion.Values {
+		if dynamoIsNull(value) {
+			switch criterion.Operator {
+			case `is`, ``:
+				ors = append(ors, fmt.Sprintf("attribute_not_exists(%s)", field))
+			case `not`:
+				ors = append(ors, fmt.Sprintf("attribute_exists(%s)", field))
+			default:
+				return ``, fmt.Errorf("Operator '%v' cannot be used with null values", criterion.Operator)
+			}
+
+			continue
+		}
+
+		switch criterion.Operator {
+		case `prefix`:
+			ors = append(ors, fmt.Sprintf("begins_with(%s, %s)", field, self.value(criterion.Field, value)))
+		case `contains`:
+			ors = append(ors, fmt.Sprintf("contains(%s, %s)", field, self.value(criterion.Field, value)))
+		default:
+			if op := dynamoToNativeOp(&criterion); op != `` {
+				ors = append(ors, fmt.Sprintf("%s %s %s", field, op, self.value(criterion.Field, value)))
 			} else {
-				return nil, nil, nil, nil, nil, fmt.Errorf("Unsupported operator '%v'", criterion.Operator)
+				return ``, fmt.Errorf("Unsupported operator '%v'", criterion.Operator)
 			}
 		}
 	}
 
-	return keyCondExpr, condExpr, attrNames, attrValues, attrFieldMap, nil
+	if len(ors) == 0 {
+		return ``, fmt.Errorf("No values given for field '%v'", criterion.Field)
+	}
+
+	return `(` + strings.Join(ors, ` OR `) + `)`, nil
+}
+
+// renders a projection expression that retrieves the given fields.
+func (self *dynamoExpression) projection(fields []string) string {
+	placeholders := make([]string, 0)
+
+	for _, field := range fields {
+		placeholders = append(placeholders, self.name(field))
+	}
+
+	return strings.Join(sliceutil.UniqueStrings(placeholders), `, `)
+}
+
+// sets the request's attribute names and values; DynamoDB rejects requests that specify these
+// as empty maps.
+func (self *dynamoExpression) apply(names *map[string]*string, values *map[string]*dynamodb.AttributeValue) {
+	if len(self.names) > 0 {
+		*names = self.names
+	}
+
+	if len(self.values) > 0 {
+		*values = self.values
+	}
+}
+
+// returns the DynamoDB attribute a filter field refers to; "id" refers to the identity field
+// unless the collection has a field with that name.
+func dynamoAttributeName(collection *dal.Collection, field string) string {
+	if field == `id` {
+		if _, ok := collection.GetField(field); !ok {
+			return collection.GetIdentityFieldName()
+		}
+	}
+
+	return field
+}
+
+// unset criterion values and the literal value "null" are treated as nil.
+func dynamoIsNull(value interface{}) bool {
+	switch typeutil.String(value) {
+	case `null`, ``:
+		return true
+	default:
+		return false
+	}
 }
 
 func (self *DynamoBackend) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.QueryContext(aws.BackgroundContext(), collection, f, resultFns...)
+}
+
+func (self *DynamoBackend) QueryContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	if f != nil {
 		f.Options[`ForceIndexRecord`] = true
 	}
 
-	return DefaultQueryImplementation(self, collection, f, resultFns...)
+	return DefaultQueryImplementationContext(ctx, self, collection, f, resultFns...)
 }
 
 func (self *DynamoBackend) ListValues(collection *dal.Collection, fields []string, flt *filter.Filter) (map[string][]interface{}, error) {
-	return nil, fmt.Errorf("%T.ListValues: Not Implemented", self)
+	values := make(map[string][]interface{})
+
+	// only read the attributes we're listing the values of
+	f := aggregationFilter(flt)
+	f.Fields = fields
+
+	if err := self.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil {
+			for _, field := range fields {
+				var v []interface{}
+				var newV interface{}
+
+				if current, ok := values[field]; ok {
+					v = current
+				} else {
+					v = make([]interface{}, 0)
+				}
+
+				if dynamoAttributeName(collection, field) == collection.GetIdentityFieldName() {
+					newV = record.ID
+				} else {
+					newV = record.Get(field)
+				}
+
+				if newV != nil {
+					v = sliceutil.Unique(append(v, newV))
+				}
+
+				values[field] = v
+			}
+		}
+
+		return nil
+	}); err == nil {
+		return values, nil
+	} else {
+		return nil, err
+	}
 }
 
+// Deletes all records matching the given filter, reading their keys using the same Query or Scan
+// a search would, and removing them in batches.
 func (self *DynamoBackend) DeleteQuery(collection *dal.Collection, flt *filter.Filter) error {
-	return fmt.Errorf("%T.DeleteQuery: Not Implemented", self)
+	if err := self.validateFilter(collection, flt); err != nil {
+		return fmt.Errorf("Cannot validate filter: %v", err)
+	}
+
+	ctx := aws.BackgroundContext()
+	keyNames := dynamoKeyAttributeNames(collection)
+	deletes := make([]*dynamodb.WriteRequest, 0)
+
+	// all matching records are deleted, and only their keys need to be read
+	f := aggregationFilter(flt)
+	f.Fields = keyNames
+
+	if err := self.queryPages(ctx, collection, f, func(plan *dynamoQueryPlan, items []map[string]*dynamodb.AttributeValue, count int64) (bool, error) {
+		for _, item := range items {
+			deletes = append(deletes, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: dynamoItemKey(collection, item),
+				},
+			})
+		}
+
+		// deleting items already read doesn't affect the rest of the query
+		if len(deletes) >= dynamoBatchWriteSize {
+			if err := self.batchWrite(ctx, collection, deletes); err != nil {
+				return false, err
+			}
+
+			deletes = deletes[:0]
+		}
+
+		return true, nil
+	}); err == nil {
+		return self.batchWrite(ctx, collection, deletes)
+	} else {
+		return err
+	}
 }
 
 func (self *DynamoBackend) FlushIndex() error {
@@ -173,16 +643,8 @@ func (self *DynamoBackend) FlushIndex() error {
 
 func (self *DynamoBackend) validateFilter(collection *dal.Collection, flt *filter.Filter) error {
 	if flt != nil {
-		for _, field := range flt.CriteriaFields() {
-			if collection.IsIdentityField(field) {
-				continue
-			}
-
-			if collection.IsKeyField(field) {
-				continue
-			}
-
-			return fmt.Errorf("Filter field '%v' cannot be used: not a key field", field)
+		if _, err := newDynamoExpression(collection).criteria(flt.Conjunction, flt.Criteria); err != nil {
+			return err
 		}
 	}
 
@@ -208,30 +670,101 @@ func dynamoToNativeOp(criterion *filter.Criterion) string {
 	}
 }
 
-func (self *DynamoBackend) iterResult(collection *dal.Collection, flt *filter.Filter, items []map[string]*dynamodb.AttributeValue, processed int, totalResults int64, pageNumber int, lastPage bool, resultFn IndexResultFunc) bool {
-	if len(items) > 0 {
-		for _, item := range items {
-			record, err := dynamoRecordFromItem(collection, nil, item)
-
-			// fire off the result handler
-			if err := resultFn(record, err, IndexPage{
-				Page:         pageNumber,
-				TotalPages:   int(math.Ceil(float64(totalResults) / float64(25))),
-				Limit:        flt.Limit,
-				Offset:       (pageNumber - 1) * 25,
-				TotalResults: totalResults,
-			}); err != nil {
-				return false
-			}
+func (self *DynamoBackend) iterResult(collection *dal.Collection, flt *filter.Filter, plan *dynamoQueryPlan, items []map[string]*dynamodb.AttributeValue, processed *int, totalResults int64, pageNumber int, resultFn IndexResultFunc) (bool, error) {
+	for _, item := range items {
+		var nextCursor string
+
+		record, err := dynamoRecordFromItem(collection, nil, item)
 
-			// perform bounds checking
-			if processed += 1; flt.Limit > 0 && processed >= flt.Limit {
-				return false
+		if flt.UsesCursor() {
+			nextCursor = dynamoCursorFor(plan.CursorKeys(collection), item)
+		}
+
+		// fire off the result handler
+		if err := resultFn(record, err, IndexPage{
+			Page:         pageNumber,
+			TotalPages:   int(math.Ceil(float64(totalResults) / float64(25))),
+			Limit:        flt.Limit,
+			Offset:       (pageNumber - 1) * 25,
+			TotalResults: totalResults,
+			NextCursor:   nextCursor,
+		}); err != nil {
+			return false, err
+		}
+
+		// perform bounds checking
+		if *processed += 1; flt.Limit > 0 && *processed >= flt.Limit {
+			return false, nil
+		}
+	}
+
+	// pages read with a filter expression may be empty without being the last page
+	return true, nil
+}
+
+// returns the names of the attributes that make up the primary key of the given collection.
+func dynamoKeyAttributeNames(collection *dal.Collection) []string {
+	names := []string{collection.GetIdentityFieldName()}
+
+	if rangeKey, ok := collection.GetFirstNonIdentityKeyField(); ok {
+		names = append(names, rangeKey.Name)
+	}
+
+	return names
+}
+
+// returns a cursor encoding the given key attributes of the item.  This is the same key DynamoDB
+// would return as the LastEvaluatedKey of a page ending with that item.
+func dynamoCursorFor(names []string, item map[string]*dynamodb.AttributeValue) string {
+	key := make(map[string]map[string]string)
+
+	for _, name := range names {
+		if attr, ok := item[name]; ok && attr != nil {
+			switch {
+			case attr.S != nil:
+				key[name] = map[string]string{`S`: *attr.S}
+			case attr.N != nil:
+				key[name] = map[string]string{`N`: *attr.N}
+			case attr.B != nil:
+				key[name] = map[string]string{`B`: base64.StdEncoding.EncodeToString(attr.B)}
 			}
 		}
+	}
 
-		return !lastPage
-	} else {
-		return false
+	cursor, _ := filter.EncodeCursor(key)
+	return cursor
+}
+
+// decodes a cursor produced by dynamoCursorFor into an ExclusiveStartKey.  Returns nil if the
+// filter is not requesting a page after the first one.
+func dynamoExclusiveStartKey(flt *filter.Filter) (map[string]*dynamodb.AttributeValue, error) {
+	if flt == nil || !flt.UsesCursor() || flt.Cursor == filter.CursorStart {
+		return nil, nil
 	}
+
+	var key map[string]map[string]string
+
+	if err := filter.DecodeCursor(flt.Cursor, &key); err != nil {
+		return nil, err
+	}
+
+	startKey := make(map[string]*dynamodb.AttributeValue)
+
+	for name, attr := range key {
+		if v, ok := attr[`S`]; ok {
+			startKey[name] = (&dynamodb.AttributeValue{}).SetS(v)
+		} else if v, ok := attr[`N`]; ok {
+			startKey[name] = (&dynamodb.AttributeValue{}).SetN(v)
+		} else if v, ok := attr[`B`]; ok {
+			if data, err := base64.StdEncoding.DecodeString(v); err == nil {
+				startKey[name] = (&dynamodb.AttributeValue{}).SetB(data)
+			} else {
+				return nil, fmt.Errorf("invalid cursor: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("invalid cursor: unsupported key attribute %q", name)
+		}
+	}
+
+	return startKey, nil
 }
@@ -0,0 +1,205 @@
+package backends
+
+// this file satifies the TransactionalBackend interface for DynamoBackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The maximum number of writes DynamoDB accepts in a single TransactWriteItems request.
+var DynamoMaxTransactionItems = 100
+
+// A DynamoTransaction collects writes and performs them all at once with TransactWriteItems when
+// Commit is called, so that either all of them are made or none are.  Reads made through the
+// transaction go directly to the table and do not see its pending writes.
+type DynamoTransaction struct {
+	*DynamoBackend
+	items   []*dynamodb.TransactWriteItem
+	indexed map[*dal.Collection]*dal.RecordSet
+	done    bool
+}
+
+func (self *DynamoBackend) Begin() (Transaction, error) {
+	return &DynamoTransaction{
+		DynamoBackend: self,
+		items:         make([]*dynamodb.TransactWriteItem, 0),
+		indexed:       make(map[*dal.Collection]*dal.RecordSet),
+	}, nil
+}
+
+func (self *DynamoTransaction) Begin() (Transaction, error) {
+	return nil, fmt.Errorf("nested transactions are not supported")
+}
+
+func (self *DynamoTransaction) Insert(name string, records *dal.RecordSet) error {
+	return self.InsertContext(context.Background(), name, records)
+}
+
+func (self *DynamoTransaction) InsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
+	return self.put(name, records, true)
+}
+
+func (self *DynamoTransaction) Update(name string, records *dal.RecordSet, target ...string) error {
+	return self.UpdateContext(context.Background(), name, records, target...)
+}
+
+func (self *DynamoTransaction) UpdateContext(ctx context.Context, name string, records *dal.RecordSet, target ...string) error {
+	return self.put(name, records, false)
+}
+
+func (self *DynamoTransaction) Upsert(name string, records *dal.RecordSet) error {
+	return self.UpsertContext(context.Background(), name, records)
+}
+
+func (self *DynamoTransaction) UpsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
+	return self.put(name, records, false)
+}
+
+func (self *DynamoTransaction) Delete(name string, ids ...interface{}) error {
+	return self.DeleteContext(context.Background(), name, ids...)
+}
+
+func (self *DynamoTransaction) DeleteContext(ctx context.Context, name string, ids ...interface{}) error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, keys, err := self.getKeyAttributes(name, id); err == nil {
+			self.items = append(self.items, &dynamodb.TransactWriteItem{
+				Delete: &dynamodb.Delete{
+					TableName: aws.String(name),
+					Key:       keys,
+				},
+			})
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Perform all pending writes in a single TransactWriteItems request.
+func (self *DynamoTransaction) Commit() error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	self.done = true
+
+	if len(self.items) == 0 {
+		return nil
+	} else if len(self.items) > DynamoMaxTransactionItems {
+		return fmt.Errorf("commit failed: transactions are limited to %d writes, got %d", DynamoMaxTransactionItems, len(self.items))
+	}
+
+	if _, err := self.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: self.items,
+	}); err != nil {
+		return fmt.Errorf("commit failed: %v", dynamoTransactionError(err))
+	}
+
+	for collection, records := range self.indexed {
+		if search := self.WithSearch(collection); search != nil {
+			if err := search.Index(collection, records); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Discard all pending writes.
+func (self *DynamoTransaction) Rollback() error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	self.done = true
+	self.items = nil
+	self.indexed = nil
+
+	return nil
+}
+
+func (self *DynamoTransaction) put(name string, records *dal.RecordSet, isCreate bool) error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	if collection, err := self.GetCollection(name); err == nil {
+		for _, record := range records.Records {
+			if item, err := dynamoRecordToItem(collection, record); err == nil {
+				put := &dynamodb.Put{
+					TableName: aws.String(collection.Name),
+					Item:      item,
+				}
+
+				if isCreate {
+					condition, attrNames := dynamoCreateCondition(collection)
+					put.SetConditionExpression(condition)
+					put.SetExpressionAttributeNames(attrNames)
+				}
+
+				self.items = append(self.items, &dynamodb.TransactWriteItem{
+					Put: put,
+				})
+			} else {
+				return err
+			}
+		}
+
+		if !collection.SkipIndexPersistence {
+			if indexed, ok := self.indexed[collection]; ok {
+				indexed.Append(records)
+			} else {
+				self.indexed[collection] = dal.NewRecordSet(records.Records...)
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *DynamoTransaction) checkDone() error {
+	if self.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+
+	return nil
+}
+
+// describes why a transaction was canceled, which DynamoDB reports for each write in it.
+func dynamoTransactionError(err error) error {
+	if tce, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		reasons := make([]string, 0)
+
+		for _, reason := range tce.CancellationReasons {
+			switch code := aws.StringValue(reason.Code); code {
+			case ``, `None`:
+				continue
+			case `ConditionalCheckFailed`:
+				reasons = append(reasons, `Record already exists`)
+			default:
+				reasons = append(reasons, sliceutil.OrString(aws.StringValue(reason.Message), code))
+			}
+		}
+
+		if len(reasons) > 0 {
+			return fmt.Errorf("%s", strings.Join(reasons, `; `))
+		}
+	}
+
+	return dynamoError(err)
+}
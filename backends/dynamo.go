@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -27,6 +28,15 @@ var DefaultAmazonRegion = `us-east-1`
 var DefaultSharedCredentialsFile = `~/.aws/credentials`
 var DefaultSharedCredentialsProfile = `default`
 
+// The number of times a batch write is retried when DynamoDB reports some of its items as
+// unprocessed, and the delay before the first retry (doubling with each one after).
+var DynamoBatchRetryLimit = 8
+var DynamoBatchRetryBackoff = 50 * time.Millisecond
+
+// the maximum number of items DynamoDB accepts in a single BatchWriteItem and BatchGetItem request
+const dynamoBatchWriteSize = 25
+const dynamoBatchGetSize = 100
+
 type DynamoBackend struct {
 	Backend
 	Indexer
@@ -55,7 +65,7 @@ func NewDynamoBackend(connection dal.ConnectionString) Backend {
 func (self *DynamoBackend) Supports(features ...BackendFeature) bool {
 	for _, feat := range features {
 		switch feat {
-		case PartialSearch, CompositeKeys:
+		case PartialSearch, CompositeKeys, Transactional:
 			continue
 		default:
 			return false
@@ -90,6 +100,11 @@ func (self *DynamoBackend) SetIndexer(indexConnString dal.ConnectionString) erro
 	}
 }
 
+func (self *DynamoBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
 func (self *DynamoBackend) Initialize() error {
 	var providers []credentials.Provider
 	var logLevel aws.LogLevelType
@@ -122,14 +137,18 @@ func (self *DynamoBackend) Initialize() error {
 		logLevel = aws.LogDebugWithHTTPBody
 	}
 
-	self.db = dynamodb.New(
-		session.New(),
-		&aws.Config{
-			Region:      aws.String(self.region),
-			Credentials: credentials.NewChainCredentials(providers),
-			LogLevel:    &logLevel,
-		},
-	)
+	config := &aws.Config{
+		Region:      aws.String(self.region),
+		Credentials: credentials.NewChainCredentials(providers),
+		LogLevel:    &logLevel,
+	}
+
+	// point at a specific endpoint (e.g.: DynamoDB Local)
+	if endpoint := self.cs.OptString(`endpoint`, ``); endpoint != `` {
+		config.Endpoint = aws.String(endpoint)
+	}
+
+	self.db = dynamodb.New(session.New(), config)
 
 	if self.cs.OptBool(`autoregister`, true) {
 		// retrieve each table once as a cache warming mechanism
@@ -164,6 +183,12 @@ func (self *DynamoBackend) RegisterCollection(definition *dal.Collection) {
 }
 
 func (self *DynamoBackend) Exists(name string, id interface{}) bool {
+	// DynamoDB removes expired items some time after they expire, so they must be read to be ruled out
+	if collection, err := self.GetCollection(name); err == nil && collection.TimeToLiveField != `` {
+		_, err := self.Retrieve(name, id)
+		return (err == nil)
+	}
+
 	if _, keys, err := self.getKeyAttributes(name, id); err == nil {
 		if out, err := self.db.GetItem(&dynamodb.GetItemInput{
 			TableName:      aws.String(name),
@@ -180,17 +205,25 @@ func (self *DynamoBackend) Exists(name string, id interface{}) bool {
 }
 
 func (self *DynamoBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
+	return self.RetrieveContext(context.Background(), name, id, fields...)
+}
+
+func (self *DynamoBackend) RetrieveContext(ctx context.Context, name string, id interface{}, fields ...string) (*dal.Record, error) {
 	if collection, err := self.GetCollection(name); err == nil {
 		// get the key attributes that target this specific record
 		if _, keys, err := self.getKeyAttributes(name, id); err == nil {
 			// execute the GetItem request
-			if out, err := self.db.GetItem(&dynamodb.GetItemInput{
+			if out, err := self.db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 				TableName:      aws.String(name),
 				ConsistentRead: aws.Bool(self.cs.OptBool(`readsConsistent`, true)),
 				Key:            keys,
 			}); err == nil {
 				// return the record
-				return dynamoRecordFromItem(collection, id, out.Item)
+				if record, err := dynamoRecordFromItem(collection, id, out.Item); err == nil {
+					return unlessExpired(collection, id, record)
+				} else {
+					return nil, err
+				}
 			} else if aerr, ok := err.(awserr.Error); ok {
 				switch aerr.Code() {
 				case dynamodb.ErrCodeResourceNotFoundException:
@@ -212,50 +245,65 @@ func (self *DynamoBackend) Retrieve(name string, id interface{}, fields ...strin
 }
 
 func (self *DynamoBackend) Insert(name string, records *dal.RecordSet) error {
+	return self.InsertContext(context.Background(), name, records)
+}
+
+func (self *DynamoBackend) InsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
 	if collection, err := self.GetCollection(name); err == nil {
-		return self.upsertRecords(collection, records, true)
+		return self.upsertRecords(ctx, collection, records, true)
+	} else {
+		return err
+	}
+}
+
+// PutItem replaces any existing item with the same key, so upserts are the same as updates.
+func (self *DynamoBackend) Upsert(name string, records *dal.RecordSet) error {
+	return self.UpsertContext(context.Background(), name, records)
+}
+
+func (self *DynamoBackend) UpsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
+	if collection, err := self.GetCollection(name); err == nil {
+		return self.upsertRecords(ctx, collection, records, false)
 	} else {
 		return err
 	}
 }
 
 func (self *DynamoBackend) Update(name string, records *dal.RecordSet, target ...string) error {
+	return self.UpdateContext(context.Background(), name, records, target...)
+}
+
+func (self *DynamoBackend) UpdateContext(ctx context.Context, name string, records *dal.RecordSet, target ...string) error {
 	if collection, err := self.GetCollection(name); err == nil {
-		return self.upsertRecords(collection, records, false)
+		return self.upsertRecords(ctx, collection, records, false)
 	} else {
 		return err
 	}
 }
 
 func (self *DynamoBackend) Delete(name string, ids ...interface{}) error {
-	if _, err := self.GetCollection(name); err == nil {
+	return self.DeleteContext(context.Background(), name, ids...)
+}
+
+func (self *DynamoBackend) DeleteContext(ctx context.Context, name string, ids ...interface{}) error {
+	if collection, err := self.GetCollection(name); err == nil {
+		deletes := make([]*dynamodb.WriteRequest, 0)
+
 		// for each id we're deleting...
 		for _, id := range ids {
 			// get the key attributes that target this specific record
 			if _, keys, err := self.getKeyAttributes(name, id); err == nil {
-				// execute the DeleteItem request
-				if _, err := self.db.DeleteItem(&dynamodb.DeleteItemInput{
-					TableName: aws.String(name),
-					Key:       keys,
-				}); err != nil {
-					// handle errors (if any)
-					if aerr, ok := err.(awserr.Error); ok {
-						switch aerr.Code() {
-						case dynamodb.ErrCodeProvisionedThroughputExceededException:
-							return fmt.Errorf("Throughput exceeded")
-						default:
-							return aerr
-						}
-					} else {
-						return err
-					}
-				}
+				deletes = append(deletes, &dynamodb.WriteRequest{
+					DeleteRequest: &dynamodb.DeleteRequest{
+						Key: keys,
+					},
+				})
 			} else {
 				return err
 			}
 		}
 
-		return nil
+		return self.batchWrite(ctx, collection, deletes)
 	} else {
 		return err
 	}
@@ -266,8 +314,35 @@ func (self *DynamoBackend) CreateCollection(definition *dal.Collection) error {
 		return fmt.Errorf("View-type collections are not supported on this backend.")
 	}
 
-	return fmt.Errorf("Not Implemented")
+	if input, err := dynamoCreateTableInput(definition); err == nil {
+		if _, err := self.db.CreateTable(input); err == nil {
+			if err := self.db.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+				TableName: input.TableName,
+			}); err != nil {
+				return err
+			}
 
+			// have DynamoDB remove items once the epoch seconds in their TTL attribute have passed
+			if definition.TimeToLiveField != `` {
+				if _, err := self.db.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+					TableName: input.TableName,
+					TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+						AttributeName: aws.String(definition.TimeToLiveField),
+						Enabled:       aws.Bool(true),
+					},
+				}); err != nil {
+					return fmt.Errorf("failed to enable TTL: %v", err)
+				}
+			}
+
+			self.RegisterCollection(definition)
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
 }
 
 func (self *DynamoBackend) DeleteCollection(name string) error {
@@ -294,10 +369,13 @@ func (self *DynamoBackend) GetCollection(name string) (*dal.Collection, error) {
 }
 
 func (self *DynamoBackend) WithSearch(collection *dal.Collection, filters ...*filter.Filter) Indexer {
-	// if this is a query we _can_ handle, then use ourself as the indexer
+	// if this is a query we _can_ handle, then use ourself as the indexer.  Queries that would
+	// require scanning the whole table are left to an external indexer if there is one.
 	if len(filters) > 0 {
 		if err := self.validateFilter(collection, filters[0]); err == nil {
-			return self
+			if !dynamoPlanQuery(collection, filters[0]).IsScan() || self.indexer == nil || self.indexer == Indexer(self) {
+				return self
+			}
 		}
 	}
 
@@ -311,7 +389,7 @@ func (self *DynamoBackend) WithAggregator(collection *dal.Collection) Aggregator
 		}
 	}
 
-	return nil
+	return newFallbackAggregator(self.indexer, &self.cs)
 }
 
 func (self *DynamoBackend) Flush() error {
@@ -370,6 +448,35 @@ func (self *DynamoBackend) cacheTable(name string) (*dal.Collection, error) {
 			})
 		}
 
+		for _, gsi := range table.Table.GlobalSecondaryIndexes {
+			collection.SecondaryIndexes = append(collection.SecondaryIndexes, self.secondaryIndexFromSchema(
+				collection,
+				typemap,
+				aws.StringValue(gsi.IndexName),
+				gsi.KeySchema,
+				false,
+			))
+		}
+
+		for _, lsi := range table.Table.LocalSecondaryIndexes {
+			collection.SecondaryIndexes = append(collection.SecondaryIndexes, self.secondaryIndexFromSchema(
+				collection,
+				typemap,
+				aws.StringValue(lsi.IndexName),
+				lsi.KeySchema,
+				true,
+			))
+		}
+
+		if ttl, err := self.db.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+			TableName: aws.String(name),
+		}); err == nil && ttl.TimeToLiveDescription != nil {
+			switch aws.StringValue(ttl.TimeToLiveDescription.TimeToLiveStatus) {
+			case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+				collection.TimeToLiveField = aws.StringValue(ttl.TimeToLiveDescription.AttributeName)
+			}
+		}
+
 		self.tableCache.Store(name, collection)
 		return collection, nil
 	} else {
@@ -377,6 +484,124 @@ func (self *DynamoBackend) cacheTable(name string) (*dal.Collection, error) {
 	}
 }
 
+// builds the SecondaryIndex described by the given key schema, adding any of its key attributes
+// that aren't already fields of the collection.
+func (self *DynamoBackend) secondaryIndexFromSchema(collection *dal.Collection, typemap map[string]string, name string, schema []*dynamodb.KeySchemaElement, local bool) dal.SecondaryIndex {
+	index := dal.SecondaryIndex{
+		Name:  name,
+		Local: local,
+	}
+
+	for _, element := range schema {
+		attr := aws.StringValue(element.AttributeName)
+
+		if aws.StringValue(element.KeyType) == dynamodb.KeyTypeRange {
+			index.RangeKey = attr
+		} else {
+			index.HashKey = attr
+		}
+
+		if _, ok := collection.GetField(attr); !ok {
+			collection.AddFields(dal.Field{
+				Name: attr,
+				Type: self.toDalType(typemap[attr]),
+			})
+		}
+	}
+
+	return index
+}
+
+// builds the request that creates a table for the given collection, along with any secondary
+// indexes it declares.  Tables are created with on-demand billing.
+func dynamoCreateTableInput(definition *dal.Collection) (*dynamodb.CreateTableInput, error) {
+	attrs := make(map[string]string)
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(definition.Name),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	}
+
+	keySchema := func(names ...string) ([]*dynamodb.KeySchemaElement, error) {
+		schema := make([]*dynamodb.KeySchemaElement, 0)
+
+		for i, name := range names {
+			if field, ok := definition.GetField(name); ok {
+				keyType := dynamodb.KeyTypeHash
+
+				if i > 0 {
+					keyType = dynamodb.KeyTypeRange
+				}
+
+				schema = append(schema, &dynamodb.KeySchemaElement{
+					AttributeName: aws.String(name),
+					KeyType:       aws.String(keyType),
+				})
+
+				attrs[name] = dynamoAttributeType(field.Type)
+			} else {
+				return nil, fmt.Errorf("Key field %q is not defined in collection %v", name, definition.Name)
+			}
+		}
+
+		return schema, nil
+	}
+
+	if schema, err := keySchema(dynamoKeyAttributeNames(definition)...); err == nil {
+		input.KeySchema = schema
+	} else {
+		return nil, err
+	}
+
+	for _, index := range definition.SecondaryIndexes {
+		if schema, err := keySchema(index.KeyFieldNames()...); err == nil {
+			projection := &dynamodb.Projection{
+				ProjectionType: aws.String(dynamodb.ProjectionTypeAll),
+			}
+
+			if index.Local {
+				if index.HashKey != definition.GetIdentityFieldName() {
+					return nil, fmt.Errorf("Local secondary index %q must use the identity field as its hash key", index.Name)
+				}
+
+				input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndex{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  schema,
+					Projection: projection,
+				})
+			} else {
+				input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  schema,
+					Projection: projection,
+				})
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	for _, name := range maputil.StringKeys(attrs) {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String(attrs[name]),
+		})
+	}
+
+	return input, nil
+}
+
+// returns the DynamoDB scalar attribute type used to store key values of the given type.
+func dynamoAttributeType(t dal.Type) string {
+	switch t {
+	case dal.IntType, dal.FloatType:
+		return dynamodb.ScalarAttributeTypeN
+	case dal.RawType:
+		return dynamodb.ScalarAttributeTypeB
+	default:
+		return dynamodb.ScalarAttributeTypeS
+	}
+}
+
 func dynamoRecordFromItem(collection *dal.Collection, id interface{}, item map[string]*dynamodb.AttributeValue) (*dal.Record, error) {
 	// build the record we're returning
 	var data = make(map[string]interface{})
@@ -384,6 +609,13 @@ func dynamoRecordFromItem(collection *dal.Collection, id interface{}, item map[s
 
 	if err := dynamodbattribute.UnmarshalMap(item, &data); err == nil {
 		for k, v := range data {
+			// TTL attributes are stored as epoch seconds, which are unmarshaled as float64
+			if k == collection.TimeToLiveField {
+				if f, ok := v.(float64); ok {
+					v = int64(f)
+				}
+			}
+
 			if field, ok := collection.GetField(k); ok {
 				if typed, err := field.ConvertValue(v); err == nil {
 					if collection.IsIdentityField(field.Name) {
@@ -425,6 +657,13 @@ func dynamoRecordFromItem(collection *dal.Collection, id interface{}, item map[s
 
 func dynamoRecordToItem(collection *dal.Collection, record *dal.Record) (map[string]*dynamodb.AttributeValue, error) {
 	if data, err := collection.MapFromRecord(record); err == nil {
+		// DynamoDB only expires items whose TTL attribute holds a number of epoch seconds
+		if ttl := collection.TimeToLiveField; ttl != `` {
+			if value, ok := data[ttl]; ok && !typeutil.IsZero(value) {
+				data[ttl] = typeutil.V(value).Time().Unix()
+			}
+		}
+
 		return dynamodbattribute.MarshalMap(data)
 	} else {
 		return nil, err
@@ -510,23 +749,35 @@ func dynamoToDynamoAttributes(collection *dal.Collection, values map[string]inte
 			}
 		}
 
-		if field, ok := collection.GetField(fieldName); ok {
-			aval := new(dynamodb.AttributeValue)
+		if _, ok := collection.GetField(fieldName); ok {
+			rv[k] = dynamoToDynamoAttribute(collection, fieldName, v)
+		}
+	}
 
-			switch field.Type {
-			case dal.BooleanType:
-				aval = aval.SetBOOL(typeutil.V(v).Bool())
-			case dal.FloatType, dal.IntType:
-				aval = aval.SetN(typeutil.V(v).String())
-			default:
-				aval = aval.SetS(typeutil.V(v).String())
-			}
+	return rv
+}
 
-			rv[k] = aval
+// converts a value according to the type of the named field.  Values of fields the collection
+// doesn't define are marshaled according to their Go type.
+func dynamoToDynamoAttribute(collection *dal.Collection, fieldName string, v interface{}) *dynamodb.AttributeValue {
+	aval := new(dynamodb.AttributeValue)
+
+	if field, ok := collection.GetField(fieldName); ok {
+		switch field.Type {
+		case dal.BooleanType:
+			aval = aval.SetBOOL(typeutil.V(v).Bool())
+		case dal.FloatType, dal.IntType:
+			aval = aval.SetN(typeutil.V(v).String())
+		default:
+			aval = aval.SetS(typeutil.V(v).String())
 		}
+	} else if marshaled, err := dynamodbattribute.Marshal(v); err == nil {
+		aval = marshaled
+	} else {
+		aval = aval.SetS(typeutil.V(v).String())
 	}
 
-	return rv
+	return aval
 }
 
 func (self *DynamoBackend) getKeyAttributes(name string, id interface{}) (*filter.Filter, map[string]*dynamodb.AttributeValue, error) {
@@ -559,9 +810,10 @@ func (self *DynamoBackend) getKeyAttributes(name string, id interface{}) (*filte
 	}
 }
 
-func (self *DynamoBackend) upsertRecords(collection *dal.Collection, records *dal.RecordSet, isCreate bool) error {
-	for _, record := range records.Records {
-		if item, err := dynamoRecordToItem(collection, record); err == nil {
+func (self *DynamoBackend) upsertRecords(ctx context.Context, collection *dal.Collection, records *dal.RecordSet, isCreate bool) error {
+	if len(records.Records) == 1 {
+		// a single record is written with a (conditional) PutItem
+		if item, err := dynamoRecordToItem(collection, records.Records[0]); err == nil {
 			op := &dynamodb.PutItemInput{
 				TableName: aws.String(collection.Name),
 				Item:      item,
@@ -570,23 +822,13 @@ func (self *DynamoBackend) upsertRecords(collection *dal.Collection, records *da
 			// if this is a create statement, we need to add conditions to the PutItem call that
 			// ensures that an existing record with these id(s) doesn't exist.
 			if isCreate {
-				expr := []string{`attribute_not_exists(#HashKey)`}
-				attrNames := map[string]*string{
-					`#HashKey`: aws.String(collection.IdentityField),
-				}
-
-				// if there's a range key, we gotta add that to the conditional expression too
-				if rangeKey, ok := collection.GetFirstNonIdentityKeyField(); ok {
-					expr = append(expr, `attribute_not_exists(#RangeKey)`)
-					attrNames[`#RangeKey`] = aws.String(rangeKey.Name)
-				}
-
-				op = op.SetConditionExpression(strings.Join(expr, ` AND `))
+				condition, attrNames := dynamoCreateCondition(collection)
+				op = op.SetConditionExpression(condition)
 				op = op.SetExpressionAttributeNames(attrNames)
 			}
 
 			// perform the call
-			if _, err := self.db.PutItem(op); err != nil {
+			if _, err := self.db.PutItemWithContext(ctx, op); err != nil {
 				if aerr, ok := err.(awserr.Error); ok {
 					switch aerr.Code() {
 					case dynamodb.ErrCodeConditionalCheckFailedException:
@@ -603,6 +845,50 @@ func (self *DynamoBackend) upsertRecords(collection *dal.Collection, records *da
 		} else {
 			return err
 		}
+	} else if isCreate {
+		// BatchWriteItem can't make writes conditional, so creates are made with conditional puts
+		// in as few transactions as possible.  Each transaction either writes all of its records or
+		// none of them, but records beyond the first DynamoMaxTransactionItems are written
+		// separately.
+		items := make([]map[string]*dynamodb.AttributeValue, 0, len(records.Records))
+
+		for _, record := range records.Records {
+			if item, err := dynamoRecordToItem(collection, record); err == nil {
+				items = append(items, item)
+			} else {
+				return err
+			}
+		}
+
+		if transactions, err := dynamoCreateTransactions(collection, items); err == nil {
+			for _, transaction := range transactions {
+				if _, err := self.db.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+					TransactItems: transaction,
+				}); err != nil {
+					return dynamoTransactionError(err)
+				}
+			}
+		} else {
+			return err
+		}
+	} else {
+		puts := make([]*dynamodb.WriteRequest, 0)
+
+		for _, record := range records.Records {
+			if item, err := dynamoRecordToItem(collection, record); err == nil {
+				puts = append(puts, &dynamodb.WriteRequest{
+					PutRequest: &dynamodb.PutRequest{
+						Item: item,
+					},
+				})
+			} else {
+				return err
+			}
+		}
+
+		if err := self.batchWrite(ctx, collection, puts); err != nil {
+			return err
+		}
 	}
 
 	if !collection.SkipIndexPersistence {
@@ -615,3 +901,250 @@ func (self *DynamoBackend) upsertRecords(collection *dal.Collection, records *da
 
 	return nil
 }
+
+// Retrieves the records with the given IDs using as few BatchGetItem requests as possible.  Records
+// are returned in the order their IDs were given, skipping any that do not exist.
+func (self *DynamoBackend) RetrieveBatch(ctx context.Context, name string, ids []interface{}, fields ...string) (*dal.RecordSet, error) {
+	if collection, err := self.GetCollection(name); err == nil {
+		keys := make([]map[string]*dynamodb.AttributeValue, len(ids))
+
+		for i, id := range ids {
+			if _, key, err := self.getKeyAttributes(name, id); err == nil {
+				keys[i] = key
+			} else {
+				return nil, err
+			}
+		}
+
+		if items, err := self.batchGet(ctx, collection, keys, fields); err == nil {
+			keyNames := dynamoKeyAttributeNames(collection)
+			found := make(map[string]map[string]*dynamodb.AttributeValue)
+			records := dal.NewRecordSet()
+
+			for _, item := range items {
+				found[dynamoCursorFor(keyNames, item)] = item
+			}
+
+			for _, key := range keys {
+				if item, ok := found[dynamoCursorFor(keyNames, key)]; ok {
+					if record, err := dynamoRecordFromItem(collection, nil, item); err == nil {
+						if !collection.IsExpired(record) {
+							records.Push(record)
+						}
+					} else {
+						return nil, err
+					}
+				}
+			}
+
+			records.ResultCount = int64(len(records.Records))
+			return records, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Reads the items with the given keys in batches, retrying any keys DynamoDB reports as
+// unprocessed with an exponential backoff.  Items are returned in no particular order.
+func (self *DynamoBackend) batchGet(ctx context.Context, collection *dal.Collection, keys []map[string]*dynamodb.AttributeValue, fields []string) ([]map[string]*dynamodb.AttributeValue, error) {
+	items := make([]map[string]*dynamodb.AttributeValue, 0)
+	seen := make(map[string]bool)
+	keyNames := dynamoKeyAttributeNames(collection)
+
+	for len(keys) > 0 {
+		request := &dynamodb.KeysAndAttributes{
+			ConsistentRead: aws.Bool(self.cs.OptBool(`readsConsistent`, true)),
+		}
+
+		// a batch may not request the same key twice
+		for len(keys) > 0 && len(request.Keys) < dynamoBatchGetSize {
+			if id := dynamoCursorFor(keyNames, keys[0]); !seen[id] {
+				seen[id] = true
+				request.Keys = append(request.Keys, keys[0])
+			}
+
+			keys = keys[1:]
+		}
+
+		if len(request.Keys) == 0 {
+			break
+		}
+
+		if len(fields) > 0 {
+			expr := newDynamoExpression(collection)
+			request.SetProjectionExpression(expr.projection(append(keyNames, fields...)))
+			request.SetExpressionAttributeNames(expr.names)
+		}
+
+		pending := map[string]*dynamodb.KeysAndAttributes{
+			collection.Name: request,
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if err := self.backoff(ctx, attempt, len(pending[collection.Name].Keys)); err != nil {
+				return nil, err
+			}
+
+			if out, err := self.db.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: pending,
+			}); err == nil {
+				items = append(items, out.Responses[collection.Name]...)
+				pending = out.UnprocessedKeys
+			} else {
+				return nil, dynamoError(err)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// Writes the given requests in batches, retrying any items DynamoDB reports as unprocessed (e.g.:
+// due to throttling) with an exponential backoff.
+func (self *DynamoBackend) batchWrite(ctx context.Context, collection *dal.Collection, requests []*dynamodb.WriteRequest) error {
+	keyNames := dynamoKeyAttributeNames(collection)
+
+	for len(requests) > 0 {
+		batch := make([]*dynamodb.WriteRequest, 0)
+		seen := make(map[string]bool)
+
+		// a batch may not write the same key twice, so later writes to a key go in the next batch
+		for len(requests) > 0 && len(batch) < dynamoBatchWriteSize {
+			var key map[string]*dynamodb.AttributeValue
+
+			if put := requests[0].PutRequest; put != nil {
+				key = put.Item
+			} else if del := requests[0].DeleteRequest; del != nil {
+				key = del.Key
+			}
+
+			if id := dynamoCursorFor(keyNames, key); seen[id] {
+				break
+			} else {
+				seen[id] = true
+			}
+
+			batch = append(batch, requests[0])
+			requests = requests[1:]
+		}
+
+		pending := map[string][]*dynamodb.WriteRequest{
+			collection.Name: batch,
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if err := self.backoff(ctx, attempt, len(pending[collection.Name])); err != nil {
+				return err
+			}
+
+			if out, err := self.db.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: pending,
+			}); err == nil {
+				pending = out.UnprocessedItems
+			} else {
+				return dynamoError(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// waits before retrying the given attempt of a batch operation, or returns an error if the batch
+// has been retried too many times already.
+func (self *DynamoBackend) backoff(ctx context.Context, attempt int, unprocessed int) error {
+	if attempt > DynamoBatchRetryLimit {
+		return fmt.Errorf("Throughput exceeded: %d items unprocessed after %d retries", unprocessed, DynamoBatchRetryLimit)
+	} else if attempt > 0 {
+		select {
+		case <-time.After(DynamoBatchRetryBackoff * time.Duration(1<<uint(attempt-1))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// returns the condition that makes a write fail if the record it's writing already exists.
+func dynamoCreateCondition(collection *dal.Collection) (string, map[string]*string) {
+	expr := []string{`attribute_not_exists(#HashKey)`}
+	attrNames := map[string]*string{
+		`#HashKey`: aws.String(collection.GetIdentityFieldName()),
+	}
+
+	// if there's a range key, we gotta add that to the conditional expression too
+	if rangeKey, ok := collection.GetFirstNonIdentityKeyField(); ok {
+		expr = append(expr, `attribute_not_exists(#RangeKey)`)
+		attrNames[`#RangeKey`] = aws.String(rangeKey.Name)
+	}
+
+	return strings.Join(expr, ` AND `), attrNames
+}
+
+// groups conditional puts that create the given items into transactions of at most
+// DynamoMaxTransactionItems writes.  Items that share a key are rejected, as only one of them could
+// be created.
+func dynamoCreateTransactions(collection *dal.Collection, items []map[string]*dynamodb.AttributeValue) ([][]*dynamodb.TransactWriteItem, error) {
+	keyNames := dynamoKeyAttributeNames(collection)
+	seen := make(map[string]bool)
+	transactions := make([][]*dynamodb.TransactWriteItem, 0)
+	condition, attrNames := dynamoCreateCondition(collection)
+
+	for i, item := range items {
+		if id := dynamoCursorFor(keyNames, item); seen[id] {
+			return nil, fmt.Errorf("Record already exists")
+		} else {
+			seen[id] = true
+		}
+
+		if i%DynamoMaxTransactionItems == 0 {
+			transactions = append(transactions, make([]*dynamodb.TransactWriteItem, 0))
+		}
+
+		put := &dynamodb.Put{
+			TableName: aws.String(collection.Name),
+			Item:      item,
+		}
+
+		put.SetConditionExpression(condition)
+		put.SetExpressionAttributeNames(attrNames)
+
+		last := len(transactions) - 1
+		transactions[last] = append(transactions[last], &dynamodb.TransactWriteItem{
+			Put: put,
+		})
+	}
+
+	return transactions, nil
+}
+
+// returns the primary key attributes of the given item.
+func dynamoItemKey(collection *dal.Collection, item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	key := make(map[string]*dynamodb.AttributeValue)
+
+	for _, name := range dynamoKeyAttributeNames(collection) {
+		if attr, ok := item[name]; ok {
+			key[name] = attr
+		}
+	}
+
+	return key
+}
+
+// converts errors returned by DynamoDB into friendlier ones where possible.
+func dynamoError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeProvisionedThroughputExceededException:
+			return fmt.Errorf("Throughput exceeded")
+		default:
+			return aerr
+		}
+	}
+
+	return err
+}
@@ -1,11 +1,14 @@
 package backends
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/stretchr/testify/require"
 )
 
@@ -69,3 +72,229 @@ func TestDynamoRecordFromItem(t *testing.T) {
 	assert.EqualValues(`tester`, record.Get(`name`))
 	assert.EqualValues(42, record.Get(`age`))
 }
+
+func TestDynamoPlanQuery(t *testing.T) {
+	assert := require.New(t)
+	collection := &dal.Collection{
+		Name:          `TestDynamoPlanQuery`,
+		IdentityField: `account`,
+		Fields: []dal.Field{
+			{
+				Name: `created_at`,
+				Type: dal.IntType,
+				Key:  true,
+			}, {
+				Name: `email`,
+				Type: dal.StringType,
+			}, {
+				Name: `age`,
+				Type: dal.IntType,
+			},
+		},
+		SecondaryIndexes: []dal.SecondaryIndex{
+			{
+				Name:     `by_email`,
+				HashKey:  `email`,
+				RangeKey: `age`,
+			},
+		},
+	}
+
+	// hash and range key
+	plan := dynamoPlanQuery(collection, filter.MustParse(`account/a1/created_at/gt:5/age/9`))
+	assert.False(plan.IsScan())
+	assert.Equal(``, plan.IndexName)
+	assert.Len(plan.KeyCriteria, 2)
+	assert.Len(plan.FilterCriteria, 1)
+	assert.Equal(`age`, plan.FilterCriteria[0].Field)
+
+	// "id" refers to the identity field
+	plan = dynamoPlanQuery(collection, filter.MustParse(`id/a1`))
+	assert.False(plan.IsScan())
+	assert.Equal(`account`, plan.HashKey)
+
+	// a secondary index covering more criteria is preferred over the table's key
+	plan = dynamoPlanQuery(collection, filter.MustParse(`account/a1/email/me@example.com/age/lt:30`))
+	assert.False(plan.IsScan())
+	assert.Equal(`by_email`, plan.IndexName)
+	assert.Equal([]string{`account`, `created_at`, `email`, `age`}, plan.CursorKeys(collection))
+	assert.Len(plan.FilterCriteria, 1)
+	assert.Equal(`account`, plan.FilterCriteria[0].Field)
+
+	// hash keys must be matched exactly against a single value
+	for _, spec := range []string{
+		`email/prefix:me`,
+		`email/me@example.com|you@example.com`,
+		`age/20`,
+		`or(/account/a1/email/me@example.com/)`,
+	} {
+		plan = dynamoPlanQuery(collection, filter.MustParse(spec))
+		assert.True(plan.IsScan(), spec)
+		assert.Len(plan.FilterCriteria, len(filter.MustParse(spec).Criteria), spec)
+	}
+}
+
+func TestDynamoExpression(t *testing.T) {
+	assert := require.New(t)
+	expr := newDynamoExpression(dynamoTestCollection)
+
+	condition, err := expr.criteria(filter.AndConjunction, filter.MustParse(
+		`name/prefix:te/age/gte:21/enabled/not:null`,
+	).Criteria)
+
+	assert.NoError(err)
+	assert.Equal(`(begins_with(#F0, :v0)) AND (#F1 >= :v1) AND (attribute_exists(#F2))`, condition)
+	assert.Equal(`name`, aws.StringValue(expr.names[`#F0`]))
+	assert.Equal(`21`, aws.StringValue(expr.values[`:v1`].N))
+
+	// names are reused, values are not
+	condition, err = expr.keyConditions(filter.MustParse(`age/21`).Criteria)
+	assert.NoError(err)
+	assert.Equal(`#F1 = :v2`, condition)
+
+	_, err = expr.criteria(filter.AndConjunction, filter.MustParse(`name/suffix:er`).Criteria)
+	assert.Error(err)
+}
+
+func TestDynamoCreateTableInput(t *testing.T) {
+	assert := require.New(t)
+	input, err := dynamoCreateTableInput(&dal.Collection{
+		Name:              `TestDynamoCreateTableInput`,
+		IdentityField:     `account`,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `created_at`,
+				Type: dal.IntType,
+				Key:  true,
+			}, {
+				Name: `email`,
+				Type: dal.StringType,
+			},
+		},
+		SecondaryIndexes: []dal.SecondaryIndex{
+			{
+				Name:    `by_email`,
+				HashKey: `email`,
+			}, {
+				Name:     `by_account_email`,
+				HashKey:  `account`,
+				RangeKey: `email`,
+				Local:    true,
+			},
+		},
+	})
+
+	assert.NoError(err)
+	assert.Len(input.KeySchema, 2)
+	assert.Equal(`account`, aws.StringValue(input.KeySchema[0].AttributeName))
+	assert.Equal(dynamodb.KeyTypeRange, aws.StringValue(input.KeySchema[1].KeyType))
+	assert.Len(input.GlobalSecondaryIndexes, 1)
+	assert.Len(input.LocalSecondaryIndexes, 1)
+	assert.Len(input.AttributeDefinitions, 3)
+	assert.Equal(`created_at`, aws.StringValue(input.AttributeDefinitions[1].AttributeName))
+	assert.Equal(dynamodb.ScalarAttributeTypeN, aws.StringValue(input.AttributeDefinitions[1].AttributeType))
+
+	_, err = dynamoCreateTableInput(&dal.Collection{
+		Name: `TestDynamoCreateTableInput`,
+		SecondaryIndexes: []dal.SecondaryIndex{
+			{
+				Name:    `missing`,
+				HashKey: `nope`,
+			},
+		},
+	})
+
+	assert.Error(err)
+}
+
+func TestDynamoTransactionError(t *testing.T) {
+	assert := require.New(t)
+
+	err := dynamoTransactionError(&dynamodb.TransactionCanceledException{
+		CancellationReasons: []*dynamodb.CancellationReason{
+			{Code: aws.String(`None`)},
+			{Code: aws.String(`ConditionalCheckFailed`)},
+		},
+	})
+
+	assert.True(dal.IsExistError(err))
+
+	condition, names := dynamoCreateCondition(&dal.Collection{
+		Name: `TestDynamoTransactionError`,
+		Fields: []dal.Field{
+			{
+				Name: `created_at`,
+				Type: dal.IntType,
+				Key:  true,
+			},
+		},
+	})
+
+	assert.Equal(`attribute_not_exists(#HashKey) AND attribute_not_exists(#RangeKey)`, condition)
+	assert.Equal(`id`, aws.StringValue(names[`#HashKey`]))
+	assert.Equal(`created_at`, aws.StringValue(names[`#RangeKey`]))
+}
+
+func TestDynamoCreateTransactions(t *testing.T) {
+	assert := require.New(t)
+	items := make([]map[string]*dynamodb.AttributeValue, 0)
+
+	for i := 0; i < DynamoMaxTransactionItems+1; i++ {
+		items = append(items, map[string]*dynamodb.AttributeValue{
+			`id`:   {S: aws.String(fmt.Sprintf("%d", i))},
+			`name`: {S: aws.String(`test`)},
+		})
+	}
+
+	transactions, err := dynamoCreateTransactions(dynamoTestCollection, items)
+	assert.NoError(err)
+	assert.Len(transactions, 2)
+	assert.Len(transactions[0], DynamoMaxTransactionItems)
+	assert.Len(transactions[1], 1)
+
+	// every write only succeeds if the record doesn't already exist
+	for _, transaction := range transactions {
+		for _, write := range transaction {
+			assert.Equal(`attribute_not_exists(#HashKey)`, aws.StringValue(write.Put.ConditionExpression))
+		}
+	}
+
+	// records can't be created twice in the same call
+	_, err = dynamoCreateTransactions(dynamoTestCollection, append(items, items[0]))
+	assert.True(dal.IsExistError(err))
+}
+
+func TestDynamoRecordTimeToLive(t *testing.T) {
+	assert := require.New(t)
+
+	collection := &dal.Collection{
+		Name:            `TestDynamoRecordTimeToLive`,
+		TimeToLiveField: `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name: `expires_at`,
+				Type: dal.TimeType,
+			},
+		},
+	}
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	item, err := dynamoRecordToItem(collection, dal.NewRecord(`a`).Set(`expires_at`, expiresAt))
+	assert.NoError(err)
+	assert.NotNil(item[`expires_at`].N)
+	assert.Equal(fmt.Sprintf("%d", expiresAt.Unix()), aws.StringValue(item[`expires_at`].N))
+
+	record, err := dynamoRecordFromItem(collection, `a`, item)
+	assert.NoError(err)
+	assert.True(expiresAt.Equal(record.Get(`expires_at`).(time.Time)))
+	assert.False(collection.IsExpired(record))
+
+	item, err = dynamoRecordToItem(collection, dal.NewRecord(`b`).Set(`expires_at`, time.Now().Add(-time.Minute)))
+	assert.NoError(err)
+
+	record, err = dynamoRecordFromItem(collection, `b`, item)
+	assert.NoError(err)
+	assert.True(collection.IsExpired(record))
+}
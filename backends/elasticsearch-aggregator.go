@@ -3,22 +3,17 @@ package backends
 // this file satifies the Aggregator interface for ElasticsearchIndexer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/PerformLine/pivot/v3/filter/generators"
 )
 
-type esAggregationQuery struct {
-	Aggregations map[string]esAggregation `json:"aggs"`
-	Filter       map[string]interface{}   `json:"filter,omitempty"`
-	Size         int                      `json:"size"`
-}
-
-type esAggregation map[string]interface{}
-
 func (self *ElasticsearchIndexer) Sum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
 	return self.aggregateFloat(collection, filter.Sum, field, f)
 }
@@ -66,100 +61,397 @@ func (self *ElasticsearchIndexer) Average(collection *dal.Collection, field stri
 }
 
 func (self *ElasticsearchIndexer) GroupBy(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
-	if result, err := self.aggregate(collection, groupBy, aggregates, flt, false); err == nil {
-		return result.(*dal.RecordSet), nil
+	return self.GroupByContext(context.Background(), collection, groupBy, aggregates, flt...)
+}
+
+func (self *ElasticsearchIndexer) GroupByContext(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
+	return self.aggregate(ctx, collection, groupBy, aggregates, flt)
+}
+
+// DateHistogram groups the records matching the query into buckets using a date_histogram
+// aggregation.
+func (self *ElasticsearchIndexer) DateHistogram(ctx context.Context, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error) {
+	histogram := map[string]interface{}{
+		`field`:             query.Field,
+		`calendar_interval`: string(query.Interval),
+		`time_zone`:         query.Location.String(),
+		`min_doc_count`:     0,
+	}
+
+	if !query.Start.IsZero() && !query.End.IsZero() {
+		histogram[`extended_bounds`] = map[string]interface{}{
+			`min`: query.Start.UnixNano() / int64(time.Millisecond),
+			`max`: query.End.Add(-time.Nanosecond).UnixNano() / int64(time.Millisecond),
+		}
+	}
+
+	if metrics, err := esMetricAggregations(query.Aggregates); err == nil {
+		if len(metrics) > 0 {
+			histogram[`aggs`] = metrics
+		}
 	} else {
+		return nil, NotImplementedError
+	}
+
+	output, err := self.search(ctx, collection, query.sourceFilter(true), map[string]interface{}{
+		HistogramBucketField: map[string]interface{}{
+			`date_histogram`: histogram,
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]*dal.Record, 0)
+
+	for _, b := range esBuckets(output, HistogramBucketField) {
+		ms := typeutil.Int(b[`key`])
+		bucket := dal.NewRecord(nil).Set(HistogramBucketField, time.Unix(0, ms*int64(time.Millisecond)))
+
+		for i, aggregate := range query.Aggregates {
+			bucket.Set(aggregate.ResultName(), esMetricValue(i, aggregate, b, b[`doc_count`]))
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	return histogramRecordSet(query, buckets)
+}
+
+// Facets counts the values of each field using a terms aggregation per field.
+func (self *ElasticsearchIndexer) Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	aggs := make(map[string]interface{})
+
+	for i, field := range query.Fields {
+		if field == filter.DefaultIdentityField || field == ElasticsearchIdentityField || collection.IsIdentityField(field) {
+			return nil, NotImplementedError
+		}
+
+		var order interface{}
+
+		switch query.Sort {
+		case FacetSortValue:
+			order = map[string]interface{}{
+				`_key`: `asc`,
+			}
+		default:
+			order = []map[string]interface{}{
+				{`_count`: `desc`},
+				{`_key`: `asc`},
+			}
+		}
+
+		aggs[fmt.Sprintf("facet%d", i)] = map[string]interface{}{
+			`terms`: map[string]interface{}{
+				`field`: field,
+				`size`:  query.size(),
+				`order`: order,
+			},
+		}
+	}
+
+	output, err := self.search(ctx, collection, aggregationFilter(query.Filter), aggs)
+
+	if err != nil {
 		return nil, err
 	}
+
+	facets := make(map[string][]FacetValue)
+
+	for i, field := range query.Fields {
+		values := make([]FacetValue, 0)
+
+		for _, bucket := range esBuckets(output, fmt.Sprintf("facet%d", i)) {
+			values = append(values, FacetValue{
+				Value: collection.ConvertValue(field, bucket[`key`]),
+				Count: typeutil.Int(bucket[`doc_count`]),
+			})
+		}
+
+		facets[field] = values
+	}
+
+	return facets, nil
 }
 
 func (self *ElasticsearchIndexer) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (float64, error) {
-	if result, err := self.aggregate(collection, nil, []filter.Aggregate{
-		{
-			Aggregation: aggregation,
-			Field:       field,
-		},
-	}, flt, true); err == nil {
-		return result.(float64), nil
+	aggregate := filter.Aggregate{
+		Name:        `value`,
+		Aggregation: aggregation,
+		Field:       field,
+	}
+
+	if results, err := self.aggregate(context.Background(), collection, nil, []filter.Aggregate{aggregate}, flt); err == nil {
+		if len(results.Records) > 0 {
+			return typeutil.Float(results.Records[0].Get(aggregate.ResultName())), nil
+		} else {
+			return 0, nil
+		}
 	} else {
 		return 0, err
 	}
 }
 
-func (self *ElasticsearchIndexer) aggregate(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt []*filter.Filter, single bool) (interface{}, error) {
+// calculates the given aggregates across all matching records, or for each distinct combination of
+// the groupBy fields (using a composite aggregation, which is paged through until exhausted).
+func (self *ElasticsearchIndexer) aggregate(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt []*filter.Filter) (*dal.RecordSet, error) {
 	var f *filter.Filter
 
 	if len(flt) > 0 {
 		f = flt[0]
 	}
 
-	if query, err := filter.Render(
-		generators.NewElasticsearchGenerator(),
-		collection.GetAggregatorName(),
-		f,
-	); err == nil {
-		var esFilter map[string]interface{}
+	f = aggregationFilter(f)
+	metrics, err := esMetricAggregations(aggregates)
 
-		if err := json.Unmarshal(query, &esFilter); err == nil {
-			aggs := esAggregationQuery{
-				Aggregations: make(map[string]esAggregation),
-			}
+	if err != nil {
+		return nil, err
+	}
 
-			for _, aggregate := range aggregates {
-				var statsKey = aggregate.Field
-				var statsField esAggregation
+	recordset := dal.NewRecordSet()
 
-				if s, ok := aggs.Aggregations[statsKey]; ok {
-					statsField = s
+	if len(groupBy) == 0 {
+		if output, err := self.search(ctx, collection, f, metrics); err == nil {
+			result := dal.NewRecord(nil)
+			aggs, _ := output[`aggregations`].(map[string]interface{})
+			var total interface{}
+
+			// hits.total is a number before Elasticsearch 7, and an object after
+			if hits, ok := output[`hits`].(map[string]interface{}); ok {
+				if t, ok := hits[`total`].(map[string]interface{}); ok {
+					total = t[`value`]
 				} else {
-					statsField = make(esAggregation)
+					total = hits[`total`]
 				}
+			}
 
-				statsField[`stats`] = map[string]interface{}{
-					`field`: aggregate.Field,
-				}
+			for i, aggregate := range aggregates {
+				result.Set(aggregate.ResultName(), esMetricValue(i, aggregate, aggs, total))
+			}
+
+			recordset.Push(result)
+		} else {
+			return nil, err
+		}
+
+		return recordset, nil
+	}
+
+	sources := make([]map[string]interface{}, len(groupBy))
+
+	for i, field := range groupBy {
+		sources[i] = map[string]interface{}{
+			field: map[string]interface{}{
+				`terms`: map[string]interface{}{
+					`field`: field,
+				},
+			},
+		}
+	}
 
-				aggs.Aggregations[statsKey] = statsField
+	var after interface{}
+
+	for {
+		composite := map[string]interface{}{
+			`size`:    IndexerPageSize,
+			`sources`: sources,
+		}
+
+		if after != nil {
+			composite[`after`] = after
+		}
+
+		groups := map[string]interface{}{
+			`composite`: composite,
+		}
+
+		if len(metrics) > 0 {
+			groups[`aggs`] = metrics
+		}
+
+		output, err := self.search(ctx, collection, f, map[string]interface{}{
+			`groups`: groups,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		buckets := esBuckets(output, `groups`)
+
+		for _, bucket := range buckets {
+			result := dal.NewRecord(nil)
+			key, _ := bucket[`key`].(map[string]interface{})
+
+			for _, field := range groupBy {
+				result.Set(field, key[field])
 			}
 
-			if len(esFilter) > 0 {
-				aggs.Filter = esFilter
-				aggs.Size = 0
+			for i, aggregate := range aggregates {
+				result.Set(aggregate.ResultName(), esMetricValue(i, aggregate, bucket, bucket[`doc_count`]))
 			}
 
-			if query, err := json.Marshal(aggs); err == nil {
-				if req, err := self.newRequest(`GET`, fmt.Sprintf("/%s/_search", collection.GetAggregatorName()), string(query)); err == nil {
-					// perform request, read response
-					if response, err := self.client.Do(req); err == nil {
-						if response.StatusCode < 400 {
-							output := make(map[string]interface{})
-
-							if err := json.NewDecoder(response.Body).Decode(&output); err == nil {
-								return output, nil
-							} else {
-								return nil, fmt.Errorf("response decode error: %v", err)
-							}
-						} else {
-							return nil, fmt.Errorf("Got HTTP %v", response.Status)
-						}
-					} else {
-						return nil, err
-					}
+			recordset.Push(result)
+		}
+
+		if aggs, ok := output[`aggregations`].(map[string]interface{}); ok && len(buckets) > 0 {
+			if g, ok := aggs[`groups`].(map[string]interface{}); ok && g[`after_key`] != nil {
+				after = g[`after_key`]
+				continue
+			}
+		}
+
+		return recordset, nil
+	}
+}
+
+// performs a search for the records matching the given filter, returning the given aggregations
+// (but no records).
+func (self *ElasticsearchIndexer) search(ctx context.Context, collection *dal.Collection, f *filter.Filter, aggs map[string]interface{}) (map[string]interface{}, error) {
+	var payload map[string]interface{}
+
+	if data, err := filter.Render(
+		generators.NewElasticsearchGenerator(),
+		collection.GetAggregatorName(),
+		f,
+	); err == nil {
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, fmt.Errorf("filter decode error: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("filter error: %v", err)
+	}
+
+	delete(payload, `sort`)
+	delete(payload, `from`)
+	payload[`size`] = 0
+
+	if len(aggs) > 0 {
+		payload[`aggs`] = aggs
+	}
 
+	if body, err := json.Marshal(payload); err == nil {
+		if req, err := self.newRequest(`GET`, fmt.Sprintf("/%s/_search", collection.GetAggregatorName()), string(body)); err == nil {
+			if response, err := self.client.Do(req.WithContext(ctx)); err == nil {
+				defer response.Body.Close()
+
+				if response.StatusCode >= 400 {
+					return nil, fmt.Errorf("Got HTTP %v", response.Status)
+				}
+
+				output := make(map[string]interface{})
+
+				if err := json.NewDecoder(response.Body).Decode(&output); err == nil {
+					return output, nil
 				} else {
-					return nil, err
+					return nil, fmt.Errorf("response decode error: %v", err)
 				}
 			} else {
-				return nil, fmt.Errorf("filter encode error: %v", err)
+				return nil, err
 			}
 		} else {
-			return nil, fmt.Errorf("filter decode error: %v", err)
+			return nil, err
 		}
 	} else {
-		return nil, fmt.Errorf("filter error: %v", err)
+		return nil, fmt.Errorf("filter encode error: %v", err)
+	}
+}
+
+// returns the metric aggregations that calculate the given aggregates, keyed by their position.
+// Counts are read from each bucket's document count, and so have no aggregation of their own.
+func esMetricAggregations(aggregates []filter.Aggregate) (map[string]interface{}, error) {
+	metrics := make(map[string]interface{})
+
+	for i, aggregate := range aggregates {
+		var fn string
+		options := map[string]interface{}{
+			`field`: aggregate.Field,
+		}
+
+		switch aggregate.Aggregation {
+		case filter.Count:
+			continue
+		case filter.Sum:
+			fn = `sum`
+		case filter.Average:
+			fn = `avg`
+		case filter.Minimum:
+			fn = `min`
+		case filter.Maximum:
+			fn = `max`
+		case filter.Cardinality:
+			fn = `cardinality`
+		case filter.CountDistinct:
+			// cardinality counts are exact up to the precision threshold, which is set to its maximum
+			fn = `cardinality`
+			options[`precision_threshold`] = 40000
+		case filter.Percentile, filter.Median:
+			fn = `percentiles`
+			options[`percents`] = []float64{aggregate.Quantile() * 100}
+			options[`keyed`] = false
+		case filter.StdDev, filter.Variance:
+			fn = `extended_stats`
+		default:
+			return nil, fmt.Errorf("Elasticsearch does not support %v aggregates", aggregate.Aggregation)
+		}
+
+		metrics[fmt.Sprintf("agg%d", i)] = map[string]interface{}{
+			fn: options,
+		}
+	}
+
+	return metrics, nil
+}
+
+// extracts the value of the i-th aggregate from a bucket (or the top-level aggregations).
+func esMetricValue(i int, aggregate filter.Aggregate, bucket map[string]interface{}, count interface{}) interface{} {
+	if aggregate.Aggregation == filter.Count {
+		return count
+	}
+
+	metric, ok := bucket[fmt.Sprintf("agg%d", i)].(map[string]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	switch aggregate.Aggregation {
+	case filter.Percentile, filter.Median:
+		if values, ok := metric[`values`].([]interface{}); ok && len(values) > 0 {
+			if value, ok := values[0].(map[string]interface{}); ok {
+				return value[`value`]
+			}
+		}
+
+		return nil
+	case filter.StdDev:
+		return metric[`std_deviation`]
+	case filter.Variance:
+		return metric[`variance`]
+	default:
+		return metric[`value`]
 	}
 }
 
+func esBuckets(output map[string]interface{}, name string) []map[string]interface{} {
+	var buckets []map[string]interface{}
+
+	if aggs, ok := output[`aggregations`].(map[string]interface{}); ok {
+		if agg, ok := aggs[name].(map[string]interface{}); ok {
+			if list, ok := agg[`buckets`].([]interface{}); ok {
+				for _, item := range list {
+					if bucket, ok := item.(map[string]interface{}); ok {
+						buckets = append(buckets, bucket)
+					}
+				}
+			}
+		}
+	}
+
+	return buckets
+}
+
 func (self *ElasticsearchIndexer) AggregatorConnectionString() *dal.ConnectionString {
 	return self.conn
 }
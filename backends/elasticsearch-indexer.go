@@ -2,6 +2,7 @@ package backends
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -43,6 +44,7 @@ type elasticsearchDocument struct {
 	Score   float64                `json:"_score"`
 	Found   bool                   `json:"found"`
 	Source  map[string]interface{} `json:"_source"`
+	Sort    []interface{}          `json:"sort,omitempty"`
 }
 
 type hits struct {
@@ -312,6 +314,12 @@ func (self *ElasticsearchIndexer) checkAndFlushBatches(forceFlush bool) {
 }
 
 func (self *ElasticsearchIndexer) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	return self.QueryFuncContext(context.Background(), collection, f, resultFn)
+}
+
+func (self *ElasticsearchIndexer) QueryFuncContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, f, resultFn)
+
 	defer stats.NewTiming().Send(`pivot.indexers.elasticsearch.query_time`)
 
 	if f.IdentityField == `` {
@@ -321,22 +329,25 @@ func (self *ElasticsearchIndexer) QueryFunc(collection *dal.Collection, f *filte
 	if index, err := self.getIndexForCollection(collection); err == nil {
 		originalLimit := f.Limit
 		originalOffset := f.Offset
+		originalCursor := f.Cursor
 		useScrollApi := false
 		isFirstScrollRequest := true
 		lastScrollId := ``
 
 		// unbounded requests, or bounded ones exceeding 10k results, need to use the Scroll API
+		// (unless we're paginating with search_after, which has no such limit)
 		// see: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-request-scroll.html
-		if f.Limit == 0 || f.Limit > 10000 {
+		if (f.Limit == 0 || f.Limit > 10000) && !f.UsesCursor() {
 			f.Limit = IndexerPageSize
 			useScrollApi = true
-		} else if f.Limit > IndexerPageSize {
+		} else if f.Limit == 0 || f.Limit > IndexerPageSize {
 			f.Limit = IndexerPageSize
 		}
 
 		defer func() {
 			f.Offset = originalOffset
 			f.Limit = originalLimit
+			f.Cursor = originalCursor
 		}()
 
 		page := 1
@@ -378,7 +389,7 @@ func (self *ElasticsearchIndexer) QueryFunc(collection *dal.Collection, f *filte
 				}
 
 				// perform request, read response
-				if response, err := self.client.Do(req); err == nil {
+				if response, err := self.client.Do(req.WithContext(ctx)); err == nil {
 					if response.StatusCode < 400 {
 						var searchResult elasticsearchSearchResult
 
@@ -401,16 +412,38 @@ func (self *ElasticsearchIndexer) QueryFunc(collection *dal.Collection, f *filte
 
 							// call the resultFn for each hit on this page
 							for _, hit := range results.Hits {
-								if err := resultFn(dal.NewRecord(hit.ID).SetFields(hit.Source), nil, IndexPage{
+								var nextCursor string
+
+								// the sort values of a hit are what search_after needs to resume after it
+								if f.UsesCursor() && len(hit.Sort) > 0 {
+									if cursor, err := filter.EncodeCursor(hit.Sort); err == nil {
+										nextCursor = cursor
+									} else {
+										return err
+									}
+								}
+
+								record := dal.NewRecord(hit.ID).SetFields(hit.Source)
+
+								if f.UsesFulltext() {
+									record.Set(filter.ScoreField, hit.Score)
+								}
+
+								if err := resultFn(record, nil, IndexPage{
 									Page:         page,
 									TotalPages:   totalPages,
 									Limit:        originalLimit,
 									Offset:       f.Offset,
 									TotalResults: int64(results.Total),
+									NextCursor:   nextCursor,
 								}); err != nil {
 									return err
 								}
 
+								if nextCursor != `` {
+									f.Cursor = nextCursor
+								}
+
 								processed += 1
 
 								// if we have a limit set and we're at or beyond it
@@ -460,11 +493,15 @@ func (self *ElasticsearchIndexer) QueryFunc(collection *dal.Collection, f *filte
 }
 
 func (self *ElasticsearchIndexer) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.QueryContext(context.Background(), collection, f, resultFns...)
+}
+
+func (self *ElasticsearchIndexer) QueryContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	if f.IdentityField == `` {
 		f.IdentityField = ElasticsearchIdentityField
 	}
 
-	return DefaultQueryImplementation(self, collection, f, resultFns...)
+	return DefaultQueryImplementationContext(ctx, self, collection, f, resultFns...)
 }
 
 func (self *ElasticsearchIndexer) IndexRemove(collection *dal.Collection, ids []interface{}) error {
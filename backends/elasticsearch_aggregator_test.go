@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticsearchGroupBy(t *testing.T) {
+	assert := require.New(t)
+	var requests []map[string]interface{}
+
+	// serves two pages of composite buckets, then an empty one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(json.NewDecoder(req.Body).Decode(&body))
+		requests = append(requests, body)
+
+		var buckets []interface{}
+
+		switch len(requests) {
+		case 1:
+			buckets = []interface{}{map[string]interface{}{
+				`key`:       map[string]interface{}{`team`: `blue`},
+				`doc_count`: 3,
+				`agg1`:      map[string]interface{}{`values`: []interface{}{map[string]interface{}{`key`: 95.0, `value`: 12.5}}},
+				`agg2`:      map[string]interface{}{`std_deviation`: 1.5, `variance`: 2.25},
+			}}
+		case 2:
+			buckets = []interface{}{map[string]interface{}{
+				`key`:       map[string]interface{}{`team`: `red`},
+				`doc_count`: 1,
+				`agg1`:      map[string]interface{}{`values`: []interface{}{map[string]interface{}{`key`: 95.0, `value`: 4}}},
+				`agg2`:      map[string]interface{}{`std_deviation`: 0, `variance`: 0},
+			}}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			`aggregations`: map[string]interface{}{
+				`groups`: map[string]interface{}{
+					`after_key`: map[string]interface{}{`team`: len(requests)},
+					`buckets`:   buckets,
+				},
+			},
+		})
+	}))
+
+	defer server.Close()
+
+	indexer := NewElasticsearchIndexer(dal.MustParseConnectionString(`elasticsearch://` + strings.TrimPrefix(server.URL, `http://`)))
+	collection := dal.NewCollection(`scores`)
+
+	var aggregates []filter.Aggregate
+
+	for _, spec := range []string{`count`, `p95:score`, `spread=stddev:score`} {
+		aggregate, err := filter.ParseAggregate(spec)
+		assert.NoError(err)
+		aggregates = append(aggregates, aggregate)
+	}
+
+	results, err := indexer.GroupBy(collection, []string{`team`}, aggregates, filter.MustParse(`score/gt:0`))
+	assert.NoError(err)
+	assert.Len(results.Records, 2)
+	assert.Len(requests, 3)
+
+	assert.Equal(`blue`, results.Records[0].Get(`team`))
+	assert.EqualValues(3, results.Records[0].Get(`count`))
+	assert.EqualValues(12.5, results.Records[0].Get(`score`))
+	assert.EqualValues(1.5, results.Records[0].Get(`spread`))
+	assert.Equal(`red`, results.Records[1].Get(`team`))
+
+	// pages after the first resume from the previous page's after_key
+	groups := requests[0][`aggs`].(map[string]interface{})[`groups`].(map[string]interface{})
+	assert.Nil(groups[`composite`].(map[string]interface{})[`after`])
+	assert.Equal(map[string]interface{}{
+		`percentiles`: map[string]interface{}{
+			`field`:    `score`,
+			`percents`: []interface{}{95.0},
+			`keyed`:    false,
+		},
+	}, groups[`aggs`].(map[string]interface{})[`agg1`])
+
+	groups = requests[1][`aggs`].(map[string]interface{})[`groups`].(map[string]interface{})
+	assert.Equal(map[string]interface{}{`team`: 1.0}, groups[`composite`].(map[string]interface{})[`after`])
+	assert.EqualValues(0, requests[1][`size`])
+}
@@ -80,6 +80,15 @@ func (self *EmbeddedRecordBackend) SetIndexer(cs dal.ConnectionString) error {
 	return self.backend.SetIndexer(cs)
 }
 
+func (self *EmbeddedRecordBackend) AttachIndexer(indexer Indexer) error {
+	if err := AttachIndexer(self.backend, indexer); err == nil {
+		self.indexer = indexer
+		return nil
+	} else {
+		return err
+	}
+}
+
 func (self *EmbeddedRecordBackend) RegisterCollection(c *dal.Collection) {
 	self.backend.RegisterCollection(c)
 }
@@ -96,6 +105,10 @@ func (self *EmbeddedRecordBackend) Update(collection string, records *dal.Record
 	return self.backend.Update(collection, records, target...)
 }
 
+func (self *EmbeddedRecordBackend) Upsert(collection string, records *dal.RecordSet) error {
+	return self.backend.Upsert(collection, records)
+}
+
 func (self *EmbeddedRecordBackend) Delete(collection string, ids ...interface{}) error {
 	return self.backend.Delete(collection, ids...)
 }
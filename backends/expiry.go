@@ -0,0 +1,172 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/log"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+// Wraps the given result function so that records which have outlived the collection's
+// TimeToLiveField are skipped.  Backends whose databases remove expired records some time after
+// they expire (or not at all) use this so that those records are not returned in the meantime.
+// Filters with the "IncludeExpired" option set (e.g.: those used to remove expired records) are
+// given every matching record.
+func skipExpired(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) IndexResultFunc {
+	if collection == nil || collection.TimeToLiveField == `` {
+		return resultFn
+	}
+
+	if f != nil {
+		if v, ok := f.Options[`IncludeExpired`].(bool); ok && v {
+			return resultFn
+		}
+	}
+
+	return func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil && record != nil && collection.IsExpired(record) {
+			return nil
+		}
+
+		return resultFn(record, err, page)
+	}
+}
+
+// Returns the given record, or a "does not exist" error if it has already expired.
+func unlessExpired(collection *dal.Collection, id interface{}, record *dal.Record) (*dal.Record, error) {
+	if collection.IsExpired(record) {
+		return nil, fmt.Errorf("Record %v does not exist", id)
+	}
+
+	return record, nil
+}
+
+// Returns a filter matching the records in the given collection whose TimeToLiveField has passed.
+// TimeToLiveFields that aren't time fields are taken to hold epoch seconds.  Records without an
+// expiry time never match.
+func ExpiredFilter(collection *dal.Collection) *filter.Filter {
+	ttl := collection.TimeToLiveField
+	now := time.Now()
+
+	f := filter.New()
+	f.IdentityField = collection.GetIdentityFieldName()
+	f.Options[`IncludeExpired`] = true
+
+	if field, ok := collection.GetField(ttl); ok && field.Type != dal.TimeType {
+		f.AddCriteria(filter.Criterion{
+			Type:     dal.IntType,
+			Field:    ttl,
+			Operator: `gt`,
+			Values:   []interface{}{0},
+		}, filter.Criterion{
+			Type:     dal.IntType,
+			Field:    ttl,
+			Operator: `lt`,
+			Values:   []interface{}{now.Unix()},
+		})
+	} else {
+		f.AddCriteria(filter.Criterion{
+			Type:     dal.TimeType,
+			Field:    ttl,
+			Operator: `lt`,
+			Values:   []interface{}{now.UTC().Format(time.RFC3339)},
+		})
+	}
+
+	return f
+}
+
+// Removes the records in the given collection whose TimeToLiveField has passed using the
+// collection's indexer, returning the number of records that were removed.  Indexers that don't
+// implement DeleteQueryCounter have the expired records counted before they are deleted, so the
+// count may be off if records expire (or are removed) in between.  Collections without a
+// TimeToLiveField are left untouched.
+func ExpireRecords(backend Backend, collection *dal.Collection) (int, error) {
+	if collection.TimeToLiveField == `` {
+		return 0, nil
+	}
+
+	indexer := backend.WithSearch(collection)
+
+	if indexer == nil {
+		return 0, fmt.Errorf("cannot expire records in %v: backend %v has no indexer", collection.Name, backend)
+	}
+
+	f := ExpiredFilter(collection)
+
+	if counter, ok := indexer.(DeleteQueryCounter); ok {
+		return counter.DeleteQueryCount(collection, f)
+	}
+
+	expired := 0
+
+	if err := indexer.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil {
+			expired += 1
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	if expired == 0 {
+		return 0, nil
+	}
+
+	if err := indexer.DeleteQuery(collection, f); err == nil {
+		return expired, nil
+	} else {
+		return 0, err
+	}
+}
+
+// Removes expired records from every collection on the given backend that has a TimeToLiveField,
+// returning the number of records removed from each.  Collections that fail to expire are reported
+// in the returned error, but do not prevent the remaining collections from being expired.
+func Expire(backend Backend) (map[string]int, error) {
+	var merr error
+	removed := make(map[string]int)
+
+	if names, err := backend.ListCollections(); err == nil {
+		for _, name := range names {
+			if collection, err := backend.GetCollection(name); err == nil {
+				if collection.TimeToLiveField == `` {
+					continue
+				}
+
+				if n, err := ExpireRecords(backend, collection); err == nil {
+					removed[collection.Name] = n
+				} else {
+					merr = log.AppendError(merr, err)
+				}
+			} else {
+				merr = log.AppendError(merr, err)
+			}
+		}
+	} else {
+		return nil, err
+	}
+
+	return removed, merr
+}
+
+func startPeriodicExpirer(interval time.Duration, backend Backend) {
+	for {
+		time.Sleep(interval)
+
+		removed, err := Expire(backend)
+
+		for collection, n := range removed {
+			if n > 0 {
+				log.Infof("%v: removed %d expired records from %v", backend, n, collection)
+			}
+		}
+
+		if err != nil {
+			log.Warningf("%v: expiry failed with error: %v", backend, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredRecordsAreHidden(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-expiry-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestExpiredRecordsAreHidden`,
+		IdentityFieldType: dal.StringType,
+		TimeToLiveField:   `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name: `expires_at`,
+				Type: dal.TimeType,
+			},
+		},
+	}
+
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`live`).Set(`expires_at`, time.Now().Add(time.Hour)),
+		dal.NewRecord(`forever`),
+		dal.NewRecord(`expired`).Set(`expires_at`, time.Now().Add(-time.Hour)),
+	)))
+
+	assert.True(backend.Exists(collection.Name, `live`))
+	assert.True(backend.Exists(collection.Name, `forever`))
+	assert.False(backend.Exists(collection.Name, `expired`))
+
+	_, err = backend.Retrieve(collection.Name, `expired`)
+	assert.True(dal.IsNotExistError(err))
+
+	indexer := backend.WithSearch(collection)
+	assert.NotNil(indexer)
+
+	results, err := indexer.Query(collection, filter.All())
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{`live`, `forever`}, results.Pluck(`id`))
+}
+
+func TestExpireRecords(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-expire-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	sessions := &dal.Collection{
+		Name:              `sessions`,
+		IdentityFieldType: dal.StringType,
+		TimeToLiveField:   `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name: `expires_at`,
+				Type: dal.TimeType,
+			},
+		},
+	}
+
+	tokens := &dal.Collection{
+		Name:              `tokens`,
+		IdentityFieldType: dal.StringType,
+		TimeToLiveField:   `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name: `expires_at`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.NoError(backend.CreateCollection(sessions))
+	assert.NoError(backend.CreateCollection(tokens))
+
+	assert.NoError(backend.Insert(sessions.Name, dal.NewRecordSet(
+		dal.NewRecord(`live`).Set(`expires_at`, time.Now().Add(time.Hour)),
+		dal.NewRecord(`forever`),
+		dal.NewRecord(`expired`).Set(`expires_at`, time.Now().Add(-time.Hour)),
+	)))
+
+	assert.NoError(backend.Insert(tokens.Name, dal.NewRecordSet(
+		dal.NewRecord(`live`).Set(`expires_at`, time.Now().Add(time.Hour).Unix()),
+		dal.NewRecord(`forever`).Set(`expires_at`, 0),
+		dal.NewRecord(`expired1`).Set(`expires_at`, time.Now().Add(-time.Hour).Unix()),
+		dal.NewRecord(`expired2`).Set(`expires_at`, time.Now().Add(-time.Minute).Unix()),
+	)))
+
+	removed, err := Expire(backend)
+	assert.NoError(err)
+	assert.Equal(map[string]int{`sessions`: 1, `tokens`: 2}, removed)
+
+	// expired records are gone, not just hidden
+	all := filter.All()
+	all.Options[`IncludeExpired`] = true
+
+	results, err := backend.WithSearch(sessions).Query(sessions, all)
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{`live`, `forever`}, results.Pluck(`id`))
+
+	results, err = backend.WithSearch(tokens).Query(tokens, all)
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{`live`, `forever`}, results.Pluck(`id`))
+
+	n, err := ExpireRecords(backend, sessions)
+	assert.NoError(err)
+	assert.Zero(n)
+}
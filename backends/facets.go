@@ -0,0 +1,167 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+type FacetSort string
+
+const (
+	FacetSortCount FacetSort = `count` // most common values first, then by value
+	FacetSortValue FacetSort = `value` // ascending by value
+)
+
+// Parses the name of a FacetSort ("count" or "value"), defaulting to sorting by count.
+func ParseFacetSort(name string) (FacetSort, error) {
+	switch order := FacetSort(strings.ToLower(name)); order {
+	case ``:
+		return FacetSortCount, nil
+	case FacetSortCount, FacetSortValue:
+		return order, nil
+	default:
+		return ``, fmt.Errorf("Unsupported facet sort %q", name)
+	}
+}
+
+// A distinct value of a field, along with the number of records that have that value.
+type FacetValue struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// Describes the fields to count the distinct values of, and which records to count them in.
+type FacetQuery struct {
+	Fields []string       // the fields to count the values of
+	Sort   FacetSort      // the order that each field's values are returned in
+	Limit  int            // if positive, only this many values are returned for each field
+	Filter *filter.Filter // selects the records to include
+}
+
+// Implemented by indexers that can count field values natively.  Implementations may return
+// NotImplementedError for queries they cannot perform, in which case the values are counted by
+// reading the matching records instead.
+type Faceter interface {
+	Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error)
+}
+
+// Returns the distinct non-null values of each of the query's fields in the records matching its
+// filter, along with the number of records having each value.
+func Facets(ctx context.Context, indexer Indexer, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	if faceter, ok := indexer.(Faceter); ok {
+		if facets, err := faceter.Facets(ctx, collection, query); err != NotImplementedError {
+			return facets, err
+		}
+	}
+
+	return IndexerFacets(ctx, indexer, collection, query)
+}
+
+// Counts field values by reading all matching records from the given indexer.
+func IndexerFacets(ctx context.Context, indexer Indexer, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]map[string]*FacetValue)
+
+	for _, field := range query.Fields {
+		counts[field] = make(map[string]*FacetValue)
+	}
+
+	if err := QueryFuncContext(ctx, indexer, collection, aggregationFilter(query.Filter), func(record *dal.Record, err error, _ IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		for i, value := range memoryFieldValues(collection, record, query.Fields) {
+			if value == nil {
+				continue
+			}
+
+			key := typeutil.String(value)
+			values := counts[query.Fields[i]]
+
+			if facet, ok := values[key]; ok {
+				facet.Count += 1
+			} else {
+				values[key] = &FacetValue{
+					Value: value,
+					Count: 1,
+				}
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	facets := make(map[string][]FacetValue)
+
+	for field, values := range counts {
+		list := make([]FacetValue, 0, len(values))
+
+		for _, facet := range values {
+			list = append(list, *facet)
+		}
+
+		facets[field] = query.finalize(list)
+	}
+
+	return facets, nil
+}
+
+func (self *FacetQuery) normalize() error {
+	if len(self.Fields) == 0 {
+		return fmt.Errorf("must specify at least one field to count values of")
+	}
+
+	if order, err := ParseFacetSort(string(self.Sort)); err == nil {
+		self.Sort = order
+	} else {
+		return err
+	}
+
+	if self.Limit < 0 {
+		self.Limit = 0
+	}
+
+	return nil
+}
+
+// the number of values to retrieve for each field from backends that must be given a limit.
+func (self *FacetQuery) size() int {
+	if self.Limit > 0 && self.Limit < MaxFacetCardinality {
+		return self.Limit
+	}
+
+	return MaxFacetCardinality
+}
+
+// sorts the given values in the query's order, and removes those beyond the limit.
+func (self *FacetQuery) finalize(values []FacetValue) []FacetValue {
+	sort.SliceStable(values, func(i int, j int) bool {
+		if self.Sort == FacetSortCount && values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+
+		return memoryCompare(values[i].Value, values[j].Value) < 0
+	})
+
+	if self.Limit > 0 && len(values) > self.Limit {
+		values = values[:self.Limit]
+	}
+
+	return values
+}
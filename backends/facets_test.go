@@ -0,0 +1,106 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a collection of products and their sales shared by the facet and histogram tests.  Only
+// the first four records have a sale time and value; the rest are only counted by facets.
+func testAnalyticsCollection(name string) (*dal.Collection, *dal.RecordSet) {
+	collection := &dal.Collection{
+		Name:              name,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `color`,
+				Type: dal.StringType,
+			}, {
+				Name: `size`,
+				Type: dal.IntType,
+			}, {
+				Name: `at`,
+				Type: dal.TimeType,
+			}, {
+				Name: `value`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	return collection, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`color`, `red`).Set(`size`, 1).Set(`at`, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)).Set(`value`, 1),
+		dal.NewRecord(2).Set(`color`, `blue`).Set(`size`, 2).Set(`at`, time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)).Set(`value`, 2),
+		dal.NewRecord(3).Set(`color`, `red`).Set(`size`, 2).Set(`at`, time.Date(2024, 1, 3, 5, 0, 0, 0, time.UTC)).Set(`value`, 3),
+		dal.NewRecord(4).Set(`color`, `green`).Set(`size`, 3).Set(`at`, time.Date(2024, 1, 9, 12, 0, 0, 0, time.UTC)).Set(`value`, 4),
+		dal.NewRecord(5).Set(`color`, `red`).Set(`size`, 3),
+		dal.NewRecord(6).Set(`color`, `blue`).Set(`size`, 3),
+		dal.NewRecord(7).Set(`size`, 1),
+	)
+}
+
+func TestFacetSort(t *testing.T) {
+	assert := require.New(t)
+
+	order, err := ParseFacetSort(``)
+	assert.NoError(err)
+	assert.Equal(FacetSortCount, order)
+
+	order, err = ParseFacetSort(`Value`)
+	assert.NoError(err)
+	assert.Equal(FacetSortValue, order)
+
+	_, err = ParseFacetSort(`random`)
+	assert.Error(err)
+}
+
+func TestIndexerFacets(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	collection, records := testAnalyticsCollection(`products`)
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, records))
+	indexer := backend.WithSearch(collection)
+
+	// most common values first, ties broken by value; missing values are not counted
+	facets, err := Facets(context.Background(), indexer, collection, &FacetQuery{
+		Fields: []string{`color`, `size`},
+	})
+
+	assert.NoError(err)
+	assert.Equal([]FacetValue{
+		{Value: `red`, Count: 3},
+		{Value: `blue`, Count: 2},
+		{Value: `green`, Count: 1},
+	}, facets[`color`])
+
+	assert.Len(facets[`size`], 3)
+	assert.EqualValues(3, facets[`size`][0].Value)
+	assert.EqualValues(3, facets[`size`][0].Count)
+	assert.EqualValues(1, facets[`size`][1].Value)
+	assert.EqualValues(2, facets[`size`][1].Count)
+
+	// sorted by value, limited, and filtered
+	facets, err = Facets(context.Background(), indexer, collection, &FacetQuery{
+		Fields: []string{`color`},
+		Sort:   FacetSortValue,
+		Limit:  2,
+		Filter: filter.MustParse(`size/gt:1`),
+	})
+
+	assert.NoError(err)
+	assert.Equal([]FacetValue{
+		{Value: `blue`, Count: 2},
+		{Value: `green`, Count: 1},
+	}, facets[`color`])
+
+	_, err = Facets(context.Background(), indexer, collection, &FacetQuery{})
+	assert.Error(err)
+}
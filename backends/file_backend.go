@@ -314,8 +314,8 @@ func (self *FileBackend) Exists(name string, id interface{}) bool {
 		self.refresh(collection.SourceURI)
 
 		if rs := self.rs(collection.Name); rs != nil {
-			_, ok := rs.GetRecordByID(id)
-			return ok
+			record, ok := rs.GetRecordByID(id)
+			return ok && !collection.IsExpired(record)
 		}
 	}
 
@@ -329,7 +329,7 @@ func (self *FileBackend) Retrieve(name string, id interface{}, fields ...string)
 		}
 
 		if rs := self.rs(collection.Name); rs != nil {
-			if record, ok := rs.GetRecordByID(id); ok {
+			if record, ok := rs.GetRecordByID(id); ok && !collection.IsExpired(record) {
 				return record.OnlyFields(fields), nil
 			} else {
 				return nil, fmt.Errorf("Record %v does not exist", id)
@@ -348,6 +348,10 @@ func (self *FileBackend) Update(collection string, records *dal.RecordSet, targe
 	return fmt.Errorf("File backends are read-only")
 }
 
+func (self *FileBackend) Upsert(collection string, records *dal.RecordSet) error {
+	return fmt.Errorf("File backends are read-only")
+}
+
 func (self *FileBackend) Delete(collection string, ids ...interface{}) error {
 	return fmt.Errorf("File backends are read-only")
 }
@@ -385,8 +389,45 @@ func (self *FileBackend) WithSearch(collection *dal.Collection, filters ...*filt
 	return nil
 }
 
+// file backends have no indexer, so aggregates are calculated by scanning the file's records
 func (self *FileBackend) WithAggregator(collection *dal.Collection) Aggregator {
-	return nil
+	return newFallbackAggregator(self, &self.conn)
+}
+
+func (self *FileBackend) IndexConnectionString() *dal.ConnectionString {
+	return &self.conn
+}
+
+// QueryFunc calls resultFn with each record in the collection matching the given filter.  Sorting
+// and pagination are not supported.
+func (self *FileBackend) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, f, resultFn)
+
+	if err := self.refresh(collection.SourceURI); err != nil {
+		return err
+	}
+
+	if f == nil {
+		f = filter.All()
+	}
+
+	if rs := self.rs(collection.Name); rs != nil {
+		for _, record := range rs.Records {
+			if f.IsMatchAll() || f.MatchesRecord(record) {
+				if err := resultFn(record.OnlyFields(f.Fields), nil, IndexPage{
+					Page:         1,
+					TotalPages:   1,
+					TotalResults: int64(len(rs.Records)),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return dal.CollectionNotFound
 }
 
 func (self *FileBackend) Flush() error {
@@ -1,6 +1,8 @@
 package backends
 
 import (
+	"sort"
+
 	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/go-stockutil/stringutil"
 	"github.com/PerformLine/pivot/v3/dal"
@@ -37,42 +39,61 @@ func (self *FilesystemBackend) Index(collection *dal.Collection, records *dal.Re
 }
 
 func (self *FilesystemBackend) QueryFunc(collection *dal.Collection, filter *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, filter, resultFn)
+
 	defer stats.NewTiming().Send(`pivot.indexers.filesystem.query_time`)
 	querylog.Debugf("[%T] Query using filter %q", self, filter.String())
 
-	if filter.IdOnly() {
-		if id, ok := filter.GetFirstValue(); ok {
-			if record, err := self.Retrieve(collection.GetIndexName(), id); err == nil {
-				querylog.Debugf("[%T] Record %v matches filter %q", self, id, filter.String())
-
-				if err := resultFn(record, err, IndexPage{
-					Page:         1,
-					TotalPages:   1,
-					Limit:        filter.Limit,
-					Offset:       0,
-					TotalResults: 1,
-				}); err != nil {
-					return err
-				}
-			} else {
+	if id, ok := filter.GetFirstValue(); ok && filter.IdOnly() {
+		if record, err := self.retrieve(collection, id); err == nil {
+			querylog.Debugf("[%T] Record %v matches filter %q", self, id, filter.String())
+
+			if err := resultFn(record, err, IndexPage{
+				Page:         1,
+				TotalPages:   1,
+				Limit:        filter.Limit,
+				Offset:       0,
+				TotalResults: 1,
+			}); err != nil {
 				return err
 			}
+		} else {
+			return err
 		}
 	} else {
 		if ids, err := self.listObjectIdsInCollection(collection); err == nil {
 			page := 1
 			processed := 0
+			matched := 0
 			offset := filter.Offset
+			afterId, err := idCursorPosition(filter)
+
+			if err != nil {
+				return err
+			}
+
+			// cursor pagination walks the IDs in order, starting just after the one in the cursor
+			if filter.UsesCursor() {
+				sort.Strings(ids)
+				offset = 0
+			}
 
 			for _, id := range ids {
+				if afterId != `` && id <= afterId {
+					continue
+				}
+
 				// retrieve the record by id
-				if record, err := self.Retrieve(collection.Name, id); err == nil {
+				if record, err := self.retrieve(collection, id); err == nil {
 					record.ID = stringutil.Autotype(record.ID)
 
 					// if matching all records OR the found record matches the filter
 					if filter.MatchesRecord(record) {
+						scoreRecord(filter, record)
+
 						if processed >= offset {
 							querylog.Debugf("[%T] Record %v matches filter %q", self, record.ID, filter.String())
+							matched += 1
 
 							if err := resultFn(record, err, IndexPage{
 								Page:         page,
@@ -80,11 +101,15 @@ func (self *FilesystemBackend) QueryFunc(collection *dal.Collection, filter *fil
 								Limit:        filter.Limit,
 								Offset:       offset,
 								TotalResults: -1,
+								NextCursor:   idCursorFor(id),
 							}); err != nil {
 								return err
 							}
 						}
 					}
+				} else if dal.IsNotExistError(err) {
+					// the record was removed since the IDs were listed
+					continue
 				} else {
 					if err := resultFn(dal.NewRecord(nil), err, IndexPage{
 						Page:         page,
@@ -100,7 +125,12 @@ func (self *FilesystemBackend) QueryFunc(collection *dal.Collection, filter *fil
 				processed += 1
 				page = int(float64(processed) / float64(filter.Limit))
 
-				if filter.Limit > 0 && processed >= (offset+filter.Limit) {
+				if filter.UsesCursor() {
+					if filter.Limit > 0 && matched >= filter.Limit {
+						querylog.Debugf("[%T] %d at or beyond limit %d, returning results", self, matched, filter.Limit)
+						break
+					}
+				} else if filter.Limit > 0 && processed >= (offset+filter.Limit) {
 					querylog.Debugf("[%T] %d at or beyond limit %d, returning results", self, processed, filter.Limit)
 					break
 				}
@@ -163,6 +193,11 @@ func (self *FilesystemBackend) ListValues(collection *dal.Collection, fields []s
 }
 
 func (self *FilesystemBackend) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
+	_, err := self.DeleteQueryCount(collection, f)
+	return err
+}
+
+func (self *FilesystemBackend) DeleteQueryCount(collection *dal.Collection, f *filter.Filter) (int, error) {
 	idsToRemove := make([]interface{}, 0)
 
 	if err := self.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
@@ -172,9 +207,9 @@ func (self *FilesystemBackend) DeleteQuery(collection *dal.Collection, f *filter
 
 		return nil
 	}); err == nil {
-		return self.Delete(collection.Name, idsToRemove...)
+		return len(idsToRemove), self.Delete(collection.Name, idsToRemove...)
 	} else {
-		return err
+		return 0, err
 	}
 }
 
@@ -0,0 +1,167 @@
+package backends
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+func (self *FilesystemBackend) MigrationStatements(step dal.MigrationStep) ([]string, error) {
+	if err := step.Validate(); err != nil {
+		return nil, err
+	}
+
+	if collection, err := self.GetCollection(step.Collection); err == nil {
+		stmts := make([]string, 0)
+		dir := filepath.Join(self.root, collection.Name)
+
+		if fsMigrationTouchesRecords(step) {
+			stmts = append(stmts, fmt.Sprintf("rewrite records in %s: %v", filepath.Join(dir, self.recordSubdir), step))
+		}
+
+		if step.Operation != dal.BackfillOperation {
+			stmts = append(stmts, fmt.Sprintf("rewrite schema %s", filepath.Join(dir, self.makeFilename(collection, `schema`, false))))
+		}
+
+		return stmts, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *FilesystemBackend) ApplyMigrationStep(step dal.MigrationStep) error {
+	if err := step.Validate(); err != nil {
+		return err
+	}
+
+	collection, err := self.GetCollection(step.Collection)
+
+	if err != nil {
+		return err
+	}
+
+	// make sure the schema change is valid before touching any records
+	updated := *collection
+	updated.Fields = append([]dal.Field(nil), collection.Fields...)
+
+	if err := step.ApplyToCollection(&updated); err != nil {
+		return err
+	}
+
+	if fsMigrationTouchesRecords(step) {
+		flt := filter.All()
+
+		if step.Filter != `` {
+			if f, err := filter.Parse(step.Filter); err == nil {
+				flt = f
+			} else {
+				return err
+			}
+		}
+
+		if ids, err := self.listObjectIdsInCollection(collection); err == nil {
+			changed := dal.NewRecordSet()
+
+			for _, id := range ids {
+				var record dal.Record
+
+				if err := self.readObject(collection, id, true, &record); err != nil {
+					return err
+				}
+
+				if ok, err := fsMigrateRecord(step, flt, &record); err == nil && ok {
+					if err := self.writeObject(collection, id, true, &record); err != nil {
+						return err
+					}
+
+					self.recordCache.Remove(fmt.Sprintf("%v|%v", collection.Name, id))
+					changed.Push(&record)
+				} else if err != nil {
+					return fmt.Errorf("record %v: %v", id, err)
+				}
+			}
+
+			if search := self.WithSearch(collection); search != nil && len(changed.Records) > 0 {
+				if err := search.Index(collection, changed); err != nil {
+					return err
+				}
+			}
+		} else {
+			return err
+		}
+	}
+
+	if step.Operation == dal.BackfillOperation {
+		return nil
+	}
+
+	if err := step.ApplyToCollection(collection); err != nil {
+		return err
+	}
+
+	return self.writeObject(collection, `schema`, false, collection)
+}
+
+// returns whether the given step requires existing records to be rewritten.
+func fsMigrationTouchesRecords(step dal.MigrationStep) bool {
+	switch step.Operation {
+	case dal.AddFieldOperation:
+		return (step.Definition.DefaultValue != nil)
+	default:
+		return true
+	}
+}
+
+// applies the given step to a single record, returning whether the record was modified.
+func fsMigrateRecord(step dal.MigrationStep, flt *filter.Filter, record *dal.Record) (bool, error) {
+	if record.Fields == nil {
+		record.Fields = make(map[string]interface{})
+	}
+
+	name := step.FieldName()
+	value, exists := record.Fields[name]
+
+	switch step.Operation {
+	case dal.AddFieldOperation:
+		if !exists {
+			record.Fields[name] = step.Definition.GetDefaultValue()
+			return true, nil
+		}
+
+	case dal.RenameFieldOperation:
+		if exists {
+			record.Fields[step.To] = value
+			delete(record.Fields, name)
+			return true, nil
+		}
+
+	case dal.DropFieldOperation:
+		if exists {
+			delete(record.Fields, name)
+			return true, nil
+		}
+
+	case dal.ChangeTypeOperation:
+		if exists {
+			if converted, err := step.Definition.ConvertValue(value); err == nil {
+				record.Fields[name] = converted
+				return true, nil
+			} else {
+				return false, err
+			}
+		}
+
+	case dal.BackfillOperation:
+		if flt.MatchesRecord(record) {
+			for k, v := range step.Set {
+				record.Fields[k] = v
+			}
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,303 @@
+package backends
+
+// this file satifies the TransactionalBackend interface for FilesystemBackend
+
+import (
+	"fmt"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+type fsJournalEntry struct {
+	collection *dal.Collection
+	id         string
+	record     *dal.Record // the record to write, or nil if the record is being deleted
+	before     *dal.Record // the record as it existed on disk before this entry was applied
+	applied    bool
+}
+
+// A FilesystemTransaction emulates transactions for the filesystem backend by recording all
+// writes to an in-memory journal.  Records read with Retrieve and Exists reflect the journaled
+// changes, but queries (made with WithSearch) only see records that have been committed, and
+// nothing is written to disk until Commit is called.  Records deleted with DeleteQuery are
+// journaled like any other delete.  If any journaled write fails during Commit, all writes that
+// were already applied are reverted.
+type FilesystemTransaction struct {
+	*FilesystemBackend
+	journal []*fsJournalEntry
+	overlay map[string]*fsJournalEntry
+	done    bool
+}
+
+func (self *FilesystemBackend) Begin() (Transaction, error) {
+	return &FilesystemTransaction{
+		FilesystemBackend: self,
+		journal:           make([]*fsJournalEntry, 0),
+		overlay:           make(map[string]*fsJournalEntry),
+	}, nil
+}
+
+func (self *FilesystemTransaction) Begin() (Transaction, error) {
+	return nil, fmt.Errorf("nested transactions are not supported")
+}
+
+func (self *FilesystemTransaction) Insert(collectionName string, recordset *dal.RecordSet) error {
+	seen := make(map[string]bool)
+
+	for _, record := range recordset.Records {
+		if key := self.key(collectionName, record.ID); seen[key] || self.Exists(collectionName, record.ID) {
+			return fmt.Errorf("Record %q already exists", record.ID)
+		} else {
+			seen[key] = true
+		}
+	}
+
+	return self.Update(collectionName, recordset)
+}
+
+func (self *FilesystemTransaction) Update(name string, recordset *dal.RecordSet, target ...string) error {
+	if err := self.checkDone(); err != nil {
+		return err
+	} else if len(target) > 0 {
+		return fmt.Errorf("updating target fields is not supported in filesystem transactions")
+	}
+
+	if collection, err := self.GetCollection(name); err == nil {
+		for _, record := range recordset.Records {
+			if r, err := collection.StructToRecord(record); err == nil {
+				self.append(collection, fmt.Sprintf("%v", r.ID), r)
+			} else {
+				return err
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *FilesystemTransaction) Upsert(name string, recordset *dal.RecordSet) error {
+	return self.Update(name, recordset)
+}
+
+func (self *FilesystemTransaction) Delete(name string, ids ...interface{}) error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	if collection, err := self.GetCollection(name); err == nil {
+		if identities, err := fsRecordIdentities(collection, ids, func(identity interface{}) (*dal.Record, error) {
+			return self.Retrieve(name, identity)
+		}); err == nil {
+			for _, identity := range identities {
+				self.append(collection, fmt.Sprintf("%v", identity), nil)
+			}
+
+			return nil
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+func (self *FilesystemTransaction) Exists(name string, id interface{}) bool {
+	if record, ok := id.(*dal.Record); ok {
+		id = record.ID
+	}
+
+	if entry, ok := self.overlay[self.key(name, id)]; ok {
+		return (entry.record != nil)
+	}
+
+	return self.FilesystemBackend.Exists(name, id)
+}
+
+func (self *FilesystemTransaction) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
+	if entry, ok := self.overlay[self.key(name, id)]; ok {
+		if entry.record == nil {
+			return nil, fmt.Errorf("Record %q does not exist", fmt.Sprintf("%v", id))
+		}
+
+		record := dal.NewRecord(nil)
+
+		if err := record.Copy(entry.record); err != nil {
+			return nil, err
+		}
+
+		if err := self.prepareIncomingRecord(name, record); err != nil {
+			return nil, err
+		}
+
+		return record.OnlyFields(fields), nil
+	}
+
+	if record, err := self.FilesystemBackend.Retrieve(name, id); err == nil && len(fields) > 0 {
+		// the backend may return its cached copy of the record, so only a copy is trimmed
+		trimmed := dal.NewRecord(nil)
+
+		if err := trimmed.Copy(record); err != nil {
+			return nil, err
+		}
+
+		return trimmed.OnlyFields(fields), nil
+	} else {
+		return record, err
+	}
+}
+
+// Returns an indexer that queries the records that have been committed, and journals the records
+// removed by DeleteQuery instead of deleting them immediately.
+func (self *FilesystemTransaction) WithSearch(collection *dal.Collection, filters ...*filter.Filter) Indexer {
+	if indexer := self.FilesystemBackend.WithSearch(collection, filters...); indexer != nil {
+		return &fsTransactionIndexer{
+			Indexer: indexer,
+			tx:      self,
+		}
+	} else {
+		return nil
+	}
+}
+
+// Apply all journaled writes to disk.  If any write fails, previously-applied writes are reverted
+// to the state they were in before the commit began.
+func (self *FilesystemTransaction) Commit() error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	self.done = true
+
+	for _, entry := range self.journal {
+		if before, err := self.FilesystemBackend.Retrieve(entry.collection.Name, entry.id); err == nil {
+			entry.before = before
+		}
+
+		var err error
+
+		if entry.record != nil {
+			err = self.FilesystemBackend.Update(entry.collection.Name, dal.NewRecordSet(entry.record))
+		} else {
+			err = self.FilesystemBackend.Delete(entry.collection.Name, entry.id)
+		}
+
+		if err == nil {
+			entry.applied = true
+		} else {
+			if rerr := self.revert(); rerr != nil {
+				return fmt.Errorf("commit failed: %v (revert also failed: %v)", err, rerr)
+			}
+
+			return fmt.Errorf("commit failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Discard all journaled writes.
+func (self *FilesystemTransaction) Rollback() error {
+	if err := self.checkDone(); err != nil {
+		return err
+	}
+
+	self.done = true
+	self.journal = nil
+	self.overlay = nil
+
+	return nil
+}
+
+func (self *FilesystemTransaction) revert() error {
+	var lastErr error
+
+	for i := len(self.journal) - 1; i >= 0; i-- {
+		entry := self.journal[i]
+
+		if !entry.applied {
+			continue
+		}
+
+		var err error
+
+		if entry.before == nil {
+			err = self.FilesystemBackend.Delete(entry.collection.Name, entry.id)
+		} else {
+			err = self.FilesystemBackend.Update(entry.collection.Name, dal.NewRecordSet(entry.before))
+		}
+
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func (self *FilesystemTransaction) append(collection *dal.Collection, id string, record *dal.Record) {
+	entry := &fsJournalEntry{
+		collection: collection,
+		id:         id,
+		record:     record,
+	}
+
+	self.journal = append(self.journal, entry)
+	self.overlay[self.key(collection.Name, id)] = entry
+}
+
+func (self *FilesystemTransaction) key(collectionName string, id interface{}) string {
+	return fmt.Sprintf("%v|%v", collectionName, id)
+}
+
+func (self *FilesystemTransaction) checkDone() error {
+	if self.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+
+	return nil
+}
+
+type fsTransactionIndexer struct {
+	Indexer
+	tx *FilesystemTransaction
+}
+
+func (self *fsTransactionIndexer) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
+	_, err := self.DeleteQueryCount(collection, f)
+	return err
+}
+
+func (self *fsTransactionIndexer) DeleteQueryCount(collection *dal.Collection, f *filter.Filter) (int, error) {
+	if err := self.tx.checkDone(); err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0)
+
+	if err := self.Indexer.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil {
+			ids = append(ids, fmt.Sprintf("%v", record.ID))
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	for _, id := range ids {
+		// records already deleted within the transaction are left alone
+		if entry, ok := self.tx.overlay[self.tx.key(collection.Name, id)]; ok && entry.record == nil {
+			continue
+		}
+
+		self.tx.append(collection, id, nil)
+		deleted += 1
+	}
+
+	return deleted, nil
+}
@@ -6,10 +6,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/PerformLine/go-stockutil/pathutil"
+	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/ghodss/yaml"
@@ -56,6 +58,8 @@ func NewFilesystemBackend(connection dal.ConnectionString) Backend {
 func (self *FilesystemBackend) Supports(features ...BackendFeature) bool {
 	for _, feat := range features {
 		switch feat {
+		case Transactional:
+			return true
 		default:
 			return false
 		}
@@ -105,6 +109,11 @@ func (self *FilesystemBackend) SetIndexer(indexConnString dal.ConnectionString)
 	}
 }
 
+func (self *FilesystemBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
 func (self *FilesystemBackend) Initialize() error {
 	switch self.conn.Protocol() {
 	case `yaml`:
@@ -179,6 +188,11 @@ func (self *FilesystemBackend) Insert(collectionName string, recordset *dal.Reco
 	return self.Update(collectionName, recordset)
 }
 
+// Writing a record's file replaces any existing one, so upserts are the same as updates.
+func (self *FilesystemBackend) Upsert(collectionName string, recordset *dal.RecordSet) error {
+	return self.Update(collectionName, recordset)
+}
+
 func (self *FilesystemBackend) Exists(name string, id interface{}) bool {
 	if collection, err := self.GetCollection(name); err == nil {
 		if dataRoot, err := self.getDataRoot(collection.Name, true); err == nil {
@@ -189,6 +203,12 @@ func (self *FilesystemBackend) Exists(name string, id interface{}) bool {
 			if filename := self.makeFilename(collection, fmt.Sprintf("%v", id), true); filename != `` {
 				if stat, err := os.Stat(filepath.Join(dataRoot, filename)); err == nil {
 					if stat.Size() > 0 {
+						// expired records are still on disk, so they must be read to be ruled out
+						if collection.TimeToLiveField != `` {
+							_, err := self.Retrieve(name, id)
+							return (err == nil)
+						}
+
 						return true
 					}
 				}
@@ -201,20 +221,29 @@ func (self *FilesystemBackend) Exists(name string, id interface{}) bool {
 
 func (self *FilesystemBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
 	if collection, err := self.GetCollection(name); err == nil {
-		var record dal.Record
-
-		if err := self.readObject(collection, fmt.Sprintf("%v", id), true, &record); err == nil {
-			if err := self.prepareIncomingRecord(collection.Name, &record); err != nil {
-				return nil, err
-			}
+		if record, err := self.retrieve(collection, id); err == nil {
+			return unlessExpired(collection, id, record)
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
 
-			// add/touch item in cache for rapid readback if necessary
-			self.recordCache.Add(fmt.Sprintf("%v|%v", collection.Name, record.ID), &record)
+// reads the given record from disk, whether or not it has expired.
+func (self *FilesystemBackend) retrieve(collection *dal.Collection, id interface{}) (*dal.Record, error) {
+	var record dal.Record
 
-			return &record, nil
-		} else {
+	if err := self.readObject(collection, fmt.Sprintf("%v", id), true, &record); err == nil {
+		if err := self.prepareIncomingRecord(collection.Name, &record); err != nil {
 			return nil, err
 		}
+
+		// add/touch item in cache for rapid readback if necessary
+		self.recordCache.Add(fmt.Sprintf("%v|%v", collection.Name, record.ID), &record)
+
+		return &record, nil
 	} else {
 		return nil, err
 	}
@@ -251,13 +280,27 @@ func (self *FilesystemBackend) Update(name string, recordset *dal.RecordSet, tar
 
 func (self *FilesystemBackend) Delete(name string, ids ...interface{}) error {
 	if collection, err := self.GetCollection(name); err == nil {
+		var removed []interface{}
+
 		// remove documents from index
 		if search := self.WithSearch(collection); search != nil {
-			defer search.IndexRemove(collection, ids)
+			defer func() {
+				search.IndexRemove(collection, removed)
+			}()
+		}
+
+		identities, err := fsRecordIdentities(collection, ids, func(identity interface{}) (*dal.Record, error) {
+			return self.retrieve(collection, identity)
+		})
+
+		if err != nil {
+			return err
 		}
 
 		if dataRoot, err := self.getDataRoot(collection.Name, true); err == nil {
-			for _, id := range ids {
+			for _, id := range identities {
+				removed = append(removed, id)
+
 				if filename := self.makeFilename(collection, fmt.Sprintf("%v", id), true); filename != `` {
 					os.Remove(filepath.Join(dataRoot, filename))
 				}
@@ -275,12 +318,44 @@ func (self *FilesystemBackend) Delete(name string, ids ...interface{}) error {
 	}
 }
 
+// Returns the identities that the records with the given IDs are stored under.  Records are stored
+// under their identity alone, so IDs in collections with composite keys must give the whole key (as
+// a slice or record), and only resolve if the rest of the key matches the record retrieved by the
+// given function.
+func fsRecordIdentities(collection *dal.Collection, ids []interface{}, retrieve func(identity interface{}) (*dal.Record, error)) ([]interface{}, error) {
+	identities := make([]interface{}, 0, len(ids))
+
+	for _, id := range ids {
+		if collection.KeyCount() > 1 {
+			if keys, err := collection.KeyValues(id); err == nil {
+				if stored, err := retrieve(keys[0]); err == nil {
+					if reflect.DeepEqual(sliceutil.Stringify(stored.Keys(collection)), sliceutil.Stringify(keys)) {
+						identities = append(identities, keys[0])
+					}
+				}
+			} else {
+				return nil, err
+			}
+		} else if record, ok := id.(*dal.Record); ok {
+			identities = append(identities, record.ID)
+		} else {
+			identities = append(identities, id)
+		}
+	}
+
+	return identities, nil
+}
+
 func (self *FilesystemBackend) WithSearch(collection *dal.Collection, filters ...*filter.Filter) Indexer {
 	return self.indexer
 }
 
 func (self *FilesystemBackend) WithAggregator(collection *dal.Collection) Aggregator {
-	return nil
+	if agg, ok := self.indexer.(Aggregator); ok {
+		return agg
+	}
+
+	return newFallbackAggregator(self.indexer, &self.conn)
 }
 
 func (self *FilesystemBackend) ListCollections() ([]string, error) {
@@ -319,6 +394,8 @@ func (self *FilesystemBackend) CreateCollection(definition *dal.Collection) erro
 func (self *FilesystemBackend) DeleteCollection(name string) error {
 	if _, err := self.GetCollection(name); err == nil {
 		if datadir, err := self.getDataRoot(name, false); err == nil {
+			delete(self.registeredCollections, name)
+
 			if _, err := os.Stat(datadir); os.IsNotExist(err) {
 				return nil
 			}
@@ -367,15 +444,23 @@ func (self *FilesystemBackend) Flush() error {
 }
 
 func (self *FilesystemBackend) readSchemaFromDisk(name string) (*dal.Collection, error) {
-	schemaDesc := filepath.Join(self.root, name, `schema.json`)
+	schemaDesc := filepath.Join(self.root, name, self.makeFilename(nil, `schema`, false))
 
 	querylog.Debugf("[%T] Read schema definition at %v", self, schemaDesc)
 
-	if file, err := os.Open(schemaDesc); err == nil {
-		defer file.Close()
+	if data, err := ioutil.ReadFile(schemaDesc); err == nil {
 		var schema dal.Collection
 
-		if err := json.NewDecoder(file).Decode(&schema); err == nil {
+		switch self.format {
+		case FormatYAML:
+			err = yaml.Unmarshal(data, &schema)
+		case FormatJSON:
+			err = json.Unmarshal(data, &schema)
+		default:
+			err = fmt.Errorf("Not Implemented")
+		}
+
+		if err == nil {
 			return &schema, nil
 		} else {
 			return nil, err
@@ -0,0 +1,52 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemCompositeKeyDelete(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-composite-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestFilesystemCompositeKeyDelete`,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `account`,
+				Type: dal.StringType,
+				Key:  true,
+			},
+		},
+	}
+
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`account`, `x`),
+		dal.NewRecord(`b`).Set(`account`, `y`),
+		dal.NewRecord(`c`).Set(`account`, `z`),
+	)))
+
+	// keys that don't match the stored record leave it alone
+	assert.NoError(backend.Delete(collection.Name, []interface{}{`a`, `y`}))
+	assert.True(backend.Exists(collection.Name, `a`))
+
+	assert.NoError(backend.Delete(collection.Name, []string{`a`, `x`}, dal.NewRecord(`b`).Set(`account`, `y`)))
+	assert.False(backend.Exists(collection.Name, `a`))
+	assert.False(backend.Exists(collection.Name, `b`))
+	assert.True(backend.Exists(collection.Name, `c`))
+
+	// the whole key is required, so a lone identity deletes nothing
+	assert.Error(backend.Delete(collection.Name, `c`))
+	assert.True(backend.Exists(collection.Name, `c`))
+}
@@ -0,0 +1,353 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+// The field that the start of each bucket is returned as in histogram results.
+var HistogramBucketField = `bucket`
+
+// The maximum number of buckets a single histogram may return.
+var MaxHistogramBuckets = 10000
+
+type HistogramInterval string
+
+const (
+	MinuteInterval HistogramInterval = `minute`
+	HourInterval   HistogramInterval = `hour`
+	DayInterval    HistogramInterval = `day`
+	WeekInterval   HistogramInterval = `week`
+	MonthInterval  HistogramInterval = `month`
+	YearInterval   HistogramInterval = `year`
+)
+
+// Parses the name of a HistogramInterval (e.g.: "hour", "day", "week").
+func ParseHistogramInterval(name string) (HistogramInterval, error) {
+	switch interval := HistogramInterval(strings.ToLower(name)); interval {
+	case MinuteInterval, HourInterval, DayInterval, WeekInterval, MonthInterval, YearInterval:
+		return interval, nil
+	default:
+		return ``, fmt.Errorf("Unsupported histogram interval %q", name)
+	}
+}
+
+// Returns the start of the bucket that the given time falls into, in the given location.  Weeks
+// start on Monday.
+func (self HistogramInterval) Truncate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+
+	switch self {
+	case MinuteInterval:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	case HourInterval:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case WeekInterval:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case MonthInterval:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case YearInterval:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// Returns the start of the bucket following the one starting at the given time.
+func (self HistogramInterval) Next(bucket time.Time) time.Time {
+	switch self {
+	case MinuteInterval:
+		return bucket.Add(time.Minute)
+	case HourInterval:
+		return bucket.Add(time.Hour)
+	case WeekInterval:
+		return bucket.AddDate(0, 0, 7)
+	case MonthInterval:
+		return bucket.AddDate(0, 1, 0)
+	case YearInterval:
+		return bucket.AddDate(1, 0, 0)
+	default:
+		return bucket.AddDate(0, 0, 1)
+	}
+}
+
+// Describes a histogram of the records in a collection, bucketed by the value of a time field.
+type DateHistogramQuery struct {
+	Field      string             // the time field to bucket records by
+	Interval   HistogramInterval  // the size of each bucket
+	Location   *time.Location     // the time zone buckets are aligned to; defaults to UTC
+	Start      time.Time          // if non-zero, only records at or after this time are included
+	End        time.Time          // if non-zero, only records before this time are included
+	Aggregates []filter.Aggregate // calculated for each bucket; defaults to counting records
+	Filter     *filter.Filter     // selects the records to include
+}
+
+// Implemented by aggregators that can calculate date histograms natively.  Implementations may
+// return NotImplementedError for queries they cannot perform, in which case the histogram is
+// calculated from the collection's indexer instead.
+type HistogramAggregator interface {
+	DateHistogram(ctx context.Context, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error)
+}
+
+// Returns a record for each bucket between the first and last records matching the query (or the
+// query's bounds, if given), containing the start of the bucket and the result of each aggregate.
+// Buckets containing no records are included, with a count and sum of zero.
+func DateHistogram(ctx context.Context, backend Backend, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	if aggregator := backend.WithAggregator(collection); aggregator != nil {
+		if ha, ok := aggregator.(HistogramAggregator); ok {
+			if recordset, err := ha.DateHistogram(ctx, collection, query); err != NotImplementedError {
+				return recordset, err
+			}
+		}
+	}
+
+	if indexer := backend.WithSearch(collection); indexer != nil {
+		return IndexerDateHistogram(ctx, indexer, collection, query)
+	} else {
+		return nil, fmt.Errorf("backend %v cannot calculate histograms for collection %q", backend, collection.Name)
+	}
+}
+
+// Calculates a date histogram by reading all matching records from the given indexer.
+func IndexerDateHistogram(ctx context.Context, indexer Indexer, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	f := query.sourceFilter(false)
+	f.Fields = []string{query.Field}
+
+	for _, aggregate := range query.Aggregates {
+		if !collection.IsIdentityField(aggregate.Field) && aggregate.Field != filter.DefaultIdentityField {
+			f.Fields = append(f.Fields, aggregate.Field)
+		}
+	}
+
+	buckets := make(map[int64][]*dal.Record)
+
+	if err := QueryFuncContext(ctx, indexer, collection, f, func(record *dal.Record, err error, _ IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		if value := record.Get(query.Field); value != nil {
+			if t, err := histogramTime(collection.ConvertValue(query.Field, value)); err == nil {
+				// some backends (e.g.: SQL) read missing times back as the zero time, which native
+				// implementations leave out of the histogram
+				if !t.IsZero() && query.contains(t) {
+					bucket := query.Interval.Truncate(t, query.Location).Unix()
+					buckets[bucket] = append(buckets[bucket], record)
+				}
+			} else {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	results := make([]*dal.Record, 0, len(buckets))
+
+	for bucket, records := range buckets {
+		result := dal.NewRecord(nil).Set(HistogramBucketField, time.Unix(bucket, 0))
+
+		for _, aggregate := range query.Aggregates {
+			if value, err := memoryAggregate(collection, records, aggregate); err == nil {
+				result.Set(aggregate.ResultName(), value)
+			} else {
+				return nil, err
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return histogramRecordSet(query, results)
+}
+
+func (self *DateHistogramQuery) normalize() error {
+	if self.Field == `` {
+		return fmt.Errorf("histogram must specify a field")
+	}
+
+	if self.Interval == `` {
+		self.Interval = DayInterval
+	} else if interval, err := ParseHistogramInterval(string(self.Interval)); err == nil {
+		self.Interval = interval
+	} else {
+		return err
+	}
+
+	if self.Location == nil {
+		self.Location = time.UTC
+	}
+
+	if len(self.Aggregates) == 0 {
+		aggregate, _ := filter.ParseAggregate(`count`)
+		self.Aggregates = []filter.Aggregate{aggregate}
+	}
+
+	if !self.Start.IsZero() && !self.End.IsZero() && !self.End.After(self.Start) {
+		return fmt.Errorf("histogram end must be after its start")
+	}
+
+	return nil
+}
+
+// returns a copy of the query's filter suitable for selecting the records to bucket, optionally
+// limited to the query's bounds.
+func (self *DateHistogramQuery) sourceFilter(bounded bool) *filter.Filter {
+	f := aggregationFilter(self.Filter)
+
+	if bounded {
+		if !self.Start.IsZero() {
+			f.AddCriteria(filter.Criterion{
+				Type:     dal.TimeType,
+				Field:    self.Field,
+				Operator: `gte`,
+				Values:   []interface{}{self.Start.UTC()},
+			})
+		}
+
+		if !self.End.IsZero() {
+			f.AddCriteria(filter.Criterion{
+				Type:     dal.TimeType,
+				Field:    self.Field,
+				Operator: `lt`,
+				Values:   []interface{}{self.End.UTC()},
+			})
+		}
+
+		if len(f.Criteria) > 0 {
+			f.MatchAll = false
+		}
+	}
+
+	return f
+}
+
+func (self *DateHistogramQuery) contains(t time.Time) bool {
+	if !self.Start.IsZero() && t.Before(self.Start) {
+		return false
+	} else if !self.End.IsZero() && !t.Before(self.End) {
+		return false
+	}
+
+	return true
+}
+
+// sorts the given buckets, fills in any that are missing, and normalizes their values so that
+// every implementation returns the same results.
+func histogramRecordSet(query *DateHistogramQuery, buckets []*dal.Record) (*dal.RecordSet, error) {
+	byStart := make(map[int64]*dal.Record)
+	var first, last time.Time
+
+	for _, record := range buckets {
+		if t, err := histogramTime(record.Get(HistogramBucketField)); err == nil {
+			t = query.Interval.Truncate(t, query.Location)
+			byStart[t.Unix()] = record
+
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+
+			if last.IsZero() || t.After(last) {
+				last = t
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	if !query.Start.IsZero() {
+		first = query.Interval.Truncate(query.Start, query.Location)
+	}
+
+	if !query.End.IsZero() {
+		last = query.Interval.Truncate(query.End.Add(-time.Nanosecond), query.Location)
+	}
+
+	recordset := dal.NewRecordSet()
+
+	if first.IsZero() || last.IsZero() {
+		return recordset, nil
+	}
+
+	for bucket := first; !bucket.After(last); bucket = query.Interval.Next(bucket) {
+		if len(recordset.Records) >= MaxHistogramBuckets {
+			return nil, fmt.Errorf("histogram would return more than %d buckets", MaxHistogramBuckets)
+		}
+
+		record, ok := byStart[bucket.Unix()]
+
+		if !ok {
+			record = dal.NewRecord(nil)
+		}
+
+		result := dal.NewRecord(bucket).Set(HistogramBucketField, bucket)
+
+		for _, aggregate := range query.Aggregates {
+			name := aggregate.ResultName()
+			value := record.Get(name)
+
+			switch aggregate.Aggregation {
+			case filter.Count, filter.CountDistinct, filter.Cardinality:
+				value = typeutil.Int(value)
+			case filter.Sum:
+				value = typeutil.Float(value)
+			case filter.Average, filter.Percentile, filter.Median, filter.StdDev, filter.Variance:
+				if value != nil {
+					value = typeutil.Float(value)
+				}
+			}
+
+			result.Set(name, value)
+		}
+
+		recordset.Push(result)
+	}
+
+	recordset.KnownSize = true
+	return recordset, nil
+}
+
+// converts a bucket or field value returned by a backend into a time.
+func histogramTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		return histogramTime(string(v))
+	case string:
+		for _, layout := range []string{
+			time.RFC3339Nano,
+			`2006-01-02 15:04:05.999999999-07:00`,
+			`2006-01-02 15:04:05.999999999`,
+			`2006-01-02 15:04:05`,
+			`2006-01-02`,
+		} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	if t := typeutil.V(value).Time(); !t.IsZero() {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("cannot use %T value %v as a time", value, value)
+}
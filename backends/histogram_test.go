@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramIntervalTruncate(t *testing.T) {
+	assert := require.New(t)
+	at := time.Date(2024, 2, 29, 13, 45, 30, 0, time.UTC)
+
+	assert.Equal(time.Date(2024, 2, 29, 13, 45, 0, 0, time.UTC), MinuteInterval.Truncate(at, time.UTC))
+	assert.Equal(time.Date(2024, 2, 29, 13, 0, 0, 0, time.UTC), HourInterval.Truncate(at, time.UTC))
+	assert.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), DayInterval.Truncate(at, time.UTC))
+	assert.Equal(time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), WeekInterval.Truncate(at, time.UTC))
+	assert.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), MonthInterval.Truncate(at, time.UTC))
+	assert.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), YearInterval.Truncate(at, time.UTC))
+
+	// Sundays belong to the week that started the previous Monday
+	assert.Equal(
+		time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+		WeekInterval.Truncate(time.Date(2024, 3, 3, 23, 0, 0, 0, time.UTC), time.UTC),
+	)
+
+	assert.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), MonthInterval.Next(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+	_, err := ParseHistogramInterval(`fortnight`)
+	assert.Error(err)
+}
+
+func TestIndexerDateHistogram(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	collection, records := testAnalyticsCollection(`events`)
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, records))
+
+	total, _ := filter.ParseAggregate(`total=sum:value`)
+	count, _ := filter.ParseAggregate(`count`)
+
+	// empty days between the first and last records are filled in
+	results, err := DateHistogram(context.Background(), backend, collection, &DateHistogramQuery{
+		Field:      `at`,
+		Aggregates: []filter.Aggregate{count, total},
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 9)
+	assert.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), results.Records[0].Get(`bucket`))
+	assert.EqualValues(2, results.Records[0].Get(`count`))
+	assert.EqualValues(3, results.Records[0].Get(`total`))
+	assert.EqualValues(0, results.Records[1].Get(`count`))
+	assert.EqualValues(0, results.Records[1].Get(`total`))
+	assert.EqualValues(1, results.Records[2].Get(`count`))
+	assert.EqualValues(1, results.Records[8].Get(`count`))
+
+	// weeks start on Monday
+	results, err = DateHistogram(context.Background(), backend, collection, &DateHistogramQuery{
+		Field:    `at`,
+		Interval: WeekInterval,
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 2)
+	assert.EqualValues(3, results.Records[0].Get(`count`))
+	assert.Equal(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), results.Records[1].Get(`bucket`))
+	assert.EqualValues(1, results.Records[1].Get(`count`))
+
+	// bounds limit both the records and the buckets returned
+	results, err = DateHistogram(context.Background(), backend, collection, &DateHistogramQuery{
+		Field:  `at`,
+		Start:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		Filter: filter.MustParse(`value/gt:1`),
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 3)
+	assert.EqualValues(0, results.Records[0].Get(`count`))
+	assert.EqualValues(1, results.Records[1].Get(`count`))
+	assert.EqualValues(0, results.Records[2].Get(`count`))
+
+	// buckets are aligned to the requested time zone
+	ny, err := time.LoadLocation(`America/New_York`)
+	assert.NoError(err)
+
+	results, err = DateHistogram(context.Background(), backend, collection, &DateHistogramQuery{
+		Field:    `at`,
+		Location: ny,
+		Filter:   filter.MustParse(`value/lt:3`),
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+	assert.True(time.Date(2024, 1, 1, 0, 0, 0, 0, ny).Equal(results.Records[0].Get(`bucket`).(time.Time)))
+	assert.EqualValues(2, results.Records[0].Get(`count`))
+}
@@ -0,0 +1,187 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+// The default maximum number of records an IndexerAggregator will read to answer a single query.
+var IndexerAggregatorMaxRecords = 1000000
+
+// An IndexerAggregator calculates aggregates for backends that cannot do so natively by streaming
+// the matching records out of an Indexer, keeping only the running result of each aggregate (and
+// group) in memory.
+type IndexerAggregator struct {
+	MaxRecords int // if positive, queries that would read more than this many records fail
+	indexer    Indexer
+}
+
+func NewIndexerAggregator(indexer Indexer) *IndexerAggregator {
+	return &IndexerAggregator{
+		MaxRecords: IndexerAggregatorMaxRecords,
+		indexer:    indexer,
+	}
+}
+
+// returns an IndexerAggregator for backends without a native aggregator, or nil if there is no
+// indexer to read from.  The record limit can be set with the "aggregator_max_records" option.
+func newFallbackAggregator(indexer Indexer, conn *dal.ConnectionString) Aggregator {
+	if indexer == nil {
+		return nil
+	}
+
+	aggregator := NewIndexerAggregator(indexer)
+
+	if conn != nil {
+		aggregator.MaxRecords = int(conn.OptInt(`aggregator_max_records`, int64(aggregator.MaxRecords)))
+	}
+
+	return aggregator
+}
+
+func (self *IndexerAggregator) AggregatorConnectionString() *dal.ConnectionString {
+	return self.indexer.IndexConnectionString()
+}
+
+func (self *IndexerAggregator) AggregatorInitialize(parent Backend) error {
+	return nil
+}
+
+func (self *IndexerAggregator) Sum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Sum, field, f)
+}
+
+func (self *IndexerAggregator) Count(collection *dal.Collection, f ...*filter.Filter) (uint64, error) {
+	if value, err := self.aggregateOne(collection, filter.Count, filter.DefaultIdentityField, f); err == nil {
+		return uint64(typeutil.Int(value)), nil
+	} else {
+		return 0, err
+	}
+}
+
+func (self *IndexerAggregator) Minimum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Minimum, field, f)
+}
+
+func (self *IndexerAggregator) Maximum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Maximum, field, f)
+}
+
+func (self *IndexerAggregator) Average(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Average, field, f)
+}
+
+func (self *IndexerAggregator) GroupBy(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error) {
+	return self.GroupByContext(context.Background(), collection, groupBy, aggregates, f...)
+}
+
+// GroupByContext returns one record for each distinct combination of values in the groupBy
+// fields, in the order each combination was first seen.
+func (self *IndexerAggregator) GroupByContext(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
+	type group struct {
+		values       []interface{}
+		accumulators []*aggregateAccumulator
+	}
+
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+	scanned := 0
+
+	if err := QueryFuncContext(ctx, self.indexer, collection, self.sourceFilter(collection, groupBy, aggregates, flt), func(record *dal.Record, err error, _ IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		if scanned += 1; self.MaxRecords > 0 && scanned > self.MaxRecords {
+			return fmt.Errorf("aggregation would read more than %d records", self.MaxRecords)
+		}
+
+		values := memoryFieldValues(collection, record, groupBy)
+		key := strings.Join(sliceutil.Stringify(values), memoryKeySeparator)
+		g, ok := groups[key]
+
+		if !ok {
+			g = &group{
+				values: values,
+			}
+
+			for _, aggregate := range aggregates {
+				g.accumulators = append(g.accumulators, newAggregateAccumulator(collection, aggregate))
+			}
+
+			groups[key] = g
+			order = append(order, key)
+		}
+
+		for _, acc := range g.accumulators {
+			if err := acc.Add(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	recordset := dal.NewRecordSet()
+
+	for _, key := range order {
+		g := groups[key]
+		result := dal.NewRecord(nil)
+
+		for i, field := range groupBy {
+			result.Set(field, g.values[i])
+		}
+
+		for i, aggregate := range aggregates {
+			result.Set(aggregate.ResultName(), g.accumulators[i].Value())
+		}
+
+		recordset.Push(result)
+	}
+
+	return recordset, nil
+}
+
+// builds the query used to read records, which only retrieves the fields being grouped on and
+// aggregated.  (Filters that only select the identity field are treated as ID lookups by some
+// indexers, so in that case every field is retrieved.)
+func (self *IndexerAggregator) sourceFilter(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt []*filter.Filter) *filter.Filter {
+	f := aggregationFilter(memoryAggregateFilter(flt))
+
+	for _, field := range groupBy {
+		if field != filter.DefaultIdentityField && !collection.IsIdentityField(field) {
+			f.Fields = append(f.Fields, field)
+		}
+	}
+
+	for _, aggregate := range aggregates {
+		if aggregate.Field != filter.DefaultIdentityField && !collection.IsIdentityField(aggregate.Field) {
+			f.Fields = append(f.Fields, aggregate.Field)
+		}
+	}
+
+	return f
+}
+
+func (self *IndexerAggregator) aggregateOne(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (interface{}, error) {
+	return AggregateValue(context.Background(), self, collection, filter.Aggregate{
+		Aggregation: aggregation,
+		Field:       field,
+	}, flt...)
+}
+
+func (self *IndexerAggregator) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (float64, error) {
+	if value, err := self.aggregateOne(collection, aggregation, field, flt); err == nil {
+		return typeutil.Float(value), nil
+	} else {
+		return 0, err
+	}
+}
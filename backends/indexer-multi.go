@@ -1,11 +1,16 @@
 package backends
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/PerformLine/pivot/v3/util"
 )
 
 type IndexSelectionStrategy int
@@ -18,6 +23,38 @@ const (
 	Random
 )
 
+var indexSelectionStrategyNames = map[IndexSelectionStrategy]string{
+	Sequential:     `sequential`,
+	All:            `all`,
+	First:          `first`,
+	AllExceptFirst: `all-except-first`,
+	Random:         `random`,
+}
+
+// Parses the name of an IndexSelectionStrategy (e.g.: "sequential", "all-except-first").  An empty
+// string returns the given fallback strategy.
+func ParseIndexSelectionStrategy(name string, fallback IndexSelectionStrategy) (IndexSelectionStrategy, error) {
+	if name == `` {
+		return fallback, nil
+	}
+
+	for strategy, n := range indexSelectionStrategyNames {
+		if strings.EqualFold(strings.ReplaceAll(name, `_`, `-`), n) {
+			return strategy, nil
+		}
+	}
+
+	return fallback, fmt.Errorf("Unrecognized selection strategy %q", name)
+}
+
+func (self IndexSelectionStrategy) String() string {
+	if name, ok := indexSelectionStrategyNames[self]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("IndexSelectionStrategy(%d)", int(self))
+}
+
 func (self IndexSelectionStrategy) IsCompoundable() bool {
 	switch self {
 	case All, AllExceptFirst:
@@ -42,10 +79,19 @@ type MultiIndex struct {
 	DeleteStrategy     IndexSelectionStrategy
 	InspectionStrategy IndexSelectionStrategy
 	indexers           []Indexer
+	health             []*indexerHealth
+	healthLock         sync.Mutex
 	connectionStrings  []string
 	backend            Backend
 }
 
+type indexerHealth struct {
+	Errors      int
+	LastError   error
+	LastErrorAt time.Time
+	LastOkAt    time.Time
+}
+
 type IndexerResult struct {
 	Index   int
 	Indexer Indexer
@@ -62,7 +108,30 @@ func NewMultiIndex(connectionStrings ...string) *MultiIndex {
 		InspectionStrategy: All,
 		connectionStrings:  connectionStrings,
 		indexers:           make([]Indexer, 0),
+		health:             make([]*indexerHealth, 0),
+	}
+}
+
+// Sets the selection strategy for each operation from the names given in the options, leaving
+// the current strategy in place for any that aren't specified.
+func (self *MultiIndex) SetStrategies(options ConnectOptions) error {
+	for _, strategy := range []struct {
+		name  string
+		value *IndexSelectionStrategy
+	}{
+		{options.RetrievalStrategy, &self.RetrievalStrategy},
+		{options.PersistStrategy, &self.PersistStrategy},
+		{options.DeleteStrategy, &self.DeleteStrategy},
+		{options.InspectionStrategy, &self.InspectionStrategy},
+	} {
+		if s, err := ParseIndexSelectionStrategy(strategy.name, *strategy.value); err == nil {
+			*strategy.value = s
+		} else {
+			return err
+		}
 	}
+
+	return nil
 }
 
 func (self *MultiIndex) AddIndexer(indexer Indexer) error {
@@ -73,10 +142,23 @@ func (self *MultiIndex) AddIndexer(indexer Indexer) error {
 		}
 	}
 
-	self.indexers = append(self.indexers, indexer)
+	self.appendIndexer(indexer)
 	return nil
 }
 
+func (self *MultiIndex) appendIndexer(indexer Indexer) {
+	self.healthLock.Lock()
+	defer self.healthLock.Unlock()
+
+	self.indexers = append(self.indexers, indexer)
+	self.health = append(self.health, new(indexerHealth))
+}
+
+// Returns the indexers in the order they were added.
+func (self *MultiIndex) Indexers() []Indexer {
+	return self.indexers
+}
+
 func (self *MultiIndex) AddIndexerByConnectionString(cs string) error {
 	if ics, err := dal.ParseConnectionString(cs); err == nil {
 		if indexer, err := MakeIndexer(ics); err == nil {
@@ -87,7 +169,7 @@ func (self *MultiIndex) AddIndexerByConnectionString(cs string) error {
 				}
 			}
 
-			self.indexers = append(self.indexers, indexer)
+			self.appendIndexer(indexer)
 		} else {
 			return err
 		}
@@ -107,6 +189,13 @@ func (self *MultiIndex) IndexConnectionString() *dal.ConnectionString {
 }
 
 func (self *MultiIndex) IndexInitialize(backend Backend) error {
+	for _, indexer := range self.indexers {
+		if err := indexer.IndexInitialize(backend); err != nil {
+			return err
+		}
+	}
+
+	// indexers added from here on are initialized as they're added
 	self.backend = backend
 
 	for _, cs := range self.connectionStrings {
@@ -115,13 +204,66 @@ func (self *MultiIndex) IndexInitialize(backend Backend) error {
 		}
 	}
 
-	for _, indexer := range self.indexers {
-		if err := indexer.IndexInitialize(self.backend); err != nil {
-			return err
+	self.connectionStrings = nil
+	return nil
+}
+
+// Returns the current state of each indexer, in the order they were added.
+func (self *MultiIndex) Status() []util.IndexerStatus {
+	self.healthLock.Lock()
+	defer self.healthLock.Unlock()
+
+	statuses := make([]util.IndexerStatus, len(self.indexers))
+
+	for i, indexer := range self.indexers {
+		health := self.health[i]
+		status := util.IndexerStatus{
+			Index:   i,
+			Primary: (i == 0),
+			Healthy: (health.LastError == nil),
+			Errors:  health.Errors,
+		}
+
+		if cs := indexer.IndexConnectionString(); cs != nil {
+			status.Indexer = cs.String()
+		}
+
+		if health.LastError != nil {
+			lastErrorAt := health.LastErrorAt
+			status.LastError = health.LastError.Error()
+			status.LastErrorAt = &lastErrorAt
 		}
+
+		if !health.LastOkAt.IsZero() {
+			lastOkAt := health.LastOkAt
+			status.LastOkAt = &lastOkAt
+		}
+
+		statuses[i] = status
 	}
 
-	return nil
+	return statuses
+}
+
+// records the outcome of an operation performed against the indexer at the given index
+func (self *MultiIndex) track(index int, err error) error {
+	self.healthLock.Lock()
+	defer self.healthLock.Unlock()
+
+	if index >= 0 && index < len(self.health) {
+		health := self.health[index]
+
+		if err == nil {
+			health.LastError = nil
+			health.LastOkAt = time.Now()
+		} else {
+			health.Errors += 1
+			health.LastError = err
+			health.LastErrorAt = time.Now()
+		}
+	}
+
+	return err
 }
 
 func (self *MultiIndex) GetBackend() Backend {
@@ -171,8 +313,8 @@ func (self *MultiIndex) IndexRetrieve(collection *dal.Collection, id interface{}
 func (self *MultiIndex) IndexRemove(collection *dal.Collection, ids []interface{}) error {
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, DeleteOperation, func(indexer Indexer, _ int, _ int) error {
-		if err := indexer.IndexRemove(collection, ids); err != nil {
+	if err := self.EachSelectedIndex(collection, DeleteOperation, func(indexer Indexer, current int, _ int) error {
+		if err := self.track(current, indexer.IndexRemove(collection, ids)); err != nil {
 			querylog.Debugf("MultiIndex: Failed to remove IDs from %v from indexer %T: %v", collection, indexer, err)
 			indexErr = err
 		}
@@ -188,8 +330,8 @@ func (self *MultiIndex) IndexRemove(collection *dal.Collection, ids []interface{
 func (self *MultiIndex) Index(collection *dal.Collection, records *dal.RecordSet) error {
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, PersistOperation, func(indexer Indexer, _ int, _ int) error {
-		if err := indexer.Index(collection, records); err != nil {
+	if err := self.EachSelectedIndex(collection, PersistOperation, func(indexer Indexer, current int, _ int) error {
+		if err := self.track(current, indexer.Index(collection, records)); err != nil {
 			querylog.Debugf("MultiIndex: Failed to persist records in indexer %T: %v", indexer, err)
 			indexErr = err
 		}
@@ -203,15 +345,28 @@ func (self *MultiIndex) Index(collection *dal.Collection, records *dal.RecordSet
 }
 
 func (self *MultiIndex) QueryFunc(collection *dal.Collection, filter *filter.Filter, resultFn IndexResultFunc) error {
+	return self.QueryFuncContext(context.Background(), collection, filter, resultFn)
+}
+
+func (self *MultiIndex) QueryFuncContext(ctx context.Context, collection *dal.Collection, filter *filter.Filter, resultFn IndexResultFunc) error {
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, _ int, _ int) error {
-		if err := indexer.QueryFunc(collection, filter, resultFn); err == nil {
+	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, current int, _ int) error {
+		var streamed bool
+
+		if err := self.track(current, QueryFuncContext(ctx, indexer, collection, filter, func(record *dal.Record, err error, page IndexPage) error {
+			streamed = true
+			return resultFn(record, err, page)
+		})); err == nil {
 			querylog.Debugf("MultiIndex: Indexer query to %v/%v: %v", indexer, collection, filter)
+			indexErr = nil
 
-			if self.RetrievalStrategy.IsCompoundable() {
+			if !self.RetrievalStrategy.IsCompoundable() {
 				return IndexerResultsStop
 			}
+		} else if streamed && !self.RetrievalStrategy.IsCompoundable() {
+			// failing over now would send the caller the results it has already received again
+			return err
 		} else {
 			indexErr = err
 			querylog.Debugf("MultiIndex: Indexer query to %T/%v failed: %v", indexer, collection.GetIndexName(), err)
@@ -226,16 +381,24 @@ func (self *MultiIndex) QueryFunc(collection *dal.Collection, filter *filter.Fil
 }
 
 func (self *MultiIndex) Query(collection *dal.Collection, filter *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.QueryContext(context.Background(), collection, filter, resultFns...)
+}
+
+func (self *MultiIndex) QueryContext(ctx context.Context, collection *dal.Collection, filter *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	recordset := dal.NewRecordSet()
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, _ int, _ int) error {
-		if rs, err := indexer.Query(collection, filter, resultFns...); err == nil {
-			if !rs.IsEmpty() {
-				if self.RetrievalStrategy.IsCompoundable() {
-					recordset.Append(rs)
-				} else {
-					recordset = rs
+	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, current int, _ int) error {
+		if rs, err := QueryContext(ctx, indexer, collection, filter, resultFns...); self.track(current, err) == nil {
+			indexErr = nil
+
+			if self.RetrievalStrategy.IsCompoundable() {
+				recordset.Append(rs)
+			} else {
+				recordset = rs
+
+				// an empty resultset is a valid answer, but there's no harm in asking the next indexer
+				if !rs.IsEmpty() {
 					return IndexerResultsStop
 				}
 			}
@@ -256,8 +419,10 @@ func (self *MultiIndex) ListValues(collection *dal.Collection, fields []string,
 	values := make(map[string][]interface{})
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, _ int, _ int) error {
-		if kv, err := indexer.ListValues(collection, fields, filter); err == nil {
+	if err := self.EachSelectedIndex(collection, RetrieveOperation, func(indexer Indexer, current int, _ int) error {
+		if kv, err := indexer.ListValues(collection, fields, filter); self.track(current, err) == nil {
+			indexErr = nil
+
 			if len(kv) > 0 {
 				if self.RetrievalStrategy.IsCompoundable() {
 					for k, v := range kv {
@@ -288,8 +453,8 @@ func (self *MultiIndex) ListValues(collection *dal.Collection, fields []string,
 func (self *MultiIndex) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
 	var indexErr error
 
-	if err := self.EachSelectedIndex(collection, DeleteOperation, func(indexer Indexer, _ int, _ int) error {
-		if err := indexer.DeleteQuery(collection, f); err != nil {
+	if err := self.EachSelectedIndex(collection, DeleteOperation, func(indexer Indexer, current int, _ int) error {
+		if err := self.track(current, indexer.DeleteQuery(collection, f)); err != nil {
 			querylog.Debugf("MultiIndex: Failed to remove by query %v from %v, %v: %v", f, collection, indexer, err)
 			indexErr = err
 		}
@@ -326,49 +491,46 @@ func (self *MultiIndex) FlushIndex() error {
 	}
 }
 
+// Calls resultFn for each indexer selected by the strategy for the given operation.  With the
+// Sequential strategy, the next indexer is only selected if resultFn did not return
+// IndexerResultsStop, which is how failing over to another indexer is implemented.
 func (self *MultiIndex) EachSelectedIndex(collection *dal.Collection, operation IndexOperation, resultFn IndexerResultFunc) error {
 	lastIndexer := -1
 
 	for {
 		if results, err := self.SelectIndex(collection, operation, lastIndexer); err == nil {
+			if len(results) == 0 {
+				return nil
+			}
+
 			for _, result := range results {
-				if result.Indexer.IndexExists(collection, collection.GetIndexName()) {
-					if err := resultFn(result.Indexer, result.Index, lastIndexer); err != nil {
-						if err == IndexerResultsStop {
-							return nil
-						} else {
-							return err
-						}
+				if err := resultFn(result.Indexer, result.Index, lastIndexer); err != nil {
+					if err == IndexerResultsStop {
+						return nil
+					} else {
+						return err
 					}
 				}
 
 				lastIndexer = result.Index
 			}
 
+			if strategy, err := self.strategyFor(operation); err != nil {
+				return err
+			} else if strategy != Sequential {
+				return nil
+			}
 		} else {
 			return err
 		}
-
-		break
 	}
-
-	return nil
 }
 
 func (self *MultiIndex) SelectIndex(collection *dal.Collection, operation IndexOperation, lastIndexer int) ([]IndexerResult, error) {
-	var strategy IndexSelectionStrategy
+	strategy, err := self.strategyFor(operation)
 
-	switch operation {
-	case RetrieveOperation:
-		strategy = self.RetrievalStrategy
-	case PersistOperation:
-		strategy = self.PersistStrategy
-	case DeleteOperation:
-		strategy = self.DeleteStrategy
-	case InspectionOperation:
-		strategy = self.InspectionStrategy
-	default:
-		return nil, fmt.Errorf("Unrecognized index operation '%v'", operation)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(self.indexers) == 0 {
@@ -435,3 +597,18 @@ func (self *MultiIndex) SelectIndex(collection *dal.Collection, operation IndexO
 		return nil, fmt.Errorf("Unrecognized selection strategy '%v'", strategy)
 	}
 }
+
+func (self *MultiIndex) strategyFor(operation IndexOperation) (IndexSelectionStrategy, error) {
+	switch operation {
+	case RetrieveOperation:
+		return self.RetrievalStrategy, nil
+	case PersistOperation:
+		return self.PersistStrategy, nil
+	case DeleteOperation:
+		return self.DeleteStrategy, nil
+	case InspectionOperation:
+		return self.InspectionStrategy, nil
+	default:
+		return Sequential, fmt.Errorf("Unrecognized index operation '%v'", operation)
+	}
+}
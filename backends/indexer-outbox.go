@@ -0,0 +1,419 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+var DefaultOutboxWorkers = 4
+var DefaultOutboxMaxAttempts = 10
+var OutboxBatchSize = 100
+var OutboxPollInterval = time.Second
+var OutboxMinBackoff = 250 * time.Millisecond
+var OutboxMaxBackoff = 30 * time.Second
+var OutboxFlushTimeout = 30 * time.Second
+
+// Describes the state of an OutboxIndexer's queue.
+type OutboxStats struct {
+	Depth    int           `json:"depth"`    // the number of entries waiting to be indexed
+	Lag      time.Duration `json:"lag"`      // the age of the oldest entry waiting to be indexed
+	Applied  int64         `json:"applied"`  // the number of entries successfully indexed
+	Retries  int64         `json:"retries"`  // the number of times an entry has been retried
+	Failures int64         `json:"failures"` // the number of entries dropped after MaxAttempts
+}
+
+// An OutboxIndexer performs write-behind indexing for another Indexer.  Writes to the index are
+// appended to a durable IndexOutbox and return immediately; a pool of workers drains the outbox
+// into the wrapped indexer in the background, retrying failures with exponential backoff.  Entries
+// for the same collection are always applied in the order they were written.  Reads are passed
+// directly to the wrapped indexer, and so may not reflect writes that are still in the outbox.
+type OutboxIndexer struct {
+	Workers     int // the number of workers applying entries to the indexer
+	MaxAttempts int // if positive, entries that fail this many times are logged and dropped; otherwise they are retried forever
+	indexer     Indexer
+	outbox      IndexOutbox
+	parent      Backend
+	skip        string
+	stats       OutboxStats
+	statsLock   sync.Mutex
+	wake        chan bool
+	stop        chan bool
+	done        chan bool
+}
+
+func NewOutboxIndexer(indexer Indexer, outbox IndexOutbox) *OutboxIndexer {
+	return &OutboxIndexer{
+		Workers:     DefaultOutboxWorkers,
+		MaxAttempts: DefaultOutboxMaxAttempts,
+		indexer:     indexer,
+		outbox:      outbox,
+	}
+}
+
+// Returns the indexer that entries are applied to.
+func (self *OutboxIndexer) Indexer() Indexer {
+	return self.indexer
+}
+
+func (self *OutboxIndexer) IndexConnectionString() *dal.ConnectionString {
+	return self.indexer.IndexConnectionString()
+}
+
+func (self *OutboxIndexer) IndexInitialize(parent Backend) error {
+	self.parent = parent
+
+	if err := self.indexer.IndexInitialize(parent); err != nil {
+		return err
+	}
+
+	if err := self.outbox.Initialize(parent); err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+
+	// the outbox collection is written to the backend like any other, but must never be indexed
+	// (doing so would enqueue another entry for every entry enqueued)
+	if co, ok := self.outbox.(*CollectionOutbox); ok {
+		self.skip = co.Name
+	}
+
+	if self.Workers <= 0 {
+		self.Workers = 1
+	}
+
+	self.wake = make(chan bool, 1)
+	self.stop = make(chan bool)
+	self.done = make(chan bool)
+
+	go self.run()
+
+	return nil
+}
+
+func (self *OutboxIndexer) GetBackend() Backend {
+	return self.parent
+}
+
+func (self *OutboxIndexer) IndexExists(collection *dal.Collection, id interface{}) bool {
+	return self.indexer.IndexExists(collection, id)
+}
+
+func (self *OutboxIndexer) IndexRetrieve(collection *dal.Collection, id interface{}) (*dal.Record, error) {
+	return self.indexer.IndexRetrieve(collection, id)
+}
+
+func (self *OutboxIndexer) IndexRemove(collection *dal.Collection, ids []interface{}) error {
+	if collection.Name == self.skip {
+		return nil
+	}
+
+	return self.enqueue(&OutboxEntry{
+		Operation:  OutboxRemove,
+		Collection: collection.Name,
+		IDs:        ids,
+	})
+}
+
+func (self *OutboxIndexer) Index(collection *dal.Collection, records *dal.RecordSet) error {
+	if collection.Name == self.skip {
+		return nil
+	}
+
+	return self.enqueue(&OutboxEntry{
+		Operation:  OutboxIndex,
+		Collection: collection.Name,
+		Records:    records.Records,
+	})
+}
+
+func (self *OutboxIndexer) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	return self.indexer.QueryFunc(collection, f, resultFn)
+}
+
+func (self *OutboxIndexer) QueryFuncContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	return QueryFuncContext(ctx, self.indexer, collection, f, resultFn)
+}
+
+func (self *OutboxIndexer) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.indexer.Query(collection, f, resultFns...)
+}
+
+func (self *OutboxIndexer) QueryContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return QueryContext(ctx, self.indexer, collection, f, resultFns...)
+}
+
+func (self *OutboxIndexer) ListValues(collection *dal.Collection, fields []string, f *filter.Filter) (map[string][]interface{}, error) {
+	return self.indexer.ListValues(collection, fields, f)
+}
+
+func (self *OutboxIndexer) Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	return Facets(ctx, self.indexer, collection, query)
+}
+
+func (self *OutboxIndexer) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
+	if collection.Name == self.skip {
+		return nil
+	}
+
+	if data, err := json.Marshal(f); err == nil {
+		return self.enqueue(&OutboxEntry{
+			Operation:  OutboxDeleteQuery,
+			Collection: collection.Name,
+			Filter:     data,
+		})
+	} else {
+		return err
+	}
+}
+
+// Waits (up to OutboxFlushTimeout) for all entries in the outbox to be applied, then flushes the
+// wrapped indexer.
+func (self *OutboxIndexer) FlushIndex() error {
+	deadline := time.Now().Add(OutboxFlushTimeout)
+
+	for {
+		if depth, err := self.outbox.Len(); err == nil {
+			if depth == 0 {
+				break
+			} else if time.Now().After(deadline) {
+				return fmt.Errorf("outbox still contains %d entries after %v", depth, OutboxFlushTimeout)
+			}
+		} else {
+			return err
+		}
+
+		self.notify()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return self.indexer.FlushIndex()
+}
+
+// Returns the current state of the outbox.
+func (self *OutboxIndexer) Stats() OutboxStats {
+	self.statsLock.Lock()
+	defer self.statsLock.Unlock()
+
+	return self.stats
+}
+
+// Stops the workers and closes the outbox.  Entries that have not yet been applied remain in the
+// outbox and will be applied the next time it is opened.
+func (self *OutboxIndexer) Close() error {
+	if self.stop != nil {
+		close(self.stop)
+		<-self.done
+		self.stop = nil
+	}
+
+	return self.outbox.Close()
+}
+
+func (self *OutboxIndexer) enqueue(entry *OutboxEntry) error {
+	defer stats.NewTiming().Send(`pivot.indexers.outbox.append_time`)
+
+	entry.CreatedAt = time.Now()
+
+	if err := self.outbox.Append(entry); err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+
+	self.notify()
+	return nil
+}
+
+func (self *OutboxIndexer) notify() {
+	select {
+	case self.wake <- true:
+	default:
+	}
+}
+
+func (self *OutboxIndexer) run() {
+	defer close(self.done)
+
+	for {
+		self.drain()
+
+		select {
+		case <-self.stop:
+			return
+		case <-self.wake:
+		case <-time.After(OutboxPollInterval):
+		}
+	}
+}
+
+// applies batches of pending entries until the outbox is empty (or we're told to stop).  Each
+// batch is split between the workers by collection, so that a collection's entries are applied
+// by a single worker in the order they appear in the outbox.
+func (self *OutboxIndexer) drain() {
+	for {
+		entries, err := self.outbox.Pending(OutboxBatchSize)
+
+		if err != nil {
+			querylog.Errorf("[%T] failed to read pending entries: %v", self, err)
+			return
+		}
+
+		self.updateStats(entries)
+
+		if len(entries) == 0 {
+			return
+		}
+
+		lanes := make([][]*OutboxEntry, self.Workers)
+
+		for _, entry := range entries {
+			hash := fnv.New32a()
+			hash.Write([]byte(entry.Collection))
+			lane := int(hash.Sum32() % uint32(self.Workers))
+
+			lanes[lane] = append(lanes[lane], entry)
+		}
+
+		var wg sync.WaitGroup
+
+		for _, lane := range lanes {
+			if len(lane) > 0 {
+				wg.Add(1)
+
+				go func(lane []*OutboxEntry) {
+					defer wg.Done()
+
+					for _, entry := range lane {
+						if !self.process(entry) {
+							return
+						}
+					}
+				}(lane)
+			}
+		}
+
+		wg.Wait()
+
+		select {
+		case <-self.stop:
+			return
+		default:
+		}
+	}
+}
+
+// applies the given entry, retrying until it succeeds or runs out of attempts.  Returns false if
+// the indexer was closed before the entry could be applied.
+func (self *OutboxIndexer) process(entry *OutboxEntry) bool {
+	backoff := OutboxMinBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := self.apply(entry)
+
+		if err == nil {
+			self.count(func(s *OutboxStats) { s.Applied += 1 })
+		} else if dal.IsCollectionNotFoundErr(err) {
+			querylog.Warningf("[%T] dropping %v entry %d: %v", self, entry.Operation, entry.Sequence, err)
+		} else if self.MaxAttempts > 0 && attempt >= self.MaxAttempts {
+			querylog.Errorf("[%T] dropping %v entry %d after %d attempts: %v", self, entry.Operation, entry.Sequence, attempt, err)
+			stats.Increment(`pivot.indexers.outbox.failures`)
+			self.count(func(s *OutboxStats) { s.Failures += 1 })
+		} else {
+			querylog.Warningf("[%T] %v entry %d failed (attempt %d), retrying in %v: %v", self, entry.Operation, entry.Sequence, attempt, backoff, err)
+			stats.Increment(`pivot.indexers.outbox.retries`)
+			self.count(func(s *OutboxStats) { s.Retries += 1 })
+
+			select {
+			case <-self.stop:
+				return false
+			case <-time.After(backoff):
+			}
+
+			if backoff *= 2; backoff > OutboxMaxBackoff {
+				backoff = OutboxMaxBackoff
+			}
+
+			continue
+		}
+
+		if err := self.outbox.Ack(entry.Sequence); err != nil {
+			querylog.Errorf("[%T] failed to acknowledge entry %d: %v", self, entry.Sequence, err)
+		}
+
+		return true
+	}
+}
+
+func (self *OutboxIndexer) apply(entry *OutboxEntry) error {
+	defer stats.NewTiming().Send(`pivot.indexers.outbox.apply_time`)
+
+	collection, err := self.parent.GetCollection(entry.Collection)
+
+	if err != nil {
+		return err
+	}
+
+	// indexers may batch writes, so make sure that earlier writes land before they can be removed
+	if entry.Operation != OutboxIndex {
+		if err := self.indexer.FlushIndex(); err != nil {
+			return err
+		}
+	}
+
+	switch entry.Operation {
+	case OutboxIndex:
+		return self.indexer.Index(collection, entry.recordSet(collection))
+
+	case OutboxRemove:
+		ids := make([]interface{}, len(entry.IDs))
+
+		for i, id := range entry.IDs {
+			ids[i] = collection.ConvertValue(collection.GetIdentityFieldName(), id)
+		}
+
+		return self.indexer.IndexRemove(collection, ids)
+
+	case OutboxDeleteQuery:
+		if f, err := filter.FromJSON(entry.Filter); err == nil {
+			return self.indexer.DeleteQuery(collection, f)
+		} else {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown outbox operation %q", entry.Operation)
+	}
+}
+
+func (self *OutboxIndexer) updateStats(pending []*OutboxEntry) {
+	depth, err := self.outbox.Len()
+
+	if err != nil {
+		depth = len(pending)
+	}
+
+	var lag time.Duration
+
+	if len(pending) > 0 {
+		lag = time.Since(pending[0].CreatedAt)
+	}
+
+	self.count(func(s *OutboxStats) {
+		s.Depth = depth
+		s.Lag = lag
+	})
+
+	stats.Gauge(`pivot.indexers.outbox.depth`, depth)
+	stats.Gauge(`pivot.indexers.outbox.lag`, int64(lag/time.Millisecond))
+}
+
+func (self *OutboxIndexer) count(fn func(s *OutboxStats)) {
+	self.statsLock.Lock()
+	defer self.statsLock.Unlock()
+
+	fn(&self.stats)
+}
@@ -0,0 +1,97 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexerAggregator(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	users := &dal.Collection{
+		Name:              `users`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `group`,
+				Type: dal.StringType,
+			}, {
+				Name: `age`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.NoError(backend.CreateCollection(users))
+	assert.NoError(backend.Insert(`users`, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`group`, `red`).Set(`age`, 30),
+		dal.NewRecord(2).Set(`group`, `red`).Set(`age`, 40),
+		dal.NewRecord(3).Set(`group`, `blue`).Set(`age`, 20),
+		dal.NewRecord(4).Set(`group`, `blue`),
+	)))
+
+	aggregator := NewIndexerAggregator(backend.WithSearch(users))
+
+	count, err := aggregator.Count(users, filter.All())
+	assert.NoError(err)
+	assert.EqualValues(4, count)
+
+	sum, err := aggregator.Sum(users, `age`, filter.MustParse(`group/red`))
+	assert.NoError(err)
+	assert.Equal(float64(70), sum)
+
+	min, err := aggregator.Minimum(users, `age`)
+	assert.NoError(err)
+	assert.Equal(float64(20), min)
+
+	max, err := aggregator.Maximum(users, `age`)
+	assert.NoError(err)
+	assert.Equal(float64(40), max)
+
+	avg, err := aggregator.Average(users, `age`)
+	assert.NoError(err)
+	assert.Equal(float64(30), avg)
+
+	// nothing matching yields zero values rather than an error
+	count, err = aggregator.Count(users, filter.MustParse(`group/green`))
+	assert.NoError(err)
+	assert.Zero(count)
+
+	// the results agree with the memory backend's native aggregator
+	total, _ := filter.ParseAggregate(`total=sum:age`)
+	members, _ := filter.ParseAggregate(`members=count`)
+
+	query := &GroupByQuery{
+		Fields:     []string{`group`},
+		Aggregates: []filter.Aggregate{total, members},
+		Sort:       []string{`group`},
+	}
+
+	native, err := GroupByQueryContext(context.Background(), backend.WithAggregator(users), users, query)
+	assert.NoError(err)
+
+	streamed, err := GroupByQueryContext(context.Background(), aggregator, users, query)
+	assert.NoError(err)
+	assert.Len(streamed.Records, 2)
+	assert.Equal(native.Records, streamed.Records)
+	assert.Equal(`blue`, streamed.Records[0].Get(`group`))
+	assert.EqualValues(20, typeutil.Float(streamed.Records[0].Get(`total`)))
+	assert.EqualValues(2, streamed.Records[0].Get(`members`))
+
+	// queries reading more than MaxRecords fail instead of returning partial results
+	aggregator.MaxRecords = 3
+
+	_, err = aggregator.Count(users, filter.All())
+	assert.Error(err)
+
+	count, err = aggregator.Count(users, filter.MustParse(`group/red`))
+	assert.NoError(err)
+	assert.EqualValues(2, count)
+}
@@ -0,0 +1,136 @@
+package backends
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+type failingIndexer struct {
+	*MemoryBackend
+}
+
+func (self failingIndexer) IndexConnectionString() *dal.ConnectionString {
+	cs := dal.MustParseConnectionString(`failing://`)
+	return &cs
+}
+
+func (self failingIndexer) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return nil, fmt.Errorf("indexer unavailable")
+}
+
+// an indexer that fails after returning the first result of a query
+type partialIndexer struct {
+	*MemoryBackend
+}
+
+func (self partialIndexer) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	var sent bool
+
+	return self.MemoryBackend.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if sent {
+			return fmt.Errorf("connection reset")
+		}
+
+		sent = true
+		return resultFn(record, err, page)
+	})
+}
+
+func TestParseIndexSelectionStrategy(t *testing.T) {
+	assert := require.New(t)
+
+	for name, expected := range map[string]IndexSelectionStrategy{
+		`sequential`:       Sequential,
+		`all`:              All,
+		`First`:            First,
+		`all-except-first`: AllExceptFirst,
+		`all_except_first`: AllExceptFirst,
+		`random`:           Random,
+		``:                 Random,
+	} {
+		actual, err := ParseIndexSelectionStrategy(name, Random)
+		assert.NoError(err, name)
+		assert.Equal(expected, actual, name)
+	}
+
+	_, err := ParseIndexSelectionStrategy(`sometimes`, Sequential)
+	assert.Error(err)
+}
+
+func TestMultiIndexFailover(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`)).(*MemoryBackend)
+
+	multi := NewMultiIndex()
+	assert.NoError(multi.SetStrategies(ConnectOptions{
+		RetrievalStrategy: `sequential`,
+	}))
+
+	assert.NoError(multi.AddIndexer(failingIndexer{backend}))
+	assert.NoError(multi.AddIndexer(backend))
+	assert.NoError(AttachIndexer(backend, multi))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `First`),
+		dal.NewRecord(`b`).Set(`name`, `Second`),
+	)))
+
+	// the first indexer fails, so the query is answered by the second
+	results, err := backend.WithSearch(groups).Query(groups, filter.MustParse(`name/Second`))
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+	assert.Equal(`b`, results.Records[0].ID)
+
+	status := multi.Status()
+	assert.Len(status, 2)
+
+	assert.True(status[0].Primary)
+	assert.False(status[0].Healthy)
+	assert.Equal(1, status[0].Errors)
+	assert.Equal(`indexer unavailable`, status[0].LastError)
+	assert.NotNil(status[0].LastErrorAt)
+
+	assert.False(status[1].Primary)
+	assert.True(status[1].Healthy)
+	assert.Zero(status[1].Errors)
+	assert.NotNil(status[1].LastOkAt)
+}
+
+func TestMultiIndexNoFailoverAfterResults(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`)).(*MemoryBackend)
+
+	multi := NewMultiIndex()
+	assert.NoError(multi.SetStrategies(ConnectOptions{
+		RetrievalStrategy: `sequential`,
+	}))
+
+	assert.NoError(multi.AddIndexer(partialIndexer{backend}))
+	assert.NoError(multi.AddIndexer(backend))
+	assert.NoError(AttachIndexer(backend, multi))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `First`),
+		dal.NewRecord(`b`).Set(`name`, `Second`),
+	)))
+
+	// the second indexer would repeat the result the first one already returned
+	ids := make([]interface{}, 0)
+
+	assert.EqualError(multi.QueryFunc(groups, filter.All(), func(record *dal.Record, err error, _ IndexPage) error {
+		ids = append(ids, record.ID)
+		return err
+	}), `connection reset`)
+
+	assert.Equal([]interface{}{`a`}, ids)
+}
@@ -0,0 +1,288 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+// fails the first n calls to Index
+type flakyIndexer struct {
+	Indexer
+	failures int
+	lock     sync.Mutex
+}
+
+func (self *flakyIndexer) Index(collection *dal.Collection, records *dal.RecordSet) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.failures > 0 {
+		self.failures -= 1
+		return fmt.Errorf("indexer unavailable")
+	}
+
+	return self.Indexer.Index(collection, records)
+}
+
+func TestFileOutboxReplay(t *testing.T) {
+	assert := require.New(t)
+
+	root, err := ioutil.TempDir(``, `pivot-outbox-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	outbox := NewFileOutbox(root)
+	assert.NoError(outbox.Initialize(nil))
+
+	for _, id := range []string{`a`, `b`, `c`} {
+		assert.NoError(outbox.Append(&OutboxEntry{
+			Operation:  OutboxRemove,
+			Collection: `groups`,
+			IDs:        []interface{}{id},
+		}))
+	}
+
+	assert.NoError(outbox.Ack(1))
+	assert.NoError(outbox.Close())
+
+	// unacknowledged entries survive reopening the outbox, and numbering continues where it left off
+	outbox = NewFileOutbox(root)
+	assert.NoError(outbox.Initialize(nil))
+
+	pending, err := outbox.Pending(0)
+	assert.NoError(err)
+	assert.Len(pending, 2)
+	assert.EqualValues(2, pending[0].Sequence)
+	assert.Equal([]interface{}{`b`}, pending[0].IDs)
+	assert.EqualValues(3, pending[1].Sequence)
+
+	assert.NoError(outbox.Append(&OutboxEntry{
+		Operation:  OutboxRemove,
+		Collection: `groups`,
+	}))
+
+	pending, err = outbox.Pending(1)
+	assert.NoError(err)
+	assert.Len(pending, 1)
+
+	n, err := outbox.Len()
+	assert.NoError(err)
+	assert.Equal(3, n)
+
+	// the log is emptied once everything has been acknowledged
+	for _, seq := range []int64{2, 3, 4} {
+		assert.NoError(outbox.Ack(seq))
+	}
+
+	stat, err := os.Stat(outbox.Path)
+	assert.NoError(err)
+	assert.Zero(stat.Size())
+	assert.NoError(outbox.Close())
+}
+
+func TestFileOutboxCompaction(t *testing.T) {
+	assert := require.New(t)
+
+	root, err := ioutil.TempDir(``, `pivot-outbox-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	outbox := NewFileOutbox(root)
+	outbox.CompactAfter = 5
+	assert.NoError(outbox.Initialize(nil))
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(outbox.Append(&OutboxEntry{
+			Operation:  OutboxRemove,
+			Collection: `groups`,
+			IDs:        []interface{}{i},
+		}))
+	}
+
+	stat, err := os.Stat(outbox.Path)
+	assert.NoError(err)
+	full := stat.Size()
+
+	// acknowledging enough entries rewrites the log with only the pending ones
+	for seq := int64(1); seq <= 5; seq++ {
+		assert.NoError(outbox.Ack(seq))
+	}
+
+	stat, err = os.Stat(outbox.Path)
+	assert.NoError(err)
+	assert.True(stat.Size() < full)
+
+	// the compacted log is still appended to
+	assert.NoError(outbox.Ack(6))
+	assert.NoError(outbox.Close())
+
+	outbox = NewFileOutbox(root)
+	assert.NoError(outbox.Initialize(nil))
+
+	pending, err := outbox.Pending(0)
+	assert.NoError(err)
+	assert.Len(pending, 4)
+
+	for i, entry := range pending {
+		assert.EqualValues(i+7, entry.Sequence)
+	}
+
+	assert.NoError(outbox.Close())
+}
+
+func TestCollectionOutboxLen(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-outbox-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	outbox := NewCollectionOutbox(DefaultOutboxCollectionName)
+	assert.NoError(outbox.Initialize(backend))
+
+	n, err := outbox.Len()
+	assert.NoError(err)
+	assert.Zero(n)
+
+	// the filesystem indexer does not report how many results a query matched
+	for _, id := range []string{`a`, `b`, `c`} {
+		assert.NoError(outbox.Append(&OutboxEntry{
+			Operation:  OutboxRemove,
+			Collection: `groups`,
+			IDs:        []interface{}{id},
+		}))
+	}
+
+	n, err = outbox.Len()
+	assert.NoError(err)
+	assert.Equal(3, n)
+
+	pending, err := outbox.Pending(1)
+	assert.NoError(err)
+	assert.Len(pending, 1)
+	assert.NoError(outbox.Ack(pending[0].Sequence))
+
+	n, err = outbox.Len()
+	assert.NoError(err)
+	assert.Equal(2, n)
+}
+
+func TestOutboxIndexer(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(backoff time.Duration) {
+		OutboxMinBackoff = backoff
+	}(OutboxMinBackoff)
+
+	OutboxMinBackoff = time.Millisecond
+
+	for _, spec := range []string{`file`, `collection`} {
+		root, err := ioutil.TempDir(``, `pivot-outbox-`)
+		assert.NoError(err)
+		defer os.RemoveAll(root)
+
+		if spec == `file` {
+			spec = root + `/outbox`
+		}
+
+		outbox, err := MakeIndexOutbox(spec)
+		assert.NoError(err)
+
+		index := &flakyIndexer{
+			Indexer:  NewBleveIndexer(dal.MustParseConnectionString(`bleve:///` + root + `/index`)),
+			failures: 2,
+		}
+
+		indexer := NewOutboxIndexer(index, outbox)
+		backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+		assert.NoError(AttachIndexer(backend, indexer))
+		assert.NoError(backend.Initialize())
+
+		groups, _ := testMemoryCollections()
+		assert.NoError(backend.CreateCollection(groups))
+		assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+			dal.NewRecord(`a`).Set(`name`, `First`),
+			dal.NewRecord(`b`).Set(`name`, `Second`),
+			dal.NewRecord(`c`).Set(`name`, `Third`),
+		)))
+		assert.NoError(backend.WithSearch(groups).IndexRemove(groups, []interface{}{`c`}))
+
+		// writes are retried until the indexer accepts them, and applied in order
+		assert.NoError(indexer.FlushIndex())
+
+		f := filter.MustParse(`all`)
+		f.Fields = []string{`name`}
+
+		rs, err := index.Query(groups, f)
+		assert.NoError(err)
+		assert.Len(rs.Records, 2)
+		assert.Equal(`First`, rs.Records[0].Get(`name`))
+		assert.Equal(`Second`, rs.Records[1].Get(`name`))
+
+		stats := indexer.Stats()
+		assert.Zero(stats.Depth)
+		assert.EqualValues(2, stats.Retries)
+		assert.Zero(stats.Failures)
+
+		n, err := outbox.Len()
+		assert.NoError(err)
+		assert.Zero(n)
+
+		assert.NoError(indexer.Close())
+	}
+}
+
+func TestOutboxIndexerDropsFailingEntries(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(backoff time.Duration, attempts int) {
+		OutboxMinBackoff = backoff
+		DefaultOutboxMaxAttempts = attempts
+	}(OutboxMinBackoff, DefaultOutboxMaxAttempts)
+
+	OutboxMinBackoff = time.Millisecond
+	DefaultOutboxMaxAttempts = 3
+
+	root, err := ioutil.TempDir(``, `pivot-outbox-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	outbox, err := MakeIndexOutbox(root + `/outbox`)
+	assert.NoError(err)
+
+	// the first entry fails every attempt it is given, and must not hold up the ones after it
+	index := &flakyIndexer{
+		Indexer:  NewBleveIndexer(dal.MustParseConnectionString(`bleve:///` + root + `/index`)),
+		failures: 3,
+	}
+
+	indexer := NewOutboxIndexer(index, outbox)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(AttachIndexer(backend, indexer))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(dal.NewRecord(`a`).Set(`name`, `First`))))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(dal.NewRecord(`b`).Set(`name`, `Second`))))
+	assert.NoError(indexer.FlushIndex())
+
+	rs, err := index.Query(groups, filter.MustParse(`all`))
+	assert.NoError(err)
+	assert.Equal([]interface{}{`b`}, rs.Pluck(`id`))
+
+	stats := indexer.Stats()
+	assert.EqualValues(1, stats.Failures)
+	assert.EqualValues(2, stats.Retries)
+	assert.NoError(indexer.Close())
+}
@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strings"
@@ -21,6 +22,7 @@ type IndexPage struct {
 	Limit        int
 	Offset       int
 	TotalResults int64
+	NextCursor   string // if non-empty, a cursor pointing just past the record this page was given with
 }
 
 type IndexResultFunc func(record *dal.Record, err error, page IndexPage) error // {}
@@ -40,17 +42,71 @@ type Indexer interface {
 	GetBackend() Backend
 }
 
+// Implemented by indexers that can report how many records a DeleteQuery removed.
+type DeleteQueryCounter interface {
+	DeleteQueryCount(collection *dal.Collection, f *filter.Filter) (int, error)
+}
+
+// Implemented by backends that can use an already-constructed Indexer (e.g.: a MultiIndex) instead
+// of one created from a connection string by SetIndexer.
+type IndexAttacher interface {
+	AttachIndexer(Indexer) error
+}
+
+// Tells the given backend to use the given indexer, provided the backend supports it.
+func AttachIndexer(backend Backend, indexer Indexer) error {
+	if attacher, ok := backend.(IndexAttacher); ok {
+		return attacher.AttachIndexer(indexer)
+	} else {
+		return fmt.Errorf("backend %v does not support attaching indexers", backend)
+	}
+}
+
+// Creates an Indexer from the given connection string.  If the "outbox" option is present, writes
+// to the indexer are made asynchronously via an OutboxIndexer (see MakeIndexOutbox), which is
+// further configured with the "outbox_workers" and "outbox_max_attempts" options.
 func MakeIndexer(connection dal.ConnectionString) (Indexer, error) {
+	var outbox IndexOutbox
+	var workers = DefaultOutboxWorkers
+	var maxAttempts = DefaultOutboxMaxAttempts
+
+	if connection.HasOpt(`outbox`) {
+		if o, err := MakeIndexOutbox(connection.OptString(`outbox`, ``)); err == nil {
+			outbox = o
+		} else {
+			return nil, err
+		}
+
+		workers = int(connection.OptInt(`outbox_workers`, int64(workers)))
+		maxAttempts = int(connection.OptInt(`outbox_max_attempts`, int64(maxAttempts)))
+
+		connection.ClearOpt(`outbox`)
+		connection.ClearOpt(`outbox_workers`)
+		connection.ClearOpt(`outbox_max_attempts`)
+	}
+
 	log.Infof("Creating indexer: %v", connection.String())
 
+	var indexer Indexer
+
 	switch connection.Backend() {
 	case `bleve`:
-		return NewBleveIndexer(connection), nil
+		indexer = NewBleveIndexer(connection)
 	case `elasticsearch`:
-		return NewElasticsearchIndexer(connection), nil
+		indexer = NewElasticsearchIndexer(connection)
 	default:
 		return nil, fmt.Errorf("Unknown indexer type %q", connection.Backend())
 	}
+
+	if outbox != nil {
+		oi := NewOutboxIndexer(indexer, outbox)
+		oi.Workers = workers
+		oi.MaxAttempts = maxAttempts
+
+		return oi, nil
+	}
+
+	return indexer, nil
 }
 
 func PopulateRecordSetPageDetails(recordset *dal.RecordSet, f *filter.Filter, page IndexPage) {
@@ -81,12 +137,54 @@ func PopulateRecordSetPageDetails(recordset *dal.RecordSet, f *filter.Filter, pa
 	}
 }
 
+// Returns the ID that a sorted-ID cursor points at, or an empty string if the filter is requesting
+// the first page.  Sorted-ID cursors are used by backends that can only paginate by walking their
+// record IDs in lexical order.
+func idCursorPosition(f *filter.Filter) (string, error) {
+	var id string
+
+	if f.UsesCursor() && f.Cursor != filter.CursorStart {
+		if err := filter.DecodeCursor(f.Cursor, &id); err != nil {
+			return ``, err
+		}
+	}
+
+	return id, nil
+}
+
+// Returns a sorted-ID cursor pointing just past the given ID.
+func idCursorFor(id string) string {
+	cursor, _ := filter.EncodeCursor(id)
+	return cursor
+}
+
 func DefaultQueryImplementation(indexer Indexer, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return DefaultQueryImplementationContext(context.Background(), indexer, collection, f, resultFns...)
+}
+
+// Same as DefaultQueryImplementation, but the given context is passed to the indexer and is used
+// when retrieving records from the parent backend.
+func DefaultQueryImplementationContext(ctx context.Context, indexer Indexer, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	recordset := dal.NewRecordSet()
+	var returned int
+	var lastCursor string
 
-	if err := indexer.QueryFunc(collection, f, func(indexRecord *dal.Record, err error, page IndexPage) error {
+	if err := QueryFuncContext(ctx, indexer, collection, f, func(indexRecord *dal.Record, err error, page IndexPage) error {
 		defer PopulateRecordSetPageDetails(recordset, f, page)
 
+		// keep track of where the last record we've seen is, in case another page is requested
+		if f != nil && f.UsesCursor() && indexRecord != nil {
+			returned += 1
+
+			if page.NextCursor != `` {
+				lastCursor = page.NextCursor
+			} else if cursor, err := f.CursorFor(indexRecord); err == nil {
+				lastCursor = cursor
+			} else {
+				return err
+			}
+		}
+
 		parent := indexer.GetBackend()
 		var forceIndexRecord bool
 
@@ -155,8 +253,8 @@ func DefaultQueryImplementation(indexer Indexer, collection *dal.Collection, f *
 			if f.IdOnly() {
 				return resultFn(emptyRecord, err, page)
 			} else if parent != nil && !forceIndexRecord {
-				if record, err := parent.Retrieve(collection.Name, indexRecord.ID, f.Fields...); err == nil {
-					return resultFn(record, err, page)
+				if record, err := RetrieveContext(ctx, parent, collection.Name, indexRecord.ID, f.Fields...); err == nil {
+					return resultFn(withIndexScore(record, indexRecord), err, page)
 				} else {
 					return resultFn(emptyRecord, err, page)
 				}
@@ -168,8 +266,8 @@ func DefaultQueryImplementation(indexer Indexer, collection *dal.Collection, f *
 				recordset.Records = append(recordset.Records, dal.NewRecord(indexRecord.ID))
 
 			} else if parent != nil && !forceIndexRecord {
-				if record, err := parent.Retrieve(collection.Name, indexRecord.ID, f.Fields...); err == nil {
-					recordset.Records = append(recordset.Records, record)
+				if record, err := RetrieveContext(ctx, parent, collection.Name, indexRecord.ID, f.Fields...); err == nil {
+					recordset.Records = append(recordset.Records, withIndexScore(record, indexRecord))
 
 				} else {
 					recordset.Records = append(recordset.Records, dal.NewRecordErr(indexRecord.ID, err))
@@ -184,5 +282,30 @@ func DefaultQueryImplementation(indexer Indexer, collection *dal.Collection, f *
 		return nil, err
 	}
 
+	// a full page of results means there may be more of them
+	if f != nil && f.UsesCursor() && f.Limit > 0 && returned >= f.Limit {
+		recordset.NextCursor = lastCursor
+	}
+
 	return recordset, nil
 }
+
+// copies the full-text relevance score (if any) from an index record onto the record retrieved
+// from the parent backend.
+func withIndexScore(record *dal.Record, indexRecord *dal.Record) *dal.Record {
+	if score := indexRecord.Get(filter.ScoreField); score != nil {
+		record.Set(filter.ScoreField, score)
+	}
+
+	return record
+}
+
+// sets the full-text relevance score of the given record if the filter contains fulltext criteria;
+// for use by indexers that match records in-process.
+func scoreRecord(f *filter.Filter, record *dal.Record) *dal.Record {
+	if f != nil && record != nil && f.UsesFulltext() {
+		record.Set(filter.ScoreField, f.Score(record))
+	}
+
+	return record
+}
@@ -31,4 +31,11 @@ type Mapper interface {
 	Maximum(field string, flt interface{}) (float64, error)
 	Average(field string, flt interface{}) (float64, error)
 	GroupBy(fields []string, aggregates []filter.Aggregate, flt interface{}) (*dal.RecordSet, error)
+	CountDistinct(field string, flt interface{}) (uint64, error)
+	Percentile(field string, percentile float64, flt interface{}) (float64, error)
+	Median(field string, flt interface{}) (float64, error)
+	StdDev(field string, flt interface{}) (float64, error)
+	Variance(field string, flt interface{}) (float64, error)
+	Aggregate(aggregate filter.Aggregate, flt interface{}) (interface{}, error)
+	Transaction(fn func(tx Mapper) error) error
 }
@@ -0,0 +1,262 @@
+package backends
+
+// this file satifies the Aggregator interface for MemoryBackend
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/stringutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+func (self *MemoryBackend) AggregatorConnectionString() *dal.ConnectionString {
+	return self.GetConnectionString()
+}
+
+func (self *MemoryBackend) AggregatorInitialize(parent Backend) error {
+	return nil
+}
+
+func (self *MemoryBackend) Sum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Sum, field, f)
+}
+
+func (self *MemoryBackend) Count(collection *dal.Collection, flt ...*filter.Filter) (uint64, error) {
+	if matches, err := self.matchingRecords(collection, memoryAggregateFilter(flt)); err == nil {
+		return uint64(len(matches)), nil
+	} else {
+		return 0, err
+	}
+}
+
+func (self *MemoryBackend) Minimum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Minimum, field, f)
+}
+
+func (self *MemoryBackend) Maximum(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Maximum, field, f)
+}
+
+func (self *MemoryBackend) Average(collection *dal.Collection, field string, f ...*filter.Filter) (float64, error) {
+	return self.aggregateFloat(collection, filter.Average, field, f)
+}
+
+// GroupBy returns one record for each distinct combination of values in the groupBy fields.  Each
+// record contains those values, as well as the result of each aggregate stored under its name.
+func (self *MemoryBackend) GroupBy(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
+	if matches, err := self.matchingRecords(collection, memoryAggregateFilter(flt)); err == nil {
+		groups := make(map[string][]*dal.Record)
+		order := make([]string, 0)
+
+		for _, record := range matches {
+			key := strings.Join(sliceutil.Stringify(memoryFieldValues(collection, record, groupBy)), memoryKeySeparator)
+
+			if _, ok := groups[key]; !ok {
+				order = append(order, key)
+			}
+
+			groups[key] = append(groups[key], record)
+		}
+
+		recordset := dal.NewRecordSet()
+
+		for _, key := range order {
+			records := groups[key]
+			values := memoryFieldValues(collection, records[0], groupBy)
+			result := dal.NewRecord(nil)
+
+			for i, field := range groupBy {
+				result.Set(field, values[i])
+			}
+
+			for _, aggregate := range aggregates {
+				if value, err := memoryAggregate(collection, records, aggregate); err == nil {
+					result.Set(aggregate.ResultName(), value)
+				} else {
+					return nil, err
+				}
+			}
+
+			recordset.Push(result)
+		}
+
+		return recordset, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *MemoryBackend) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (float64, error) {
+	if matches, err := self.matchingRecords(collection, memoryAggregateFilter(flt)); err == nil {
+		if value, err := memoryAggregate(collection, matches, filter.Aggregate{
+			Aggregation: aggregation,
+			Field:       field,
+		}); err == nil {
+			return typeutil.Float(value), nil
+		} else {
+			return 0, err
+		}
+	} else {
+		return 0, err
+	}
+}
+
+func memoryAggregateFilter(flt []*filter.Filter) *filter.Filter {
+	if len(flt) > 0 && flt[0] != nil {
+		return flt[0]
+	}
+
+	return filter.All()
+}
+
+func memoryFieldValues(collection *dal.Collection, record *dal.Record, fields []string) []interface{} {
+	values := make([]interface{}, len(fields))
+
+	for i, field := range fields {
+		if field == `id` || collection.IsIdentityField(field) {
+			values[i] = record.ID
+		} else {
+			values[i] = record.Get(field)
+		}
+	}
+
+	return values
+}
+
+// performs the given aggregation on a field across all of the given records.  Records that do
+// not have a value for the field are ignored (except by Count).
+func memoryAggregate(collection *dal.Collection, records []*dal.Record, aggregate filter.Aggregate) (interface{}, error) {
+	acc := newAggregateAccumulator(collection, aggregate)
+
+	for _, record := range records {
+		if err := acc.Add(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc.Value(), nil
+}
+
+// calculates a single aggregation over records as they are added to it, so that aggregates can be
+// calculated without holding every record in memory (except for percentiles, which need to see
+// every value).
+type aggregateAccumulator struct {
+	collection *dal.Collection
+	aggregate  filter.Aggregate
+	result     interface{}
+	sum        float64
+	sumSquares float64
+	count      int
+	distinct   map[string]bool
+	values     []float64
+}
+
+func newAggregateAccumulator(collection *dal.Collection, aggregate filter.Aggregate) *aggregateAccumulator {
+	return &aggregateAccumulator{
+		collection: collection,
+		aggregate:  aggregate,
+		distinct:   make(map[string]bool),
+	}
+}
+
+func (self *aggregateAccumulator) Add(record *dal.Record) error {
+	value := memoryFieldValues(self.collection, record, []string{self.aggregate.Field})[0]
+
+	if self.aggregate.Aggregation == filter.Count {
+		self.count += 1
+		return nil
+	} else if value == nil {
+		return nil
+	}
+
+	switch self.aggregate.Aggregation {
+	case filter.First:
+		if self.result == nil {
+			self.result = value
+		}
+	case filter.Last:
+		self.result = value
+	case filter.Minimum:
+		if self.result == nil || memoryCompare(value, self.result) < 0 {
+			self.result = value
+		}
+	case filter.Maximum:
+		if self.result == nil || memoryCompare(value, self.result) > 0 {
+			self.result = value
+		}
+	case filter.CountDistinct, filter.Cardinality:
+		self.distinct[fmt.Sprintf("%T:%v", value, value)] = true
+	case filter.Sum, filter.Average, filter.StdDev, filter.Variance, filter.Percentile, filter.Median:
+		if v, err := stringutil.ConvertToFloat(value); err == nil {
+			self.sum += v
+			self.sumSquares += v * v
+			self.count += 1
+
+			if self.aggregate.Aggregation == filter.Percentile || self.aggregate.Aggregation == filter.Median {
+				self.values = append(self.values, v)
+			}
+		} else {
+			return fmt.Errorf("cannot aggregate non-numeric field %q: %v", self.aggregate.Field, err)
+		}
+	default:
+		return fmt.Errorf("Unsupported aggregation %v", self.aggregate.Aggregation)
+	}
+
+	return nil
+}
+
+func (self *aggregateAccumulator) Value() interface{} {
+	switch self.aggregate.Aggregation {
+	case filter.Count:
+		return self.count
+	case filter.CountDistinct, filter.Cardinality:
+		return len(self.distinct)
+	case filter.Sum:
+		return self.sum
+	case filter.Average:
+		if self.count > 0 {
+			return self.sum / float64(self.count)
+		} else {
+			return float64(0)
+		}
+	case filter.StdDev, filter.Variance:
+		if self.count == 0 {
+			return nil
+		}
+
+		mean := self.sum / float64(self.count)
+		variance := math.Max(self.sumSquares/float64(self.count)-(mean*mean), 0)
+
+		if self.aggregate.Aggregation == filter.StdDev {
+			return math.Sqrt(variance)
+		} else {
+			return variance
+		}
+	case filter.Percentile, filter.Median:
+		return percentileOf(self.values, self.aggregate.Quantile())
+	default:
+		return self.result
+	}
+}
+
+// returns the value at the given quantile (0-1) of the given values, interpolating linearly
+// between the closest values (as SQL's percentile_cont does).  The values are sorted in place.
+func percentileOf(values []float64, quantile float64) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sort.Float64s(values)
+
+	rank := quantile * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,264 @@
+package backends
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/stringutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+func (self *MemoryBackend) IndexConnectionString() *dal.ConnectionString {
+	return &dal.ConnectionString{}
+}
+
+func (self *MemoryBackend) IndexInitialize(_ Backend) error {
+	return nil
+}
+
+func (self *MemoryBackend) GetBackend() Backend {
+	return self
+}
+
+func (self *MemoryBackend) IndexExists(collection *dal.Collection, id interface{}) bool {
+	return self.Exists(collection.GetIndexName(), id)
+}
+
+func (self *MemoryBackend) IndexRetrieve(collection *dal.Collection, id interface{}) (*dal.Record, error) {
+	defer stats.NewTiming().Send(`pivot.indexers.memory.retrieve_time`)
+	return self.Retrieve(collection.GetIndexName(), id)
+}
+
+func (self *MemoryBackend) IndexRemove(collection *dal.Collection, ids []interface{}) error {
+	return nil
+}
+
+func (self *MemoryBackend) Index(collection *dal.Collection, records *dal.RecordSet) error {
+	return nil
+}
+
+func (self *MemoryBackend) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	defer stats.NewTiming().Send(`pivot.indexers.memory.query_time`)
+	querylog.Debugf("[%T] Query using filter %q", self, f.String())
+
+	if matches, err := self.matchingRecords(collection, f); err == nil {
+		total := len(matches)
+		totalPages := 1
+
+		if f.UsesCursor() {
+			if after, err := memoryRecordsAfterCursor(collection, f, matches); err == nil {
+				matches = after
+			} else {
+				return err
+			}
+		} else if f.Offset > 0 {
+			if f.Offset < len(matches) {
+				matches = matches[f.Offset:]
+			} else {
+				matches = nil
+			}
+		}
+
+		if f.Limit > 0 {
+			totalPages = int(math.Ceil(float64(total) / float64(f.Limit)))
+
+			if len(matches) > f.Limit {
+				matches = matches[:f.Limit]
+			}
+		}
+
+		for i, record := range matches {
+			querylog.Debugf("[%T] Record %v matches filter %q", self, record.ID, f.String())
+
+			page := 1
+
+			if f.Limit > 0 {
+				page = ((f.Offset + i) / f.Limit) + 1
+			}
+
+			if err := resultFn(record.OnlyFields(f.Fields), nil, IndexPage{
+				Page:         page,
+				TotalPages:   totalPages,
+				Limit:        f.Limit,
+				Offset:       f.Offset,
+				TotalResults: int64(total),
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *MemoryBackend) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	if f != nil {
+		f.Options[`ForceIndexRecord`] = true
+	}
+
+	return DefaultQueryImplementation(self, collection, f, resultFns...)
+}
+
+func (self *MemoryBackend) ListValues(collection *dal.Collection, fields []string, f *filter.Filter) (map[string][]interface{}, error) {
+	values := make(map[string][]interface{})
+
+	if err := self.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil {
+			for _, field := range fields {
+				var value interface{}
+
+				switch field {
+				case `id`, collection.IdentityField:
+					field = collection.IdentityField
+					value = record.ID
+				default:
+					value = record.Get(field)
+				}
+
+				if _, ok := values[field]; !ok {
+					values[field] = make([]interface{}, 0)
+				}
+
+				if value != nil {
+					values[field] = sliceutil.Unique(append(values[field], value))
+				}
+			}
+		}
+
+		return err
+	}); err == nil {
+		return values, nil
+	} else {
+		return values, err
+	}
+}
+
+func (self *MemoryBackend) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
+	_, err := self.DeleteQueryCount(collection, f)
+	return err
+}
+
+func (self *MemoryBackend) DeleteQueryCount(collection *dal.Collection, f *filter.Filter) (int, error) {
+	idsToRemove := make([]interface{}, 0)
+
+	if err := self.QueryFunc(collection, f, func(record *dal.Record, err error, page IndexPage) error {
+		if err == nil {
+			idsToRemove = append(idsToRemove, record.Keys(collection))
+		}
+
+		return err
+	}); err == nil {
+		return len(idsToRemove), self.Delete(collection.Name, idsToRemove...)
+	} else {
+		return 0, err
+	}
+}
+
+func (self *MemoryBackend) FlushIndex() error {
+	return nil
+}
+
+// returns the records (which must already be sorted) that appear after the position encoded in
+// the filter's cursor.
+func memoryRecordsAfterCursor(collection *dal.Collection, f *filter.Filter, records []*dal.Record) ([]*dal.Record, error) {
+	values, err := f.CursorValues()
+
+	if err != nil {
+		return nil, err
+	} else if values == nil {
+		return records, nil
+	}
+
+	sortBy := f.CursorSort()
+
+	for i, record := range records {
+		for j, s := range sortBy {
+			var value interface{}
+
+			if s.Field == `id` || collection.IsIdentityField(s.Field) {
+				value = record.ID
+			} else {
+				value = record.Get(s.Field)
+			}
+
+			// cursors store times as strings, so compare them as times
+			if _, ok := value.(time.Time); ok {
+				if t, err := stringutil.ConvertToTime(values[j]); err == nil {
+					values[j] = t
+				}
+			}
+
+			if c := memoryCompare(value, values[j]); c != 0 {
+				if (c > 0) != s.Descending {
+					return records[i:], nil
+				} else {
+					break
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// returns copies of all unexpired records in the given collection that match the filter, sorted
+// according to the filter's sort fields (or by ID if none are given).  If the filter contains any
+// fulltext criteria, each record's relevance is set in its ScoreField.
+func (self *MemoryBackend) matchingRecords(collection *dal.Collection, f *filter.Filter) ([]*dal.Record, error) {
+	if table, err := self.getTable(collection.GetIndexName()); err == nil {
+		matches := make([]*dal.Record, 0)
+
+		self.lock.RLock()
+
+		for _, record := range self.sortedRecords(table) {
+			if f == nil || f.MatchesRecord(record) {
+				matches = append(matches, scoreRecord(f, memoryCopyRecord(record)))
+			}
+		}
+
+		self.lock.RUnlock()
+
+		if f != nil {
+			memorySortRecords(collection, matches, f.GetSort())
+		}
+
+		return matches, nil
+	} else {
+		return nil, err
+	}
+}
+
+// sorts the given records in place by the given fields, keeping records with equal values in
+// their original order.
+func memorySortRecords(collection *dal.Collection, records []*dal.Record, sortBy []filter.SortBy) {
+	if len(sortBy) == 0 {
+		return
+	}
+
+	sort.SliceStable(records, func(i int, j int) bool {
+		for _, s := range sortBy {
+			var a, b interface{}
+
+			if s.Field == `id` || collection.IsIdentityField(s.Field) {
+				a, b = records[i].ID, records[j].ID
+			} else {
+				a, b = records[i].Get(s.Field), records[j].Get(s.Field)
+			}
+
+			if c := memoryCompare(a, b); c != 0 {
+				if s.Descending {
+					return c > 0
+				} else {
+					return c < 0
+				}
+			}
+		}
+
+		return false
+	})
+}
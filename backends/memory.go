@@ -0,0 +1,753 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/pathutil"
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+var memoryKeySeparator = "\x1f"
+
+type memoryTable struct {
+	collection *dal.Collection
+	records    map[string]*dal.Record
+	lastID     int64
+}
+
+type memorySnapshot struct {
+	Collections []*dal.Collection        `json:"collections"`
+	Records     map[string][]*dal.Record `json:"records"`
+}
+
+// A MemoryBackend stores all collections and records in process memory.  It is primarily intended
+// for use in tests and other short-lived programs.  If the connection string specifies a path
+// (e.g.: memory:///tmp/snapshot.json), the contents of the backend are loaded from that file when
+// the backend is initialized and written to it whenever Flush() is called.
+type MemoryBackend struct {
+	conn                  dal.ConnectionString
+	indexer               Indexer
+	tables                map[string]*memoryTable
+	registeredCollections map[string]*dal.Collection
+	snapshotPath          string
+	lock                  sync.RWMutex
+}
+
+func NewMemoryBackend(connection dal.ConnectionString) Backend {
+	return &MemoryBackend{
+		conn:                  connection,
+		tables:                make(map[string]*memoryTable),
+		registeredCollections: make(map[string]*dal.Collection),
+	}
+}
+
+func (self *MemoryBackend) Supports(features ...BackendFeature) bool {
+	for _, feat := range features {
+		switch feat {
+		case PartialSearch, CompositeKeys, Constraints:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self *MemoryBackend) String() string {
+	return `memory`
+}
+
+func (self *MemoryBackend) GetConnectionString() *dal.ConnectionString {
+	return &self.conn
+}
+
+func (self *MemoryBackend) Ping(timeout time.Duration) error {
+	return nil
+}
+
+func (self *MemoryBackend) RegisterCollection(collection *dal.Collection) {
+	if collection != nil {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		self.registeredCollections[collection.Name] = collection
+
+		// if the collection already exists (e.g.: it was loaded from a snapshot), use the
+		// registered definition from now on so that formatters and validators are honored.
+		if table, ok := self.tables[collection.Name]; ok {
+			table.collection = collection
+		}
+	}
+}
+
+func (self *MemoryBackend) SetIndexer(indexConnString dal.ConnectionString) error {
+	if indexer, err := MakeIndexer(indexConnString); err == nil {
+		self.indexer = indexer
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *MemoryBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
+func (self *MemoryBackend) Initialize() error {
+	if dataset := self.conn.Dataset(); dataset != `` {
+		if strings.HasPrefix(dataset, `~`) {
+			if v, err := pathutil.ExpandUser(dataset); err == nil {
+				dataset = v
+			} else {
+				return err
+			}
+		} else if !strings.HasPrefix(dataset, `.`) {
+			dataset = `/` + dataset
+		}
+
+		if v, err := filepath.Abs(dataset); err == nil {
+			self.snapshotPath = v
+		} else {
+			return err
+		}
+
+		if err := self.loadSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	if self.indexer == nil {
+		self.indexer = self
+	}
+
+	if err := self.indexer.IndexInitialize(self); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (self *MemoryBackend) Exists(name string, id interface{}) bool {
+	if _, err := self.Retrieve(name, id); err == nil {
+		return true
+	}
+
+	return false
+}
+
+func (self *MemoryBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
+	if table, err := self.getTable(name); err == nil {
+		if key, err := self.keyFor(table.collection, id); err == nil {
+			self.lock.RLock()
+			record, ok := table.records[key]
+			self.lock.RUnlock()
+
+			if ok {
+				// expired records are removed lazily as they are encountered
+				if table.collection.IsExpired(record) {
+					self.lock.Lock()
+					delete(table.records, key)
+					self.lock.Unlock()
+				} else {
+					return memoryCopyRecord(record).OnlyFields(fields), nil
+				}
+			}
+
+			return nil, fmt.Errorf("Record %v does not exist", id)
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func (self *MemoryBackend) Insert(name string, recordset *dal.RecordSet) error {
+	return self.upsert(name, recordset, true)
+}
+
+func (self *MemoryBackend) Upsert(name string, recordset *dal.RecordSet) error {
+	return self.upsert(name, recordset, false)
+}
+
+// Update the given records, creating any that do not exist.  If a record does not specify an ID
+// and a target filter is given, all records matching that filter are updated instead.
+func (self *MemoryBackend) Update(name string, recordset *dal.RecordSet, target ...string) error {
+	if len(target) > 0 {
+		var targeted = dal.NewRecordSet()
+		var untargeted = dal.NewRecordSet()
+
+		for _, record := range recordset.Records {
+			if typeutil.IsZero(record.ID) {
+				targeted.Push(record)
+			} else {
+				untargeted.Push(record)
+			}
+		}
+
+		if !targeted.IsEmpty() {
+			if err := self.updateWhere(name, targeted, target[0]); err != nil {
+				return err
+			}
+		}
+
+		recordset = untargeted
+	}
+
+	return self.upsert(name, recordset, false)
+}
+
+func (self *MemoryBackend) Delete(name string, ids ...interface{}) error {
+	if table, err := self.getTable(name); err == nil {
+		collection := table.collection
+
+		// the indexer is called without holding the lock, as it may write back to this backend
+		if err := func() error {
+			self.lock.Lock()
+			defer self.lock.Unlock()
+
+			for _, id := range ids {
+				if key, err := self.keyFor(collection, id); err == nil {
+					delete(table.records, key)
+				} else {
+					return err
+				}
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+
+		if search := self.indexer; search != nil && search != Indexer(self) && !collection.SkipIndexPersistence {
+			if err := search.IndexRemove(collection, ids); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *MemoryBackend) CreateCollection(definition *dal.Collection) error {
+	if definition.View {
+		return fmt.Errorf("View-type collections are not supported on this backend.")
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if _, ok := self.tables[definition.Name]; ok {
+		return fmt.Errorf("Collection %q already exists", definition.Name)
+	}
+
+	self.tables[definition.Name] = &memoryTable{
+		collection: definition,
+		records:    make(map[string]*dal.Record),
+	}
+
+	self.registeredCollections[definition.Name] = definition
+	return nil
+}
+
+func (self *MemoryBackend) DeleteCollection(name string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if _, ok := self.tables[name]; ok {
+		delete(self.tables, name)
+		delete(self.registeredCollections, name)
+		return nil
+	} else {
+		return dal.CollectionNotFound
+	}
+}
+
+func (self *MemoryBackend) ListCollections() ([]string, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	names := make([]string, 0, len(self.tables))
+
+	for name := range self.tables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (self *MemoryBackend) GetCollection(name string) (*dal.Collection, error) {
+	if table, err := self.getTable(name); err == nil {
+		return table.collection, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *MemoryBackend) WithSearch(collection *dal.Collection, filters ...*filter.Filter) Indexer {
+	return self.indexer
+}
+
+func (self *MemoryBackend) WithAggregator(collection *dal.Collection) Aggregator {
+	return self
+}
+
+// Flush writes the contents of the backend to the snapshot file (if one was specified in the
+// connection string).
+func (self *MemoryBackend) Flush() error {
+	if self.indexer != nil && self.indexer != Indexer(self) {
+		if err := self.indexer.FlushIndex(); err != nil {
+			return err
+		}
+	}
+
+	if self.snapshotPath != `` {
+		return self.writeSnapshot()
+	}
+
+	return nil
+}
+
+func (self *MemoryBackend) getTable(name string) (*memoryTable, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	if table, ok := self.tables[name]; ok {
+		return table, nil
+	} else {
+		return nil, dal.CollectionNotFound
+	}
+}
+
+// returns the string used to store the record identified by the given ID, which may be a scalar
+// value, a slice of composite key values, or a *dal.Record.
+func (self *MemoryBackend) keyFor(collection *dal.Collection, id interface{}) (string, error) {
+	var keys []interface{}
+
+	if record, ok := id.(*dal.Record); ok {
+		keys = record.Keys(collection)
+	} else {
+		keys = sliceutil.Sliceify(id)
+	}
+
+	if len(keys) == 0 || typeutil.IsZero(keys[0]) {
+		return ``, fmt.Errorf("Record ID must be specified")
+	} else if count := collection.KeyCount(); count > 1 && len(keys) != count {
+		return ``, fmt.Errorf("%v: expected %d key values, got %d", self, count, len(keys))
+	}
+
+	return strings.Join(sliceutil.Stringify(keys), memoryKeySeparator), nil
+}
+
+func (self *MemoryBackend) upsert(name string, recordset *dal.RecordSet, create bool) error {
+	if table, err := self.getTable(name); err == nil {
+		collection := table.collection
+
+		// the indexer is called without holding the lock, as it may write back to this backend
+		if err := func() error {
+			self.lock.Lock()
+			defer self.lock.Unlock()
+
+			for _, record := range recordset.Records {
+				// generate numeric IDs for records that don't specify one
+				if typeutil.IsZero(record.ID) && collection.IdentityFieldType == dal.IntType {
+					record.ID = table.lastID + 1
+				}
+
+				if r, err := collection.StructToRecord(record); err == nil {
+					if record.ID == nil {
+						record.ID = r.ID
+					}
+
+					record = r
+					record.ID = collection.ConvertValue(collection.GetIdentityFieldName(), record.ID)
+				} else {
+					return err
+				}
+
+				if key, err := self.keyFor(collection, record); err == nil {
+					existing, exists := table.records[key]
+
+					// don't store already-expired records; writing one removes any existing copy
+					if collection.IsExpired(record) {
+						delete(table.records, key)
+						continue
+					} else if exists && collection.IsExpired(existing) {
+						delete(table.records, key)
+						existing = nil
+						exists = false
+					}
+
+					if create && exists {
+						return fmt.Errorf("Record %v already exists", record.ID)
+					}
+
+					if err := self.checkConstraints(table, key, record); err != nil {
+						return err
+					}
+
+					stored := memoryCopyRecord(record)
+
+					// updates only replace the fields that were given
+					if exists {
+						for k, v := range existing.Fields {
+							if _, ok := stored.Fields[k]; !ok {
+								stored.Fields[k] = v
+							}
+						}
+					}
+
+					table.records[key] = stored
+
+					if id := typeutil.Int(record.ID); id > table.lastID {
+						table.lastID = id
+					}
+				} else {
+					return err
+				}
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+
+		if search := self.indexer; search != nil && search != Indexer(self) && !collection.SkipIndexPersistence {
+			if err := search.Index(collection, recordset); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *MemoryBackend) updateWhere(name string, recordset *dal.RecordSet, target string) error {
+	if f, err := filter.Parse(target); err == nil {
+		if collection, err := self.GetCollection(name); err == nil {
+			matched := dal.NewRecordSet()
+
+			if err := self.QueryFunc(collection, f, func(record *dal.Record, err error, _ IndexPage) error {
+				if err == nil {
+					for _, update := range recordset.Records {
+						for k, v := range update.Fields {
+							record.Set(k, v)
+						}
+					}
+
+					matched.Push(record)
+				}
+
+				return err
+			}); err != nil {
+				return err
+			}
+
+			return self.upsert(name, matched, false)
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// enforce unique fields, unique field groups, and foreign key constraints for the given record.
+// This must be called with the write lock held.
+func (self *MemoryBackend) checkConstraints(table *memoryTable, key string, record *dal.Record) error {
+	collection := table.collection
+	uniqueGroups := make(map[string][]string)
+
+	for _, field := range collection.Fields {
+		if field.Unique {
+			uniqueGroups[field.Name] = []string{field.Name}
+		} else if field.UniqueGroup != `` {
+			uniqueGroups[`group:`+field.UniqueGroup] = append(uniqueGroups[`group:`+field.UniqueGroup], field.Name)
+		}
+	}
+
+	for _, fields := range uniqueGroups {
+		for otherKey, other := range table.records {
+			if otherKey == key || collection.IsExpired(other) {
+				continue
+			}
+
+			duplicate := true
+
+			for _, field := range fields {
+				if !memoryValuesEqual(record.Get(field), other.Get(field)) {
+					duplicate = false
+					break
+				}
+			}
+
+			if duplicate {
+				return fmt.Errorf("%v: unique constraint violation on %s", collection.Name, strings.Join(fields, `, `))
+			}
+		}
+	}
+
+	for _, constraint := range collection.GetAllConstraints() {
+		localFields := sliceutil.Stringify(constraint.On)
+		remoteFields := sliceutil.Stringify(constraint.Field)
+		values := memoryFieldValues(collection, record, localFields)
+
+		// constraints only apply to records that reference something
+		if len(sliceutil.Compact(values)) == 0 {
+			continue
+		}
+
+		if remote, ok := self.tables[constraint.Collection]; ok {
+			var found bool
+
+			for _, other := range remote.records {
+				found = true
+
+				for i, otherValue := range memoryFieldValues(remote.collection, other, remoteFields) {
+					if i >= len(values) || !memoryValuesEqual(values[i], otherValue) {
+						found = false
+						break
+					}
+				}
+
+				if found {
+					break
+				}
+			}
+
+			if !found {
+				return fmt.Errorf(
+					"%v: foreign key constraint violation: %v not found in %v",
+					collection.Name,
+					strings.Join(localFields, `, `),
+					constraint.Collection,
+				)
+			}
+		} else {
+			return fmt.Errorf("%v: constraint references unknown collection %q", collection.Name, constraint.Collection)
+		}
+	}
+
+	return nil
+}
+
+func (self *MemoryBackend) loadSnapshot() error {
+	if file, err := os.Open(self.snapshotPath); err == nil {
+		defer file.Close()
+
+		var snapshot memorySnapshot
+
+		if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+			return fmt.Errorf("invalid snapshot %v: %v", self.snapshotPath, err)
+		}
+
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		for _, collection := range snapshot.Collections {
+			if registered, ok := self.registeredCollections[collection.Name]; ok {
+				collection = registered
+			}
+
+			table := &memoryTable{
+				collection: collection,
+				records:    make(map[string]*dal.Record),
+			}
+
+			for _, record := range snapshot.Records[collection.Name] {
+				loaded := dal.NewRecord(nil)
+
+				if err := loaded.Copy(record, collection); err != nil {
+					return err
+				}
+
+				if key, err := self.keyFor(collection, loaded); err == nil {
+					table.records[key] = loaded
+
+					if id := typeutil.Int(loaded.ID); id > table.lastID {
+						table.lastID = id
+					}
+				} else {
+					return err
+				}
+			}
+
+			self.tables[collection.Name] = table
+		}
+
+		return nil
+	} else if os.IsNotExist(err) {
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *MemoryBackend) writeSnapshot() error {
+	snapshot := memorySnapshot{
+		Records: make(map[string][]*dal.Record),
+	}
+
+	self.lock.RLock()
+
+	for _, table := range self.tables {
+		snapshot.Collections = append(snapshot.Collections, table.collection)
+
+		for _, record := range self.sortedRecords(table) {
+			snapshot.Records[table.collection.Name] = append(snapshot.Records[table.collection.Name], record)
+		}
+	}
+
+	data, err := json.MarshalIndent(&snapshot, ``, `  `)
+	self.lock.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that a failed write doesn't clobber the last snapshot
+	if tmp, err := ioutil.TempFile(filepath.Dir(self.snapshotPath), `.pivot-memory-`); err == nil {
+		defer os.Remove(tmp.Name())
+
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return err
+		}
+
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		return os.Rename(tmp.Name(), self.snapshotPath)
+	} else {
+		return err
+	}
+}
+
+// returns all unexpired records in the table, ordered by their keys.  This must be called with
+// the read lock held.
+func (self *MemoryBackend) sortedRecords(table *memoryTable) []*dal.Record {
+	records := make([]*dal.Record, 0, len(table.records))
+
+	for _, record := range table.records {
+		if !table.collection.IsExpired(record) {
+			records = append(records, record)
+		}
+	}
+
+	sort.SliceStable(records, func(i int, j int) bool {
+		a := records[i].Keys(table.collection)
+		b := records[j].Keys(table.collection)
+
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if c := memoryCompare(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+
+		return len(a) < len(b)
+	})
+
+	return records
+}
+
+func memoryCopyRecord(record *dal.Record) *dal.Record {
+	out := dal.NewRecord(record.ID)
+	out.Data = record.Data
+
+	for k, v := range record.Fields {
+		out.Fields[k] = memoryCopyValue(v)
+	}
+
+	return out
+}
+
+func memoryCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+
+		for k, item := range v {
+			out[k] = memoryCopyValue(item)
+		}
+
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+
+		for i, item := range v {
+			out[i] = memoryCopyValue(item)
+		}
+
+		return out
+	default:
+		return value
+	}
+}
+
+func memoryValuesEqual(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return memoryCompare(a, b) == 0
+}
+
+// compares two values, returning -1, 0, or 1.  Numbers and times are compared by value, nil sorts
+// before everything else, and everything else is compared as strings.
+func memoryCompare(a interface{}, b interface{}) int {
+	if a == nil && b == nil {
+		return 0
+	} else if a == nil {
+		return -1
+	} else if b == nil {
+		return 1
+	}
+
+	if aT, ok := a.(time.Time); ok {
+		if bT, ok := b.(time.Time); ok {
+			switch {
+			case aT.Before(bT):
+				return -1
+			case aT.After(bT):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	if typeutil.IsNumeric(a) && typeutil.IsNumeric(b) {
+		aF := typeutil.Float(a)
+		bF := typeutil.Float(b)
+
+		switch {
+		case aF < bF:
+			return -1
+		case aF > bF:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(typeutil.String(a), typeutil.String(b))
+}
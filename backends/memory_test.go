@@ -0,0 +1,315 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func testMemoryCollections() (*dal.Collection, *dal.Collection) {
+	groups := &dal.Collection{
+		Name:              `groups`,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `name`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	users := &dal.Collection{
+		Name:              `users`,
+		IdentityFieldType: dal.IntType,
+		TimeToLiveField:   `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name:   `email`,
+				Type:   dal.StringType,
+				Unique: true,
+			}, {
+				Name:      `group`,
+				Type:      dal.StringType,
+				BelongsTo: `groups`,
+			}, {
+				Name: `age`,
+				Type: dal.IntType,
+			}, {
+				Name: `expires_at`,
+				Type: dal.TimeType,
+			},
+		},
+	}
+
+	return groups, users
+}
+
+func TestMemoryBackend(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	groups, users := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.CreateCollection(users))
+	assert.Error(backend.CreateCollection(users))
+
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`admins`).Set(`name`, `Administrators`),
+		dal.NewRecord(`staff`).Set(`name`, `Staff`),
+	)))
+
+	// IDs are generated for records that don't specify one
+	recordset := dal.NewRecordSet(
+		dal.NewRecord(nil).SetFields(map[string]interface{}{`email`: `a@example.com`, `group`: `admins`, `age`: 30}),
+		dal.NewRecord(nil).SetFields(map[string]interface{}{`email`: `b@example.com`, `group`: `staff`, `age`: 40}),
+		dal.NewRecord(nil).SetFields(map[string]interface{}{`email`: `c@example.com`, `group`: `staff`, `age`: 50}),
+	)
+
+	assert.NoError(backend.Insert(`users`, recordset))
+	assert.Equal(int64(1), recordset.Records[0].ID)
+	assert.Equal(int64(3), recordset.Records[2].ID)
+	assert.True(backend.Exists(`users`, `1`))
+	assert.True(backend.Exists(`users`, 1))
+
+	// duplicate IDs, unique fields, and missing foreign keys are rejected
+	assert.Error(backend.Insert(`users`, dal.NewRecordSet(dal.NewRecord(1).Set(`email`, `z@example.com`))))
+	assert.Error(backend.Insert(`users`, dal.NewRecordSet(dal.NewRecord(4).Set(`email`, `a@example.com`))))
+	assert.Error(backend.Insert(`users`, dal.NewRecordSet(dal.NewRecord(4).Set(`group`, `nobody`))))
+	assert.False(backend.Exists(`users`, 4))
+
+	// updates merge into the existing record
+	assert.NoError(backend.Update(`users`, dal.NewRecordSet(dal.NewRecord(1).Set(`age`, 31))))
+	record, err := backend.Retrieve(`users`, 1)
+	assert.NoError(err)
+	assert.Equal(int64(31), record.Get(`age`))
+	assert.Equal(`a@example.com`, record.Get(`email`))
+
+	// records that have expired are not returned
+	assert.NoError(backend.Update(`users`, dal.NewRecordSet(dal.NewRecord(3).Set(`expires_at`, time.Now().Add(-time.Minute)))))
+	assert.False(backend.Exists(`users`, 3))
+
+	f := filter.All()
+	f.Sort = []string{`-age`}
+
+	recordset, err = backend.WithSearch(users).Query(users, f)
+	assert.NoError(err)
+	assert.Equal(int64(2), recordset.ResultCount)
+	assert.Equal(int64(2), recordset.Records[0].ID)
+	assert.Equal(int64(1), recordset.Records[1].ID)
+
+	values, err := backend.WithSearch(users).ListValues(users, []string{`group`}, filter.All())
+	assert.NoError(err)
+	assert.ElementsMatch([]interface{}{`admins`, `staff`}, values[`group`])
+
+	aggregator := backend.WithAggregator(users)
+
+	sum, err := aggregator.Sum(users, `age`)
+	assert.NoError(err)
+	assert.Equal(float64(71), sum)
+
+	count, err := aggregator.Count(users, filter.MustParse(`group/staff`))
+	assert.NoError(err)
+	assert.Equal(uint64(1), count)
+
+	assert.NoError(backend.Insert(`users`, dal.NewRecordSet(
+		dal.NewRecord(nil).SetFields(map[string]interface{}{`email`: `d@example.com`, `group`: `staff`, `age`: 60}),
+	)))
+
+	grouped, err := aggregator.GroupBy(users, []string{`group`}, []filter.Aggregate{
+		{Aggregation: filter.Sum, Field: `age`},
+	})
+
+	assert.NoError(err)
+	assert.Len(grouped.Records, 2)
+	assert.Equal(`admins`, grouped.Records[0].Get(`group`))
+	assert.Equal(float64(31), grouped.Records[0].Get(`age`))
+	assert.Equal(`staff`, grouped.Records[1].Get(`group`))
+	assert.Equal(float64(100), grouped.Records[1].Get(`age`))
+
+	total, _ := filter.ParseAggregate(`total=sum:age`)
+	n, _ := filter.ParseAggregate(`count`)
+
+	grouped, err = GroupByQueryContext(context.Background(), aggregator, users, &GroupByQuery{
+		Fields:     []string{`group`},
+		Aggregates: []filter.Aggregate{total, n},
+		Sort:       []string{`-total`},
+	})
+
+	assert.NoError(err)
+	assert.Len(grouped.Records, 2)
+	assert.Equal(`staff`, grouped.Records[0].Get(`group`))
+	assert.Equal(float64(100), grouped.Records[0].Get(`total`))
+	assert.Equal(2, grouped.Records[0].Get(`count`))
+	assert.Equal(`admins`, grouped.Records[1].Get(`group`))
+
+	grouped, err = GroupByQueryContext(context.Background(), aggregator, users, &GroupByQuery{
+		Fields:     []string{`group`},
+		Aggregates: []filter.Aggregate{total, n},
+		Having:     filter.MustParse(`count/gt:1`),
+		Limit:      1,
+	})
+
+	assert.NoError(err)
+	assert.Len(grouped.Records, 1)
+	assert.Equal(`staff`, grouped.Records[0].Get(`group`))
+
+	assert.NoError(backend.WithSearch(users).DeleteQuery(users, filter.MustParse(`group/staff`)))
+	assert.False(backend.Exists(`users`, 2))
+	assert.True(backend.Exists(`users`, 1))
+}
+
+// records the IDs of everything indexed and removed from the index
+type recordingIndexer struct {
+	Indexer
+	indexed []interface{}
+	removed []interface{}
+}
+
+func (self *recordingIndexer) Index(collection *dal.Collection, records *dal.RecordSet) error {
+	for _, record := range records.Records {
+		self.indexed = append(self.indexed, record.ID)
+	}
+
+	return nil
+}
+
+func (self *recordingIndexer) IndexRemove(collection *dal.Collection, ids []interface{}) error {
+	self.removed = append(self.removed, ids...)
+	return nil
+}
+
+func TestMemoryBackendExternalIndexer(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`)).(*MemoryBackend)
+	indexer := &recordingIndexer{
+		Indexer: NewMemoryBackend(dal.MustParseConnectionString(`memory://`)).(*MemoryBackend),
+	}
+
+	assert.NoError(backend.AttachIndexer(indexer))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`admins`).Set(`name`, `Administrators`),
+		dal.NewRecord(`staff`).Set(`name`, `Staff`),
+	)))
+
+	assert.Equal([]interface{}{`admins`, `staff`}, indexer.indexed)
+
+	// deleted records are removed from the index too
+	assert.NoError(backend.Delete(`groups`, `staff`))
+	assert.Equal([]interface{}{`staff`}, indexer.removed)
+
+	// deleting a collection forgets its definition
+	assert.NoError(backend.DeleteCollection(`groups`))
+	assert.NotContains(backend.registeredCollections, `groups`)
+	_, err := backend.GetCollection(`groups`)
+	assert.Error(err)
+}
+
+func TestMemoryBackendSnapshot(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-memory-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	conn := dal.MustParseConnectionString(`memory:///` + filepath.Join(root, `snapshot.json`))
+	backend := NewMemoryBackend(conn)
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`admins`).Set(`name`, `Administrators`),
+	)))
+
+	assert.NoError(backend.Flush())
+
+	restored := NewMemoryBackend(conn)
+	assert.NoError(restored.Initialize())
+
+	names, err := restored.ListCollections()
+	assert.NoError(err)
+	assert.Equal([]string{`groups`}, names)
+
+	record, err := restored.Retrieve(`groups`, `admins`)
+	assert.NoError(err)
+	assert.Equal(`Administrators`, record.Get(`name`))
+}
+
+func TestMemoryBackendCursorPagination(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	_, users := testMemoryCollections()
+	users.Fields[1].BelongsTo = ``
+	assert.NoError(backend.CreateCollection(users))
+
+	recordset := dal.NewRecordSet()
+
+	for i, age := range []int{30, 40, 30, 50, 40, 30, 20} {
+		recordset.Push(dal.NewRecord(i+1).Set(`age`, age).Set(`email`, fmt.Sprintf("user%d@example.com", i)))
+	}
+
+	assert.NoError(backend.Insert(`users`, recordset))
+
+	ids := make([]interface{}, 0)
+	cursor := filter.CursorStart
+
+	for cursor != `` {
+		f := filter.All()
+		f.Sort = []string{`-age`}
+		f.Limit = 2
+		f.Cursor = cursor
+
+		page, err := backend.WithSearch(users).Query(users, f)
+		assert.NoError(err)
+		assert.EqualValues(7, page.ResultCount)
+
+		for _, record := range page.Records {
+			ids = append(ids, record.ID)
+		}
+
+		cursor = page.NextCursor
+	}
+
+	// ties are broken by ID
+	assert.Equal([]interface{}{int64(4), int64(2), int64(5), int64(1), int64(3), int64(6), int64(7)}, ids)
+}
+
+func TestMemoryBackendFulltext(t *testing.T) {
+	assert := require.New(t)
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `The quick brown fox jumps over the lazy dog`),
+		dal.NewRecord(`b`).Set(`name`, `Quick brown fox`),
+		dal.NewRecord(`c`).Set(`name`, `A slow red turtle`),
+	)))
+
+	f := filter.MustParse(`name/fulltext:QUICK fox`)
+	f.Sort = []string{`-_score`}
+
+	results, err := backend.WithSearch(groups).Query(groups, f)
+	assert.NoError(err)
+	assert.Len(results.Records, 2)
+
+	// shorter text with the same matching terms is more relevant
+	assert.Equal(`b`, results.Records[0].ID)
+	assert.Equal(`a`, results.Records[1].ID)
+	assert.True(results.Records[0].Get(`_score`).(float64) > results.Records[1].Get(`_score`).(float64))
+}
@@ -0,0 +1,356 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+)
+
+// The name of the collection used to record which migrations have been applied.
+var MigrationsCollection = `_pivot_migrations`
+
+// Migrator is implemented by backends that can apply versioned schema migrations.
+type Migrator interface {
+	// Returns the native statements that applying the given step would execute.
+	MigrationStatements(step dal.MigrationStep) ([]string, error)
+
+	// Applies the given step, updating the collection's registered definition to match.
+	ApplyMigrationStep(step dal.MigrationStep) error
+}
+
+// Implemented by migrators that can apply all of a migration's steps and record the outcome in the
+// migration history atomically.  The record function is called with a backend scoped to the same
+// transaction as the steps.
+type TransactionalMigrator interface {
+	ApplyMigrationSteps(steps []dal.MigrationStep, record func(tx Backend) error) error
+}
+
+// Describes whether a given migration has been applied, and when.  Migrations that failed partway
+// through on backends that cannot apply them atomically describe the step that failed in Failed.
+type MigrationStatus struct {
+	Version     string    `json:"version"`
+	Description string    `json:"description,omitempty"`
+	Applied     bool      `json:"applied"`
+	AppliedAt   time.Time `json:"applied_at,omitempty"`
+	Failed      string    `json:"failed,omitempty"`
+}
+
+// Describes a migration that was applied or reverted (or would have been, in a dry run).
+type MigrationResult struct {
+	Version    string                 `json:"version"`
+	Direction  dal.MigrationDirection `json:"direction"`
+	Statements []string               `json:"statements"`
+}
+
+// A MigrationRunner applies and reverts a set of migrations against a backend, recording which
+// migrations have been applied in the MigrationsCollection.
+type MigrationRunner struct {
+	// If true, no changes are made; results contain the statements that would have been executed.
+	DryRun     bool
+	backend    Backend
+	migrator   Migrator
+	migrations []*dal.Migration
+}
+
+func NewMigrationRunner(backend Backend, migrations ...*dal.Migration) (*MigrationRunner, error) {
+	migrator, ok := backend.(Migrator)
+
+	if !ok {
+		return nil, fmt.Errorf("backend %v does not support migrations", backend)
+	}
+
+	versions := make(map[string]bool)
+
+	for _, migration := range migrations {
+		if err := migration.Validate(); err != nil {
+			return nil, err
+		} else if versions[migration.Version] {
+			return nil, fmt.Errorf("duplicate migration version %v", migration.Version)
+		}
+
+		versions[migration.Version] = true
+	}
+
+	sorted := make([]*dal.Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return dal.MigrationVersionLess(sorted[i].Version, sorted[j].Version)
+	})
+
+	return &MigrationRunner{
+		backend:    backend,
+		migrator:   migrator,
+		migrations: sorted,
+	}, nil
+}
+
+// Returns the status of every known migration, in the order they would be applied.
+func (self *MigrationRunner) Status() ([]MigrationStatus, error) {
+	statuses := make([]MigrationStatus, 0, len(self.migrations))
+
+	if history, err := self.history(); err == nil {
+		for _, migration := range self.migrations {
+			status := MigrationStatus{
+				Version:     migration.Version,
+				Description: migration.Description,
+			}
+
+			if record, ok := history[migration.Version]; ok {
+				if failed := typeutil.String(record.Get(`failed`)); failed != `` {
+					status.Failed = failed
+				} else {
+					status.Applied = true
+					status.AppliedAt = typeutil.V(record.Get(`applied_at`)).Time()
+				}
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		return statuses, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Applies all pending migrations up to and including the given version.  If no version is given,
+// all pending migrations are applied.
+func (self *MigrationRunner) Up(target string) ([]*MigrationResult, error) {
+	results := make([]*MigrationResult, 0)
+
+	if target != `` && !self.hasVersion(target) {
+		return nil, fmt.Errorf("unknown migration version %v", target)
+	}
+
+	if history, err := self.history(); err == nil {
+		if err := checkFailedMigrations(history); err != nil {
+			return nil, err
+		}
+
+		for _, migration := range self.migrations {
+			if target != `` && dal.MigrationVersionLess(target, migration.Version) {
+				break
+			} else if _, ok := history[migration.Version]; ok {
+				continue
+			}
+
+			if result, err := self.run(migration, dal.MigrateUp); err == nil {
+				results = append(results, result)
+			} else {
+				return results, err
+			}
+		}
+
+		return results, nil
+	} else {
+		return nil, err
+	}
+}
+
+// Reverts the given number of most recently-applied migrations.
+func (self *MigrationRunner) Down(steps int) ([]*MigrationResult, error) {
+	results := make([]*MigrationResult, 0)
+
+	if history, err := self.history(); err == nil {
+		if err := checkFailedMigrations(history); err != nil {
+			return nil, err
+		}
+
+		for i := len(self.migrations) - 1; i >= 0 && len(results) < steps; i-- {
+			migration := self.migrations[i]
+
+			if _, ok := history[migration.Version]; !ok {
+				continue
+			}
+
+			if result, err := self.run(migration, dal.MigrateDown); err == nil {
+				results = append(results, result)
+			} else {
+				return results, err
+			}
+		}
+
+		return results, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *MigrationRunner) hasVersion(version string) bool {
+	for _, migration := range self.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applies (or, in a dry run, describes) each step of the migration in the given direction, then
+// records the outcome in the migration history.
+func (self *MigrationRunner) run(migration *dal.Migration, direction dal.MigrationDirection) (*MigrationResult, error) {
+	result := &MigrationResult{
+		Version:    migration.Version,
+		Direction:  direction,
+		Statements: make([]string, 0),
+	}
+
+	steps := migration.Steps(direction)
+
+	// reverting a migration with no down steps would leave the schema migrated while recording
+	// that it isn't
+	if direction == dal.MigrateDown && len(steps) == 0 {
+		return result, fmt.Errorf("migration %v is irreversible", migration.Version)
+	}
+
+	for i, step := range steps {
+		if stmts, err := self.migrator.MigrationStatements(step); err == nil {
+			result.Statements = append(result.Statements, stmts...)
+		} else {
+			return result, fmt.Errorf("migration %v: %s step %d: %v", migration.Version, direction, i+1, err)
+		}
+	}
+
+	if self.DryRun {
+		return result, nil
+	}
+
+	if err := self.createHistoryCollection(); err != nil {
+		return result, err
+	}
+
+	if tm, ok := self.migrator.(TransactionalMigrator); ok {
+		querylog.Debugf("[%v] migration %v: %s", self.backend, migration.Version, direction)
+
+		if err := tm.ApplyMigrationSteps(steps, func(tx Backend) error {
+			return self.record(tx, migration, direction)
+		}); err != nil {
+			return result, fmt.Errorf("migration %v: %s %v", migration.Version, direction, err)
+		}
+
+		return result, nil
+	}
+
+	for i, step := range steps {
+		querylog.Debugf("[%v] migration %v: %s step %d: %v", self.backend, migration.Version, direction, i+1, step)
+
+		if err := self.migrator.ApplyMigrationStep(step); err != nil {
+			err = fmt.Errorf("migration %v: %s step %d: %v", migration.Version, direction, i+1, err)
+
+			// the steps before this one can't be undone, so the migration is marked as failed
+			// until the schema has been repaired by hand
+			if i > 0 {
+				if rerr := self.backend.Upsert(MigrationsCollection, dal.NewRecordSet(
+					dal.NewRecord(migration.Version).Set(
+						`description`, migration.Description,
+					).Set(
+						`failed`, fmt.Sprintf("%s step %d", direction, i+1),
+					),
+				)); rerr != nil {
+					return result, fmt.Errorf("%v (and recording the failure failed: %v)", err, rerr)
+				}
+			}
+
+			return result, err
+		}
+	}
+
+	return result, self.record(self.backend, migration, direction)
+}
+
+// records that the given migration was applied (or removes the record of it, if it was reverted.)
+func (self *MigrationRunner) record(backend Backend, migration *dal.Migration, direction dal.MigrationDirection) error {
+	if direction == dal.MigrateDown {
+		return backend.Delete(MigrationsCollection, migration.Version)
+	} else {
+		return backend.Insert(MigrationsCollection, dal.NewRecordSet(
+			dal.NewRecord(migration.Version).Set(
+				`description`, migration.Description,
+			).Set(
+				`applied_at`, time.Now(),
+			),
+		))
+	}
+}
+
+// refuses to apply or revert any migrations while one of them is only partially applied.
+func checkFailedMigrations(history map[string]*dal.Record) error {
+	versions := make([]string, 0, len(history))
+
+	for version := range history {
+		versions = append(versions, version)
+	}
+
+	sort.Strings(versions)
+
+	for _, version := range versions {
+		if failed := typeutil.String(history[version].Get(`failed`)); failed != `` {
+			return fmt.Errorf(
+				"migration %v failed at %s after earlier steps were applied; repair the schema and remove %v from %v before continuing",
+				version,
+				failed,
+				version,
+				MigrationsCollection,
+			)
+		}
+	}
+
+	return nil
+}
+
+// retrieves the history records for all known migrations, keyed on version.
+func (self *MigrationRunner) history() (map[string]*dal.Record, error) {
+	history := make(map[string]*dal.Record)
+
+	if _, err := self.backend.GetCollection(MigrationsCollection); err != nil {
+		if dal.IsCollectionNotFoundErr(err) {
+			return history, nil
+		} else {
+			return nil, err
+		}
+	}
+
+	for _, migration := range self.migrations {
+		if self.backend.Exists(MigrationsCollection, migration.Version) {
+			if record, err := self.backend.Retrieve(MigrationsCollection, migration.Version); err == nil {
+				history[migration.Version] = record
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	return history, nil
+}
+
+func (self *MigrationRunner) createHistoryCollection() error {
+	if _, err := self.backend.GetCollection(MigrationsCollection); err == nil {
+		return nil
+	} else if dal.IsCollectionNotFoundErr(err) {
+		collection := &dal.Collection{
+			Name:              MigrationsCollection,
+			IdentityField:     dal.DefaultIdentityField,
+			IdentityFieldType: dal.StringType,
+			Fields: []dal.Field{
+				{
+					Name: `description`,
+					Type: dal.StringType,
+				}, {
+					Name: `applied_at`,
+					Type: dal.TimeType,
+				}, {
+					Name: `failed`,
+					Type: dal.StringType,
+				},
+			},
+		}
+
+		return self.backend.CreateCollection(collection)
+	} else {
+		return err
+	}
+}
@@ -0,0 +1,380 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrations() []*dal.Migration {
+	return []*dal.Migration{
+		{
+			Version:     `002`,
+			Description: `rename name to full_name, backfill status`,
+			Up: []dal.MigrationStep{
+				{
+					Operation:  dal.RenameFieldOperation,
+					Collection: `TestMigrations`,
+					Field:      `name`,
+					To:         `full_name`,
+				}, {
+					Operation:  dal.BackfillOperation,
+					Collection: `TestMigrations`,
+					Filter:     `full_name/first`,
+					Set: map[string]interface{}{
+						`status`: `active`,
+					},
+				},
+			},
+			Down: []dal.MigrationStep{
+				{
+					Operation:  dal.RenameFieldOperation,
+					Collection: `TestMigrations`,
+					Field:      `full_name`,
+					To:         `name`,
+				},
+			},
+		}, {
+			Version:     `001`,
+			Description: `add status`,
+			Up: []dal.MigrationStep{
+				{
+					Operation:  dal.AddFieldOperation,
+					Collection: `TestMigrations`,
+					Definition: &dal.Field{
+						Name:         `status`,
+						Type:         dal.StringType,
+						DefaultValue: `pending`,
+					},
+				},
+			},
+			Down: []dal.MigrationStep{
+				{
+					Operation:  dal.DropFieldOperation,
+					Collection: `TestMigrations`,
+					Field:      `status`,
+				},
+			},
+		},
+	}
+}
+
+func testMigrationRunner(t *testing.T, backend Backend) {
+	assert := require.New(t)
+	collection := testTransactionCollection(`TestMigrations`)
+
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `first`),
+		dal.NewRecord(`b`).Set(`name`, `second`),
+	)))
+
+	runner, err := NewMigrationRunner(backend, testMigrations()...)
+	assert.NoError(err)
+
+	status, err := runner.Status()
+	assert.NoError(err)
+	assert.Len(status, 2)
+	assert.Equal(`001`, status[0].Version)
+	assert.False(status[0].Applied)
+
+	// dry runs describe the changes without making them
+	runner.DryRun = true
+	results, err := runner.Up(``)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.NotEmpty(results[0].Statements)
+
+	status, err = runner.Status()
+	assert.NoError(err)
+	assert.False(status[0].Applied)
+
+	// apply the first migration only
+	runner.DryRun = false
+	results, err = runner.Up(`001`)
+	assert.NoError(err)
+	assert.Len(results, 1)
+
+	record, err := backend.Retrieve(collection.Name, `a`)
+	assert.NoError(err)
+	assert.Equal(`pending`, record.Get(`status`))
+
+	// apply the rest
+	results, err = runner.Up(``)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(`002`, results[0].Version)
+
+	status, err = runner.Status()
+	assert.NoError(err)
+	assert.True(status[0].Applied)
+	assert.True(status[1].Applied)
+	assert.False(status[1].AppliedAt.IsZero())
+
+	record, err = backend.Retrieve(collection.Name, `a`)
+	assert.NoError(err)
+	assert.Equal(`first`, record.Get(`full_name`))
+	assert.Equal(`active`, record.Get(`status`))
+
+	record, err = backend.Retrieve(collection.Name, `b`)
+	assert.NoError(err)
+	assert.Equal(`pending`, record.Get(`status`))
+
+	// nothing left to apply
+	results, err = runner.Up(``)
+	assert.NoError(err)
+	assert.Empty(results)
+
+	// revert the most recent migration
+	results, err = runner.Down(1)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(`002`, results[0].Version)
+
+	record, err = backend.Retrieve(collection.Name, `a`)
+	assert.NoError(err)
+	assert.Equal(`first`, record.Get(`name`))
+
+	status, err = runner.Status()
+	assert.NoError(err)
+	assert.True(status[0].Applied)
+	assert.False(status[1].Applied)
+}
+
+// a migration whose second step fails once the first has been applied
+func testFailingMigration() *dal.Migration {
+	return &dal.Migration{
+		Version: `003`,
+		Up: []dal.MigrationStep{
+			{
+				Operation:  dal.AddFieldOperation,
+				Collection: `TestMigrations`,
+				Definition: &dal.Field{
+					Name: `notes`,
+					Type: dal.StringType,
+				},
+			}, {
+				Operation:  dal.RenameFieldOperation,
+				Collection: `TestMigrations`,
+				Field:      `missing`,
+				To:         `other`,
+			},
+		},
+	}
+}
+
+func TestSqlMigrations(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`))
+	assert.NoError(backend.Initialize())
+
+	testMigrationRunner(t, backend)
+
+	statements, err := backend.(Migrator).MigrationStatements(dal.MigrationStep{
+		Operation:  dal.DropFieldOperation,
+		Collection: `TestMigrations`,
+		Field:      `status`,
+	})
+
+	assert.NoError(err)
+	assert.Equal([]string{`ALTER TABLE "TestMigrations" DROP COLUMN "status"`}, statements)
+
+	// a failed step undoes the steps before it, so the migration can be fixed and run again
+	runner, err := NewMigrationRunner(backend, append(testMigrations(), testFailingMigration())...)
+	assert.NoError(err)
+
+	_, err = runner.Up(``)
+	assert.Error(err)
+
+	detected, err := backend.(*SqlBackend).refreshCollectionFunc(``, `TestMigrations`)
+	assert.NoError(err)
+
+	_, ok := detected.GetField(`notes`)
+	assert.False(ok)
+
+	status, err := runner.Status()
+	assert.NoError(err)
+	assert.False(status[2].Applied)
+	assert.Empty(status[2].Failed)
+
+	fixed := testFailingMigration()
+	fixed.Up = fixed.Up[:1]
+
+	runner, err = NewMigrationRunner(backend, append(testMigrations(), fixed)...)
+	assert.NoError(err)
+
+	results, err := runner.Up(``)
+	assert.NoError(err)
+	assert.Len(results, 1)
+}
+
+func TestFilesystemMigrations(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-migrate-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	testMigrationRunner(t, backend)
+
+	// steps can't be undone here, so a migration that fails partway through is recorded as such
+	// and no further migrations are run until it has been dealt with
+	runner, err := NewMigrationRunner(backend, append(testMigrations(), testFailingMigration())...)
+	assert.NoError(err)
+
+	_, err = runner.Up(``)
+	assert.Error(err)
+
+	status, err := runner.Status()
+	assert.NoError(err)
+	assert.False(status[2].Applied)
+	assert.Equal(`up step 2`, status[2].Failed)
+
+	_, err = runner.Up(``)
+	assert.Error(err)
+
+	_, err = runner.Down(1)
+	assert.Error(err)
+
+	assert.NoError(backend.Delete(MigrationsCollection, `003`))
+
+	_, err = runner.Down(1)
+	assert.NoError(err)
+}
+
+func TestMigrationRunnerValidation(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`))
+
+	_, err := NewMigrationRunner(backend, &dal.Migration{
+		Version: `001`,
+		Up: []dal.MigrationStep{
+			{
+				Operation:  dal.RenameFieldOperation,
+				Collection: `TestMigrations`,
+				Field:      `name`,
+			},
+		},
+	})
+
+	assert.Error(err)
+
+	_, err = NewMigrationRunner(backend, &dal.Migration{Version: `001`}, &dal.Migration{Version: `001`})
+	assert.Error(err)
+
+	_, err = NewMigrationRunner(NewMemoryBackend(dal.MustParseConnectionString(`memory://`)))
+	assert.Error(err)
+}
+
+func TestMigrationVersionOrder(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`))
+
+	runner, err := NewMigrationRunner(backend,
+		&dal.Migration{Version: `10`},
+		&dal.Migration{Version: `2`},
+		&dal.Migration{Version: `1`},
+	)
+
+	assert.NoError(err)
+
+	var versions []string
+
+	for _, migration := range runner.migrations {
+		versions = append(versions, migration.Version)
+	}
+
+	assert.Equal([]string{`1`, `2`, `10`}, versions)
+}
+
+func TestIrreversibleMigration(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-migrate-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+	assert.NoError(backend.CreateCollection(&dal.Collection{
+		Name: `TestMigrations`,
+	}))
+
+	runner, err := NewMigrationRunner(backend, &dal.Migration{
+		Version: `001`,
+		Up: []dal.MigrationStep{
+			{
+				Operation:  dal.AddFieldOperation,
+				Collection: `TestMigrations`,
+				Definition: &dal.Field{
+					Name: `status`,
+					Type: dal.StringType,
+				},
+			},
+		},
+	})
+
+	assert.NoError(err)
+
+	_, err = runner.Up(``)
+	assert.NoError(err)
+
+	_, err = runner.Down(1)
+	assert.EqualError(err, `migration 001 is irreversible`)
+
+	status, err := runner.Status()
+	assert.NoError(err)
+	assert.True(status[0].Applied)
+}
+
+func TestSqliteChangeTypeMigration(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary?foreign_keys=true`))
+	assert.NoError(backend.Initialize())
+
+	collection := dal.NewCollection(`TestSqliteChangeType`).AddFields(dal.Field{
+		Name: `count`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	})
+
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`count`, `42`).Set(`name`, `first`),
+	)))
+
+	step := dal.MigrationStep{
+		Operation:  dal.ChangeTypeOperation,
+		Collection: collection.Name,
+		Field:      `count`,
+		Definition: &dal.Field{
+			Type: dal.IntType,
+		},
+	}
+
+	// sqlite can't change column types in place, so the table is rebuilt
+	statements, err := backend.(Migrator).MigrationStatements(step)
+	assert.NoError(err)
+	assert.Len(statements, 4)
+	assert.Contains(statements[0], `CREATE TABLE "_pivot_rebuild_TestSqliteChangeType"`)
+
+	assert.NoError(backend.(Migrator).ApplyMigrationStep(step))
+
+	actual, err := backend.GetCollection(collection.Name)
+	assert.NoError(err)
+
+	field, ok := actual.GetField(`count`)
+	assert.True(ok)
+	assert.EqualValues(dal.IntType, field.Type)
+
+	record, err := backend.Retrieve(collection.Name, 1)
+	assert.NoError(err)
+	assert.EqualValues(42, record.Get(`count`))
+	assert.Equal(`first`, record.Get(`name`))
+}
@@ -3,8 +3,8 @@ package backends
 // this file satifies the Aggregator interface for MongoBackend
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/PerformLine/go-stockutil/stringutil"
@@ -50,112 +50,262 @@ func (self *MongoBackend) Average(collection *dal.Collection, field string, f ..
 }
 
 func (self *MongoBackend) GroupBy(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
-	if result, err := self.aggregate(collection, groupBy, aggregates, flt, false); err == nil {
-		return result.(*dal.RecordSet), nil
-	} else {
-		return nil, err
-	}
-}
-
-func (self *MongoBackend) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (float64, error) {
-	if result, err := self.aggregate(collection, nil, []filter.Aggregate{
-		{
-			Aggregation: aggregation,
-			Field:       field,
-		},
-	}, flt, true); err == nil {
-		if vF, ok := result.(float64); ok {
-			return vF, nil
-		} else {
-			return 0, err
-		}
-	} else {
-		return 0, err
-	}
+	return self.GroupByContext(context.Background(), collection, groupBy, aggregates, flt...)
 }
 
-func (self *MongoBackend) aggregate(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt []*filter.Filter, single bool) (interface{}, error) {
+// GroupByContext calculates the given aggregates for each distinct combination of the groupBy
+// fields using a $group stage.  Percentile and median aggregates require MongoDB 7.0 or later.
+func (self *MongoBackend) GroupByContext(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, flt ...*filter.Filter) (*dal.RecordSet, error) {
 	var f *filter.Filter
 
 	if len(flt) > 0 {
 		f = flt[0]
 	}
 
-	if query, err := self.filterToNative(collection, f); err == nil {
-		var aggGroups []bson.M
-		var firstKey string
-
-		for _, aggregate := range aggregates {
-			var mongoFn string
-
-			switch aggregate.Aggregation {
-			case filter.Sum:
-				mongoFn = `$sum`
-			case filter.First:
-				mongoFn = `$first`
-			case filter.Last:
-				mongoFn = `$last`
-			case filter.Minimum:
-				mongoFn = `$min`
-			case filter.Maximum:
-				mongoFn = `$max`
-			case filter.Average:
-				mongoFn = `$avg`
-			}
+	var pipeline []bson.M
 
-			aggGroups = append(aggGroups, bson.M{
-				`$group`: bson.M{
-					`_id`: aggregate.Field,
-					strings.TrimPrefix(mongoFn, `$`): bson.M{
-						mongoFn: fmt.Sprintf("$%s", aggregate.Field),
-					},
-				},
+	if match, err := self.filterToNative(collection, aggregationFilter(f)); err == nil {
+		if len(match) > 0 {
+			pipeline = append(pipeline, bson.M{
+				`$match`: match,
 			})
+		}
+	} else {
+		return nil, fmt.Errorf("filter error: %v", err)
+	}
 
-			if firstKey == `` {
-				firstKey = strings.TrimPrefix(mongoFn, `$`)
+	var groupId interface{}
+
+	if len(groupBy) > 0 {
+		keys := bson.M{}
+
+		for i, field := range groupBy {
+			keys[fmt.Sprintf("g%d", i)] = `$` + mongoFieldName(collection, field)
+		}
+
+		groupId = keys
+	}
+
+	group := bson.M{
+		`_id`: groupId,
+	}
+
+	project := bson.M{
+		`_id`: 1,
+	}
+
+	for i, aggregate := range aggregates {
+		key := fmt.Sprintf("agg%d", i)
+		field := `$` + mongoFieldName(collection, aggregate.Field)
+		project[key] = 1
+
+		switch aggregate.Aggregation {
+		case filter.Count:
+			group[key] = bson.M{`$sum`: 1}
+		case filter.Sum:
+			group[key] = bson.M{`$sum`: field}
+		case filter.Average:
+			group[key] = bson.M{`$avg`: field}
+		case filter.Minimum:
+			group[key] = bson.M{`$min`: field}
+		case filter.Maximum:
+			group[key] = bson.M{`$max`: field}
+		case filter.First:
+			group[key] = bson.M{`$first`: field}
+		case filter.Last:
+			group[key] = bson.M{`$last`: field}
+		case filter.CountDistinct, filter.Cardinality:
+			group[key] = bson.M{`$addToSet`: field}
+			project[key] = bson.M{`$size`: `$` + key}
+		case filter.StdDev:
+			group[key] = bson.M{`$stdDevPop`: field}
+		case filter.Variance:
+			group[key] = bson.M{`$stdDevPop`: field}
+			project[key] = bson.M{`$pow`: []interface{}{`$` + key, 2}}
+		case filter.Percentile, filter.Median:
+			group[key] = bson.M{
+				`$percentile`: bson.M{
+					`input`:  field,
+					`p`:      []float64{aggregate.Quantile()},
+					`method`: `approximate`,
+				},
 			}
+
+			project[key] = bson.M{`$arrayElemAt`: []interface{}{`$` + key, 0}}
+		default:
+			return nil, fmt.Errorf("Unsupported aggregation %v", aggregate.Aggregation)
 		}
+	}
+
+	pipeline = append(pipeline, bson.M{
+		`$group`: group,
+	}, bson.M{
+		`$project`: project,
+	})
 
-		var finalQuery []bson.M
+	iter := self.db.C(collection.Name).Pipe(pipeline).Iter()
+	recordset := dal.NewRecordSet()
+	var result bson.M
 
-		if len(query) > 0 {
-			finalQuery = append(finalQuery, query)
+	for iter.Next(&result) {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return nil, err
 		}
 
-		finalQuery = append(finalQuery, aggGroups...)
-
-		q := self.db.C(collection.Name).Pipe(finalQuery)
-		iter := q.Iter()
-
-		var result map[string]interface{}
-
-		for iter.Next(&result) {
-			if err := iter.Err(); err != nil {
-				return nil, err
-			} else if single {
-				_id, _ := result[`_id`]
-
-				if v, ok := result[firstKey]; ok {
-					if vF, err := stringutil.ConvertToFloat(v); err == nil {
-						return vF, nil
-					} else if vT, err := stringutil.ConvertToTime(v); err == nil {
-						return float64(vT.UnixNano()) / float64(time.Second), nil
-					} else {
-						return 0, fmt.Errorf("'%s' aggregation not supported for field %v", firstKey, _id)
-					}
-				} else {
-					return 0, fmt.Errorf("missing aggregation value '%s'", firstKey)
-				}
-			} else {
-				return nil, fmt.Errorf("Not implemented")
+		record := dal.NewRecord(nil)
+
+		if keys, ok := result[`_id`].(bson.M); ok {
+			for i, field := range groupBy {
+				record.Set(field, keys[fmt.Sprintf("g%d", i)])
+			}
+		}
+
+		for i, aggregate := range aggregates {
+			record.Set(aggregate.ResultName(), result[fmt.Sprintf("agg%d", i)])
+		}
+
+		recordset.Push(record)
+		result = nil
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return recordset, nil
+}
+
+// DateHistogram groups the records matching the query into buckets using $dateTrunc, which
+// requires MongoDB 5.0 or later.
+func (self *MongoBackend) DateHistogram(ctx context.Context, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error) {
+	group := bson.M{
+		`_id`: bson.M{
+			`$dateTrunc`: bson.M{
+				`date`:        fmt.Sprintf("$%s", query.Field),
+				`unit`:        string(query.Interval),
+				`timezone`:    query.Location.String(),
+				`startOfWeek`: `monday`,
+			},
+		},
+	}
+
+	for _, aggregate := range query.Aggregates {
+		var mongoFn string
+
+		switch aggregate.Aggregation {
+		case filter.Count:
+			group[aggregate.ResultName()] = bson.M{
+				`$sum`: 1,
 			}
+
+			continue
+		case filter.Sum:
+			mongoFn = `$sum`
+		case filter.First:
+			mongoFn = `$first`
+		case filter.Last:
+			mongoFn = `$last`
+		case filter.Minimum:
+			mongoFn = `$min`
+		case filter.Maximum:
+			mongoFn = `$max`
+		case filter.Average:
+			mongoFn = `$avg`
+		default:
+			return nil, NotImplementedError
+		}
+
+		group[aggregate.ResultName()] = bson.M{
+			mongoFn: fmt.Sprintf("$%s", aggregate.Field),
 		}
+	}
+
+	var pipeline []bson.M
 
-		return nil, nil
+	if match, err := self.filterToNative(collection, query.sourceFilter(true)); err == nil {
+		if len(match) > 0 {
+			pipeline = append(pipeline, bson.M{
+				`$match`: match,
+			})
+		}
 	} else {
 		return nil, fmt.Errorf("filter error: %v", err)
 	}
+
+	pipeline = append(pipeline, bson.M{
+		`$group`: group,
+	}, bson.M{
+		`$sort`: bson.M{
+			`_id`: 1,
+		},
+	})
+
+	iter := self.db.C(collection.Name).Pipe(pipeline).Iter()
+	buckets := make([]*dal.Record, 0)
+	var result map[string]interface{}
+
+	for iter.Next(&result) {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		if start, ok := result[`_id`]; ok && start != nil {
+			bucket := dal.NewRecord(nil).Set(HistogramBucketField, start)
+
+			for _, aggregate := range query.Aggregates {
+				bucket.Set(aggregate.ResultName(), result[aggregate.ResultName()])
+			}
+
+			buckets = append(buckets, bucket)
+		}
+
+		result = nil
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return histogramRecordSet(query, buckets)
+}
+
+func (self *MongoBackend) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, flt []*filter.Filter) (float64, error) {
+	aggregate := filter.Aggregate{
+		Name:        `value`,
+		Aggregation: aggregation,
+		Field:       field,
+	}
+
+	if results, err := self.GroupBy(collection, nil, []filter.Aggregate{aggregate}, flt...); err == nil {
+		if len(results.Records) == 0 {
+			return 0, nil
+		}
+
+		v := results.Records[0].Get(aggregate.ResultName())
+
+		if v == nil {
+			return 0, nil
+		} else if vF, err := stringutil.ConvertToFloat(v); err == nil {
+			return vF, nil
+		} else if vT, err := stringutil.ConvertToTime(v); err == nil {
+			return float64(vT.UnixNano()) / float64(time.Second), nil
+		} else {
+			return 0, fmt.Errorf("'%v' aggregation not supported for field %v", aggregation, field)
+		}
+	} else {
+		return 0, err
+	}
+}
+
+// returns the name of the given field in MongoDB documents
+func mongoFieldName(collection *dal.Collection, field string) string {
+	if field == filter.DefaultIdentityField || collection.IsIdentityField(field) {
+		return MongoIdentityField
+	}
+
+	return field
 }
 
 func (self *MongoBackend) AggregatorConnectionString() *dal.ConnectionString {
@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -43,10 +44,37 @@ func (self *MongoBackend) Index(collection *dal.Collection, records *dal.RecordS
 }
 
 func (self *MongoBackend) QueryFunc(collection *dal.Collection, flt *filter.Filter, resultFn IndexResultFunc) error {
+	return self.QueryFuncContext(context.Background(), collection, flt, resultFn)
+}
+
+func (self *MongoBackend) QueryFuncContext(ctx context.Context, collection *dal.Collection, flt *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, flt, resultFn)
+
 	var result map[string]interface{}
 
+	if flt.UsesCursor() {
+		return fmt.Errorf("%T does not support cursor pagination", self)
+	}
+
 	if query, err := self.filterToNative(collection, flt); err == nil {
-		q := self.db.C(collection.Name).Find(query)
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
+		// full-text searches require a text index, and return a relevance score for each result
+		fulltext := flt.UsesFulltext()
+
+		if fulltext {
+			if err := self.ensureTextIndex(db, collection); err != nil {
+				return err
+			}
+		}
+
+		q := mongoQueryContext(ctx, db.C(collection.Name).Find(query))
 
 		if totalResults, err := q.Count(); err == nil {
 			if flt.Limit > 0 {
@@ -58,16 +86,33 @@ func (self *MongoBackend) QueryFunc(collection *dal.Collection, flt *filter.Filt
 			}
 
 			if len(flt.Sort) > 0 {
-				q = q.Sort(flt.Sort...)
+				q = q.Sort(mongoSortFields(flt.Sort)...)
 			}
 
-			q = self.prepMongoQuery(q, flt.Fields)
+			projection := mongoProjection(flt.Fields)
+
+			if fulltext {
+				if projection == nil {
+					projection = make(bson.M)
+				}
+
+				projection[filter.ScoreField] = bson.M{
+					`$meta`: `textScore`,
+				}
+			}
+
+			if projection != nil {
+				q = q.Select(projection)
+			}
 
 			iter := q.Iter()
 
 			for iter.Next(&result) {
 				if err := iter.Err(); err != nil {
 					return err
+				} else if err := ctx.Err(); err != nil {
+					iter.Close()
+					return err
 				} else {
 					if record, err := self.recordFromResult(collection, result, flt.Fields...); err == nil {
 						if err := resultFn(record, nil, IndexPage{
@@ -95,6 +140,10 @@ func (self *MongoBackend) QueryFunc(collection *dal.Collection, flt *filter.Filt
 }
 
 func (self *MongoBackend) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.QueryContext(context.Background(), collection, f, resultFns...)
+}
+
+func (self *MongoBackend) QueryContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	if f != nil {
 		if f.IdentityField == `` {
 			f.IdentityField = MongoIdentityField
@@ -103,7 +152,7 @@ func (self *MongoBackend) Query(collection *dal.Collection, f *filter.Filter, re
 		f.Options[`ForceIndexRecord`] = true
 	}
 
-	return DefaultQueryImplementation(self, collection, f, resultFns...)
+	return DefaultQueryImplementationContext(ctx, self, collection, f, resultFns...)
 }
 
 func (self *MongoBackend) ListValues(collection *dal.Collection, fields []string, flt *filter.Filter) (map[string][]interface{}, error) {
@@ -132,6 +181,82 @@ func (self *MongoBackend) ListValues(collection *dal.Collection, fields []string
 	}
 }
 
+// Facets counts the values of all fields in a single query, using a $facet stage that groups,
+// sorts, and limits the values of each field.
+func (self *MongoBackend) Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	var pipeline []bson.M
+
+	if match, err := self.filterToNative(collection, aggregationFilter(query.Filter)); err == nil {
+		if len(match) > 0 {
+			pipeline = append(pipeline, bson.M{
+				`$match`: match,
+			})
+		}
+	} else {
+		return nil, fmt.Errorf("filter error: %v", err)
+	}
+
+	facets := bson.M{}
+
+	for i, field := range query.Fields {
+		name := mongoFieldName(collection, field)
+		order := bson.D{{Name: `count`, Value: -1}, {Name: `_id`, Value: 1}}
+
+		if query.Sort == FacetSortValue {
+			order = bson.D{{Name: `_id`, Value: 1}}
+		}
+
+		stages := []bson.M{
+			{`$match`: bson.M{name: bson.M{`$ne`: nil}}},
+			{`$group`: bson.M{`_id`: `$` + name, `count`: bson.M{`$sum`: 1}}},
+			{`$sort`: order},
+		}
+
+		if query.Limit > 0 {
+			stages = append(stages, bson.M{
+				`$limit`: query.Limit,
+			})
+		}
+
+		facets[fmt.Sprintf("facet%d", i)] = stages
+	}
+
+	pipeline = append(pipeline, bson.M{
+		`$facet`: facets,
+	})
+
+	var result bson.M
+	iter := self.db.C(collection.Name).Pipe(pipeline).Iter()
+	iter.Next(&result)
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	output := make(map[string][]FacetValue)
+
+	for i, field := range query.Fields {
+		values := make([]FacetValue, 0)
+
+		if groups, ok := result[fmt.Sprintf("facet%d", i)].([]interface{}); ok {
+			for _, item := range groups {
+				if group, ok := item.(bson.M); ok {
+					values = append(values, FacetValue{
+						Value: group[`_id`],
+						Count: typeutil.Int(group[`count`]),
+					})
+				}
+			}
+		}
+
+		output[field] = values
+	}
+
+	return output, nil
+}
+
 func (self *MongoBackend) DeleteQuery(collection *dal.Collection, flt *filter.Filter) error {
 	if query, err := self.filterToNative(collection, flt); err == nil {
 		if _, err := self.db.C(collection.Name).RemoveAll(&query); err == nil {
@@ -148,6 +273,22 @@ func (self *MongoBackend) FlushIndex() error {
 	return nil
 }
 
+// text search relevance can only be sorted on (in descending order) using the special $textScore syntax
+func mongoSortFields(sort []string) []string {
+	fields := make([]string, len(sort))
+
+	for i, field := range sort {
+		switch field {
+		case filter.ScoreField, filter.SortAscending + filter.ScoreField, filter.SortDescending + filter.ScoreField:
+			fields[i] = `$textScore:` + filter.ScoreField
+		default:
+			fields[i] = field
+		}
+	}
+
+	return fields
+}
+
 func (self *MongoBackend) filterToNative(collection *dal.Collection, flt *filter.Filter) (bson.M, error) {
 	if data, err := filter.Render(
 		generators.NewMongoDBGenerator(),
@@ -0,0 +1,143 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type mongoMigrationUpdate struct {
+	collection string
+	query      bson.M
+	update     bson.M
+}
+
+func (self mongoMigrationUpdate) String() string {
+	query, _ := json.Marshal(self.query)
+	update, _ := json.Marshal(self.update)
+
+	return fmt.Sprintf("db.%s.updateMany(%s, %s)", self.collection, string(query), string(update))
+}
+
+func (self *MongoBackend) MigrationStatements(step dal.MigrationStep) ([]string, error) {
+	if updates, err := self.migrationUpdates(step); err == nil {
+		out := make([]string, len(updates))
+
+		for i, update := range updates {
+			out[i] = update.String()
+		}
+
+		return out, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *MongoBackend) ApplyMigrationStep(step dal.MigrationStep) error {
+	if collection, err := self.GetCollection(step.Collection); err == nil {
+		if updates, err := self.migrationUpdates(step); err == nil {
+			for _, update := range updates {
+				querylog.Debugf("[%v] %v", self, update)
+
+				if _, err := self.db.C(update.collection).UpdateAll(update.query, update.update); err != nil {
+					return err
+				}
+			}
+		} else {
+			return err
+		}
+
+		return step.ApplyToCollection(collection)
+	} else {
+		return err
+	}
+}
+
+func (self *MongoBackend) migrationUpdates(step dal.MigrationStep) ([]mongoMigrationUpdate, error) {
+	if err := step.Validate(); err != nil {
+		return nil, err
+	}
+
+	collection, err := self.GetCollection(step.Collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch step.Operation {
+	case dal.AddFieldOperation:
+		// only fields with a default value require existing documents to be touched
+		if step.Definition.DefaultValue != nil {
+			return []mongoMigrationUpdate{{
+				collection: collection.Name,
+				query: bson.M{
+					step.Definition.Name: bson.M{
+						`$exists`: false,
+					},
+				},
+				update: bson.M{
+					`$set`: bson.M{
+						step.Definition.Name: step.Definition.GetDefaultValue(),
+					},
+				},
+			}}, nil
+		}
+
+		return nil, nil
+
+	case dal.RenameFieldOperation:
+		return []mongoMigrationUpdate{{
+			collection: collection.Name,
+			query:      bson.M{},
+			update: bson.M{
+				`$rename`: bson.M{
+					step.Field: step.To,
+				},
+			},
+		}}, nil
+
+	case dal.DropFieldOperation:
+		return []mongoMigrationUpdate{{
+			collection: collection.Name,
+			query:      bson.M{},
+			update: bson.M{
+				`$unset`: bson.M{
+					step.Field: ``,
+				},
+			},
+		}}, nil
+
+	case dal.ChangeTypeOperation:
+		// documents are schemaless; values are converted to the new type as they are read
+		return nil, nil
+
+	case dal.BackfillOperation:
+		flt := filter.All()
+
+		if step.Filter != `` {
+			if f, err := filter.Parse(step.Filter); err == nil {
+				flt = f
+			} else {
+				return nil, err
+			}
+		}
+
+		if query, err := self.filterToNative(collection, flt); err == nil {
+			return []mongoMigrationUpdate{{
+				collection: collection.Name,
+				query:      query,
+				update: bson.M{
+					`$set`: self.prepareValuesForWrite(step.Set),
+				},
+			}}, nil
+		} else {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported migration operation %q", step.Operation)
+	}
+}
@@ -1,6 +1,7 @@
 package backends
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/PerformLine/go-stockutil/maputil"
 	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/go-stockutil/stringutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 	"gopkg.in/mgo.v2"
@@ -106,6 +108,11 @@ func (self *MongoBackend) SetIndexer(indexConnString dal.ConnectionString) error
 	}
 }
 
+func (self *MongoBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
 func (self *MongoBackend) RegisterCollection(collection *dal.Collection) {
 	if collection != nil {
 		collection.IdentityField = MongoIdentityField
@@ -147,6 +154,12 @@ func (self *MongoBackend) Exists(name string, id interface{}) bool {
 			id = record.ID
 		}
 
+		// the server removes expired documents periodically, so they must be read to be ruled out
+		if collection.TimeToLiveField != `` {
+			_, err := self.Retrieve(name, id)
+			return (err == nil)
+		}
+
 		if n, err := self.db.C(collection.Name).FindId(self.getId(id)).Count(); err == nil && n == 1 {
 			return true
 		}
@@ -156,14 +169,31 @@ func (self *MongoBackend) Exists(name string, id interface{}) bool {
 }
 
 func (self *MongoBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
+	return self.RetrieveContext(context.Background(), name, id, fields...)
+}
+
+func (self *MongoBackend) RetrieveContext(ctx context.Context, name string, id interface{}, fields ...string) (*dal.Record, error) {
 	if collection, err := self.GetCollection(name); err == nil {
 		var data map[string]interface{}
 
-		q := self.db.C(collection.Name).FindId(self.getId(id))
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer done()
+
+		q := db.C(collection.Name).FindId(self.getId(id))
 		q = self.prepMongoQuery(q, fields)
+		q = mongoQueryContext(ctx, q)
 
 		if err := q.One(&data); err == nil {
-			return self.recordFromResult(collection, data, fields...)
+			if record, err := self.recordFromResult(collection, data, fields...); err == nil {
+				return unlessExpired(collection, id, record)
+			} else {
+				return nil, err
+			}
 		} else if err == mgo.ErrNotFound {
 			return nil, fmt.Errorf("Record %v does not exist", id)
 		} else {
@@ -175,10 +205,27 @@ func (self *MongoBackend) Retrieve(name string, id interface{}, fields ...string
 }
 
 func (self *MongoBackend) Insert(name string, records *dal.RecordSet) error {
+	return self.InsertContext(context.Background(), name, records)
+}
+
+func (self *MongoBackend) InsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
 	if collection, err := self.GetCollection(name); err == nil {
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
 		for _, record := range records.Records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			if _, err := collection.StructToRecord(record); err == nil {
 				data := self.prepareValuesForWrite(record.Fields)
+				mongoPrepareTimeToLive(collection, data)
 
 				if record.ID == nil {
 					record.ID = bson.NewObjectId().Hex()
@@ -187,7 +234,7 @@ func (self *MongoBackend) Insert(name string, records *dal.RecordSet) error {
 				data[MongoIdentityField] = self.getId(record.ID)
 				querylog.Debugf("[%T] %s: new id=%v", self, name, record.ID)
 
-				if err := self.db.C(collection.Name).Insert(&data); err != nil {
+				if err := db.C(collection.Name).Insert(&data); err != nil {
 					return err
 				}
 			} else {
@@ -202,15 +249,32 @@ func (self *MongoBackend) Insert(name string, records *dal.RecordSet) error {
 }
 
 func (self *MongoBackend) Update(name string, records *dal.RecordSet, target ...string) error {
+	return self.UpdateContext(context.Background(), name, records, target...)
+}
+
+func (self *MongoBackend) UpdateContext(ctx context.Context, name string, records *dal.RecordSet, target ...string) error {
 	if collection, err := self.GetCollection(name); err == nil {
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
 		for _, record := range records.Records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			if _, err := collection.StructToRecord(record); err == nil {
 				data := self.prepareValuesForWrite(record.Fields)
+				mongoPrepareTimeToLive(collection, data)
 
 				if record.ID == nil {
 					return fmt.Errorf("Cannot update record without an ID")
 				} else {
-					if err := self.db.C(collection.Name).UpdateId(self.getId(record.ID), data); err != nil {
+					if err := db.C(collection.Name).UpdateId(self.getId(record.ID), data); err != nil {
 						return err
 					}
 				}
@@ -225,10 +289,69 @@ func (self *MongoBackend) Update(name string, records *dal.RecordSet, target ...
 	return nil
 }
 
+func (self *MongoBackend) Upsert(name string, records *dal.RecordSet) error {
+	return self.UpsertContext(context.Background(), name, records)
+}
+
+// Replaces the documents with the given records' IDs, inserting any that don't exist in the same
+// operation (i.e.: with "upsert: true").  Records without an ID are given a new one.
+func (self *MongoBackend) UpsertContext(ctx context.Context, name string, records *dal.RecordSet) error {
+	if collection, err := self.GetCollection(name); err == nil {
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
+		for _, record := range records.Records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if _, err := collection.StructToRecord(record); err == nil {
+				data := self.prepareValuesForWrite(record.Fields)
+				mongoPrepareTimeToLive(collection, data)
+
+				if record.ID == nil {
+					record.ID = bson.NewObjectId().Hex()
+				}
+
+				if _, err := db.C(collection.Name).UpsertId(self.getId(record.ID), data); err != nil {
+					return err
+				}
+			} else {
+				return err
+			}
+		}
+	} else {
+		return err
+	}
+
+	return nil
+}
+
 func (self *MongoBackend) Delete(name string, ids ...interface{}) error {
+	return self.DeleteContext(context.Background(), name, ids...)
+}
+
+func (self *MongoBackend) DeleteContext(ctx context.Context, name string, ids ...interface{}) error {
 	if collection, err := self.GetCollection(name); err == nil {
+		db, done, err := self.dbContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
 		for _, id := range ids {
-			if err := self.db.C(collection.Name).RemoveId(self.getId(id)); err != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := db.C(collection.Name).RemoveId(self.getId(id)); err != nil {
 				return err
 			}
 		}
@@ -248,6 +371,12 @@ func (self *MongoBackend) CreateCollection(definition *dal.Collection) error {
 		return fmt.Errorf("Collection %v already exists", definition.Name)
 	} else if dal.IsCollectionNotFoundErr(err) {
 		if err := self.db.C(definition.Name).Create(&mgo.CollectionInfo{}); err == nil {
+			if definition.TimeToLiveField != `` {
+				if err := self.ensureTTLIndex(self.db, definition); err != nil {
+					return err
+				}
+			}
+
 			self.registeredCollections.Store(definition.Name, definition)
 			return nil
 		} else {
@@ -340,7 +469,7 @@ func (self *MongoBackend) recordFromResult(collection *dal.Collection, data map[
 		for k, v := range data {
 			v = self.fromId(v)
 
-			if _, ok := collection.GetField(k); ok || len(collection.Fields) == 0 {
+			if _, ok := collection.GetField(k); ok || len(collection.Fields) == 0 || k == filter.ScoreField {
 				record.Set(k, v)
 			}
 		}
@@ -382,6 +511,15 @@ func (self *MongoBackend) fromId(in interface{}) interface{} {
 }
 
 func (self *MongoBackend) prepMongoQuery(q *mgo.Query, fields []string) *mgo.Query {
+	if projection := mongoProjection(fields); projection != nil {
+		q = q.Select(projection)
+	}
+
+	return q
+}
+
+// returns the projection that limits results to the given fields, or nil if all fields are wanted.
+func mongoProjection(fields []string) bson.M {
 	if len(fields) > 0 {
 		projection := make(bson.M)
 
@@ -390,8 +528,78 @@ func (self *MongoBackend) prepMongoQuery(q *mgo.Query, fields []string) *mgo.Que
 			projection[first] = 1
 		}
 
-		q = q.Select(projection)
+		return projection
 	}
 
-	return q
+	return nil
+}
+
+// creates the text index used to perform full-text searches against the given collection.  MongoDB
+// allows only one text index per collection, so it covers all of the collection's string fields.
+func (self *MongoBackend) ensureTextIndex(db *mgo.Database, collection *dal.Collection) error {
+	keys := make([]string, 0)
+
+	for _, field := range collection.Fields {
+		if field.Type == dal.StringType && !field.Identity {
+			keys = append(keys, `$text:`+field.Name)
+		}
+	}
+
+	if len(keys) == 0 {
+		keys = append(keys, `$text:$**`)
+	}
+
+	return db.C(collection.Name).EnsureIndex(mgo.Index{
+		Key:        keys,
+		Background: true,
+	})
+}
+
+// creates the TTL index that has the server remove documents once the time in the collection's
+// TimeToLiveField has passed.  The index is created with a raw command because mgo cannot express
+// an expiry of zero seconds after the indexed time.
+func (self *MongoBackend) ensureTTLIndex(db *mgo.Database, collection *dal.Collection) error {
+	return db.Run(bson.D{
+		{Name: `createIndexes`, Value: collection.Name},
+		{Name: `indexes`, Value: []bson.M{{
+			`key`:                bson.M{collection.TimeToLiveField: 1},
+			`name`:               collection.TimeToLiveField + `_ttl`,
+			`expireAfterSeconds`: 0,
+		}}},
+	}, nil)
+}
+
+// TTL indexes only expire documents whose indexed field holds a date, so TimeToLiveField values
+// given in any other form (e.g.: epoch seconds) are written as one.
+func mongoPrepareTimeToLive(collection *dal.Collection, data map[string]interface{}) {
+	if ttl := collection.TimeToLiveField; ttl != `` {
+		if value, ok := data[ttl]; ok && !typeutil.IsZero(value) {
+			data[ttl] = typeutil.V(value).Time()
+		}
+	}
+}
+
+// The mgo driver has no notion of contexts, so the best we can do is to bound socket operations by
+// the context's deadline (if any) and check for cancellation between operations.  The returned
+// function must be called once the database handle is no longer needed.
+func (self *MongoBackend) dbContext(ctx context.Context) (*mgo.Database, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	} else if deadline, ok := ctx.Deadline(); ok {
+		session := self.session.Copy()
+		session.SetSocketTimeout(time.Until(deadline))
+
+		return session.DB(self.db.Name), session.Close, nil
+	} else {
+		return self.db, func() {}, nil
+	}
+}
+
+// instructs the server to abort the query if it runs beyond the context's deadline.
+func mongoQueryContext(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if deadline, ok := ctx.Deadline(); ok {
+		return q.SetMaxTime(time.Until(deadline))
+	} else {
+		return q
+	}
 }
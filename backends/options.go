@@ -3,6 +3,10 @@ package backends
 type ConnectOptions struct {
 	Indexer               string   `json:"indexer"`
 	AdditionalIndexers    []string `json:"additional_indexers"`
+	RetrievalStrategy     string   `json:"retrieval_strategy"`
+	PersistStrategy       string   `json:"persist_strategy"`
+	DeleteStrategy        string   `json:"delete_strategy"`
+	InspectionStrategy    string   `json:"inspection_strategy"`
 	SkipInitialize        bool     `json:"skip_initialize"`
 	AutocreateCollections bool     `json:"autocreate_collections"`
 }
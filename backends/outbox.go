@@ -0,0 +1,534 @@
+package backends
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+var DefaultOutboxCollectionName = `pivot_index_outbox`
+var DefaultOutboxFilename = `outbox.log`
+var DefaultFileOutboxCompactAfter = 1000
+
+type OutboxOperation string
+
+const (
+	OutboxIndex       OutboxOperation = `index`
+	OutboxRemove                      = `remove`
+	OutboxDeleteQuery                 = `delete-query`
+)
+
+// An indexing operation that has been written to an outbox, but not yet applied to an indexer.
+type OutboxEntry struct {
+	Sequence   int64           `json:"seq"`
+	Operation  OutboxOperation `json:"op"`
+	Collection string          `json:"collection"`
+	Records    []*dal.Record   `json:"records,omitempty"`
+	IDs        []interface{}   `json:"ids,omitempty"`
+	Filter     json.RawMessage `json:"filter,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// An IndexOutbox durably stores indexing operations until they have been applied to an indexer.
+type IndexOutbox interface {
+	// Prepares the outbox for use with the given backend.
+	Initialize(backend Backend) error
+
+	// Stores the given entry, assigning it the next sequence number.
+	Append(entry *OutboxEntry) error
+
+	// Returns up to limit entries that have not been acknowledged, oldest first.
+	Pending(limit int) ([]*OutboxEntry, error)
+
+	// Removes the entry with the given sequence number from the outbox.
+	Ack(sequence int64) error
+
+	// Returns the number of entries that have not been acknowledged.
+	Len() (int, error)
+
+	Close() error
+}
+
+// Creates an IndexOutbox from the value of an indexer's "outbox" connection string option.  The
+// value "collection" (or "collection:NAME") stores entries in a collection in the primary backend;
+// anything else is treated as the path of a directory in which to keep an append-only log file.
+func MakeIndexOutbox(spec string) (IndexOutbox, error) {
+	if kind, name := splitOutboxSpec(spec); kind == `collection` {
+		if name == `` {
+			name = DefaultOutboxCollectionName
+		}
+
+		return NewCollectionOutbox(name), nil
+	} else if spec != `` {
+		return NewFileOutbox(spec), nil
+	} else {
+		return nil, fmt.Errorf("must specify an outbox path or collection")
+	}
+}
+
+func splitOutboxSpec(spec string) (string, string) {
+	if spec == `collection` {
+		return spec, ``
+	} else if len(spec) > 11 && spec[:11] == `collection:` {
+		return `collection`, spec[11:]
+	} else {
+		return ``, spec
+	}
+}
+
+// converts the values of records that have been serialized back into their collection's types
+func (self *OutboxEntry) recordSet(collection *dal.Collection) *dal.RecordSet {
+	recordset := dal.NewRecordSet()
+
+	for _, record := range self.Records {
+		record.ID = collection.ConvertValue(collection.GetIdentityFieldName(), record.ID)
+
+		for k, v := range record.Fields {
+			record.Fields[k] = collection.ConvertValue(k, v)
+		}
+
+		recordset.Push(record)
+	}
+
+	return recordset
+}
+
+// File Outbox
+// -------------------------------------------------------------------------------------------------
+
+type fileOutboxLine struct {
+	Entry *OutboxEntry `json:"entry,omitempty"`
+	Ack   int64        `json:"ack,omitempty"`
+}
+
+// An IndexOutbox that appends entries (and acknowledgements) to a log file on local disk.  The file
+// is truncated whenever all of its entries have been acknowledged, and is rewritten to contain only
+// the pending entries once CompactAfter entries have been acknowledged since it was last rewritten.
+type FileOutbox struct {
+	Path         string
+	Sync         bool // whether to sync the log to disk after every write
+	CompactAfter int  // if positive, the number of acknowledgements after which the log is compacted
+	file         *os.File
+	pending      map[int64]*OutboxEntry
+	sequence     int64
+	acked        int
+	lock         sync.Mutex
+}
+
+func NewFileOutbox(dir string) *FileOutbox {
+	return &FileOutbox{
+		Path:         filepath.Join(dir, DefaultOutboxFilename),
+		Sync:         true,
+		CompactAfter: DefaultFileOutboxCompactAfter,
+		pending:      make(map[int64]*OutboxEntry),
+	}
+}
+
+func (self *FileOutbox) Initialize(_ Backend) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(self.Path), 0700); err != nil {
+		return err
+	}
+
+	if file, err := os.OpenFile(self.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600); err == nil {
+		self.file = file
+	} else {
+		return err
+	}
+
+	// replay the log to work out which entries are still pending
+	scanner := bufio.NewScanner(self.file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var line fileOutboxLine
+
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// a partially-written final line is what a crash mid-append looks like
+			querylog.Debugf("[%T] skipping unreadable line: %v", self, err)
+			continue
+		}
+
+		if line.Entry != nil {
+			self.pending[line.Entry.Sequence] = line.Entry
+
+			if line.Entry.Sequence > self.sequence {
+				self.sequence = line.Entry.Sequence
+			}
+		} else if line.Ack > 0 {
+			delete(self.pending, line.Ack)
+			self.acked += 1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return self.compactIfNeeded()
+}
+
+func (self *FileOutbox) Append(entry *OutboxEntry) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.sequence += 1
+	entry.Sequence = self.sequence
+
+	// keep a decoded copy of the entry so that pending entries look the same whether they were
+	// appended by this process or replayed from the log
+	var stored OutboxEntry
+
+	if data, err := json.Marshal(entry); err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	if err := self.write(fileOutboxLine{
+		Entry: &stored,
+	}); err != nil {
+		return err
+	}
+
+	self.pending[stored.Sequence] = &stored
+	return nil
+}
+
+func (self *FileOutbox) Pending(limit int) ([]*OutboxEntry, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	entries := make([]*OutboxEntry, 0, len(self.pending))
+
+	for _, entry := range self.pending {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Sequence < entries[j].Sequence
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func (self *FileOutbox) Ack(sequence int64) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if _, ok := self.pending[sequence]; !ok {
+		return nil
+	}
+
+	delete(self.pending, sequence)
+
+	// nothing left to replay, so start the log over
+	if len(self.pending) == 0 {
+		if err := self.file.Truncate(0); err != nil {
+			return err
+		}
+
+		self.acked = 0
+		_, err := self.file.Seek(0, 0)
+		return err
+	}
+
+	if err := self.write(fileOutboxLine{
+		Ack: sequence,
+	}); err != nil {
+		return err
+	}
+
+	self.acked += 1
+	return self.compactIfNeeded()
+}
+
+func (self *FileOutbox) Len() (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return len(self.pending), nil
+}
+
+func (self *FileOutbox) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.file != nil {
+		err := self.file.Close()
+		self.file = nil
+		return err
+	}
+
+	return nil
+}
+
+// rewrites the log to contain only the pending entries if enough entries have been acknowledged
+// since it was last rewritten.  The new log is written alongside the current one and renamed over
+// it, so a crash part way through leaves one or the other intact.
+func (self *FileOutbox) compactIfNeeded() error {
+	if self.CompactAfter <= 0 || self.acked < self.CompactAfter {
+		return nil
+	}
+
+	entries := make([]*OutboxEntry, 0, len(self.pending))
+
+	for _, entry := range self.pending {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Sequence < entries[j].Sequence
+	})
+
+	tmp := self.Path + `.compact`
+
+	if file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err == nil {
+		writer := bufio.NewWriter(file)
+		encoder := json.NewEncoder(writer)
+
+		for _, entry := range entries {
+			if err := encoder.Encode(fileOutboxLine{
+				Entry: entry,
+			}); err != nil {
+				file.Close()
+				return err
+			}
+		}
+
+		if err := writer.Flush(); err != nil {
+			file.Close()
+			return err
+		} else if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		} else if err := file.Close(); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	if err := os.Rename(tmp, self.Path); err != nil {
+		return err
+	}
+
+	if file, err := os.OpenFile(self.Path, os.O_RDWR|os.O_APPEND, 0600); err == nil {
+		if self.file != nil {
+			self.file.Close()
+		}
+
+		self.file = file
+		self.acked = 0
+
+		querylog.Debugf("[%T] compacted %v to %d pending entries", self, self.Path, len(entries))
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *FileOutbox) write(line fileOutboxLine) error {
+	if self.file == nil {
+		return fmt.Errorf("outbox %v is not open", self.Path)
+	}
+
+	if data, err := json.Marshal(line); err == nil {
+		if _, err := self.file.Write(append(data, '\n')); err != nil {
+			return err
+		}
+
+		if self.Sync {
+			return self.file.Sync()
+		}
+
+		return nil
+	} else {
+		return err
+	}
+}
+
+// Collection Outbox
+// -------------------------------------------------------------------------------------------------
+
+// An IndexOutbox that stores entries as records in a collection in the primary backend, so that
+// they are written alongside the data being indexed.  The backend must be able to query its own
+// records (i.e.: it must implement Indexer).
+type CollectionOutbox struct {
+	Name       string
+	backend    Backend
+	source     Indexer
+	collection *dal.Collection
+	sequence   int64
+	lock       sync.Mutex
+}
+
+func NewCollectionOutbox(name string) *CollectionOutbox {
+	return &CollectionOutbox{
+		Name: name,
+	}
+}
+
+func (self *CollectionOutbox) Initialize(backend Backend) error {
+	if source, ok := backend.(Indexer); ok {
+		self.backend = backend
+		self.source = source
+	} else {
+		return fmt.Errorf("backend %v cannot store an outbox collection", backend)
+	}
+
+	self.collection = &dal.Collection{
+		Name:              self.Name,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name:     `operation`,
+				Type:     dal.StringType,
+				Required: true,
+			}, {
+				Name:     `collection`,
+				Type:     dal.StringType,
+				Required: true,
+			}, {
+				Name: `payload`,
+				Type: dal.StringType,
+			}, {
+				Name: `created_at`,
+				Type: dal.TimeType,
+			},
+		},
+	}
+
+	backend.RegisterCollection(self.collection)
+
+	if existing, err := backend.GetCollection(self.Name); err == nil {
+		self.collection = existing
+	} else if dal.IsCollectionNotFoundErr(err) {
+		if err := backend.CreateCollection(self.collection); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	// continue numbering from the newest entry already in the outbox
+	f := filter.All()
+	f.Sort = []string{`-` + self.collection.GetIdentityFieldName()}
+	f.Limit = 1
+
+	if rs, err := self.source.Query(self.collection, f); err == nil {
+		for _, record := range rs.Records {
+			self.sequence = typeutil.Int(record.ID)
+		}
+	} else {
+		return err
+	}
+
+	return nil
+}
+
+func (self *CollectionOutbox) Append(entry *OutboxEntry) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	// sequence numbers are time-based so that they remain ordered across restarts
+	if now := time.Now().UnixNano(); now > self.sequence {
+		self.sequence = now
+	} else {
+		self.sequence += 1
+	}
+
+	entry.Sequence = self.sequence
+
+	if payload, err := json.Marshal(entry); err == nil {
+		return self.backend.Insert(self.Name, dal.NewRecordSet(
+			dal.NewRecord(outboxRecordID(entry.Sequence)).SetFields(map[string]interface{}{
+				`operation`:  string(entry.Operation),
+				`collection`: entry.Collection,
+				`payload`:    string(payload),
+				`created_at`: entry.CreatedAt,
+			}),
+		))
+	} else {
+		return err
+	}
+}
+
+func (self *CollectionOutbox) Pending(limit int) ([]*OutboxEntry, error) {
+	f := filter.All()
+	f.Sort = []string{self.collection.GetIdentityFieldName()}
+	f.Limit = limit
+
+	entries := make([]*OutboxEntry, 0)
+
+	if err := self.source.QueryFunc(self.collection, f, func(record *dal.Record, err error, _ IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		var entry OutboxEntry
+
+		if err := json.Unmarshal([]byte(typeutil.String(record.Get(`payload`))), &entry); err == nil {
+			entries = append(entries, &entry)
+			return nil
+		} else {
+			return fmt.Errorf("outbox entry %v: %v", record.ID, err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (self *CollectionOutbox) Ack(sequence int64) error {
+	return self.backend.Delete(self.Name, outboxRecordID(sequence))
+}
+
+// Len counts the entries in the collection, as not every indexer reports the total number of
+// results a query matched.
+func (self *CollectionOutbox) Len() (int, error) {
+	var count int
+
+	f := filter.All()
+	f.Fields = []string{self.collection.GetIdentityFieldName()}
+
+	if err := self.source.QueryFunc(self.collection, f, func(_ *dal.Record, err error, _ IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		count += 1
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (self *CollectionOutbox) Close() error {
+	return nil
+}
+
+// IDs are zero-padded so that sorting them lexically also sorts them in sequence order
+func outboxRecordID(sequence int64) string {
+	return fmt.Sprintf("%020d", sequence)
+}
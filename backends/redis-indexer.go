@@ -3,10 +3,12 @@ package backends
 import (
 	"fmt"
 	"math"
+	"sort"
 
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/utils"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
-	"github.com/gomodule/redigo/redis"
 )
 
 func (self *RedisBackend) IndexConnectionString() *dal.ConnectionString {
@@ -30,85 +32,142 @@ func (self *RedisBackend) IndexRetrieve(collection *dal.Collection, id interface
 }
 
 func (self *RedisBackend) IndexRemove(collection *dal.Collection, ids []interface{}) error {
-	return nil
+	var merr error
+
+	for _, id := range ids {
+		merr = utils.AppendError(merr, self.removeIndexes(collection, sliceutil.Sliceify(id)))
+	}
+
+	return merr
 }
 
+// Index updates the secondary indexes of fields marked as Indexed to reflect the given records.
 func (self *RedisBackend) Index(collection *dal.Collection, records *dal.RecordSet) error {
-	return nil
+	return self.updateIndexes(collection, records.Records)
 }
 
+// QueryFunc finds records using the secondary indexes of any indexed fields in the filter, falling
+// back to scanning the keys of the collection (narrowed by any key fields in the filter).  Sorting
+// requires reading all matching records before any are returned.
 func (self *RedisBackend) QueryFunc(collection *dal.Collection, flt *filter.Filter, resultFn IndexResultFunc) error {
-	if err := self.validateFilter(collection, flt); err != nil {
+	if flt == nil {
+		flt = filter.All()
+	}
+
+	if err := self.validateFilter(collection, flt.Criteria); err != nil {
 		return err
 	}
 
-	var keyPattern string
+	if err := self.expireIndexes(collection); err != nil {
+		return err
+	}
 
-	// full keyscan
-	if flt == nil || flt.IsMatchAll() {
-		keyPattern = self.key(collection.Name, `*`)
-	} else {
-		placeholders := make([]interface{}, 0)
+	plan, err := self.plan(collection, flt)
 
-		for i := 0; i < collection.KeyCount(); i++ {
-			placeholders = append(placeholders, `*`)
-		}
+	if err != nil {
+		return err
+	}
 
-		for i, criterion := range flt.Criteria {
-			if !criterion.IsExactMatch() || len(criterion.Values) != 1 {
-				return fmt.Errorf(
-					"%v: filters can only contain exact match criteria (%q is invalid on %d values)",
-					self,
-					criterion.Operator,
-					len(criterion.Values),
-				)
-			} else if i < len(placeholders) {
-				placeholders[i] = fmt.Sprintf("%v", criterion.Values[0])
-			} else {
-				return fmt.Errorf("%v: too many criteria", self)
+	members := plan.Members
+	sortBy := flt.GetSort()
+	offset := flt.Offset
+	total := int64(-1)
+
+	// cursor pagination walks the keys in order, starting just after the one in the cursor
+	if flt.UsesCursor() {
+		if afterKey, err := idCursorPosition(flt); err == nil {
+			start := sort.SearchStrings(members, afterKey)
+
+			if start < len(members) && members[start] == afterKey {
+				start += 1
 			}
+
+			members = members[start:]
+			sortBy = nil
+			offset = 0
+		} else {
+			return err
+		}
+	}
+
+	if plan.Exact {
+		total = int64(len(plan.Members))
+	}
+
+	processed := 0
+	emitted := 0
+
+	emit := func(member string, record *dal.Record) error {
+		if processed += 1; processed <= offset {
+			return nil
+		}
+
+		emitted += 1
+		totalPages := 1
+
+		if flt.Limit > 0 && total > 0 {
+			totalPages = int(math.Ceil(float64(total) / float64(flt.Limit)))
 		}
 
-		keyPattern = self.key(collection.Name, placeholders...)
+		return resultFn(record.OnlyFields(flt.Fields), nil, IndexPage{
+			Page:         1,
+			TotalPages:   totalPages,
+			Limit:        flt.Limit,
+			Offset:       offset,
+			TotalResults: total,
+			NextCursor:   idCursorFor(member),
+		})
 	}
 
-	if keys, err := redis.Strings(self.run(`KEYS`, keyPattern)); err == nil {
-		limit := len(keys)
-		total := int64(len(keys))
+	var sorted []*dal.Record
 
-		if flt.Limit <= 0 {
-			flt.Limit = IndexerPageSize
+	for _, member := range members {
+		if len(sortBy) == 0 && flt.Limit > 0 && emitted >= flt.Limit {
+			break
 		}
 
-		if flt.Limit < limit {
-			limit = flt.Limit
+		ids := self.memberIds(member)
+
+		// index entries can outlive their records until they are expired
+		if plan.Indexed && !self.Exists(collection.Name, ids) {
+			continue
 		}
 
-		for i := flt.Offset; i < limit; i++ {
-			if _, values := redisSplitKey(keys[i]); len(values) > 0 {
-				if values[0] == `__schema__` {
-					continue
-				}
-
-				record, err := self.Retrieve(collection.Name, values, flt.Fields...)
-
-				// fire off the result handler
-				if err := resultFn(record, err, IndexPage{
-					Page:         1,
-					TotalPages:   int(math.Ceil(float64(total) / float64(flt.Limit))),
-					Limit:        flt.Limit,
-					Offset:       (1 - 1) * flt.Limit,
-					TotalResults: total,
-				}); err != nil {
-					return err
-				}
+		record, err := self.Retrieve(collection.Name, ids)
+
+		if err != nil {
+			if err := resultFn(dal.NewRecord(nil), err, IndexPage{}); err != nil {
+				return err
 			}
+
+			continue
 		}
 
-		return nil
-	} else {
-		return err
+		if !plan.Residual.MatchesRecord(record) {
+			continue
+		}
+
+		if len(sortBy) > 0 {
+			sorted = append(sorted, record)
+		} else if err := emit(member, record); err != nil {
+			return err
+		}
 	}
+
+	if len(sortBy) > 0 {
+		total = int64(len(sorted))
+		memorySortRecords(collection, sorted, sortBy)
+
+		for _, record := range sorted {
+			if flt.Limit > 0 && emitted >= flt.Limit {
+				break
+			} else if err := emit(redisMember(record.Keys(collection)), record); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 func (self *RedisBackend) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
@@ -131,19 +190,32 @@ func (self *RedisBackend) FlushIndex() error {
 	return nil
 }
 
-func (self *RedisBackend) validateFilter(collection *dal.Collection, flt *filter.Filter) error {
-	if flt != nil {
-		for _, field := range flt.CriteriaFields() {
-			if collection.IsIdentityField(field) {
-				continue
+// only key fields and fields with secondary indexes can be queried on
+func (self *RedisBackend) validateFilter(collection *dal.Collection, criteria []filter.Criterion) error {
+	for _, criterion := range criteria {
+		if criterion.IsGroup() {
+			if err := self.validateFilter(collection, criterion.Criteria); err != nil {
+				return err
 			}
 
-			if collection.IsKeyField(field) {
-				continue
-			}
+			continue
+		}
+
+		field := criterion.Field
 
-			return fmt.Errorf("Filter field '%v' cannot be used: not a key field", field)
+		if field == filter.DefaultIdentityField || field == collection.GetIdentityFieldName() {
+			continue
 		}
+
+		if collection.IsIdentityField(field) || collection.IsKeyField(field) {
+			continue
+		}
+
+		if def, ok := collection.GetField(field); ok && def.Indexed {
+			continue
+		}
+
+		return fmt.Errorf("Filter field '%v' cannot be used: not a key or indexed field", field)
 	}
 
 	return nil
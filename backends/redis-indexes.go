@@ -0,0 +1,531 @@
+package backends
+
+// this file maintains the secondary indexes RedisBackend uses to answer queries on indexed fields
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/go-stockutil/utils"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/gomodule/redigo/redis"
+)
+
+// the number of keys requested from each SCAN call
+var RedisScanCount = 1000
+
+// Keys that hold collection metadata rather than records have a first key part starting with this
+// prefix (e.g.: "pivot.users:__schema__").
+const redisReservedKeyPrefix = `__`
+
+const (
+	redisSchemaKeyPart  = `__schema__`  // the collection's schema definition
+	redisIndexKeyPart   = `__index__`   // sets (by value) and sorted sets (by field) of record members
+	redisValuesKeyPart  = `__indexed__` // a hash of the indexed values of each record, used to update its index entries
+	redisExpiresKeyPart = `__expires__` // a sorted set of the members of records with a TTL, scored by expiry time
+	redisBuiltKeyPart   = `__built__`   // a set of the indexed fields whose indexes have an entry for every record
+)
+
+// Returns the fields of the collection whose values are kept in secondary indexes.
+func redisIndexedFields(collection *dal.Collection) []dal.Field {
+	fields := make([]dal.Field, 0)
+
+	for _, field := range collection.Fields {
+		if field.Indexed && !field.Key && !field.Identity {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// Numeric and time fields are indexed in a sorted set, which allows range queries and exact matches;
+// all other fields are indexed in a set per value, which only allows exact matches.
+func redisIsRangeIndexed(field dal.Field) bool {
+	switch field.Type {
+	case dal.IntType, dal.FloatType, dal.TimeType:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the sorted set score of the given value (milliseconds since the epoch for times).
+func redisIndexScore(field dal.Field, value interface{}) (float64, error) {
+	if v, err := field.ConvertValue(value); err == nil {
+		if field.Type == dal.TimeType {
+			if t, ok := v.(time.Time); ok {
+				return float64(t.UnixMilli()), nil
+			} else {
+				return 0, fmt.Errorf("field %q: cannot index %T as a time", field.Name, v)
+			}
+		}
+
+		return typeutil.Float(v), nil
+	} else {
+		return 0, err
+	}
+}
+
+// Returns the string that identifies a value in a value set's key.
+func redisIndexValue(field dal.Field, value interface{}) (string, error) {
+	if v, err := field.ConvertValue(value); err == nil {
+		if data, err := json.Marshal(v); err == nil {
+			return string(data), nil
+		} else {
+			return ``, err
+		}
+	} else {
+		return ``, err
+	}
+}
+
+// Returns the ZRANGEBYSCORE bounds that select the values matching the given operator.
+func redisScoreRange(operator string, score float64) (string, string, error) {
+	value := fmt.Sprintf("%v", score)
+
+	switch operator {
+	case ``, `is`:
+		return value, value, nil
+	case `gt`:
+		return `(` + value, `+inf`, nil
+	case `gte`:
+		return value, `+inf`, nil
+	case `lt`:
+		return `-inf`, `(` + value, nil
+	case `lte`:
+		return `-inf`, value, nil
+	default:
+		return ``, ``, fmt.Errorf("operator %q cannot be used with a range index", operator)
+	}
+}
+
+// Escapes the characters that have special meaning in SCAN patterns.
+func redisEscapePattern(value string) string {
+	var out strings.Builder
+
+	for _, c := range value {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			out.WriteRune('\\')
+		}
+
+		out.WriteRune(c)
+	}
+
+	return out.String()
+}
+
+// Returns the string identifying a record in index sets, which is the record's key without the
+// collection prefix (e.g.: "123", or "123:456" for composite keys).
+func redisMember(ids []interface{}) string {
+	return strings.Join(sliceutil.Stringify(ids), `:`)
+}
+
+func (self *RedisBackend) memberIds(member string) []interface{} {
+	return sliceutil.Sliceify(strings.Split(member, `:`))
+}
+
+func (self *RedisBackend) indexSetKey(collection *dal.Collection, field string, value string) string {
+	return self.key(collection.Name, redisIndexKeyPart, field, value)
+}
+
+func (self *RedisBackend) indexRangeKey(collection *dal.Collection, field string) string {
+	return self.key(collection.Name, redisIndexKeyPart, field)
+}
+
+func (self *RedisBackend) indexBuiltKey(collection *dal.Collection) string {
+	return self.key(collection.Name, redisBuiltKeyPart)
+}
+
+func (self *RedisBackend) indexValuesKey(collection *dal.Collection, member string) string {
+	return self.key(collection.Name, redisValuesKeyPart, member)
+}
+
+// Updates the index entries of the given records to reflect their current values.  Fields that are
+// not present in a record keep their existing entries, as they do in the record itself.
+func (self *RedisBackend) updateIndexes(collection *dal.Collection, records []*dal.Record) error {
+	fields := redisIndexedFields(collection)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var merr error
+
+	for _, record := range records {
+		member := redisMember(record.Keys(collection))
+		valuesKey := self.indexValuesKey(collection, member)
+		ttl := collection.TTL(record)
+
+		current, err := redis.StringMap(self.run(`HGETALL`, valuesKey))
+
+		if err != nil {
+			merr = utils.AppendError(merr, err)
+			continue
+		}
+
+		merr = utils.AppendError(merr, self.transaction(func(conn redis.Conn) error {
+			for _, field := range fields {
+				value, ok := record.Fields[field.Name]
+
+				if !ok {
+					continue
+				}
+
+				if previous, ok := current[field.Name]; ok {
+					if err := self.sendIndexRemove(conn, collection, field, previous, member); err != nil {
+						return err
+					}
+				}
+
+				if value == nil {
+					if err := conn.Send(`HDEL`, valuesKey, field.Name); err != nil {
+						return err
+					}
+
+					continue
+				}
+
+				if redisIsRangeIndexed(field) {
+					if score, err := redisIndexScore(field, value); err == nil {
+						if err := conn.Send(`ZADD`, self.indexRangeKey(collection, field.Name), score, member); err != nil {
+							return err
+						}
+
+						if err := conn.Send(`HSET`, valuesKey, field.Name, score); err != nil {
+							return err
+						}
+					} else {
+						return err
+					}
+				} else if indexValue, err := redisIndexValue(field, value); err == nil {
+					if err := conn.Send(`SADD`, self.indexSetKey(collection, field.Name, indexValue), member); err != nil {
+						return err
+					}
+
+					if err := conn.Send(`HSET`, valuesKey, field.Name, indexValue); err != nil {
+						return err
+					}
+				} else {
+					return err
+				}
+			}
+
+			// remember when the record expires so its entries can be removed once it has
+			if ttl > 0 {
+				return conn.Send(`ZADD`, self.key(collection.Name, redisExpiresKeyPart), time.Now().Add(ttl).UnixMilli(), member)
+			}
+
+			return nil
+		}))
+	}
+
+	return merr
+}
+
+// Removes all index entries for the record with the given key values.
+func (self *RedisBackend) removeIndexes(collection *dal.Collection, ids []interface{}) error {
+	fields := redisIndexedFields(collection)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	member := redisMember(ids)
+	valuesKey := self.indexValuesKey(collection, member)
+
+	if current, err := redis.StringMap(self.run(`HGETALL`, valuesKey)); err == nil {
+		return self.transaction(func(conn redis.Conn) error {
+			for _, field := range fields {
+				if previous, ok := current[field.Name]; ok {
+					if err := self.sendIndexRemove(conn, collection, field, previous, member); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := conn.Send(`DEL`, valuesKey); err != nil {
+				return err
+			}
+
+			return conn.Send(`ZREM`, self.key(collection.Name, redisExpiresKeyPart), member)
+		})
+	} else {
+		return err
+	}
+}
+
+// Removes the index entries of records whose TTL has passed.  Redis removes the records themselves,
+// but not the entries pointing to them.
+func (self *RedisBackend) expireIndexes(collection *dal.Collection) error {
+	if len(redisIndexedFields(collection)) == 0 {
+		return nil
+	}
+
+	if members, err := redis.Strings(self.run(
+		`ZRANGEBYSCORE`,
+		self.key(collection.Name, redisExpiresKeyPart),
+		`-inf`,
+		time.Now().UnixMilli(),
+	)); err == nil {
+		var merr error
+
+		for _, member := range members {
+			ids := self.memberIds(member)
+
+			if exists, err := redis.Bool(self.run(`EXISTS`, self.key(collection.Name, ids...))); err != nil {
+				merr = utils.AppendError(merr, err)
+			} else if !exists {
+				merr = utils.AppendError(merr, self.removeIndexes(collection, ids))
+			}
+		}
+
+		return merr
+	} else {
+		return err
+	}
+}
+
+// queues the removal of a record's entry for the given (previously indexed) value of a field
+func (self *RedisBackend) sendIndexRemove(conn redis.Conn, collection *dal.Collection, field dal.Field, indexValue string, member string) error {
+	if redisIsRangeIndexed(field) {
+		return conn.Send(`ZREM`, self.indexRangeKey(collection, field.Name), member)
+	} else {
+		return conn.Send(`SREM`, self.indexSetKey(collection, field.Name, indexValue), member)
+	}
+}
+
+// Describes how the records matching a filter are found.
+type redisQueryPlan struct {
+	Members  []string       // the members of the records that may match, in order
+	Residual *filter.Filter // the criteria that each record must still be checked against
+	Exact    bool           // whether every member is known to match
+	Indexed  bool           // whether the members were found using indexes (and so may have expired)
+}
+
+// Finds the records that may match the given filter, using secondary indexes for the criteria on
+// indexed fields where possible and scanning the collection's keys otherwise.
+func (self *RedisBackend) plan(collection *dal.Collection, flt *filter.Filter) (*redisQueryPlan, error) {
+	residual := filter.Copy(flt)
+	residual.Criteria = nil
+
+	var candidates map[string]bool
+
+	for _, criterion := range flt.Criteria {
+		if members, ok, err := self.indexLookup(collection, flt, criterion); err != nil {
+			return nil, err
+		} else if ok {
+			if candidates == nil {
+				candidates = members
+			} else {
+				for member := range candidates {
+					if !members[member] {
+						delete(candidates, member)
+					}
+				}
+			}
+		} else {
+			residual.Criteria = append(residual.Criteria, criterion)
+		}
+	}
+
+	plan := &redisQueryPlan{
+		Residual: &residual,
+	}
+
+	if candidates != nil {
+		plan.Indexed = true
+
+		for member := range candidates {
+			plan.Members = append(plan.Members, member)
+		}
+	} else if members, err := self.scanMembers(collection, flt); err == nil {
+		plan.Members = members
+	} else {
+		return nil, err
+	}
+
+	if len(residual.Criteria) == 0 {
+		residual.MatchAll = true
+		residual.Spec = filter.AllValue
+		plan.Exact = true
+	}
+
+	sort.Strings(plan.Members)
+
+	return plan, nil
+}
+
+// returns the members of the records matching the given criterion from the secondary index of its
+// field, or false if the criterion cannot be answered from an index.
+func (self *RedisBackend) indexLookup(collection *dal.Collection, flt *filter.Filter, criterion filter.Criterion) (map[string]bool, bool, error) {
+	if flt.Conjunction == filter.OrConjunction || criterion.IsGroup() || len(criterion.Values) == 0 {
+		return nil, false, nil
+	}
+
+	field, ok := collection.GetField(criterion.Field)
+
+	if !ok || !field.Indexed || field.Key || field.Identity {
+		return nil, false, nil
+	}
+
+	// entries are only written as records are, so the index of a field that was marked as indexed
+	// after records were written to the collection would be missing those records
+	if built, err := redis.Bool(self.run(`SISMEMBER`, self.indexBuiltKey(collection), field.Name)); err != nil {
+		return nil, false, err
+	} else if !built {
+		return nil, false, nil
+	}
+
+	switch criterion.Operator {
+	case ``, `is`:
+	case `gt`, `gte`, `lt`, `lte`:
+		if !redisIsRangeIndexed(field) {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+
+	members := make(map[string]bool)
+
+	// a record matches if any of the criterion's values match
+	for _, value := range criterion.Values {
+		if value == nil || typeutil.String(value) == `null` {
+			return nil, false, nil
+		}
+
+		if found, err := self.indexMembers(collection, field, criterion.Operator, value); err == nil {
+			for _, member := range found {
+				members[member] = true
+			}
+		} else {
+			return nil, false, err
+		}
+	}
+
+	return members, true, nil
+}
+
+// returns the members of the records whose value of the given indexed field matches the value.
+func (self *RedisBackend) indexMembers(collection *dal.Collection, field dal.Field, operator string, value interface{}) ([]string, error) {
+	if redisIsRangeIndexed(field) {
+		if score, err := redisIndexScore(field, value); err == nil {
+			if min, max, err := redisScoreRange(operator, score); err == nil {
+				return redis.Strings(self.run(`ZRANGEBYSCORE`, self.indexRangeKey(collection, field.Name), min, max))
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, fmt.Errorf("field %q: %v", field.Name, err)
+		}
+	} else if indexValue, err := redisIndexValue(field, value); err == nil {
+		return redis.Strings(self.run(`SMEMBERS`, self.indexSetKey(collection, field.Name, indexValue)))
+	} else {
+		return nil, fmt.Errorf("field %q: %v", field.Name, err)
+	}
+}
+
+// returns the members of all records in the collection whose keys could match the filter's exact
+// match criteria on key fields.
+func (self *RedisBackend) scanMembers(collection *dal.Collection, flt *filter.Filter) ([]string, error) {
+	keyFields := collection.KeyFields()
+	placeholders := make([]interface{}, len(keyFields))
+
+	for i := range placeholders {
+		placeholders[i] = `*`
+	}
+
+	if flt.Conjunction != filter.OrConjunction {
+		for _, criterion := range flt.Criteria {
+			if !criterion.IsExactMatch() || len(criterion.Values) != 1 {
+				continue
+			}
+
+			for i, field := range keyFields {
+				if criterion.Field == field.Name || (i == 0 && criterion.Field == filter.DefaultIdentityField) {
+					placeholders[i] = redisEscapePattern(typeutil.String(criterion.Values[0]))
+				}
+			}
+		}
+	}
+
+	prefix := self.key(collection.Name) + `:`
+
+	if keys, err := self.scan(self.key(collection.Name, placeholders...)); err == nil {
+		members := make([]string, 0, len(keys))
+
+		for _, key := range keys {
+			if member := strings.TrimPrefix(key, prefix); !strings.HasPrefix(member, redisReservedKeyPrefix) {
+				members = append(members, member)
+			}
+		}
+
+		return members, nil
+	} else {
+		return nil, err
+	}
+}
+
+// returns all keys matching the given pattern, using SCAN so that Redis is not blocked while
+// searching a large keyspace.
+func (self *RedisBackend) scan(pattern string) ([]string, error) {
+	keys := make([]string, 0)
+	cursor := `0`
+
+	for {
+		if reply, err := redis.Values(self.run(`SCAN`, cursor, `MATCH`, pattern, `COUNT`, RedisScanCount)); err == nil && len(reply) == 2 {
+			if next, err := redis.String(reply[0], nil); err == nil {
+				cursor = next
+			} else {
+				return nil, err
+			}
+
+			if page, err := redis.Strings(reply[1], nil); err == nil {
+				keys = append(keys, page...)
+			} else {
+				return nil, err
+			}
+		} else if err == nil {
+			return nil, fmt.Errorf("%v: unexpected SCAN reply", self)
+		} else {
+			return nil, err
+		}
+
+		if cursor == `0` {
+			break
+		}
+	}
+
+	// SCAN may return a key more than once
+	return sliceutil.UniqueStrings(keys), nil
+}
+
+// runs the commands queued by the given function in a MULTI/EXEC transaction on a single
+// connection, discarding them if the function returns an error.
+func (self *RedisBackend) transaction(fn func(conn redis.Conn) error) error {
+	if conn := self.pool.Get(); conn != nil {
+		defer conn.Close()
+
+		if err := conn.Send(`MULTI`); err != nil {
+			return err
+		}
+
+		if err := fn(conn); err != nil {
+			conn.Do(`DISCARD`)
+			return err
+		}
+
+		_, err := redis.DoWithTimeout(conn, self.cmdTimeout, `EXEC`)
+		return err
+	} else {
+		return fmt.Errorf("Failed to borrow Redis connection")
+	}
+}
@@ -95,6 +95,11 @@ func (self *RedisBackend) SetIndexer(indexConnString dal.ConnectionString) error
 	}
 }
 
+func (self *RedisBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
 func (self *RedisBackend) Initialize() error {
 	if self.cs.HasOpt(`prefix`) {
 		self.keyPrefix = self.cs.OptString(`prefix`, ``)
@@ -132,11 +137,7 @@ func (self *RedisBackend) Insert(name string, recordset *dal.RecordSet) error {
 
 func (self *RedisBackend) Exists(name string, id interface{}) bool {
 	if collection, err := self.GetCollection(name); err == nil {
-		if record, ok := id.(*dal.Record); ok {
-			id = record.ID
-		}
-
-		if ids := sliceutil.Sliceify(id); len(ids) == collection.KeyCount() {
+		if ids, err := collection.KeyValues(id); err == nil {
 			if i, err := redis.Int(self.run(`EXISTS`, self.key(collection.Name, ids...))); err == nil && i == 1 {
 				return true
 			}
@@ -149,7 +150,7 @@ func (self *RedisBackend) Exists(name string, id interface{}) bool {
 func (self *RedisBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
 	if collection, err := self.GetCollection(name); err == nil {
 		// expand id, make sure it matches the number of parts we need for this collection
-		if ids := sliceutil.Sliceify(id); len(ids) == collection.KeyCount() {
+		if ids, err := collection.KeyValues(id); err == nil {
 			if dbfields, err := redis.Strings(self.run(`HGETALL`, self.key(collection.Name, ids...))); err == nil {
 				record := dal.NewRecord(nil)
 
@@ -180,7 +181,7 @@ func (self *RedisBackend) Retrieve(name string, id interface{}, fields ...string
 				return nil, err
 			}
 		} else {
-			return nil, fmt.Errorf("%v: expected %d key values, got %d", self, collection.KeyCount(), len(ids))
+			return nil, fmt.Errorf("%v: %v", self, err)
 		}
 	} else {
 		return nil, err
@@ -191,19 +192,26 @@ func (self *RedisBackend) Update(name string, recordset *dal.RecordSet, target .
 	return self.upsert(false, name, recordset)
 }
 
+// HMSET creates the hash at a record's key if it doesn't exist, so upserts are the same as updates.
+func (self *RedisBackend) Upsert(name string, recordset *dal.RecordSet) error {
+	return self.upsert(false, name, recordset)
+}
+
 func (self *RedisBackend) Delete(name string, ids ...interface{}) error {
 	if collection, err := self.GetCollection(name); err == nil {
 		var merr error
 
-		keyLen := collection.KeyCount()
-
 		for _, id := range ids {
-			if ids := sliceutil.Sliceify(id); keyLen == 0 || len(ids) == keyLen {
-				if _, err := self.run(`DEL`, self.key(collection.Name, ids...)); err != nil {
+			if keys, err := collection.KeyValues(id); err == nil {
+				if err := self.removeIndexes(collection, keys); err != nil {
+					merr = utils.AppendError(merr, err)
+				}
+
+				if _, err := self.run(`DEL`, self.key(collection.Name, keys...)); err != nil {
 					merr = utils.AppendError(merr, err)
 				}
 			} else {
-				return fmt.Errorf("%v: expected %d key values, got %d", self, keyLen, len(ids))
+				return fmt.Errorf("%v: %v", self, err)
 			}
 		}
 
@@ -218,7 +226,11 @@ func (self *RedisBackend) WithSearch(collection *dal.Collection, filters ...*fil
 }
 
 func (self *RedisBackend) WithAggregator(collection *dal.Collection) Aggregator {
-	return nil
+	if agg, ok := self.indexer.(Aggregator); ok {
+		return agg
+	}
+
+	return newFallbackAggregator(self.indexer, &self.cs)
 }
 
 func (self *RedisBackend) ListCollections() ([]string, error) {
@@ -234,7 +246,7 @@ func (self *RedisBackend) CreateCollection(definition *dal.Collection) error {
 
 	// write the schema definition to the schema key
 	if data, err := json.Marshal(definition); err == nil {
-		schemaKey := self.key(definition.Name, `__schema__`)
+		schemaKey := self.key(definition.Name, redisSchemaKeyPart)
 
 		if out, err := redis.String(self.run(
 			`SET`,
@@ -247,6 +259,19 @@ func (self *RedisBackend) CreateCollection(definition *dal.Collection) error {
 			return fmt.Errorf("Collection %q already exists", definition.Name)
 		}
 
+		// the collection is empty, so the indexes of its indexed fields are already complete
+		if fields := redisIndexedFields(definition); len(fields) > 0 {
+			args := []interface{}{self.indexBuiltKey(definition)}
+
+			for _, field := range fields {
+				args = append(args, field.Name)
+			}
+
+			if _, err := self.run(`SADD`, args...); err != nil {
+				log.Warningf("[%v] collection %q will be queried without indexes: %v", self, definition.Name, err)
+			}
+		}
+
 		self.RegisterCollection(definition)
 		return nil
 	} else {
@@ -256,7 +281,7 @@ func (self *RedisBackend) CreateCollection(definition *dal.Collection) error {
 
 func (self *RedisBackend) DeleteCollection(name string) error {
 	if collection, err := self.GetCollection(name); err == nil {
-		if keys, err := redis.Strings(self.run(`KEYS`, self.key(collection.Name, `*`))); err == nil {
+		if keys, err := self.scan(self.key(collection.Name, `*`)); err == nil {
 			var merr error
 
 			for _, key := range keys {
@@ -265,7 +290,7 @@ func (self *RedisBackend) DeleteCollection(name string) error {
 				}
 			}
 
-			if _, err := self.run(`DEL`, self.key(collection.Name, `__schema__`)); err != nil {
+			if _, err := self.run(`DEL`, self.key(collection.Name, redisSchemaKeyPart)); err != nil {
 				merr = utils.AppendError(merr, err)
 			}
 
@@ -280,7 +305,7 @@ func (self *RedisBackend) DeleteCollection(name string) error {
 
 func (self *RedisBackend) GetCollection(name string) (*dal.Collection, error) {
 	if collectionI, ok := self.registeredCollections.Load(name); ok && collectionI != nil {
-		if i, err := redis.Int(self.run(`EXISTS`, self.key(name, `__schema__`))); err == nil && i == 1 {
+		if i, err := redis.Int(self.run(`EXISTS`, self.key(name, redisSchemaKeyPart))); err == nil && i == 1 {
 			return collectionI.(*dal.Collection), nil
 		}
 	}
@@ -358,6 +383,10 @@ func (self *RedisBackend) upsert(create bool, collectionName string, recordset *
 							merr = utils.AppendError(merr, err)
 						}
 					}
+
+					if err := self.updateIndexes(collection, []*dal.Record{record}); err != nil {
+						merr = utils.AppendError(merr, err)
+					}
 				} else if err == nil {
 					merr = utils.AppendError(merr, fmt.Errorf("%v: persist failed: %v", self, out))
 				} else {
@@ -366,7 +395,8 @@ func (self *RedisBackend) upsert(create bool, collectionName string, recordset *
 			}
 		}
 
-		if search := self.WithSearch(collection); search != nil {
+		// the backend's own indexes were updated as each record was written
+		if search := self.WithSearch(collection); search != nil && search != Indexer(self) {
 			if err := search.Index(collection, recordset); err != nil {
 				merr = utils.AppendError(merr, err)
 			}
@@ -424,7 +454,7 @@ func (self *RedisBackend) decode(collection *dal.Collection, key string, value [
 }
 
 func (self *RedisBackend) refreshCollections() error {
-	if schemata, err := redis.Strings(self.run(`KEYS`, self.key(`*`, `__schema__`))); err == nil {
+	if schemata, err := self.scan(self.key(`*`, redisSchemaKeyPart)); err == nil {
 		var merr error
 
 		for _, key := range schemata {
@@ -1,11 +1,354 @@
 package backends
 
 import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/require"
 )
 
+// an in-process stand-in for a Redis server, implementing only the commands RedisBackend uses
+type fakeRedis struct {
+	sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	sets    map[string]map[string]bool
+	zsets   map[string]map[string]float64
+}
+
+func newFakeRedisBackend() (*RedisBackend, *fakeRedis) {
+	db := &fakeRedis{
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		sets:    make(map[string]map[string]bool),
+		zsets:   make(map[string]map[string]float64),
+	}
+
+	backend := &RedisBackend{
+		cs:        dal.MustParseConnectionString(`redis://localhost`),
+		keyPrefix: redisDefaultKeyPrefix,
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return &fakeRedisConn{db: db}, nil
+			},
+		},
+	}
+
+	backend.indexer = backend
+
+	return backend, db
+}
+
+func (self *fakeRedis) keys() []string {
+	keys := make([]string, 0)
+
+	for key := range self.strings {
+		keys = append(keys, key)
+	}
+
+	for key := range self.hashes {
+		keys = append(keys, key)
+	}
+
+	for key := range self.sets {
+		keys = append(keys, key)
+	}
+
+	for key := range self.zsets {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (self *fakeRedis) del(key string) int64 {
+	var n int64
+
+	for _, exists := range []bool{
+		self.strings[key] != ``,
+		self.hashes[key] != nil,
+		self.sets[key] != nil,
+		self.zsets[key] != nil,
+	} {
+		if exists {
+			n = 1
+		}
+	}
+
+	delete(self.strings, key)
+	delete(self.hashes, key)
+	delete(self.sets, key)
+	delete(self.zsets, key)
+
+	return n
+}
+
+func fakeRedisScoreBound(bound string, score float64, min bool) bool {
+	exclusive := strings.HasPrefix(bound, `(`)
+	bound = strings.TrimPrefix(bound, `(`)
+
+	switch bound {
+	case `-inf`:
+		return min
+	case `+inf`:
+		return !min
+	}
+
+	value, _ := strconv.ParseFloat(bound, 64)
+
+	if min {
+		return score > value || (!exclusive && score == value)
+	} else {
+		return score < value || (!exclusive && score == value)
+	}
+}
+
+func (self *fakeRedis) do(cmd string, args []string) (interface{}, error) {
+	self.Lock()
+	defer self.Unlock()
+
+	switch cmd {
+	case `PING`:
+		return `PONG`, nil
+	case `SET`:
+		if _, ok := self.strings[args[0]]; ok && sliceutil.ContainsString(args, `NX`) {
+			return nil, nil
+		}
+
+		self.strings[args[0]] = args[1]
+		return `OK`, nil
+	case `GET`:
+		if value, ok := self.strings[args[0]]; ok {
+			return []byte(value), nil
+		}
+
+		return nil, nil
+	case `EXISTS`:
+		for _, key := range self.keys() {
+			if key == args[0] {
+				return int64(1), nil
+			}
+		}
+
+		return int64(0), nil
+	case `DEL`:
+		var n int64
+
+		for _, key := range args {
+			n += self.del(key)
+		}
+
+		return n, nil
+	case `EXPIRE`:
+		return int64(1), nil
+	case `HMSET`, `HSET`:
+		if self.hashes[args[0]] == nil {
+			self.hashes[args[0]] = make(map[string]string)
+		}
+
+		for i := 1; i+1 < len(args); i += 2 {
+			self.hashes[args[0]][args[i]] = args[i+1]
+		}
+
+		return `OK`, nil
+	case `HDEL`:
+		for _, field := range args[1:] {
+			delete(self.hashes[args[0]], field)
+		}
+
+		return int64(1), nil
+	case `HGETALL`:
+		reply := make([]interface{}, 0)
+
+		for field, value := range self.hashes[args[0]] {
+			reply = append(reply, []byte(field), []byte(value))
+		}
+
+		return reply, nil
+	case `SADD`:
+		if self.sets[args[0]] == nil {
+			self.sets[args[0]] = make(map[string]bool)
+		}
+
+		for _, member := range args[1:] {
+			self.sets[args[0]][member] = true
+		}
+
+		return int64(1), nil
+	case `SREM`:
+		for _, member := range args[1:] {
+			delete(self.sets[args[0]], member)
+		}
+
+		return int64(1), nil
+	case `SISMEMBER`:
+		if self.sets[args[0]][args[1]] {
+			return int64(1), nil
+		}
+
+		return int64(0), nil
+	case `SMEMBERS`:
+		reply := make([]interface{}, 0)
+
+		for member := range self.sets[args[0]] {
+			reply = append(reply, []byte(member))
+		}
+
+		return reply, nil
+	case `ZADD`:
+		if self.zsets[args[0]] == nil {
+			self.zsets[args[0]] = make(map[string]float64)
+		}
+
+		score, _ := strconv.ParseFloat(args[1], 64)
+		self.zsets[args[0]][args[2]] = score
+		return int64(1), nil
+	case `ZREM`:
+		for _, member := range args[1:] {
+			delete(self.zsets[args[0]], member)
+		}
+
+		return int64(1), nil
+	case `ZRANGEBYSCORE`:
+		members := make([]string, 0)
+
+		for member, score := range self.zsets[args[0]] {
+			if fakeRedisScoreBound(args[1], score, true) && fakeRedisScoreBound(args[2], score, false) {
+				members = append(members, member)
+			}
+		}
+
+		sort.Strings(members)
+		reply := make([]interface{}, 0)
+
+		for _, member := range members {
+			reply = append(reply, []byte(member))
+		}
+
+		return reply, nil
+	case `SCAN`:
+		reply := make([]interface{}, 0)
+
+		for _, key := range self.keys() {
+			if ok, _ := path.Match(args[2], key); ok {
+				reply = append(reply, []byte(key))
+			}
+		}
+
+		return []interface{}{[]byte(`0`), reply}, nil
+	default:
+		return nil, fmt.Errorf("fakeRedis: unsupported command %v", cmd)
+	}
+}
+
+type fakeRedisConn struct {
+	db      *fakeRedis
+	pending [][]interface{}
+	queued  [][]interface{}
+	multi   bool
+}
+
+func (self *fakeRedisConn) exec(cmd string, args ...interface{}) (interface{}, error) {
+	switch cmd {
+	case `MULTI`:
+		self.multi = true
+		return `OK`, nil
+	case `DISCARD`:
+		self.multi = false
+		self.queued = nil
+		return `OK`, nil
+	case `EXEC`:
+		queued := self.queued
+		replies := make([]interface{}, 0)
+
+		self.multi = false
+		self.queued = nil
+
+		for _, queued := range queued {
+			if reply, err := self.exec(queued[0].(string), queued[1:]...); err == nil {
+				replies = append(replies, reply)
+			} else {
+				return nil, err
+			}
+		}
+
+		return replies, nil
+	}
+
+	if self.multi {
+		self.queued = append(self.queued, append([]interface{}{cmd}, args...))
+		return `QUEUED`, nil
+	}
+
+	strargs := make([]string, len(args))
+
+	for i, arg := range args {
+		if data, ok := arg.([]byte); ok {
+			strargs[i] = string(data)
+		} else {
+			strargs[i] = fmt.Sprintf("%v", arg)
+		}
+	}
+
+	return self.db.do(cmd, strargs)
+}
+
+func (self *fakeRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	pending := self.pending
+	self.pending = nil
+
+	for _, command := range pending {
+		if _, err := self.exec(command[0].(string), command[1:]...); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd == `` {
+		return nil, nil
+	}
+
+	return self.exec(cmd, args...)
+}
+
+func (self *fakeRedisConn) DoWithTimeout(_ time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return self.Do(cmd, args...)
+}
+
+func (self *fakeRedisConn) Send(cmd string, args ...interface{}) error {
+	self.pending = append(self.pending, append([]interface{}{cmd}, args...))
+	return nil
+}
+
+func (self *fakeRedisConn) Flush() error {
+	return nil
+}
+
+func (self *fakeRedisConn) Receive() (interface{}, error) {
+	return nil, nil
+}
+
+func (self *fakeRedisConn) ReceiveWithTimeout(time.Duration) (interface{}, error) {
+	return nil, nil
+}
+
+func (self *fakeRedisConn) Err() error {
+	return nil
+}
+
+func (self *fakeRedisConn) Close() error {
+	return nil
+}
+
 func TestRedisSplitKey(t *testing.T) {
 	assert := require.New(t)
 
@@ -29,3 +372,137 @@ func TestRedisSplitKey(t *testing.T) {
 	assert.Equal(`testing`, collection)
 	assert.Equal([]string{`123`, `456`}, keys)
 }
+
+func TestRedisIndexHelpers(t *testing.T) {
+	assert := require.New(t)
+
+	collection := dal.NewCollection(`products`).AddFields(dal.Field{
+		Name:    `color`,
+		Type:    dal.StringType,
+		Indexed: true,
+	}, dal.Field{
+		Name:    `price`,
+		Type:    dal.FloatType,
+		Indexed: true,
+	}, dal.Field{
+		Name:    `created_at`,
+		Type:    dal.TimeType,
+		Indexed: true,
+	}, dal.Field{
+		Name: `description`,
+		Type: dal.StringType,
+	})
+
+	fields := redisIndexedFields(collection)
+	assert.Len(fields, 3)
+	assert.False(redisIsRangeIndexed(fields[0]))
+	assert.True(redisIsRangeIndexed(fields[1]))
+	assert.True(redisIsRangeIndexed(fields[2]))
+
+	value, err := redisIndexValue(fields[0], `red`)
+	assert.NoError(err)
+	assert.Equal(`"red"`, value)
+
+	score, err := redisIndexScore(fields[1], `12.5`)
+	assert.NoError(err)
+	assert.Equal(12.5, score)
+
+	score, err = redisIndexScore(fields[2], time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(err)
+	assert.Equal(float64(1704067200000), score)
+
+	min, max, err := redisScoreRange(`gt`, 5)
+	assert.NoError(err)
+	assert.Equal(`(5`, min)
+	assert.Equal(`+inf`, max)
+
+	min, max, err = redisScoreRange(`lte`, 5)
+	assert.NoError(err)
+	assert.Equal(`-inf`, min)
+	assert.Equal(`5`, max)
+
+	min, max, err = redisScoreRange(`is`, 2.5)
+	assert.NoError(err)
+	assert.Equal(`2.5`, min)
+	assert.Equal(`2.5`, max)
+
+	_, _, err = redisScoreRange(`contains`, 1)
+	assert.Error(err)
+
+	assert.Equal(`a\*b\?c\[d\]`, redisEscapePattern(`a*b?c[d]`))
+	assert.Equal(`123:456`, redisMember([]interface{}{123, 456}))
+}
+
+func TestRedisIndexOnExistingCollection(t *testing.T) {
+	assert := require.New(t)
+	backend, _ := newFakeRedisBackend()
+
+	unindexed := dal.NewCollection(`products`).AddFields(dal.Field{
+		Name: `color`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name: `price`,
+		Type: dal.FloatType,
+	})
+
+	assert.NoError(backend.CreateCollection(unindexed))
+	assert.NoError(backend.Insert(`products`, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`color`, `red`).Set(`price`, 5),
+		dal.NewRecord(2).Set(`color`, `blue`).Set(`price`, 15),
+		dal.NewRecord(3).Set(`color`, `red`).Set(`price`, 25),
+	)))
+
+	// mark the fields as indexed after records have been written to the collection
+	indexed := dal.NewCollection(`products`).AddFields(dal.Field{
+		Name:    `color`,
+		Type:    dal.StringType,
+		Indexed: true,
+	}, dal.Field{
+		Name:    `price`,
+		Type:    dal.FloatType,
+		Indexed: true,
+	})
+
+	backend.RegisterCollection(indexed)
+
+	assert.NoError(backend.Insert(`products`, dal.NewRecordSet(
+		dal.NewRecord(4).Set(`color`, `red`).Set(`price`, 35),
+	)))
+
+	for spec, ids := range map[string][]string{
+		`color/red`:               {`1`, `3`, `4`},
+		`price/gt:10`:             {`2`, `3`, `4`},
+		`color/red/price/lt:30`:   {`1`, `3`},
+		`color/blue/price/gte:15`: {`2`},
+	} {
+		plan, err := backend.plan(indexed, filter.MustParse(spec))
+		assert.NoError(err, spec)
+		assert.False(plan.Indexed, spec)
+
+		recordset, err := backend.Query(indexed, filter.MustParse(spec))
+		assert.NoError(err, spec)
+		assert.ElementsMatch(ids, sliceutil.Stringify(recordset.Pluck(`id`)), spec)
+	}
+
+	// the indexes of collections created with indexed fields are used straight away
+	widgets := dal.NewCollection(`widgets`).AddFields(dal.Field{
+		Name:    `color`,
+		Type:    dal.StringType,
+		Indexed: true,
+	})
+
+	assert.NoError(backend.CreateCollection(widgets))
+	assert.NoError(backend.Insert(`widgets`, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`color`, `red`),
+		dal.NewRecord(2).Set(`color`, `blue`),
+	)))
+
+	plan, err := backend.plan(widgets, filter.MustParse(`color/red`))
+	assert.NoError(err)
+	assert.True(plan.Indexed)
+	assert.Equal([]string{`1`}, plan.Members)
+
+	recordset, err := backend.Query(widgets, filter.MustParse(`color/red`))
+	assert.NoError(err)
+	assert.Equal([]string{`1`}, sliceutil.Stringify(recordset.Pluck(`id`)))
+}
@@ -0,0 +1,346 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+)
+
+var DefaultReindexBatchSize = 500
+
+type ReindexProgress struct {
+	Collection string `json:"collection"`
+	Indexer    string `json:"indexer"`
+	Indexed    int    `json:"indexed"`
+	Removed    int    `json:"removed"`
+	Total      int64  `json:"total"` // the number of records in the backend, or -1 if not known
+}
+
+type ReindexProgressFunc func(progress ReindexProgress) // {}
+
+// A field whose value differs between the backend and an index.
+type IndexFieldMismatch struct {
+	ID           interface{} `json:"id"`
+	Field        string      `json:"field"`
+	BackendValue interface{} `json:"backend_value"`
+	IndexValue   interface{} `json:"index_value"`
+}
+
+// Describes the differences between the records in a backend and those in one of its indexers.
+type IndexCheckReport struct {
+	Collection   string               `json:"collection"`
+	Indexer      string               `json:"indexer"`
+	BackendCount int                  `json:"backend_count"`
+	IndexCount   int                  `json:"index_count"`
+	Missing      []interface{}        `json:"missing,omitempty"`
+	Extra        []interface{}        `json:"extra,omitempty"`
+	Mismatched   []IndexFieldMismatch `json:"mismatched,omitempty"`
+}
+
+// Returns whether the index contains exactly the records (and values) that the backend does.
+func (self *IndexCheckReport) Consistent() bool {
+	return len(self.Missing) == 0 && len(self.Extra) == 0 && len(self.Mismatched) == 0
+}
+
+// A Reindexer rebuilds the indexes of a backend from the records stored in the backend itself,
+// and can check whether those indexes have drifted from the backend.  This is only possible for
+// backends that can query their own data (i.e.: those that implement Indexer).
+type Reindexer struct {
+	BatchSize int                 // the number of records to send to the indexer at a time
+	Prune     bool                // whether to remove records from the index that aren't in the backend
+	Progress  ReindexProgressFunc // called after each batch is indexed
+	backend   Backend
+}
+
+func NewReindexer(backend Backend) *Reindexer {
+	return &Reindexer{
+		BatchSize: DefaultReindexBatchSize,
+		backend:   backend,
+	}
+}
+
+// Streams every record in the given collection from the backend into its indexer(s), returning
+// the progress of each indexer once complete.
+func (self *Reindexer) Reindex(collection *dal.Collection) ([]ReindexProgress, error) {
+	return self.ReindexContext(context.Background(), collection)
+}
+
+// Same as Reindex, but stops once the given context is done.
+func (self *Reindexer) ReindexContext(ctx context.Context, collection *dal.Collection) ([]ReindexProgress, error) {
+	source, targets, err := self.indexers(collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := self.BatchSize
+
+	if batchSize <= 0 {
+		batchSize = DefaultReindexBatchSize
+	}
+
+	results := make([]ReindexProgress, len(targets))
+	seen := make(map[string]bool)
+	batch := dal.NewRecordSet()
+
+	for i, target := range targets {
+		results[i] = ReindexProgress{
+			Collection: collection.Name,
+			Indexer:    indexerName(target),
+			Total:      -1,
+		}
+	}
+
+	flush := func() error {
+		if len(batch.Records) == 0 {
+			return nil
+		}
+
+		for i, target := range targets {
+			if err := target.Index(collection, batch); err == nil {
+				results[i].Indexed += len(batch.Records)
+				self.notify(results[i])
+			} else {
+				return fmt.Errorf("%v: %v", results[i].Indexer, err)
+			}
+		}
+
+		batch = dal.NewRecordSet()
+		return nil
+	}
+
+	if err := QueryFuncContext(ctx, source, collection, filter.All(), func(record *dal.Record, err error, page IndexPage) error {
+		if err != nil {
+			return err
+		}
+
+		for i := range results {
+			results[i].Total = page.TotalResults
+		}
+
+		seen[typeutil.String(record.ID)] = true
+		batch.Push(record)
+
+		if len(batch.Records) >= batchSize {
+			return flush()
+		}
+
+		return nil
+	}); err != nil {
+		return results, err
+	}
+
+	if err := flush(); err != nil {
+		return results, err
+	}
+
+	for i, target := range targets {
+		if err := target.FlushIndex(); err != nil {
+			return results, fmt.Errorf("%v: %v", results[i].Indexer, err)
+		}
+
+		// remove records from the index that no longer exist in the backend
+		if self.Prune {
+			var extra []interface{}
+
+			if err := QueryFuncContext(ctx, target, collection, filter.All(), func(record *dal.Record, err error, _ IndexPage) error {
+				if err != nil {
+					return err
+				} else if !seen[typeutil.String(record.ID)] {
+					extra = append(extra, record.ID)
+				}
+
+				return nil
+			}); err != nil {
+				return results, fmt.Errorf("%v: %v", results[i].Indexer, err)
+			}
+
+			if len(extra) > 0 {
+				if err := target.IndexRemove(collection, extra); err == nil {
+					results[i].Removed = len(extra)
+					self.notify(results[i])
+				} else {
+					return results, fmt.Errorf("%v: %v", results[i].Indexer, err)
+				}
+
+				if err := target.FlushIndex(); err != nil {
+					return results, fmt.Errorf("%v: %v", results[i].Indexer, err)
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Compares the records in the given collection with those in each of the backend's indexers,
+// returning a report describing the differences found in each.
+func (self *Reindexer) Check(collection *dal.Collection) ([]*IndexCheckReport, error) {
+	return self.CheckContext(context.Background(), collection)
+}
+
+// Same as Check, but stops once the given context is done.
+func (self *Reindexer) CheckContext(ctx context.Context, collection *dal.Collection) ([]*IndexCheckReport, error) {
+	source, targets, err := self.indexers(collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*dal.Record)
+	order := make([]string, 0)
+
+	if err := QueryFuncContext(ctx, source, collection, filter.All(), func(record *dal.Record, err error, _ IndexPage) error {
+		if err == nil {
+			id := typeutil.String(record.ID)
+			records[id] = record
+			order = append(order, id)
+		}
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	reports := make([]*IndexCheckReport, 0)
+
+	for _, target := range targets {
+		report := &IndexCheckReport{
+			Collection:   collection.Name,
+			Indexer:      indexerName(target),
+			BackendCount: len(records),
+		}
+
+		found := make(map[string]bool)
+
+		// indexers may only return IDs unless fields are explicitly requested
+		flt := filter.All()
+
+		for _, field := range collection.Fields {
+			if !field.Identity {
+				flt.Fields = append(flt.Fields, field.Name)
+			}
+		}
+
+		if err := QueryFuncContext(ctx, target, collection, flt, func(indexed *dal.Record, err error, _ IndexPage) error {
+			if err != nil {
+				return err
+			}
+
+			id := typeutil.String(indexed.ID)
+			report.IndexCount += 1
+			found[id] = true
+
+			if record, ok := records[id]; ok {
+				report.Mismatched = append(report.Mismatched, compareIndexedRecord(collection, record, indexed)...)
+			} else {
+				report.Extra = append(report.Extra, indexed.ID)
+			}
+
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("%v: %v", report.Indexer, err)
+		}
+
+		for _, id := range order {
+			if !found[id] {
+				report.Missing = append(report.Missing, records[id].ID)
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (self *Reindexer) notify(progress ReindexProgress) {
+	if self.Progress != nil {
+		self.Progress(progress)
+	}
+}
+
+// returns the backend (as the indexer used to read its own records) and the indexers that will
+// be rebuilt from it.
+func (self *Reindexer) indexers(collection *dal.Collection) (Indexer, []Indexer, error) {
+	source, ok := self.backend.(Indexer)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("backend %v cannot enumerate its own records", self.backend)
+	}
+
+	targets := make([]Indexer, 0)
+
+	if search := self.backend.WithSearch(collection); search != nil {
+		if multi, ok := search.(*MultiIndex); ok {
+			for _, indexer := range multi.Indexers() {
+				if indexer != source {
+					targets = append(targets, indexer)
+				}
+			}
+		} else if search != source {
+			targets = append(targets, search)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("collection %q is not indexed separately from backend %v", collection.Name, self.backend)
+	}
+
+	return source, targets, nil
+}
+
+func indexerName(indexer Indexer) string {
+	if cs := indexer.IndexConnectionString(); cs != nil {
+		return cs.String()
+	}
+
+	return fmt.Sprintf("%T", indexer)
+}
+
+// compares the values of all fields in the collection between a record read from the backend and
+// the same record read from an index.
+func compareIndexedRecord(collection *dal.Collection, record *dal.Record, indexed *dal.Record) []IndexFieldMismatch {
+	var mismatches []IndexFieldMismatch
+
+	for _, field := range collection.Fields {
+		if field.Identity {
+			continue
+		}
+
+		expected, _ := field.ConvertValue(record.Get(field.Name))
+		actual, _ := field.ConvertValue(indexed.Get(field.Name))
+
+		if !indexValuesEqual(expected, actual) {
+			mismatches = append(mismatches, IndexFieldMismatch{
+				ID:           record.ID,
+				Field:        field.Name,
+				BackendValue: expected,
+				IndexValue:   actual,
+			})
+		}
+	}
+
+	return mismatches
+}
+
+func indexValuesEqual(a interface{}, b interface{}) bool {
+	if typeutil.IsZero(a) && typeutil.IsZero(b) {
+		return true
+	} else if aT, ok := a.(time.Time); ok {
+		if bT, ok := b.(time.Time); ok {
+			return aT.Equal(bT)
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+
+	return typeutil.String(a) == typeutil.String(b)
+}
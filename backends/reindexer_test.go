@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReindexer(t *testing.T) {
+	assert := require.New(t)
+
+	root, err := ioutil.TempDir(``, `pivot-reindex-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(backend.SetIndexer(dal.MustParseConnectionString(`bleve:///` + root)))
+	assert.NoError(backend.Initialize())
+
+	groups, _ := testMemoryCollections()
+	assert.NoError(backend.CreateCollection(groups))
+	assert.NoError(backend.Insert(`groups`, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `First`),
+		dal.NewRecord(`b`).Set(`name`, `Second`),
+		dal.NewRecord(`c`).Set(`name`, `Third`),
+	)))
+
+	// make the index drift from the backend
+	index := backend.WithSearch(groups)
+	assert.NoError(index.IndexRemove(groups, []interface{}{`a`}))
+	assert.NoError(index.Index(groups, dal.NewRecordSet(
+		dal.NewRecord(`b`).Set(`name`, `Changed`),
+		dal.NewRecord(`z`).Set(`name`, `Extra`),
+	)))
+	assert.NoError(index.FlushIndex())
+
+	reindexer := NewReindexer(backend)
+	reports, err := reindexer.Check(groups)
+	assert.NoError(err)
+	assert.Len(reports, 1)
+
+	report := reports[0]
+	assert.False(report.Consistent())
+	assert.Equal(3, report.BackendCount)
+	assert.Equal(3, report.IndexCount)
+	assert.Equal([]interface{}{`a`}, report.Missing)
+	assert.Equal([]interface{}{`z`}, report.Extra)
+	assert.Equal([]IndexFieldMismatch{{
+		ID:           `b`,
+		Field:        `name`,
+		BackendValue: `Second`,
+		IndexValue:   `Changed`,
+	}}, report.Mismatched)
+
+	var progress []ReindexProgress
+
+	reindexer.BatchSize = 2
+	reindexer.Prune = true
+	reindexer.Progress = func(p ReindexProgress) {
+		progress = append(progress, p)
+	}
+
+	results, err := reindexer.Reindex(groups)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Equal(3, results[0].Indexed)
+	assert.Equal(1, results[0].Removed)
+	assert.EqualValues(3, results[0].Total)
+
+	// one notification per batch, and one for the pruned records
+	assert.Len(progress, 3)
+
+	reports, err = reindexer.Check(groups)
+	assert.NoError(err)
+	assert.True(reports[0].Consistent(), "%+v", reports[0])
+
+	// backends that are their own index have nothing to rebuild
+	plain := NewMemoryBackend(dal.MustParseConnectionString(`memory://`))
+	assert.NoError(plain.Initialize())
+	assert.NoError(plain.CreateCollection(groups))
+
+	_, err = NewReindexer(plain).Reindex(groups)
+	assert.Error(err)
+}
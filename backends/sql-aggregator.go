@@ -3,8 +3,11 @@ package backends
 // this file satifies the Aggregator interface for SqlBackend
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
@@ -42,27 +45,232 @@ func (self *SqlBackend) Average(collection *dal.Collection, field string, f ...*
 }
 
 func (self *SqlBackend) GroupBy(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error) {
-	if result, err := self.aggregate(collection, groupBy, aggregates, f, self.extractRecordSet); err == nil {
+	return self.GroupByContext(context.Background(), collection, groupBy, aggregates, f...)
+}
+
+func (self *SqlBackend) GroupByContext(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, f ...*filter.Filter) (*dal.RecordSet, error) {
+	// aggregates this dialect has no functions for are calculated from the records themselves
+	queryGen := self.makeQueryGen(collection)
+
+	for _, aggregate := range aggregates {
+		if _, err := queryGen.ToAggregateExpression(aggregate); err != nil {
+			if aggregator := newFallbackAggregator(self.WithSearch(collection), self.GetConnectionString()); aggregator != nil {
+				return GroupByContext(ctx, aggregator, collection, groupBy, aggregates, f...)
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	if result, err := self.aggregate(ctx, collection, groupBy, aggregates, nil, f, self.extractRecordSet); err == nil {
 		return result.(*dal.RecordSet), nil
 	} else {
 		return nil, err
 	}
 }
 
+// GroupByQuery filters, sorts, and paginates the groups using HAVING, ORDER BY, and LIMIT clauses
+// instead of reading every group.  Queries using aggregates this dialect has no functions for are
+// not implemented, and are calculated from the records themselves instead.
+func (self *SqlBackend) GroupByQuery(ctx context.Context, collection *dal.Collection, query *GroupByQuery) (*dal.RecordSet, error) {
+	queryGen := self.makeQueryGen(collection)
+
+	for _, aggregate := range query.Aggregates {
+		if _, err := queryGen.ToAggregateExpression(aggregate); err != nil {
+			return nil, NotImplementedError
+		}
+	}
+
+	flt := aggregationFilter(query.Filter)
+	flt.Sort = query.Sort
+	flt.Limit = query.Limit
+	flt.Offset = query.Offset
+
+	var recordset *dal.RecordSet
+
+	if result, err := self.aggregate(ctx, collection, query.Fields, query.Aggregates, query.Having, []*filter.Filter{flt}, self.extractRecordSet); err == nil {
+		recordset = result.(*dal.RecordSet)
+	} else {
+		return nil, err
+	}
+
+	total := int64(query.Offset + len(recordset.Records))
+
+	// a full (or empty) page doesn't tell us how many groups there are in total
+	if (query.Limit > 0 && len(recordset.Records) == query.Limit) || (query.Offset > 0 && len(recordset.Records) == 0) {
+		if count, err := self.countGroups(ctx, collection, query); err == nil {
+			total = count
+		} else {
+			return nil, err
+		}
+	}
+
+	recordset.ResultCount = total
+	recordset.KnownSize = true
+	recordset.RecordsPerPage = query.Limit
+
+	return recordset, nil
+}
+
+// counts the groups a GroupByQuery would return if it were not paginated.
+func (self *SqlBackend) countGroups(ctx context.Context, collection *dal.Collection, query *GroupByQuery) (int64, error) {
+	queryGen := self.makeQueryGen(collection)
+
+	for _, g := range query.Fields {
+		queryGen.GroupByField(g)
+	}
+
+	for _, agg := range query.Aggregates {
+		queryGen.AggregateBy(agg)
+	}
+
+	queryGen.HavingBy(query.Having)
+
+	if err := queryGen.Initialize(collection.Name); err != nil {
+		return 0, err
+	}
+
+	if groups, err := filter.Render(queryGen, collection.Name, aggregationFilter(query.Filter)); err == nil {
+		stmt := fmt.Sprintf("SELECT COUNT(1) FROM (%s) AS grouped_results", string(groups[:]))
+		querylog.Debugf("[%T] %s %v", self, stmt, queryGen.GetValues())
+
+		if rows, err := self.dbx().QueryContext(ctx, stmt, queryGen.GetValues()...); err == nil {
+			defer rows.Close()
+
+			if count, err := self.extractSingleFloat64(rows, queryGen, collection, nil); err == nil {
+				return int64(count.(float64)), nil
+			} else {
+				return 0, err
+			}
+		} else {
+			return 0, err
+		}
+	} else {
+		return 0, err
+	}
+}
+
+// DateHistogram groups the records matching the query into buckets using the dialect's date
+// functions, aggregating over a subquery that selects the matching records.
+func (self *SqlBackend) DateHistogram(ctx context.Context, collection *dal.Collection, query *DateHistogramQuery) (*dal.RecordSet, error) {
+	if self.histogramBucketFunc == nil {
+		return nil, NotImplementedError
+	}
+
+	queryGen := self.makeQueryGen(collection)
+	fieldNameFormat := queryGen.TypeMapping.FieldNameFormat
+	var columns []string
+
+	if bucket, err := self.histogramBucketFunc(queryGen.ToFieldName(query.Field), query.Interval, query.Location); err == nil {
+		columns = append(columns, fmt.Sprintf("%s AS "+fieldNameFormat, bucket, HistogramBucketField))
+	} else {
+		return nil, err
+	}
+
+	for _, aggregate := range query.Aggregates {
+		field := aggregate.Field
+
+		switch aggregate.Aggregation {
+		case filter.First, filter.Last:
+			return nil, NotImplementedError
+		case filter.Count:
+			if field == filter.DefaultIdentityField {
+				field = collection.GetIdentityFieldName()
+			}
+		}
+
+		aggregate.Field = field
+
+		if expr, err := queryGen.ToAggregateExpression(aggregate); err == nil {
+			columns = append(columns, fmt.Sprintf("%s AS "+fieldNameFormat, expr, aggregate.ResultName()))
+		} else {
+			return nil, NotImplementedError
+		}
+	}
+
+	if err := queryGen.Initialize(collection.Name); err != nil {
+		return nil, err
+	}
+
+	if source, err := filter.Render(queryGen, collection.Name, query.sourceFilter(true)); err == nil {
+		stmt := fmt.Sprintf(
+			"SELECT %s FROM (%s) AS histogram_source GROUP BY 1",
+			strings.Join(columns, `, `),
+			string(source[:]),
+		)
+
+		querylog.Debugf("[%T] %s %v", self, stmt, queryGen.GetValues())
+
+		if rows, err := self.dbx().QueryContext(ctx, stmt, queryGen.GetValues()...); err == nil {
+			defer rows.Close()
+
+			buckets := make([]*dal.Record, 0)
+
+			for rows.Next() {
+				values := make([]interface{}, len(columns))
+				pointers := make([]interface{}, len(columns))
+
+				for i := range values {
+					pointers[i] = &values[i]
+				}
+
+				if err := rows.Scan(pointers...); err != nil {
+					return nil, err
+				}
+
+				for i, value := range values {
+					if asBytes, ok := value.([]byte); ok {
+						values[i] = string(asBytes)
+					}
+				}
+
+				if values[0] == nil {
+					continue
+				}
+
+				bucket := dal.NewRecord(nil).Set(HistogramBucketField, values[0])
+
+				for i, aggregate := range query.Aggregates {
+					value := values[i+1]
+
+					switch aggregate.Aggregation {
+					case filter.Minimum, filter.Maximum:
+						value = collection.ConvertValue(aggregate.Field, value)
+					}
+
+					bucket.Set(aggregate.ResultName(), value)
+				}
+
+				buckets = append(buckets, bucket)
+			}
+
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+
+			return histogramRecordSet(query, buckets)
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
 func (self *SqlBackend) aggregateFloat(collection *dal.Collection, aggregation filter.Aggregation, field string, f []*filter.Filter) (float64, error) {
-	if result, err := self.aggregate(collection, nil, []filter.Aggregate{
+	if result, err := self.aggregate(context.Background(), collection, nil, []filter.Aggregate{
 		{
 			Aggregation: aggregation,
 			Field:       field,
 		},
-	}, f, self.extractSingleFloat64); err == nil {
+	}, nil, f, self.extractSingleFloat64); err == nil {
 		return result.(float64), nil
 	} else {
 		return 0, err
 	}
 }
 
-func (self *SqlBackend) aggregate(collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, f []*filter.Filter, resultFn sqlAggResultFunc) (interface{}, error) {
+func (self *SqlBackend) aggregate(ctx context.Context, collection *dal.Collection, groupBy []string, aggregates []filter.Aggregate, having *filter.Filter, f []*filter.Filter, resultFn sqlAggResultFunc) (interface{}, error) {
 	queryGen := self.makeQueryGen(collection)
 	var flt *filter.Filter
 
@@ -77,17 +285,19 @@ func (self *SqlBackend) aggregate(collection *dal.Collection, groupBy []string,
 	}
 
 	for _, agg := range aggregates {
-		queryGen.AggregateByField(agg.Aggregation, agg.Field)
+		queryGen.AggregateBy(agg)
 	}
 
+	queryGen.HavingBy(having)
+
 	if err := queryGen.Initialize(collection.Name); err == nil {
 		if stmt, err := filter.Render(queryGen, collection.Name, flt); err == nil {
 			querylog.Debugf("[%T] %s %v", self, string(stmt[:]), queryGen.GetValues())
 
 			// perform query
-			if rows, err := self.db.Query(string(stmt[:]), queryGen.GetValues()...); err == nil {
+			if rows, err := self.dbx().QueryContext(ctx, string(stmt[:]), queryGen.GetValues()...); err == nil {
 				defer rows.Close()
-				return resultFn(rows, queryGen, collection, flt)
+				return resultFn(rows, queryGen, aggregateResultCollection(collection, aggregates), flt)
 			} else {
 				return nil, err
 			}
@@ -138,3 +348,34 @@ func (self *SqlBackend) extractRecordSet(rows *sql.Rows, queryGen *generators.Sq
 
 	return recordset, nil
 }
+
+// returns a copy of the collection that also describes the fields that named aggregates are
+// returned as, so that they are read from the result like any other field.
+func aggregateResultCollection(collection *dal.Collection, aggregates []filter.Aggregate) *dal.Collection {
+	var results dal.Collection = *collection
+	results.Fields = append([]dal.Field{}, collection.Fields...)
+
+	for _, aggregate := range aggregates {
+		if _, ok := results.GetField(aggregate.ResultName()); ok {
+			continue
+		}
+
+		result := dal.Field{
+			Name: aggregate.ResultName(),
+			Type: dal.FloatType,
+		}
+
+		switch aggregate.Aggregation {
+		case filter.Count, filter.CountDistinct, filter.Cardinality:
+			result.Type = dal.IntType
+		case filter.First, filter.Last, filter.Minimum, filter.Maximum:
+			if field, ok := collection.GetField(aggregate.Field); ok {
+				result.Type = field.Type
+			}
+		}
+
+		results.Fields = append(results.Fields, result)
+	}
+
+	return &results
+}
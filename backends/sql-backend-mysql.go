@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/PerformLine/go-stockutil/stringutil"
 	"github.com/PerformLine/pivot/v3/dal"
@@ -21,6 +22,34 @@ func preinitializeMysql(self *SqlBackend) {
 	self.createPrimaryKeyStrFormat = `%s VARCHAR(255) NOT NULL`
 	self.foreignKeyConstraintFormat = `FOREIGN KEY(%s) REFERENCES %s (%s) %s`
 	self.defaultCurrentTimeString = `CURRENT_TIMESTAMP`
+	self.createUniqueIndexFormat = `CREATE UNIQUE INDEX %s ON %s (%s)`
+	self.uniqueIndexExistsQuery = `SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+	self.histogramBucketFunc = mysqlHistogramBucket
+}
+
+// converting between time zones requires MySQL's time zone tables, which may not be loaded, so
+// only UTC buckets are calculated natively
+func mysqlHistogramBucket(column string, interval HistogramInterval, loc *time.Location) (string, error) {
+	if loc.String() != `UTC` {
+		return ``, NotImplementedError
+	}
+
+	switch interval {
+	case MinuteInterval:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%dT%%H:%%i:00Z')", column), nil
+	case HourInterval:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%dT%%H:00:00Z')", column), nil
+	case DayInterval:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%dT00:00:00Z')", column), nil
+	case WeekInterval:
+		return fmt.Sprintf("DATE_FORMAT(DATE_SUB(%s, INTERVAL WEEKDAY(%s) DAY), '%%Y-%%m-%%dT00:00:00Z')", column, column), nil
+	case MonthInterval:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01T00:00:00Z')", column), nil
+	case YearInterval:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-01-01T00:00:00Z')", column), nil
+	default:
+		return ``, NotImplementedError
+	}
 }
 
 func initializeMysql(self *SqlBackend) (string, string, error) {
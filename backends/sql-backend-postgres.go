@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/go-stockutil/stringutil"
@@ -17,6 +18,12 @@ import (
 func preinitializePostgres(self *SqlBackend) {
 	// tell the backend cool details about generating compatible SQL
 	self.queryGenTypeMapping = generators.PostgresTypeMapping
+
+	// store objects and arrays as JSONB, which allows for querying nested fields
+	if self.conn.OptBool(`jsonb`, false) {
+		self.queryGenTypeMapping = generators.PostgresJsonTypeMapping
+	}
+
 	self.queryGenNormalizerFormat = "regexp_replace(lower(%v), '[\\:\\[\\]\\*]+', ' ')"
 	self.listAllTablesQuery = `SELECT table_name from information_schema.TABLES WHERE table_catalog = CURRENT_CATALOG AND table_schema = 'public'`
 	self.createPrimaryKeyIntFormat = `%s BIGSERIAL`
@@ -26,6 +33,30 @@ func preinitializePostgres(self *SqlBackend) {
 	self.foreignKeyConstraintFormat = `FOREIGN KEY(%s) REFERENCES %s (%s) %s`
 	// self.defaultCurrentTimeString = `now() AT TIME ZONE 'utc'`
 	self.defaultCurrentTimeString = `current_timestamp`
+	self.histogramBucketFunc = postgresHistogramBucket
+}
+
+// buckets are truncated in the requested time zone, then converted back to a UTC timestamp
+func postgresHistogramBucket(column string, interval HistogramInterval, loc *time.Location) (string, error) {
+	// the "Local" zone means nothing to the database server
+	if loc == time.Local {
+		return ``, NotImplementedError
+	}
+
+	switch interval {
+	case MinuteInterval, HourInterval, DayInterval, WeekInterval, MonthInterval, YearInterval:
+		tz := strings.Replace(loc.String(), `'`, `''`, -1)
+
+		return fmt.Sprintf(
+			"date_trunc('%s', (%s AT TIME ZONE 'UTC') AT TIME ZONE '%s') AT TIME ZONE '%s'",
+			interval,
+			column,
+			tz,
+			tz,
+		), nil
+	default:
+		return ``, NotImplementedError
+	}
 }
 
 func initializePostgres(self *SqlBackend) (string, string, error) {
@@ -151,6 +182,9 @@ func initializePostgres(self *SqlBackend) (string, string, error) {
 								default:
 									field.Type = dal.StringType
 								}
+							} else if strings.HasPrefix(columnType, `JSON`) {
+								field.Type = dal.ObjectType
+
 							} else if strings.HasPrefix(columnType, `BOOL`) {
 								field.Type = dal.BooleanType
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/PerformLine/go-stockutil/log"
 	"github.com/PerformLine/go-stockutil/maputil"
@@ -19,24 +21,42 @@ func preinitializeSqlite(self *SqlBackend) {
 	// tell the backend cool details about generating compatible SQL
 	self.queryGenTypeMapping = generators.SqliteTypeMapping
 	self.queryGenNormalizerFormat = "LOWER(REPLACE(REPLACE(REPLACE(REPLACE(%v, ':', ' '), '[', ' '), ']', ' '), '*', ' '))"
-	self.listAllTablesQuery = `SELECT name FROM sqlite_master`
+	self.listAllTablesQuery = `SELECT name FROM sqlite_master WHERE type = 'table' AND sql NOT LIKE 'CREATE VIRTUAL TABLE%' AND name NOT LIKE '%\_\_fulltext\_%' ESCAPE '\'`
 	self.createPrimaryKeyIntFormat = `%s INTEGER NOT NULL`
 	self.createPrimaryKeyStrFormat = `%s TEXT NOT NULL`
 	self.foreignKeyConstraintFormat = `FOREIGN KEY(%s) REFERENCES %s(%s) %s`
 	self.defaultCurrentTimeString = `CURRENT_TIMESTAMP`
+	self.histogramBucketFunc = sqliteHistogramBucket
 }
 
-func initializeSqlite(self *SqlBackend) (string, string, error) {
-	// the bespoke method for determining table information for sqlite3
-	self.refreshCollectionFunc = func(datasetName string, collectionName string) (*dal.Collection, error) {
-		var uniqueConstraints []string
+// sqlite has no notion of named time zones, so only UTC buckets are calculated natively
+func sqliteHistogramBucket(column string, interval HistogramInterval, loc *time.Location) (string, error) {
+	if loc.String() != `UTC` {
+		return ``, NotImplementedError
+	}
 
-		if c, err := self.sqliteGetTableConstraints(`unique`, collectionName); err == nil {
-			uniqueConstraints = c
-		} else {
-			return nil, err
-		}
+	switch interval {
+	case MinuteInterval:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%dT%%H:%%M:00Z', %s)", column), nil
+	case HourInterval:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%dT%%H:00:00Z', %s)", column), nil
+	case DayInterval:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%dT00:00:00Z', %s)", column), nil
+	case WeekInterval:
+		// move forward to the next Sunday (or stay put), then back to that week's Monday
+		return fmt.Sprintf("strftime('%%Y-%%m-%%dT00:00:00Z', %s, 'weekday 0', '-6 days')", column), nil
+	case MonthInterval:
+		return fmt.Sprintf("strftime('%%Y-%%m-01T00:00:00Z', %s)", column), nil
+	case YearInterval:
+		return fmt.Sprintf("strftime('%%Y-01-01T00:00:00Z', %s)", column), nil
+	default:
+		return ``, NotImplementedError
+	}
+}
 
+func initializeSqlite(self *SqlBackend) (string, string, error) {
+	// the features available to us depend on the options sqlite was compiled with
+	self.postConnectFunc = func() error {
 		compileOptions := `PRAGMA compile_options`
 		querylog.Debugf("[%T] %s", self, compileOptions)
 
@@ -49,13 +69,38 @@ func initializeSqlite(self *SqlBackend) (string, string, error) {
 				if err := options.Scan(&option); err == nil {
 					switch option {
 					case `ENABLE_JSON1`:
-						// self.queryGenNestedFieldFormat = "json_extract(%v, '$.%v')"
 						log.Debugf("sqlite: using JSON1 extension")
+					case `OMIT_JSON`:
+						// nested field and array queries are built on the JSON functions, which aren't available
+						self.queryGenTypeMapping.NestedFieldFunc = nil
+						self.queryGenTypeMapping.ArrayContainsFunc = nil
+						log.Debugf("sqlite: JSON functions are not available")
+					case `ENABLE_FTS5`:
+						// full-text queries are performed against FTS5 tables kept in sync with each collection
+						self.queryGenTypeMapping.FulltextFunc = generators.SqliteFulltextMatch
+						self.queryGenTypeMapping.FulltextScoreFunc = generators.SqliteFulltextScore
+						self.fulltextCreateFunc = self.sqliteFulltextCreateStatements
+						self.fulltextDropFunc = self.sqliteFulltextDropStatements
+						self.fulltextExistsFunc = self.sqliteFulltextExists
+						log.Debugf("sqlite: using FTS5 extension")
 					}
 				} else {
-					return nil, err
+					return err
 				}
 			}
+
+			return options.Err()
+		} else {
+			return err
+		}
+	}
+
+	// the bespoke method for determining table information for sqlite3
+	self.refreshCollectionFunc = func(datasetName string, collectionName string) (*dal.Collection, error) {
+		var uniqueConstraints []string
+
+		if c, err := self.sqliteGetTableConstraints(`unique`, collectionName); err == nil {
+			uniqueConstraints = c
 		} else {
 			return nil, err
 		}
@@ -135,7 +180,24 @@ func initializeSqlite(self *SqlBackend) (string, string, error) {
 				}
 			}
 
-			return collection, rows.Err()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+
+			// table_info returns nothing (rather than an error) for tables that don't exist
+			if len(collection.Fields) == 0 {
+				return nil, dal.CollectionNotFound
+			}
+
+			if self.fulltextExistsFunc != nil {
+				if exists, err := self.fulltextExistsFunc(collectionName); err == nil {
+					collection.Fulltext = exists
+				} else {
+					return nil, err
+				}
+			}
+
+			return collection, nil
 		} else {
 			return nil, err
 		}
@@ -171,6 +233,11 @@ func initializeSqlite(self *SqlBackend) (string, string, error) {
 			opts[`mode`] = v
 		}
 
+		// sqlite only enforces foreign key constraints when asked to
+		if self.conn.OptBool(`foreign_keys`, false) {
+			opts[`_foreign_keys`] = 1
+		}
+
 		if len(opts) > 0 {
 			dsn = dsn + `?` + maputil.Join(opts, `=`, `&`)
 		}
@@ -229,3 +296,72 @@ func (self *SqlBackend) sqliteGetTableConstraints(constraintType string, collect
 		return nil, err
 	}
 }
+
+// returns the statements that create an FTS5 table indexing all of the string fields in the given
+// collection, along with the triggers that keep it up-to-date as the collection changes.  Collections
+// that haven't opted into full-text indexing only have any existing FTS5 table removed.
+func (self *SqlBackend) sqliteFulltextCreateStatements(collection *dal.Collection) []string {
+	stmts := self.sqliteFulltextDropStatements(collection.Name)
+	columns := make([]string, 0)
+
+	if !collection.Fulltext || collection.View {
+		return stmts
+	}
+
+	for _, field := range collection.Fields {
+		if field.Type == dal.StringType && !field.Identity {
+			columns = append(columns, fmt.Sprintf("%q", field.Name))
+		}
+	}
+
+	if len(columns) == 0 {
+		return stmts
+	}
+
+	table := fmt.Sprintf(generators.SqliteFulltextTableFormat, collection.Name)
+	newValues := make([]string, len(columns))
+	oldValues := make([]string, len(columns))
+
+	for i, column := range columns {
+		newValues[i] = `new.` + column
+		oldValues[i] = `old.` + column
+	}
+
+	cols := strings.Join(columns, `, `)
+	insert := fmt.Sprintf("INSERT INTO %q(rowid, %s) VALUES (new.rowid, %s);", table, cols, strings.Join(newValues, `, `))
+	remove := fmt.Sprintf("INSERT INTO %q(%q, rowid, %s) VALUES ('delete', old.rowid, %s);", table, table, cols, strings.Join(oldValues, `, `))
+
+	return append(stmts,
+		fmt.Sprintf("CREATE VIRTUAL TABLE %q USING fts5(%s, content=%q)", table, cols, collection.Name),
+		fmt.Sprintf("CREATE TRIGGER %q AFTER INSERT ON %q BEGIN %s END", table+`_ai`, collection.Name, insert),
+		fmt.Sprintf("CREATE TRIGGER %q AFTER DELETE ON %q BEGIN %s END", table+`_ad`, collection.Name, remove),
+		fmt.Sprintf("CREATE TRIGGER %q AFTER UPDATE ON %q BEGIN %s %s END", table+`_au`, collection.Name, remove, insert),
+		fmt.Sprintf("INSERT INTO %q(%q) VALUES ('rebuild')", table, table),
+	)
+}
+
+// returns the statements that remove the FTS5 table (and its triggers) for the named collection.
+func (self *SqlBackend) sqliteFulltextDropStatements(name string) []string {
+	table := fmt.Sprintf(generators.SqliteFulltextTableFormat, name)
+
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %q", table+`_ai`),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %q", table+`_ad`),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %q", table+`_au`),
+		fmt.Sprintf("DROP TABLE IF EXISTS %q", table),
+	}
+}
+
+// returns whether the FTS5 table for the named collection exists.
+func (self *SqlBackend) sqliteFulltextExists(name string) (bool, error) {
+	var count int
+
+	stmt := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	querylog.Debugf("[%T] %s", self, stmt)
+
+	if err := self.db.QueryRow(stmt, fmt.Sprintf(generators.SqliteFulltextTableFormat, name)).Scan(&count); err == nil {
+		return (count > 0), nil
+	} else {
+		return false, err
+	}
+}
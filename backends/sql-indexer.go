@@ -3,16 +3,27 @@ package backends
 // this file satifies the Indexer interface for SqlBackend
 
 import (
+	"context"
 	"math"
 	"reflect"
 
 	"github.com/PerformLine/go-stockutil/sliceutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/PerformLine/pivot/v3/filter/generators"
 )
 
+// the name that the number of records having each value is selected as when counting facets
+const sqlFacetCountField = `_count`
+
 func (self *SqlBackend) QueryFunc(collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	return self.QueryFuncContext(context.Background(), collection, f, resultFn)
+}
+
+func (self *SqlBackend) QueryFuncContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFn IndexResultFunc) error {
+	resultFn = skipExpired(collection, f, resultFn)
+
 	defer stats.NewTiming().Send(`pivot.backends.sql.query_time`)
 
 	f.IdentityField = collection.IdentityField
@@ -50,7 +61,7 @@ func (self *SqlBackend) QueryFunc(collection *dal.Collection, f *filter.Filter,
 						querylog.Debugf("[%v] %s %v", self, string(stmt[:]), values)
 
 						// perform the count query
-						if rows, err := self.db.Query(string(stmt[:]), values...); err == nil {
+						if rows, err := self.dbx().QueryContext(ctx, string(stmt[:]), values...); err == nil {
 							defer rows.Close()
 
 							if rows.Next() {
@@ -83,7 +94,7 @@ func (self *SqlBackend) QueryFunc(collection *dal.Collection, f *filter.Filter,
 				querylog.Debugf("[%v] %s %v", self, string(stmt[:]), values)
 
 				// perform query
-				if rows, err := self.db.Query(string(stmt[:]), values...); err == nil {
+				if rows, err := self.dbx().QueryContext(ctx, string(stmt[:]), values...); err == nil {
 					defer rows.Close()
 
 					if columns, err := rows.Columns(); err == nil {
@@ -152,6 +163,10 @@ func (self *SqlBackend) QueryFunc(collection *dal.Collection, f *filter.Filter,
 }
 
 func (self *SqlBackend) Query(collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
+	return self.QueryContext(context.Background(), collection, f, resultFns...)
+}
+
+func (self *SqlBackend) QueryContext(ctx context.Context, collection *dal.Collection, f *filter.Filter, resultFns ...IndexResultFunc) (*dal.RecordSet, error) {
 	if f != nil {
 		if f.IdentityField == `` {
 			f.IdentityField = MongoIdentityField
@@ -161,7 +176,7 @@ func (self *SqlBackend) Query(collection *dal.Collection, f *filter.Filter, resu
 		f.Options[`ForceIndexRecord`] = true
 	}
 
-	return DefaultQueryImplementation(self, collection, f, resultFns...)
+	return DefaultQueryImplementationContext(ctx, self, collection, f, resultFns...)
 }
 
 func (self *SqlBackend) ListValues(collection *dal.Collection, fields []string, f *filter.Filter) (map[string][]interface{}, error) {
@@ -206,6 +221,64 @@ func (self *SqlBackend) ListValues(collection *dal.Collection, fields []string,
 	return output, nil
 }
 
+// Facets counts the values of each field with a GROUP BY query, leaving the sorting and limiting
+// of the groups to the database.
+func (self *SqlBackend) Facets(ctx context.Context, collection *dal.Collection, query *FacetQuery) (map[string][]FacetValue, error) {
+	facets := make(map[string][]FacetValue)
+
+	for _, field := range query.Fields {
+		column := field
+
+		if field == filter.DefaultIdentityField {
+			column = collection.GetIdentityFieldName()
+		}
+
+		f := aggregationFilter(query.Filter)
+		f.Limit = query.Limit
+		f.Criteria = append(f.Criteria, filter.Criterion{
+			Field:    column,
+			Operator: `not`,
+			Values:   []interface{}{nil},
+		})
+
+		switch query.Sort {
+		case FacetSortValue:
+			f.Sort = []string{column}
+		default:
+			f.Sort = []string{filter.SortDescending + sqlFacetCountField, column}
+		}
+
+		if result, err := self.aggregate(ctx, collection, []string{column}, []filter.Aggregate{
+			{
+				Aggregation: filter.Count,
+				Field:       collection.GetIdentityFieldName(),
+				Name:        sqlFacetCountField,
+			},
+		}, nil, []*filter.Filter{f}, self.extractRecordSet); err == nil {
+			values := make([]FacetValue, 0)
+
+			for _, record := range result.(*dal.RecordSet).Records {
+				value := record.Get(column)
+
+				if column == collection.GetIdentityFieldName() {
+					value = record.ID
+				}
+
+				values = append(values, FacetValue{
+					Value: value,
+					Count: typeutil.Int(record.Get(sqlFacetCountField)),
+				})
+			}
+
+			facets[field] = values
+		} else {
+			return nil, err
+		}
+	}
+
+	return facets, nil
+}
+
 func (self *SqlBackend) IndexConnectionString() *dal.ConnectionString {
 	return self.GetConnectionString()
 }
@@ -238,7 +311,15 @@ func (self *SqlBackend) IndexRemove(collection *dal.Collection, ids []interface{
 
 // DeleteQuery removes records using a filter
 func (self *SqlBackend) DeleteQuery(collection *dal.Collection, f *filter.Filter) error {
-	if tx, err := self.db.Begin(); err == nil {
+	_, err := self.DeleteQueryCount(collection, f)
+	return err
+}
+
+// DeleteQueryCount removes records using a filter, returning the number of rows that were deleted.
+func (self *SqlBackend) DeleteQueryCount(collection *dal.Collection, f *filter.Filter) (int, error) {
+	ctx := context.Background()
+
+	if tx, err := self.begin(ctx); err == nil {
 		queryGen := self.makeQueryGen(collection)
 		queryGen.Type = generators.SqlDeleteStatement
 
@@ -247,22 +328,23 @@ func (self *SqlBackend) DeleteQuery(collection *dal.Collection, f *filter.Filter
 			querylog.Debugf("[%v] %s %v", self, string(stmt[:]), queryGen.GetValues())
 
 			// execute SQL
-			if _, err := tx.Exec(string(stmt[:]), queryGen.GetValues()...); err == nil {
+			if result, err := tx.ExecContext(ctx, string(stmt[:]), queryGen.GetValues()...); err == nil {
 				if err := tx.Commit(); err == nil {
-					return nil
+					n, err := result.RowsAffected()
+					return int(n), err
 				} else {
-					return err
+					return 0, err
 				}
 			} else {
 				defer tx.Rollback()
-				return err
+				return 0, err
 			}
 		} else {
 			defer tx.Rollback()
-			return err
+			return 0, err
 		}
 	} else {
-		return err
+		return 0, err
 	}
 }
 
@@ -0,0 +1,372 @@
+package backends
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/PerformLine/go-stockutil/log"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/PerformLine/pivot/v3/filter/generators"
+)
+
+type sqlMigrationStatement struct {
+	query  string
+	values []interface{}
+}
+
+func (self sqlMigrationStatement) String() string {
+	if len(self.values) > 0 {
+		return fmt.Sprintf("%s -- %v", self.query, self.values)
+	} else {
+		return self.query
+	}
+}
+
+func (self *SqlBackend) MigrationStatements(step dal.MigrationStep) ([]string, error) {
+	if stmts, err := self.migrationStatements(step); err == nil {
+		out := make([]string, len(stmts))
+
+		for i, stmt := range stmts {
+			out[i] = stmt.String()
+		}
+
+		return out, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *SqlBackend) ApplyMigrationStep(step dal.MigrationStep) error {
+	collection, err := self.migrationCollection(step.Collection)
+
+	if err != nil {
+		return err
+	}
+
+	if stmts, err := self.migrationStatements(step); err == nil {
+		if err := self.alterTx(self.migrationRequiresRebuild(step), func(tx *sql.Tx) error {
+			// full-text indexes may refer to the columns being changed; they are rebuilt below
+			if err := self.execStatements(tx, self.fulltextDropStatements(collection.Name)); err != nil {
+				return err
+			}
+
+			for _, stmt := range stmts {
+				querylog.Debugf("[%v] %s", self, stmt.query)
+
+				if _, err := tx.Exec(stmt.query, stmt.values...); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	// bring the registered definition in line with the new table structure
+	if err := step.ApplyToCollection(collection); err != nil {
+		return err
+	}
+
+	if stmts := self.fulltextCreateStatements(collection); len(stmts) > 0 {
+		if tx, err := self.db.Begin(); err == nil {
+			if err := self.execStatements(tx, stmts); err != nil {
+				defer tx.Rollback()
+				return err
+			}
+
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+	}
+
+	return self.refreshCollectionFromDatabase(collection.Name, collection)
+}
+
+// ApplyMigrationSteps applies all of the given steps in a single transaction, then calls record
+// with a backend scoped to that transaction so that the migration history is updated along with
+// the schema.  If any step (or record) fails, none of the steps are applied.
+func (self *SqlBackend) ApplyMigrationSteps(steps []dal.MigrationStep, record func(tx Backend) error) error {
+	// later steps are generated against the structure left behind by earlier ones
+	desired := make(map[string]*dal.Collection)
+	actual := make(map[string]*dal.Collection)
+	names := make([]string, 0)
+	rebuild := false
+
+	for _, step := range steps {
+		if _, ok := desired[step.Collection]; ok {
+			continue
+		}
+
+		if collection, err := self.migrationCollection(step.Collection); err == nil {
+			desired[step.Collection] = migrationCopy(collection)
+
+			if detected, ok := self.detectedCollections[step.Collection]; ok {
+				actual[step.Collection] = migrationCopy(detected)
+			} else {
+				actual[step.Collection] = migrationCopy(collection)
+			}
+
+			names = append(names, step.Collection)
+		} else {
+			return err
+		}
+	}
+
+	for _, step := range steps {
+		if self.migrationRequiresRebuild(step) {
+			rebuild = true
+		}
+	}
+
+	var scoped *SqlBackend
+
+	if err := self.alterTx(rebuild, func(tx *sql.Tx) error {
+		// full-text indexes may refer to the columns being changed; they are rebuilt below
+		for _, name := range names {
+			if err := self.execStatements(tx, self.fulltextDropStatements(name)); err != nil {
+				return err
+			}
+		}
+
+		for i, step := range steps {
+			if stmts, err := self.migrationStatementsFor(step, desired[step.Collection], actual[step.Collection]); err == nil {
+				for _, stmt := range stmts {
+					querylog.Debugf("[%v] %s", self, stmt.query)
+
+					if _, err := tx.Exec(stmt.query, stmt.values...); err != nil {
+						return fmt.Errorf("step %d: %v", i+1, err)
+					}
+				}
+			} else {
+				return fmt.Errorf("step %d: %v", i+1, err)
+			}
+
+			if err := step.ApplyToCollection(desired[step.Collection]); err != nil {
+				return fmt.Errorf("step %d: %v", i+1, err)
+			} else if err := step.ApplyToCollection(actual[step.Collection]); err != nil {
+				return fmt.Errorf("step %d: %v", i+1, err)
+			}
+		}
+
+		for _, name := range names {
+			if err := self.execStatements(tx, self.fulltextCreateStatements(desired[name])); err != nil {
+				return err
+			}
+		}
+
+		scoped = self.scopedTo(tx)
+
+		return record(scoped)
+	}); err != nil {
+		return err
+	}
+
+	var merr error
+
+	for _, hook := range scoped.txHooks {
+		merr = log.AppendError(merr, hook())
+	}
+
+	// bring the registered definitions in line with the new table structure
+	for _, step := range steps {
+		if collection, err := self.migrationCollection(step.Collection); err == nil {
+			if err := step.ApplyToCollection(collection); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		if collection, err := self.migrationCollection(name); err == nil {
+			if err := self.refreshCollectionFromDatabase(name, collection); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+	}
+
+	return merr
+}
+
+// returns a copy of the given collection that migration steps can be applied to.
+func migrationCopy(collection *dal.Collection) *dal.Collection {
+	var copied dal.Collection = *collection
+	copied.Fields = append([]dal.Field(nil), collection.Fields...)
+
+	return &copied
+}
+
+// returns the registered definition for the named collection, falling back to the structure
+// detected from the database if the collection hasn't been registered.
+func (self *SqlBackend) migrationCollection(name string) (*dal.Collection, error) {
+	if collection, err := self.GetCollection(name); err == nil {
+		return collection, nil
+	} else if detected, ok := self.detectedCollections[name]; ok {
+		return detected, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *SqlBackend) migrationStatements(step dal.MigrationStep) ([]sqlMigrationStatement, error) {
+	if err := step.Validate(); err != nil {
+		return nil, err
+	}
+
+	collection, err := self.migrationCollection(step.Collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	actual := collection
+
+	if detected, ok := self.detectedCollections[collection.Name]; ok {
+		actual = detected
+	}
+
+	return self.migrationStatementsFor(step, collection, actual)
+}
+
+// returns the statements that apply the given step to a table whose current structure is actual,
+// and whose definition (before the step) is collection.
+func (self *SqlBackend) migrationStatementsFor(step dal.MigrationStep, collection *dal.Collection, actual *dal.Collection) ([]sqlMigrationStatement, error) {
+	gen := self.makeQueryGen(collection)
+	alter := fmt.Sprintf("ALTER TABLE %s ", gen.ToTableName(collection.Name))
+
+	switch step.Operation {
+	case dal.AddFieldOperation:
+		field := *step.Definition
+
+		if clause, err := self.schemaColumnClause(&field, gen); err == nil {
+			return []sqlMigrationStatement{{
+				query: alter + `ADD COLUMN ` + clause,
+			}}, nil
+		} else {
+			return nil, err
+		}
+
+	case dal.RenameFieldOperation:
+		return []sqlMigrationStatement{{
+			query: alter + fmt.Sprintf("RENAME COLUMN %s TO %s", gen.ToFieldName(step.Field), gen.ToFieldName(step.To)),
+		}}, nil
+
+	case dal.DropFieldOperation:
+		return []sqlMigrationStatement{{
+			query: alter + `DROP COLUMN ` + gen.ToFieldName(step.Field),
+		}}, nil
+
+	case dal.ChangeTypeOperation:
+		field := *step.Definition
+		field.Name = step.FieldName()
+
+		switch self.conn.Backend() {
+		case `postgresql`:
+			if nativeType, err := gen.ToNativeType(field.Type, []dal.Type{field.Subtype}, field.Length); err == nil {
+				name := gen.ToFieldName(field.Name)
+
+				return []sqlMigrationStatement{{
+					query: alter + fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", name, nativeType, name, nativeType),
+				}}, nil
+			} else {
+				return nil, err
+			}
+
+		case `mysql`:
+			if clause, err := self.schemaColumnClause(&field, gen); err == nil {
+				return []sqlMigrationStatement{{
+					query: alter + `MODIFY ` + clause,
+				}}, nil
+			} else {
+				return nil, err
+			}
+
+		case `sqlite`:
+			return self.changeTypeRebuildStatements(collection, actual, step)
+
+		default:
+			return nil, fmt.Errorf("%v does not support changing column types", self.conn.Backend())
+		}
+
+	case dal.BackfillOperation:
+		return self.backfillStatements(collection, step)
+
+	default:
+		return nil, fmt.Errorf("unsupported migration operation %q", step.Operation)
+	}
+}
+
+// SQLite can't change the type of an existing column, so the table is rebuilt with the new definition.
+func (self *SqlBackend) migrationRequiresRebuild(step dal.MigrationStep) bool {
+	return step.Operation == dal.ChangeTypeOperation && self.conn.Backend() == `sqlite`
+}
+
+func (self *SqlBackend) changeTypeRebuildStatements(collection *dal.Collection, actual *dal.Collection, step dal.MigrationStep) ([]sqlMigrationStatement, error) {
+	desired := migrationCopy(collection)
+
+	if err := step.ApplyToCollection(desired); err != nil {
+		return nil, err
+	}
+
+	if stmts, err := self.rebuildTableStatements(actual, desired); err == nil {
+		out := make([]sqlMigrationStatement, len(stmts))
+
+		for i, stmt := range stmts {
+			out[i] = sqlMigrationStatement{
+				query: stmt,
+			}
+		}
+
+		return out, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *SqlBackend) backfillStatements(collection *dal.Collection, step dal.MigrationStep) ([]sqlMigrationStatement, error) {
+	flt := filter.All()
+
+	if step.Filter != `` {
+		if f, err := filter.Parse(step.Filter); err == nil {
+			flt = f
+		} else {
+			return nil, err
+		}
+	}
+
+	gen := self.makeQueryGen(collection)
+	gen.Type = generators.SqlUpdateStatement
+
+	for k, v := range step.Set {
+		if field, ok := collection.GetField(k); ok {
+			if converted, err := field.ConvertValue(v); err == nil {
+				gen.InputData[k] = converted
+			} else {
+				return nil, fmt.Errorf("field %v: %v", field.Name, err)
+			}
+		} else {
+			// the field may be added by an earlier step that hasn't been applied yet (e.g.: in a dry run)
+			gen.InputData[k] = v
+		}
+	}
+
+	if stmt, err := filter.Render(gen, collection.Name, flt); err == nil {
+		return []sqlMigrationStatement{{
+			query:  string(stmt),
+			values: gen.GetValues(),
+		}}, nil
+	} else {
+		return nil, err
+	}
+}
@@ -0,0 +1,137 @@
+package backends
+
+// this file satifies the TransactionalBackend interface for SqlBackend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/PerformLine/go-stockutil/log"
+)
+
+// sqlTx is the subset of *sql.Tx used by SqlBackend write operations.
+type sqlTx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	Commit() error
+	Rollback() error
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// a transaction handed out by a transaction-scoped SqlBackend.  Committing or rolling back is
+// left to the enclosing SqlTransaction, so individual operations don't end it prematurely.
+type sqlScopedTx struct {
+	*sql.Tx
+}
+
+func (self sqlScopedTx) Commit() error {
+	return nil
+}
+
+func (self sqlScopedTx) Rollback() error {
+	return nil
+}
+
+// A SqlTransaction is a SqlBackend whose reads and writes all occur within a single database
+// transaction.  Changes to external indexers are deferred until the transaction is committed.
+type SqlTransaction struct {
+	*SqlBackend
+}
+
+// Begin a new transaction.  Schema operations (creating, deleting, and migrating collections)
+// are not performed inside of the transaction.
+func (self *SqlBackend) Begin() (Transaction, error) {
+	if self.tx != nil {
+		return nil, fmt.Errorf("nested transactions are not supported")
+	} else if self.db == nil {
+		return nil, fmt.Errorf("Backend not initialized")
+	}
+
+	if tx, err := self.db.Begin(); err == nil {
+		return &SqlTransaction{
+			SqlBackend: self.scopedTo(tx),
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+// returns a copy of this backend whose reads and writes all occur within the given transaction.
+func (self *SqlBackend) scopedTo(tx *sql.Tx) *SqlBackend {
+	scoped := *self
+	scoped.tx = tx
+	scoped.txHooks = nil
+	scoped.aggregator = make(map[string]Aggregator)
+
+	// anywhere the backend refers to itself, point at the transaction-scoped copy instead
+	if self.indexer == Indexer(self) {
+		scoped.indexer = &scoped
+	}
+
+	for name, aggregator := range self.aggregator {
+		if aggregator == Aggregator(self) {
+			scoped.aggregator[name] = &scoped
+		} else {
+			scoped.aggregator[name] = aggregator
+		}
+	}
+
+	return &scoped
+}
+
+func (self *SqlTransaction) Commit() error {
+	if err := self.tx.Commit(); err == nil {
+		var merr error
+
+		for _, hook := range self.txHooks {
+			merr = log.AppendError(merr, hook())
+		}
+
+		self.txHooks = nil
+		return merr
+	} else {
+		return err
+	}
+}
+
+func (self *SqlTransaction) Rollback() error {
+	self.txHooks = nil
+	return self.tx.Rollback()
+}
+
+// returns the current transaction if we're inside of one, otherwise starts a new one that will be
+// rolled back if the given context is cancelled before it is committed.
+func (self *SqlBackend) begin(ctx context.Context) (sqlTx, error) {
+	if self.tx != nil {
+		return sqlScopedTx{self.tx}, nil
+	} else if tx, err := self.db.BeginTx(ctx, nil); err == nil {
+		return tx, nil
+	} else {
+		return nil, err
+	}
+}
+
+// returns the current transaction if we're inside of one, otherwise the database handle.
+func (self *SqlBackend) dbx() sqlQueryer {
+	if self.tx != nil {
+		return self.tx
+	} else {
+		return self.db
+	}
+}
+
+// runs the given function immediately, or (if we're inside a transaction) once the transaction
+// is successfully committed.
+func (self *SqlBackend) afterCommit(fn func() error) error {
+	if self.tx != nil {
+		self.txHooks = append(self.txHooks, fn)
+		return nil
+	} else {
+		return fn()
+	}
+}
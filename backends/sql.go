@@ -83,6 +83,9 @@ type additionalIndexer struct {
 
 type sqlTableDetailsFunc func(datasetName string, collectionName string) (*dal.Collection, error)
 
+// returns an expression that truncates the given column to the start of its histogram bucket
+type sqlHistogramBucketFunc func(column string, interval HistogramInterval, loc *time.Location) (string, error)
+
 type SqlBackend struct {
 	Backend
 	Indexer
@@ -100,23 +103,34 @@ type SqlBackend struct {
 	foreignKeyConstraintFormat string
 	defaultCurrentTimeString   string
 	refreshCollectionFunc      sqlTableDetailsFunc
+	postConnectFunc            func() error
+	fulltextCreateFunc         func(*dal.Collection) []string
+	fulltextDropFunc           func(string) []string
+	fulltextExistsFunc         func(string) (bool, error)
+	histogramBucketFunc        sqlHistogramBucketFunc
 	countEstimateQuery         string
 	countExactQuery            string
 	dropTableQuery             string
-	registeredCollections      sync.Map
+	createUniqueIndexFormat    string
+	uniqueIndexExistsQuery     string
+	registeredCollections      *sync.Map
 	knownCollections           map[string]bool
 	detectedCollections        map[string]*dal.Collection
 	initialized                bool
+	tx                         *sql.Tx
+	txHooks                    []func() error
 }
 
 func NewSqlBackend(connection dal.ConnectionString) Backend {
 	backend := &SqlBackend{
-		conn:                &connection,
-		queryGenTypeMapping: generators.DefaultSqlTypeMapping,
-		dropTableQuery:      `DROP TABLE %s`,
-		aggregator:          make(map[string]Aggregator),
-		knownCollections:    make(map[string]bool),
-		detectedCollections: make(map[string]*dal.Collection),
+		conn:                    &connection,
+		queryGenTypeMapping:     generators.DefaultSqlTypeMapping,
+		dropTableQuery:          `DROP TABLE %s`,
+		createUniqueIndexFormat: `CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)`,
+		aggregator:              make(map[string]Aggregator),
+		registeredCollections:   new(sync.Map),
+		knownCollections:        make(map[string]bool),
+		detectedCollections:     make(map[string]*dal.Collection),
 	}
 
 	if fn, ok := sqlPreInitFuncs[connection.Backend()]; ok && fn != nil {
@@ -131,6 +145,13 @@ func (self *SqlBackend) Supports(features ...BackendFeature) bool {
 	for _, feat := range features {
 		switch feat {
 		case Constraints:
+			// sqlite only enforces foreign key constraints when the foreign_keys option is set
+			if self.conn.Backend() == `sqlite` {
+				return self.conn.OptBool(`foreign_keys`, false)
+			}
+
+			return true
+		case Transactional:
 			return true
 		default:
 			return false
@@ -152,6 +173,7 @@ func (self *SqlBackend) RegisterCollection(collection *dal.Collection) {
 	if collection != nil {
 		self.registeredCollections.Store(collection.Name, collection)
 		log.Debugf("[%v] register collection %v", self, collection.Name)
+
 		go self.updateEstimatedCountForTable(collection)
 	}
 }
@@ -218,6 +240,11 @@ func (self *SqlBackend) SetIndexer(indexConnString dal.ConnectionString) error {
 	}
 }
 
+func (self *SqlBackend) AttachIndexer(indexer Indexer) error {
+	self.indexer = indexer
+	return nil
+}
+
 func (self *SqlBackend) Initialize() error {
 	backend := self.conn.Backend()
 	internalBackend := backend
@@ -251,6 +278,13 @@ func (self *SqlBackend) Initialize() error {
 		return err
 	}
 
+	// perform any driver-specific setup that requires a database connection
+	if self.postConnectFunc != nil {
+		if err := self.postConnectFunc(); err != nil {
+			return err
+		}
+	}
+
 	// refresh schema cache
 	if err := self.refreshAllCollections(); err != nil {
 		return err
@@ -281,12 +315,31 @@ func (self *SqlBackend) Ping(timeout time.Duration) error {
 }
 
 func (self *SqlBackend) Insert(name string, recordset *dal.RecordSet) error {
+	return self.InsertContext(context.Background(), name, recordset)
+}
+
+func (self *SqlBackend) InsertContext(ctx context.Context, name string, recordset *dal.RecordSet) error {
+	return self.insertRecords(ctx, name, recordset, generators.SqlInsertStatement)
+}
+
+func (self *SqlBackend) Upsert(name string, recordset *dal.RecordSet) error {
+	return self.UpsertContext(context.Background(), name, recordset)
+}
+
+// Inserts the given records, updating the existing rows of any that conflict with its primary key
+// (when the record has an ID) or a unique field group in a single INSERT ... ON CONFLICT (or
+// ON DUPLICATE KEY) statement.
+func (self *SqlBackend) UpsertContext(ctx context.Context, name string, recordset *dal.RecordSet) error {
+	return self.insertRecords(ctx, name, recordset, generators.SqlUpsertStatement)
+}
+
+func (self *SqlBackend) insertRecords(ctx context.Context, name string, recordset *dal.RecordSet, stmtType generators.SqlStatementType) error {
 	if collection, err := self.getCollectionFromCache(name); err == nil {
-		if tx, err := self.db.Begin(); err == nil {
+		if tx, err := self.begin(ctx); err == nil {
 			switch self.String() {
 			case `mysql`:
 				// disable zero-means-use-autoincrement for inserts in MySQL
-				if _, err := tx.Exec(`SET sql_mode='NO_AUTO_VALUE_ON_ZERO'`); err != nil {
+				if _, err := tx.ExecContext(ctx, `SET sql_mode='NO_AUTO_VALUE_ON_ZERO'`); err != nil {
 					defer tx.Rollback()
 					return err
 				}
@@ -302,7 +355,7 @@ func (self *SqlBackend) Insert(name string, recordset *dal.RecordSet) error {
 
 				// setup query generator
 				queryGen := self.makeQueryGen(collection)
-				queryGen.Type = generators.SqlInsertStatement
+				queryGen.Type = stmtType
 
 				// add record data to query input
 				for k, v := range record.Fields {
@@ -316,12 +369,16 @@ func (self *SqlBackend) Insert(name string, recordset *dal.RecordSet) error {
 					queryGen.InputData[collection.IdentityField] = collection.ConvertValue(collection.IdentityField, record.ID)
 				}
 
+				if stmtType == generators.SqlUpsertStatement {
+					queryGen.ConflictFields = sqlConflictFields(collection, queryGen.InputData)
+				}
+
 				// render the query into the final SQL
 				if stmt, err := filter.Render(queryGen, collection.Name, filter.Null()); err == nil {
 					querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 					// execute the SQL
-					if _, err := tx.Exec(string(stmt[:]), queryGen.GetValues()...); err != nil {
+					if _, err := tx.ExecContext(ctx, string(stmt[:]), queryGen.GetValues()...); err != nil {
 						defer tx.Rollback()
 						return err
 					}
@@ -333,15 +390,17 @@ func (self *SqlBackend) Insert(name string, recordset *dal.RecordSet) error {
 
 			// commit transaction
 			if err := tx.Commit(); err == nil {
-				if search := self.WithSearch(collection); search != nil {
-					if err := search.Index(collection, recordset); err != nil {
-						querylog.Debugf("[%v] index error %v", self, err)
-					} else {
-						return err
+				return self.afterCommit(func() error {
+					if search := self.WithSearch(collection); search != nil {
+						if err := search.Index(collection, recordset); err != nil {
+							querylog.Debugf("[%v] index error %v", self, err)
+						} else {
+							return err
+						}
 					}
-				}
 
-				return nil
+					return nil
+				})
 			} else {
 				return err
 			}
@@ -354,9 +413,17 @@ func (self *SqlBackend) Insert(name string, recordset *dal.RecordSet) error {
 }
 
 func (self *SqlBackend) Exists(name string, id interface{}) bool {
+	ctx := context.Background()
+
 	if collection, err := self.getCollectionFromCache(name); err == nil {
+		// records past their expiry remain in the table, so they must be read to be ruled out
+		if collection.TimeToLiveField != `` {
+			_, err := self.RetrieveContext(ctx, name, id)
+			return (err == nil)
+		}
+
 		if f, err := self.keyQuery(collection, id); err == nil {
-			if tx, err := self.db.Begin(); err == nil {
+			if tx, err := self.begin(ctx); err == nil {
 				defer tx.Commit()
 
 				f.Fields = []string{collection.IdentityField}
@@ -367,7 +434,7 @@ func (self *SqlBackend) Exists(name string, id interface{}) bool {
 						querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 						// perform query
-						if rows, err := tx.Query(string(stmt[:]), queryGen.GetValues()...); err == nil {
+						if rows, err := tx.QueryContext(ctx, string(stmt[:]), queryGen.GetValues()...); err == nil {
 							defer rows.Close()
 							return rows.Next()
 						} else {
@@ -393,6 +460,10 @@ func (self *SqlBackend) Exists(name string, id interface{}) bool {
 }
 
 func (self *SqlBackend) Retrieve(name string, id interface{}, fields ...string) (*dal.Record, error) {
+	return self.RetrieveContext(context.Background(), name, id, fields...)
+}
+
+func (self *SqlBackend) RetrieveContext(ctx context.Context, name string, id interface{}, fields ...string) (*dal.Record, error) {
 	if collection, err := self.getCollectionFromCache(name); err == nil {
 		if f, err := self.keyQuery(collection, id); err == nil {
 			f.Fields = fields
@@ -403,12 +474,16 @@ func (self *SqlBackend) Retrieve(name string, id interface{}, fields ...string)
 					querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 					// perform query
-					if rows, err := self.db.Query(string(stmt[:]), queryGen.GetValues()...); err == nil {
+					if rows, err := self.dbx().QueryContext(ctx, string(stmt[:]), queryGen.GetValues()...); err == nil {
 						defer rows.Close()
 
 						if columns, err := rows.Columns(); err == nil {
 							if rows.Next() {
-								return self.scanFnValueToRecord(queryGen, collection, columns, reflect.ValueOf(rows.Scan), fields)
+								if record, err := self.scanFnValueToRecord(queryGen, collection, columns, reflect.ValueOf(rows.Scan), fields); err == nil {
+									return unlessExpired(collection, id, record)
+								} else {
+									return nil, err
+								}
 							} else {
 								// if it doesn't exist, make sure it's not indexed
 								if search := self.WithSearch(collection); search != nil {
@@ -438,6 +513,10 @@ func (self *SqlBackend) Retrieve(name string, id interface{}, fields ...string)
 }
 
 func (self *SqlBackend) Update(name string, recordset *dal.RecordSet, target ...string) error {
+	return self.UpdateContext(context.Background(), name, recordset, target...)
+}
+
+func (self *SqlBackend) UpdateContext(ctx context.Context, name string, recordset *dal.RecordSet, target ...string) error {
 	var targetFilter *filter.Filter
 
 	if len(target) > 0 {
@@ -449,7 +528,7 @@ func (self *SqlBackend) Update(name string, recordset *dal.RecordSet, target ...
 	}
 
 	if collection, err := self.getCollectionFromCache(name); err == nil {
-		if tx, err := self.db.Begin(); err == nil {
+		if tx, err := self.begin(ctx); err == nil {
 			// for each record being updated...
 			for _, record := range recordset.Records {
 				if r, err := collection.StructToRecord(record); err == nil {
@@ -501,7 +580,7 @@ func (self *SqlBackend) Update(name string, recordset *dal.RecordSet, target ...
 					querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 					// execute SQL
-					if _, err := tx.Exec(string(stmt[:]), queryGen.GetValues()...); err != nil {
+					if _, err := tx.ExecContext(ctx, string(stmt[:]), queryGen.GetValues()...); err != nil {
 						defer tx.Rollback()
 						return err
 					}
@@ -512,13 +591,15 @@ func (self *SqlBackend) Update(name string, recordset *dal.RecordSet, target ...
 			}
 
 			if err := tx.Commit(); err == nil {
-				if search := self.WithSearch(collection); search != nil {
-					if err := search.Index(collection, recordset); err != nil {
-						return err
+				return self.afterCommit(func() error {
+					if search := self.WithSearch(collection); search != nil {
+						if err := search.Index(collection, recordset); err != nil {
+							return err
+						}
 					}
-				}
 
-				return nil
+					return nil
+				})
 			} else {
 				return err
 			}
@@ -531,23 +612,41 @@ func (self *SqlBackend) Update(name string, recordset *dal.RecordSet, target ...
 }
 
 func (self *SqlBackend) Delete(name string, ids ...interface{}) error {
+	return self.DeleteContext(context.Background(), name, ids...)
+}
+
+func (self *SqlBackend) DeleteContext(ctx context.Context, name string, ids ...interface{}) error {
 	if collection, err := self.getCollectionFromCache(name); err == nil {
 		// remove documents from index
 		if search := self.WithSearch(collection); search != nil {
-			defer search.IndexRemove(collection, ids)
+			defer self.afterCommit(func() error {
+				return search.IndexRemove(collection, ids)
+			})
 		}
 
-		// TODO: need to work out how to handle DELETEs on tables with composite keys
-		// f, err := self.keyQuery(collection, record)
-
 		f := filter.New()
 
-		f.AddCriteria(filter.Criterion{
-			Field:  collection.IdentityField,
-			Values: ids,
-		})
+		// rows in tables with composite keys are deleted by matching all of their key fields
+		if collection.KeyCount() > 1 {
+			rows := make([]filter.Criterion, 0, len(ids))
 
-		if tx, err := self.db.Begin(); err == nil {
+			for _, id := range ids {
+				if criterion, err := self.keyCriterion(collection, id); err == nil {
+					rows = append(rows, criterion)
+				} else {
+					return err
+				}
+			}
+
+			f.AddCriteria(filter.Or(rows...))
+		} else {
+			f.AddCriteria(filter.Criterion{
+				Field:  collection.IdentityField,
+				Values: ids,
+			})
+		}
+
+		if tx, err := self.begin(ctx); err == nil {
 			queryGen := self.makeQueryGen(collection)
 			queryGen.Type = generators.SqlDeleteStatement
 
@@ -556,7 +655,7 @@ func (self *SqlBackend) Delete(name string, ids ...interface{}) error {
 				querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 				// execute SQL
-				if _, err := tx.Exec(string(stmt[:]), queryGen.GetValues()...); err == nil {
+				if _, err := tx.ExecContext(ctx, string(stmt[:]), queryGen.GetValues()...); err == nil {
 					if err := tx.Commit(); err == nil {
 						return nil
 					} else {
@@ -593,7 +692,7 @@ func (self *SqlBackend) WithAggregator(collection *dal.Collection) Aggregator {
 }
 
 func (self *SqlBackend) ListCollections() ([]string, error) {
-	return maputil.StringKeys(&self.registeredCollections), nil
+	return maputil.StringKeys(self.registeredCollections), nil
 }
 
 func (self *SqlBackend) schemaColumnClause(field *dal.Field, gen *generators.Sql) (string, error) {
@@ -695,86 +794,28 @@ func (self *SqlBackend) CreateCollection(definition *dal.Collection) error {
 		}
 
 		stmt = fmt.Sprintf("CREATE %s VIEW %s AS %s", definition.ViewKeywords, gen.ToTableName(definition.Name), vq)
+	} else if create, err := self.createTableStatement(definition, definition.Name); err == nil {
+		stmt = create
 	} else {
-		if definition.IdentityField == `` {
-			definition.IdentityField = dal.DefaultIdentityField
-		}
-
-		stmt += fmt.Sprintf("CREATE TABLE %s (", gen.ToTableName(definition.Name))
-		fields := []string{}
-
-		if definition.IdentityField != `` {
-			switch definition.IdentityFieldType {
-			case dal.StringType:
-				fields = append(fields, fmt.Sprintf(self.createPrimaryKeyStrFormat, gen.ToFieldName(definition.IdentityField)))
-			default:
-				fields = append(fields, fmt.Sprintf(self.createPrimaryKeyIntFormat, gen.ToFieldName(definition.IdentityField)))
-			}
-		}
-
-		for _, field := range definition.Fields {
-			if clause, err := self.schemaColumnClause(&field, gen); err == nil {
-				fields = append(fields, clause)
-			} else {
-				return fmt.Errorf("field %v: %v", field.Name, err)
-			}
-		}
-
-		// Constraints
-		// ---------------------------------------------------------------------------------------------
-		// after we've added all the field definitions, append the PRIMARY KEY () constraint statement
-		// with all of the key fields in the schema.
-		primaryKeys := make([]string, 0)
-
-		for _, k := range definition.KeyFields() {
-			primaryKeys = append(primaryKeys, gen.ToFieldName(k.Name))
-		}
-
-		fields = append(fields, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, `, `)))
-
-		// append foreign key constraints
-		for _, fk := range definition.GetAllConstraints() {
-			if err := fk.Validate(); err != nil {
-				return err
-			}
-
-			locals := sliceutil.Stringify(fk.On)
-			remotes := sliceutil.Stringify(fk.Field)
-
-			// properly wrap field names
-			for i, local := range locals {
-				locals[i] = gen.ToFieldName(local)
-			}
-
-			for i, remote := range remotes {
-				remotes[i] = gen.ToFieldName(remote)
-			}
-
-			constraint := strings.TrimSpace(fmt.Sprintf(
-				self.foreignKeyConstraintFormat,
-				strings.Join(locals, `, `),
-				gen.ToTableName(fk.Collection),
-				strings.Join(remotes, `, `),
-				fk.Options,
-			))
-
-			if constraint != `` {
-				fields = append(fields, constraint)
-			} else {
-				return fmt.Errorf("invalid constraint")
-			}
-		}
-
-		// join all fields on "," and finish building the statement
-		stmt += strings.Join(fields, `, `)
-		stmt += `)`
-
+		return err
 	}
 
 	if tx, err := self.db.Begin(); err == nil {
 		querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 		if _, err := tx.Exec(stmt, values...); err == nil {
+			if !definition.View {
+				if err := self.execStatements(tx, self.uniqueGroupIndexStatements(definition)); err != nil {
+					defer tx.Rollback()
+					return err
+				}
+
+				if err := self.execStatements(tx, self.fulltextCreateStatements(definition)); err != nil {
+					defer tx.Rollback()
+					return err
+				}
+			}
+
 			defer func() {
 				self.RegisterCollection(definition)
 
@@ -814,11 +855,96 @@ func (self *SqlBackend) CreateCollection(definition *dal.Collection) error {
 	}
 }
 
+// generates the CREATE TABLE statement for the given collection definition, using the given table name.
+func (self *SqlBackend) createTableStatement(definition *dal.Collection, tableName string) (string, error) {
+	gen := self.makeQueryGen(definition)
+
+	if definition.IdentityField == `` {
+		definition.IdentityField = dal.DefaultIdentityField
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE %s (", gen.ToTableName(tableName))
+	fields := []string{}
+
+	if definition.IdentityField != `` {
+		switch definition.IdentityFieldType {
+		case dal.StringType:
+			fields = append(fields, fmt.Sprintf(self.createPrimaryKeyStrFormat, gen.ToFieldName(definition.IdentityField)))
+		default:
+			fields = append(fields, fmt.Sprintf(self.createPrimaryKeyIntFormat, gen.ToFieldName(definition.IdentityField)))
+		}
+	}
+
+	for _, field := range definition.Fields {
+		if clause, err := self.schemaColumnClause(&field, gen); err == nil {
+			fields = append(fields, clause)
+		} else {
+			return ``, fmt.Errorf("field %v: %v", field.Name, err)
+		}
+	}
+
+	// Constraints
+	// ---------------------------------------------------------------------------------------------
+	// after we've added all the field definitions, append the PRIMARY KEY () constraint statement
+	// with all of the key fields in the schema.
+	primaryKeys := make([]string, 0)
+
+	for _, k := range definition.KeyFields() {
+		primaryKeys = append(primaryKeys, gen.ToFieldName(k.Name))
+	}
+
+	fields = append(fields, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, `, `)))
+
+	// append foreign key constraints
+	for _, fk := range definition.GetAllConstraints() {
+		if err := fk.Validate(); err != nil {
+			return ``, err
+		}
+
+		locals := sliceutil.Stringify(fk.On)
+		remotes := sliceutil.Stringify(fk.Field)
+
+		// properly wrap field names
+		for i, local := range locals {
+			locals[i] = gen.ToFieldName(local)
+		}
+
+		for i, remote := range remotes {
+			remotes[i] = gen.ToFieldName(remote)
+		}
+
+		constraint := strings.TrimSpace(fmt.Sprintf(
+			self.foreignKeyConstraintFormat,
+			strings.Join(locals, `, `),
+			gen.ToTableName(fk.Collection),
+			strings.Join(remotes, `, `),
+			fk.Options,
+		))
+
+		if constraint != `` {
+			fields = append(fields, constraint)
+		} else {
+			return ``, fmt.Errorf("invalid constraint")
+		}
+	}
+
+	// join all fields on "," and finish building the statement
+	stmt += strings.Join(fields, `, `)
+	stmt += `)`
+
+	return stmt, nil
+}
+
 func (self *SqlBackend) DeleteCollection(collectionName string) error {
 	if collection, err := self.getCollectionFromCache(collectionName); err == nil {
 		gen := self.makeQueryGen(collection)
 
 		if tx, err := self.db.Begin(); err == nil {
+			if err := self.execStatements(tx, self.fulltextDropStatements(collectionName)); err != nil {
+				defer tx.Rollback()
+				return err
+			}
+
 			stmt := fmt.Sprintf(self.dropTableQuery, gen.ToTableName(collectionName))
 			querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
@@ -871,8 +997,11 @@ func (self *SqlBackend) makeQueryGen(collection *dal.Collection) *generators.Sql
 				continue
 			}
 
-			if field.Type == dal.StringType {
+			switch field.Type {
+			case dal.StringType:
 				queryGen.NormalizeFields = append(queryGen.NormalizeFields, field.Name)
+			case dal.ArrayType:
+				queryGen.ArrayFields = append(queryGen.ArrayFields, field.Name)
 			}
 		}
 
@@ -880,6 +1009,12 @@ func (self *SqlBackend) makeQueryGen(collection *dal.Collection) *generators.Sql
 		if v := self.queryGenNormalizerFormat; v != `` {
 			queryGen.NormalizerFormat = v
 		}
+
+		// without a full-text index to query, terms are matched against the fields themselves
+		if self.fulltextExistsFunc != nil && !self.usesFulltextIndex(collection) {
+			queryGen.TypeMapping.FulltextFunc = nil
+			queryGen.TypeMapping.FulltextScoreFunc = nil
+		}
 	}
 
 	return queryGen
@@ -964,6 +1099,17 @@ func (self *SqlBackend) scanFnValueToRecord(queryGen *generators.Sql, collection
 			nestedPath := strings.Split(column, queryGen.TypeMapping.NestedFieldSeparator)
 			baseColumn := nestedPath[0]
 
+			// relevance scores aren't part of the collection, but are returned alongside its fields
+			if column == filter.ScoreField {
+				if asBytes, ok := output[i].([]byte); ok {
+					fields[column] = typeutil.Float(string(asBytes))
+				} else {
+					fields[column] = typeutil.Float(output[i])
+				}
+
+				continue
+			}
+
 			if field, ok := collection.GetField(baseColumn); ok {
 				var value interface{}
 
@@ -1129,12 +1275,38 @@ func (self *SqlBackend) generateAlterStatement(delta *dal.SchemaDelta) (string,
 				return ``, nil, fmt.Errorf("field %v: %v", delta.Name, err)
 			}
 
-		case dal.FieldTypeIssue, dal.FieldPropertyIssue:
+		case dal.FieldNameIssue:
+			stmt += fmt.Sprintf(
+				"RENAME COLUMN %s TO %s",
+				gen.ToFieldName(typeutil.String(delta.Actual)),
+				gen.ToFieldName(delta.Name),
+			)
+
+		case dal.FieldExtraIssue:
+			stmt += `DROP COLUMN ` + gen.ToFieldName(delta.Name)
+
+		case dal.FieldLengthIssue, dal.FieldTypeIssue, dal.FieldPropertyIssue:
+			if self.alterRequiresRebuild(delta) {
+				return ``, nil, fmt.Errorf("field %v: %v cannot alter columns in place; the table must be rebuilt", delta.Name, self)
+			}
+
 			if field, ok := collection.GetField(delta.Name); ok {
-				if clause, err := self.schemaColumnClause(delta.DesiredField(field), gen); err == nil {
-					stmt += `MODIFY ` + clause
-				} else {
-					return ``, nil, fmt.Errorf("field %v: %v", field.Name, err)
+				desired := delta.DesiredField(field)
+
+				switch self.conn.Backend() {
+				case `postgresql`:
+					if clause, err := self.postgresAlterColumnClause(delta, desired, gen); err == nil {
+						stmt += clause
+					} else {
+						return ``, nil, fmt.Errorf("field %v: %v", field.Name, err)
+					}
+
+				default:
+					if clause, err := self.schemaColumnClause(desired, gen); err == nil {
+						stmt += `MODIFY ` + clause
+					} else {
+						return ``, nil, fmt.Errorf("field %v: %v", field.Name, err)
+					}
 				}
 			} else {
 				return ``, nil, fmt.Errorf("Cannot modify field %q: not in collection %q", delta.Name, delta.Collection)
@@ -1142,12 +1314,6 @@ func (self *SqlBackend) generateAlterStatement(delta *dal.SchemaDelta) (string,
 
 		default:
 			return ``, nil, fmt.Errorf("NI: %+v", delta)
-			// case dal.FieldNameIssue:
-			// 	// ALTER TABLE ADD COLUMN ...
-			// case dal.FieldLengthIssue:
-			// 	// ALTER TABLE  ...
-			// case dal.FieldPropertyIssue:
-			// 	// ...
 		}
 
 		return stmt, gen.GetValues(), nil
@@ -1156,6 +1322,181 @@ func (self *SqlBackend) generateAlterStatement(delta *dal.SchemaDelta) (string,
 	}
 }
 
+// PostgreSQL alters column types and properties individually rather than by redefining the column.
+func (self *SqlBackend) postgresAlterColumnClause(delta *dal.SchemaDelta, desired *dal.Field, gen *generators.Sql) (string, error) {
+	name := gen.ToFieldName(desired.Name)
+
+	switch delta.Parameter {
+	case `Required`:
+		if desired.Required {
+			return fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", name), nil
+		} else {
+			return fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", name), nil
+		}
+
+	case `DefaultValue`:
+		if v := desired.DefaultValue; v == nil {
+			return fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", name), nil
+		} else if typeutil.String(v) == `now` {
+			return fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %v", name, self.defaultCurrentTimeString), nil
+		} else {
+			return fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %v", name, gen.ToNativeValue(desired.Type, []dal.Type{desired.Subtype}, v)), nil
+		}
+
+	case `Type`, `Subtype`, `Length`:
+		if nativeType, err := gen.ToNativeType(desired.Type, []dal.Type{desired.Subtype}, desired.Length); err == nil {
+			return fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", name, nativeType, name, nativeType), nil
+		} else {
+			return ``, err
+		}
+
+	default:
+		return ``, fmt.Errorf("cannot alter %v", delta.Parameter)
+	}
+}
+
+// SQLite cannot modify existing columns, so changing them requires that the table be rebuilt.
+func (self *SqlBackend) alterRequiresRebuild(delta *dal.SchemaDelta) bool {
+	if self.conn.Backend() == `sqlite` {
+		switch delta.Issue {
+		case dal.FieldLengthIssue, dal.FieldTypeIssue, dal.FieldPropertyIssue:
+			return true
+		}
+	}
+
+	return false
+}
+
+// Runs the given function in a transaction, committing it if the function succeeds.  If tables
+// are being rebuilt on SQLite, foreign key enforcement is switched off while the transaction runs
+// (dropping a referenced table would otherwise fail or cascade), and all foreign keys are checked
+// before committing.  This follows https://www.sqlite.org/lang_altertable.html#otheralter.
+func (self *SqlBackend) alterTx(rebuild bool, fn func(tx *sql.Tx) error) error {
+	ctx := context.Background()
+
+	if !rebuild || self.conn.Backend() != `sqlite` {
+		if tx, err := self.db.BeginTx(ctx, nil); err == nil {
+			if err := fn(tx); err != nil {
+				defer tx.Rollback()
+				return err
+			}
+
+			return tx.Commit()
+		} else {
+			return err
+		}
+	}
+
+	// foreign key enforcement can't be changed inside a transaction, and only applies to the
+	// connection it's changed on
+	if conn, err := self.db.Conn(ctx); err == nil {
+		defer conn.Close()
+
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys=OFF`); err != nil {
+			return err
+		}
+
+		if self.conn.OptBool(`foreign_keys`, false) {
+			defer conn.ExecContext(ctx, `PRAGMA foreign_keys=ON`)
+		}
+
+		if tx, err := conn.BeginTx(ctx, nil); err == nil {
+			if err := fn(tx); err != nil {
+				defer tx.Rollback()
+				return err
+			}
+
+			if err := sqliteForeignKeyCheck(tx); err != nil {
+				defer tx.Rollback()
+				return err
+			}
+
+			return tx.Commit()
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// returns an error describing the first row that violates a foreign key constraint, if any.
+func sqliteForeignKeyCheck(tx *sql.Tx) error {
+	if rows, err := tx.Query(`PRAGMA foreign_key_check`); err == nil {
+		defer rows.Close()
+
+		if rows.Next() {
+			var table, parent string
+			var rowid sql.NullInt64
+			var fkid int
+
+			if err := rows.Scan(&table, &rowid, &parent, &fkid); err == nil {
+				return fmt.Errorf("row %v in table %v references a nonexistent row in %v", rowid.Int64, table, parent)
+			} else {
+				return err
+			}
+		}
+
+		return rows.Err()
+	} else {
+		return err
+	}
+}
+
+// Generates the statements that rebuild a table to match the desired definition: a new table is
+// created, the data in all columns common to both (accounting for renamed fields) is copied into it,
+// and the old table is dropped and replaced.  The statements must be run by alterTx.
+func (self *SqlBackend) rebuildTableStatements(actual *dal.Collection, desired *dal.Collection) ([]string, error) {
+	// unless we've been told to drop them, columns that aren't in the definition are carried over
+	if !self.conn.OptBool(`drop_columns`, false) {
+		withExtra := *desired
+		withExtra.Fields = append([]dal.Field(nil), desired.Fields...)
+
+		for _, delta := range desired.Diff(actual) {
+			if delta.Issue == dal.FieldExtraIssue && delta.ReferenceField != nil {
+				withExtra.Fields = append(withExtra.Fields, *delta.ReferenceField)
+			}
+		}
+
+		desired = &withExtra
+	}
+
+	gen := self.makeQueryGen(desired)
+	tempTable := `_pivot_rebuild_` + desired.Name
+
+	if create, err := self.createTableStatement(desired, tempTable); err == nil {
+		dest := []string{gen.ToFieldName(desired.GetIdentityFieldName())}
+		src := []string{gen.ToFieldName(actual.GetIdentityFieldName())}
+
+		for _, field := range desired.Fields {
+			if desired.IsIdentityField(field.Name) {
+				continue
+			} else if _, ok := actual.GetField(field.Name); ok {
+				dest = append(dest, gen.ToFieldName(field.Name))
+				src = append(src, gen.ToFieldName(field.Name))
+			} else if _, ok := actual.GetField(field.RenamedFrom); ok && field.RenamedFrom != `` {
+				dest = append(dest, gen.ToFieldName(field.Name))
+				src = append(src, gen.ToFieldName(field.RenamedFrom))
+			}
+		}
+
+		return append([]string{
+			create,
+			fmt.Sprintf(
+				"INSERT INTO %s (%s) SELECT %s FROM %s",
+				gen.ToTableName(tempTable),
+				strings.Join(dest, `, `),
+				strings.Join(src, `, `),
+				gen.ToTableName(actual.Name),
+			),
+			fmt.Sprintf(self.dropTableQuery, gen.ToTableName(actual.Name)),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", gen.ToTableName(tempTable), gen.ToTableName(desired.Name)),
+		}, self.uniqueGroupIndexStatements(desired)...), nil
+	} else {
+		return nil, err
+	}
+}
+
 func (self *SqlBackend) Migrate() error {
 	if !util.Features(`sql-migrate`) {
 		return nil
@@ -1175,15 +1516,67 @@ func (self *SqlBackend) Migrate() error {
 	})
 
 	if len(diff) > 0 {
-		// start transaction
-		if tx, err := self.db.Begin(); err == nil {
+		rebuild := make(map[string]bool)
+		rebuilt := make(map[string]bool)
+
+		// a rebuild brings the whole table in line with its definition, so if any change to a table
+		// requires one, that is the only statement we run against that table
+		for _, delta := range diff {
+			if self.alterRequiresRebuild(delta) {
+				rebuild[delta.Collection] = true
+			}
+		}
+
+		if err := self.alterTx(len(rebuild) > 0, func(tx *sql.Tx) error {
+			altered := make([]string, 0)
+
+			// full-text indexes refer to columns being altered, so they're removed beforehand and
+			// recreated once the table structure has been updated
+			for _, delta := range diff {
+				if !sliceutil.ContainsString(altered, delta.Collection) {
+					altered = append(altered, delta.Collection)
+
+					if err := self.execStatements(tx, self.fulltextDropStatements(delta.Collection)); err != nil {
+						return err
+					}
+				}
+			}
+
 			// populate statements
 			for _, delta := range diff {
+				if rebuild[delta.Collection] {
+					if rebuilt[delta.Collection] {
+						continue
+					}
+
+					rebuilt[delta.Collection] = true
+
+					if desired, err := self.getCollectionFromCache(delta.Collection); err == nil {
+						if stmts, err := self.rebuildTableStatements(self.detectedCollections[delta.Collection], desired); err == nil {
+							for _, stmt := range stmts {
+								querylog.Debugf("[%v] %s", self, stmt)
+
+								if _, err := tx.Exec(stmt); err != nil {
+									return err
+								}
+							}
+						} else {
+							return err
+						}
+					} else {
+						return err
+					}
+
+					continue
+				} else if delta.Issue == dal.FieldExtraIssue && !self.conn.OptBool(`drop_columns`, false) {
+					querylog.Debugf("[%v] not dropping %v.%v: drop_columns is not enabled", self, delta.Collection, delta.Name)
+					continue
+				}
+
 				if stmt, values, err := self.generateAlterStatement(delta); err == nil {
 					querylog.Debugf("[%v] %s", self, string(stmt[:]))
 
 					if _, err := tx.Exec(stmt, values...); err != nil {
-						defer tx.Rollback()
 						return err
 					}
 				} else {
@@ -1191,14 +1584,209 @@ func (self *SqlBackend) Migrate() error {
 				}
 			}
 
-			// commit transaction
-			return tx.Commit()
-		} else {
+			for _, name := range altered {
+				if registered, ok := self.registeredCollections.Load(name); ok {
+					if err := self.execStatements(tx, self.fulltextCreateStatements(registered.(*dal.Collection))); err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		}); err != nil {
 			return err
 		}
-	} else {
+	}
+
+	// opting an existing table in or out of full-text search and adding unique field groups to it
+	// don't change its columns, so its indexes are created or removed separately
+	for _, name := range maputil.StringKeys(self.registeredCollections) {
+		if !self.knownCollections[name] {
+			continue
+		}
+
+		if registered, ok := self.registeredCollections.Load(name); ok {
+			collection := registered.(*dal.Collection)
+
+			if err := self.syncUniqueGroupIndexes(collection); err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+
+			if synced, err := self.syncFulltextIndex(collection); err != nil {
+				return fmt.Errorf("%v: error updating full-text index: %v", name, err)
+			} else if synced {
+				if err := self.refreshCollectionFromDatabase(name, collection); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns the statements that create (or recreate) the full-text index for the given collection,
+// if the database supports them.
+func (self *SqlBackend) fulltextCreateStatements(collection *dal.Collection) []string {
+	if self.fulltextCreateFunc != nil && collection != nil {
+		return self.fulltextCreateFunc(collection)
+	}
+
+	return nil
+}
+
+// returns the statements that remove the full-text index for the named collection, if the database
+// supports them.
+func (self *SqlBackend) fulltextDropStatements(name string) []string {
+	if self.fulltextDropFunc != nil {
+		return self.fulltextDropFunc(name)
+	}
+
+	return nil
+}
+
+// returns the groups of fields that are unique together, leaving out fields that are unique on their
+// own (which are declared so in the table itself.)  Upserts that match on one of these groups rely on
+// a unique index to detect conflicting rows.
+func sqlUniqueGroups(definition *dal.Collection) [][]string {
+	groups := make([][]string, 0)
+
+	for _, group := range definition.UniqueFieldGroups() {
+		if field, ok := definition.GetField(group[0]); !ok || !field.Unique {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+func sqlUniqueIndexName(collection string, group []string) string {
+	return collection + `_` + strings.Join(group, `_`) + `_unique`
+}
+
+func (self *SqlBackend) uniqueIndexStatement(definition *dal.Collection, group []string) string {
+	gen := self.makeQueryGen(definition)
+	columns := make([]string, len(group))
+
+	for i, field := range group {
+		columns[i] = gen.ToFieldName(field)
+	}
+
+	return fmt.Sprintf(
+		self.createUniqueIndexFormat,
+		gen.ToFieldName(sqlUniqueIndexName(definition.Name, group)),
+		gen.ToTableName(definition.Name),
+		strings.Join(columns, `, `),
+	)
+}
+
+// returns the statements that create a unique index for each of the collection's unique field groups.
+func (self *SqlBackend) uniqueGroupIndexStatements(definition *dal.Collection) []string {
+	stmts := make([]string, 0)
+
+	for _, group := range sqlUniqueGroups(definition) {
+		stmts = append(stmts, self.uniqueIndexStatement(definition, group))
+	}
+
+	return stmts
+}
+
+// adds the unique indexes for the collection's unique field groups to an existing table that doesn't
+// have them yet.  This fails if the table already contains rows that would violate them.
+func (self *SqlBackend) syncUniqueGroupIndexes(collection *dal.Collection) error {
+	if collection.View {
+		return nil
+	}
+
+	stmts := make([]string, 0)
+
+	for _, group := range sqlUniqueGroups(collection) {
+		// databases that can't create an index only if it doesn't exist are asked beforehand
+		if query := self.uniqueIndexExistsQuery; query != `` {
+			var count int
+
+			if err := self.db.QueryRow(query, collection.Name, sqlUniqueIndexName(collection.Name, group)).Scan(&count); err != nil {
+				return err
+			} else if count > 0 {
+				continue
+			}
+		}
+
+		stmts = append(stmts, self.uniqueIndexStatement(collection, group))
+	}
+
+	if len(stmts) == 0 {
 		return nil
 	}
+
+	if tx, err := self.db.Begin(); err == nil {
+		if err := self.execStatements(tx, stmts); err != nil {
+			defer tx.Rollback()
+			return fmt.Errorf("cannot add unique indexes (does the table contain duplicate rows?): %v", err)
+		}
+
+		return tx.Commit()
+	} else {
+		return err
+	}
+}
+
+// creates (and populates) the full-text index for a collection that has opted into one but doesn't
+// have one yet, and removes it from collections that have not.  Returns whether the index was
+// changed.
+func (self *SqlBackend) syncFulltextIndex(collection *dal.Collection) (bool, error) {
+	if self.fulltextExistsFunc == nil || collection.View {
+		return false, nil
+	}
+
+	var stmts []string
+
+	if exists, err := self.fulltextExistsFunc(collection.Name); err == nil {
+		if collection.Fulltext && !exists {
+			stmts = self.fulltextCreateStatements(collection)
+		} else if !collection.Fulltext && exists {
+			stmts = self.fulltextDropStatements(collection.Name)
+		} else {
+			return false, nil
+		}
+	} else {
+		return false, err
+	}
+
+	if tx, err := self.db.Begin(); err == nil {
+		if err := self.execStatements(tx, stmts); err != nil {
+			defer tx.Rollback()
+			return false, err
+		}
+
+		return true, tx.Commit()
+	} else {
+		return false, err
+	}
+}
+
+// whether queries against the collection can use a full-text index.  Tables that already existed
+// when their collection opted in only have one once they have been migrated.
+func (self *SqlBackend) usesFulltextIndex(collection *dal.Collection) bool {
+	if !collection.Fulltext {
+		return false
+	} else if detected, ok := self.detectedCollections[collection.Name]; ok {
+		return detected.Fulltext
+	}
+
+	return true
+}
+
+func (self *SqlBackend) execStatements(tx *sql.Tx, stmts []string) error {
+	for _, stmt := range stmts {
+		querylog.Debugf("[%v] %s", self, stmt)
+
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (self *SqlBackend) refreshAllCollections() error {
@@ -1234,7 +1822,7 @@ func (self *SqlBackend) refreshAllCollections() error {
 		}
 
 		// purge from cache any tables that the list all query didn't return
-		for _, key := range maputil.StringKeys(&self.registeredCollections) {
+		for _, key := range maputil.StringKeys(self.registeredCollections) {
 			if !sliceutil.ContainsString(knownTables, key) {
 				log.Debugf("removing %v from collection cache", key)
 				self.registeredCollections.Delete(key)
@@ -1273,6 +1861,27 @@ func (self *SqlBackend) refreshCollectionFromDatabase(name string, definition *d
 	}
 }
 
+// chooses the fields identifying the existing row an upserted record conflicts with: the primary
+// key if the record has an ID, otherwise the first unique field group the record has values for.
+func sqlConflictFields(collection *dal.Collection, data map[string]interface{}) []string {
+	if _, ok := data[collection.GetIdentityFieldName()]; ok {
+		return sliceutil.UniqueStrings(collection.KeyFieldNames())
+	}
+
+GroupLoop:
+	for _, group := range collection.UniqueFieldGroups() {
+		for _, field := range group {
+			if _, ok := data[field]; !ok {
+				continue GroupLoop
+			}
+		}
+
+		return group
+	}
+
+	return nil
+}
+
 func (self *SqlBackend) getCollectionFromCache(name string) (*dal.Collection, error) {
 	if registered, ok := self.registeredCollections.Load(name); ok {
 		return registered.(*dal.Collection), nil
@@ -1282,30 +1891,34 @@ func (self *SqlBackend) getCollectionFromCache(name string) (*dal.Collection, er
 }
 
 func (self *SqlBackend) keyQuery(collection *dal.Collection, id interface{}) (*filter.Filter, error) {
-	var ids []interface{}
+	if criterion, err := self.keyCriterion(collection, id); err == nil {
+		var f = new(filter.Filter)
 
-	keyFields := collection.KeyFields()
+		f.AddCriteria(criterion.Criteria...)
+		f.Limit = 1
 
-	if record, ok := id.(*dal.Record); ok {
-		ids = record.Keys(collection)
+		return f, nil
 	} else {
-		ids = sliceutil.Flatten(id)
-	}
-
-	if len(keyFields) != len(ids) {
-		return nil, fmt.Errorf("Expected ID to be a slice of length %d, got %d value(s)", len(keyFields), len(ids))
+		return nil, err
 	}
+}
 
-	var f = new(filter.Filter)
+// returns a group criterion matching the row with the given (possibly composite) ID.
+func (self *SqlBackend) keyCriterion(collection *dal.Collection, id interface{}) (filter.Criterion, error) {
+	if ids, err := collection.KeyValues(id); err == nil {
+		keyFields := collection.KeyFields()
+		criteria := make([]filter.Criterion, len(keyFields))
+
+		for i, keyField := range keyFields {
+			criteria[i] = filter.Criterion{
+				Field:    keyField.Name,
+				Operator: `is`,
+				Values:   []interface{}{ids[i]},
+			}
+		}
 
-	for i, keyField := range keyFields {
-		f.AddCriteria(filter.Criterion{
-			Field:    keyField.Name,
-			Operator: `is`,
-			Values:   []interface{}{ids[i]},
-		})
+		return filter.And(criteria...), nil
+	} else {
+		return filter.Criterion{}, err
 	}
-
-	f.Limit = 1
-	return f, nil
 }
@@ -1,5 +1,17 @@
 package backends
 
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/PerformLine/pivot/v3/util"
+	"github.com/stretchr/testify/require"
+)
+
 // func TestSqlAlterStatements(t *testing.T) {
 // 	assert := require.New(t)
 // 	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
@@ -61,3 +73,774 @@ package backends
 // 		}
 // 	}
 // }
+
+func TestSqlAlterRenamesAndDrops(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	have := &dal.Collection{
+		Name:              `TestSqlAlterRenamesAndDrops`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name:   `name`,
+				Type:   dal.StringType,
+				Length: 32,
+			}, {
+				Name: `legacy`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	want := &dal.Collection{
+		Name:              `TestSqlAlterRenamesAndDrops`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name:        `full_name`,
+				Type:        dal.StringType,
+				Length:      64,
+				RenamedFrom: `name`,
+			}, {
+				Name: `email`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(have))
+	assert.NoError(b.Insert(have.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`name`, `Alice`).Set(`legacy`, `old`),
+	)))
+
+	detected := b.detectedCollections[have.Name]
+	assert.NotNil(detected)
+
+	issues := make(map[dal.DeltaIssue]string)
+
+	for _, delta := range want.Diff(detected) {
+		issues[delta.Issue] = delta.Name
+
+		switch delta.Issue {
+		case dal.FieldNameIssue:
+			stmt, _, err := b.generateAlterStatement(delta)
+			assert.NoError(err)
+			assert.Equal(`ALTER TABLE "TestSqlAlterRenamesAndDrops" RENAME COLUMN "name" TO "full_name"`, stmt)
+
+		case dal.FieldExtraIssue:
+			stmt, _, err := b.generateAlterStatement(delta)
+			assert.NoError(err)
+			assert.Equal(`ALTER TABLE "TestSqlAlterRenamesAndDrops" DROP COLUMN "legacy"`, stmt)
+		}
+	}
+
+	assert.Equal(map[dal.DeltaIssue]string{
+		dal.FieldNameIssue:    `full_name`,
+		dal.FieldLengthIssue:  `full_name`,
+		dal.FieldMissingIssue: `email`,
+		dal.FieldExtraIssue:   `legacy`,
+	}, issues)
+
+	// sqlite can't change column lengths, so the table is rebuilt (keeping columns not in the schema)
+	util.EnableFeature(`sql-migrate`)
+	defer util.DisableFeature(`sql-migrate`)
+
+	b.RegisterCollection(want)
+	assert.NoError(b.Migrate())
+
+	actual, err := b.refreshCollectionFunc(``, want.Name)
+	assert.NoError(err)
+
+	field, ok := actual.GetField(`full_name`)
+	assert.True(ok)
+	assert.Equal(64, field.Length)
+
+	_, ok = actual.GetField(`email`)
+	assert.True(ok)
+
+	_, ok = actual.GetField(`legacy`)
+	assert.True(ok)
+
+	record, err := b.Retrieve(want.Name, 1)
+	assert.NoError(err)
+	assert.Equal(`Alice`, record.Get(`full_name`))
+}
+
+func TestSqliteNestedFieldQueries(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteNestedFieldQueries`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `metadata`,
+				Type: dal.ObjectType,
+			}, {
+				Name: `tags`,
+				Type: dal.ArrayType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`metadata`, map[string]interface{}{
+			`customer`: map[string]interface{}{
+				`tier`: `gold`,
+				`age`:  42,
+			},
+		}).Set(`tags`, []string{`red`, `green`}),
+		dal.NewRecord(2).Set(`metadata`, map[string]interface{}{
+			`customer`: map[string]interface{}{
+				`tier`: `silver`,
+				`age`:  19,
+			},
+		}).Set(`tags`, []string{`blue`}),
+	)))
+
+	for spec, ids := range map[string][]interface{}{
+		`metadata.customer.tier/gold`:  {int64(1)},
+		`metadata.customer.age/gt:21`:  {int64(1)},
+		`metadata.customer.age/lte:42`: {int64(1), int64(2)},
+		`tags/blue`:                    {int64(2)},
+		`tags/red|blue`:                {int64(1), int64(2)},
+		`tags/not:red`:                 {int64(2)},
+	} {
+		results, err := b.Query(collection, filter.MustParse(spec).SortBy(`id`))
+		assert.NoError(err, spec)
+
+		actual := make([]interface{}, 0)
+
+		for _, record := range results.Records {
+			actual = append(actual, record.ID)
+		}
+
+		assert.Equal(ids, actual, spec)
+	}
+}
+
+func TestSqliteFulltextQueries(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteFulltextQueries`,
+		IdentityFieldType: dal.IntType,
+		Fulltext:          true,
+		Fields: []dal.Field{
+			{
+				Name: `title`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`title`, `The quick brown fox jumps over the lazy dog`),
+		dal.NewRecord(2).Set(`title`, `Quick brown fox`),
+		dal.NewRecord(3).Set(`title`, `A slow red turtle`),
+	)))
+
+	// the full-text index must follow changes to the collection
+	assert.NoError(b.Update(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(3).Set(`title`, `A slow red fox`),
+	)))
+
+	for spec, ids := range map[string][]interface{}{
+		`title/fulltext:quick fox`: {int64(1), int64(2)},
+		`title/fulltext:fox`:       {int64(1), int64(2), int64(3)},
+		`title/fulltext:turtle`:    {},
+	} {
+		results, err := b.Query(collection, filter.MustParse(spec).SortBy(`id`))
+		assert.NoError(err, spec)
+
+		actual := make([]interface{}, 0)
+
+		for _, record := range results.Records {
+			actual = append(actual, record.ID)
+		}
+
+		assert.Equal(ids, actual, spec)
+	}
+
+	// relevance scores are only available when sqlite is built with FTS5 support
+	if b.fulltextCreateFunc != nil {
+		results, err := b.Query(collection, filter.MustParse(`title/fulltext:fox`).SortBy(`-_score`))
+		assert.NoError(err)
+		assert.Len(results.Records, 3)
+		assert.EqualValues(2, results.Records[0].ID)
+		assert.True(typeutil.Float(results.Records[0].Get(`_score`)) > 0)
+	}
+
+	assert.NoError(b.DeleteCollection(collection.Name))
+}
+
+func TestSqliteFulltextOptIn(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteFulltextOptIn`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `title`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`title`, `Quick brown fox`),
+		dal.NewRecord(2).Set(`title`, `A slow red turtle`),
+	)))
+
+	// collections that don't opt in are searched without a full-text index
+	results, err := b.Query(collection, filter.MustParse(`title/fulltext:fox`))
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+
+	if b.fulltextExistsFunc == nil {
+		return
+	}
+
+	exists, err := b.fulltextExistsFunc(collection.Name)
+	assert.NoError(err)
+	assert.False(exists)
+
+	util.EnableFeature(`sql-migrate`)
+	defer util.DisableFeature(`sql-migrate`)
+
+	// registering an existing collection that opts in leaves the table alone, and queries continue
+	// to work without the index...
+	optedIn := *collection
+	optedIn.Fulltext = true
+	b.RegisterCollection(&optedIn)
+
+	exists, err = b.fulltextExistsFunc(collection.Name)
+	assert.NoError(err)
+	assert.False(exists)
+
+	results, err = b.Query(&optedIn, filter.MustParse(`title/fulltext:fox`))
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+
+	// ...until it is migrated, which creates the index from the rows already in the table
+	assert.NoError(b.Migrate())
+
+	exists, err = b.fulltextExistsFunc(collection.Name)
+	assert.NoError(err)
+	assert.True(exists)
+
+	results, err = b.Query(&optedIn, filter.MustParse(`title/fulltext:fox`).SortBy(`-_score`))
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+	assert.EqualValues(1, results.Records[0].ID)
+	assert.True(typeutil.Float(results.Records[0].Get(`_score`)) > 0)
+
+	// ...and opting back out removes it
+	optedOut := *collection
+	optedOut.Fulltext = false
+	b.RegisterCollection(&optedOut)
+	assert.NoError(b.Migrate())
+
+	exists, err = b.fulltextExistsFunc(collection.Name)
+	assert.NoError(err)
+	assert.False(exists)
+}
+
+func TestSqliteGroupByQuery(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteGroupByQuery`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `team`,
+				Type: dal.StringType,
+			}, {
+				Name: `score`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`team`, `red`).Set(`score`, 10),
+		dal.NewRecord(2).Set(`team`, `red`).Set(`score`, 30),
+		dal.NewRecord(3).Set(`team`, `blue`).Set(`score`, 5),
+		dal.NewRecord(4).Set(`team`, `green`).Set(`score`, 50),
+	)))
+
+	total, _ := filter.ParseAggregate(`total=sum:score`)
+	best, _ := filter.ParseAggregate(`best=max:score`)
+
+	results, err := GroupByQueryContext(context.Background(), b, collection, &GroupByQuery{
+		Fields:     []string{`team`},
+		Aggregates: []filter.Aggregate{total, best},
+		Filter:     filter.MustParse(`score/gt:5`),
+		Having:     filter.MustParse(`total/gte:40`),
+		Sort:       []string{`-total`, `team`},
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 2)
+	assert.Equal(`green`, results.Records[0].Get(`team`))
+	assert.EqualValues(50, typeutil.Int(results.Records[0].Get(`total`)))
+	assert.Equal(`red`, results.Records[1].Get(`team`))
+	assert.EqualValues(40, typeutil.Int(results.Records[1].Get(`total`)))
+	assert.EqualValues(30, typeutil.Int(results.Records[1].Get(`best`)))
+
+	// pagination applies to the groups, and the total counts all groups matching the having filter
+	results, err = GroupByQueryContext(context.Background(), b, collection, &GroupByQuery{
+		Fields:     []string{`team`},
+		Aggregates: []filter.Aggregate{total},
+		Having:     filter.MustParse(`total/gte:5`),
+		Sort:       []string{`team`},
+		Limit:      2,
+		Offset:     1,
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 2)
+	assert.Equal(`green`, results.Records[0].Get(`team`))
+	assert.Equal(`red`, results.Records[1].Get(`team`))
+	assert.EqualValues(3, results.ResultCount)
+	assert.Equal(2, results.RecordsPerPage)
+}
+
+func TestSqliteDateHistogram(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection, records := testAnalyticsCollection(`TestSqliteDateHistogram`)
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, records))
+
+	total, _ := filter.ParseAggregate(`total=sum:value`)
+	count, _ := filter.ParseAggregate(`count`)
+
+	for _, interval := range []HistogramInterval{DayInterval, WeekInterval} {
+		query := &DateHistogramQuery{
+			Field:      `at`,
+			Interval:   interval,
+			Aggregates: []filter.Aggregate{count, total},
+			Filter:     filter.MustParse(`value/gt:1`),
+		}
+
+		assert.NoError(query.normalize())
+
+		// the native implementation and the fallback agree
+		native, err := b.DateHistogram(context.Background(), collection, query)
+		assert.NoError(err)
+
+		fallback, err := IndexerDateHistogram(context.Background(), b, collection, query)
+		assert.NoError(err)
+
+		assert.NotEmpty(native.Records)
+		assert.Equal(len(fallback.Records), len(native.Records))
+
+		for i, record := range fallback.Records {
+			assert.Equal(record.Get(`bucket`), native.Records[i].Get(`bucket`))
+			assert.Equal(record.Get(`count`), native.Records[i].Get(`count`))
+			assert.Equal(record.Get(`total`), native.Records[i].Get(`total`))
+		}
+	}
+
+	// time zones other than UTC fall back to bucketing records in Go, which leaves out records
+	// without a time as the native implementation does
+	ny, err := time.LoadLocation(`America/New_York`)
+	assert.NoError(err)
+
+	results, err := DateHistogram(context.Background(), b, collection, &DateHistogramQuery{
+		Field:    `at`,
+		Location: ny,
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 9)
+}
+
+func TestSqliteStatisticalAggregates(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteStatisticalAggregates`,
+		IdentityFieldType: dal.IntType,
+		Fields: []dal.Field{
+			{
+				Name: `team`,
+				Type: dal.StringType,
+			}, {
+				Name: `player`,
+				Type: dal.StringType,
+			}, {
+				Name: `score`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`team`, `red`).Set(`player`, `a`).Set(`score`, 2),
+		dal.NewRecord(2).Set(`team`, `red`).Set(`player`, `a`).Set(`score`, 4),
+		dal.NewRecord(3).Set(`team`, `red`).Set(`player`, `b`).Set(`score`, 4),
+		dal.NewRecord(4).Set(`team`, `red`).Set(`player`, `c`).Set(`score`, 4),
+		dal.NewRecord(5).Set(`team`, `red`).Set(`player`, `c`).Set(`score`, 5),
+		dal.NewRecord(6).Set(`team`, `red`).Set(`player`, `c`).Set(`score`, 5),
+		dal.NewRecord(7).Set(`team`, `red`).Set(`player`, `d`).Set(`score`, 7),
+		dal.NewRecord(8).Set(`team`, `red`).Set(`player`, `d`).Set(`score`, 9),
+	)))
+
+	var aggregates []filter.Aggregate
+
+	for _, spec := range []string{
+		`players=count_distinct:player`,
+		`middle=median:score`,
+		`high=p75:score`,
+		`spread=stddev:score`,
+		`var=variance:score`,
+	} {
+		aggregate, err := filter.ParseAggregate(spec)
+		assert.NoError(err)
+		aggregates = append(aggregates, aggregate)
+	}
+
+	// sqlite has no percentile or standard deviation functions, so these are calculated by reading
+	// the records instead
+	results, err := b.GroupBy(collection, []string{`team`}, aggregates, filter.All())
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+
+	result := results.Records[0]
+	assert.EqualValues(4, typeutil.Int(result.Get(`players`)))
+	assert.Equal(4.5, typeutil.Float(result.Get(`middle`)))
+	assert.Equal(5.5, typeutil.Float(result.Get(`high`)))
+	assert.Equal(float64(2), typeutil.Float(result.Get(`spread`)))
+	assert.Equal(float64(4), typeutil.Float(result.Get(`var`)))
+
+	// distinct counts are calculated by the database
+	results, err = b.GroupBy(collection, nil, aggregates[:1], filter.MustParse(`score/gte:5`))
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+	assert.EqualValues(2, typeutil.Int(results.Records[0].Get(`players`)))
+}
+
+func TestSqliteFacets(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection, records := testAnalyticsCollection(`TestSqliteFacets`)
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, records))
+
+	facets, err := Facets(context.Background(), b, collection, &FacetQuery{
+		Fields: []string{`color`, `size`},
+		Limit:  2,
+	})
+
+	assert.NoError(err)
+	assert.Len(facets[`color`], 2)
+	assert.Equal(`red`, facets[`color`][0].Value)
+	assert.EqualValues(3, facets[`color`][0].Count)
+	assert.Equal(`blue`, facets[`color`][1].Value)
+	assert.EqualValues(2, facets[`color`][1].Count)
+	assert.Len(facets[`size`], 2)
+	assert.EqualValues(3, facets[`size`][0].Value)
+	assert.EqualValues(3, facets[`size`][0].Count)
+
+	facets, err = Facets(context.Background(), b, collection, &FacetQuery{
+		Fields: []string{`color`},
+		Sort:   FacetSortValue,
+		Filter: filter.MustParse(`size/gt:1`),
+	})
+
+	assert.NoError(err)
+	assert.Equal([]FacetValue{
+		{Value: `blue`, Count: 2},
+		{Value: `green`, Count: 1},
+		{Value: `red`, Count: 2},
+	}, facets[`color`])
+}
+
+func TestSqlConflictFields(t *testing.T) {
+	assert := require.New(t)
+
+	collection := &dal.Collection{
+		Name: `TestSqlConflictFields`,
+		Fields: []dal.Field{
+			{
+				Name:   `email`,
+				Type:   dal.StringType,
+				Unique: true,
+			}, {
+				Name:        `org`,
+				Type:        dal.StringType,
+				UniqueGroup: `org_name`,
+			}, {
+				Name:        `name`,
+				Type:        dal.StringType,
+				UniqueGroup: `org_name`,
+			}, {
+				Name: `size`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.Equal([]string{`id`}, sqlConflictFields(collection, map[string]interface{}{
+		`id`:    1,
+		`email`: `a@example.com`,
+	}))
+
+	assert.Equal([]string{`email`}, sqlConflictFields(collection, map[string]interface{}{
+		`email`: `a@example.com`,
+		`org`:   `x`,
+		`name`:  `y`,
+	}))
+
+	assert.Equal([]string{`org`, `name`}, sqlConflictFields(collection, map[string]interface{}{
+		`org`:  `x`,
+		`name`: `y`,
+		`size`: 4,
+	}))
+
+	assert.Nil(sqlConflictFields(collection, map[string]interface{}{
+		`org`:  `x`,
+		`size`: 4,
+	}))
+}
+
+func TestSqliteUpsertUniqueGroup(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	fields := []dal.Field{
+		{
+			Name: `org`,
+			Type: dal.StringType,
+		}, {
+			Name: `name`,
+			Type: dal.StringType,
+		}, {
+			Name: `size`,
+			Type: dal.IntType,
+		},
+	}
+
+	// the table is created before its fields were made unique together
+	assert.NoError(b.CreateCollection(&dal.Collection{
+		Name:              `TestSqliteUpsertUniqueGroup`,
+		IdentityFieldType: dal.IntType,
+		Fields:            fields,
+	}))
+
+	assert.NoError(b.Insert(`TestSqliteUpsertUniqueGroup`, dal.NewRecordSet(
+		dal.NewRecord(1).Set(`org`, `x`).Set(`name`, `y`).Set(`size`, 1),
+		dal.NewRecord(2).Set(`org`, `x`).Set(`name`, `y`).Set(`size`, 1),
+	)))
+
+	grouped := make([]dal.Field, len(fields))
+	copy(grouped, fields)
+	grouped[0].UniqueGroup = `org_name`
+	grouped[1].UniqueGroup = `org_name`
+
+	util.EnableFeature(`sql-migrate`)
+	defer util.DisableFeature(`sql-migrate`)
+
+	b.RegisterCollection(&dal.Collection{
+		Name:              `TestSqliteUpsertUniqueGroup`,
+		IdentityField:     `id`,
+		IdentityFieldType: dal.IntType,
+		Fields:            grouped,
+	})
+
+	// the unique index is added by migrating the table, which fails while it has duplicate rows
+	assert.Error(b.Migrate())
+	assert.NoError(b.Delete(`TestSqliteUpsertUniqueGroup`, 2))
+	assert.NoError(b.Migrate())
+
+	assert.NoError(b.Upsert(`TestSqliteUpsertUniqueGroup`, dal.NewRecordSet(
+		dal.NewRecord(nil).Set(`org`, `x`).Set(`name`, `y`).Set(`size`, 2),
+	)))
+
+	record, err := b.Retrieve(`TestSqliteUpsertUniqueGroup`, 1)
+	assert.NoError(err)
+	assert.EqualValues(2, record.Get(`size`))
+
+	results, err := b.Query(&dal.Collection{
+		Name:              `TestSqliteUpsertUniqueGroup`,
+		IdentityField:     `id`,
+		IdentityFieldType: dal.IntType,
+		Fields:            grouped,
+	}, filter.All())
+	assert.NoError(err)
+	assert.EqualValues(1, results.ResultCount)
+}
+
+func TestSqliteCompositeKeyDelete(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteCompositeKeyDelete`,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `version`,
+				Type: dal.IntType,
+				Key:  true,
+			}, {
+				Name: `name`,
+				Type: dal.StringType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`version`, 1).Set(`name`, `first`),
+		dal.NewRecord(`a`).Set(`version`, 2).Set(`name`, `second`),
+		dal.NewRecord(`b`).Set(`version`, 1).Set(`name`, `third`),
+		dal.NewRecord(`b`).Set(`version`, 2).Set(`name`, `fourth`),
+	)))
+
+	assert.NoError(b.Delete(collection.Name, []interface{}{`a`, 1}))
+
+	_, err := b.Retrieve(collection.Name, []interface{}{`a`, 1})
+	assert.Error(err)
+
+	record, err := b.Retrieve(collection.Name, []interface{}{`a`, 2})
+	assert.NoError(err)
+	assert.Equal(`second`, record.Get(`name`))
+
+	// several keys, given as slices or records, are deleted at once
+	assert.NoError(b.Delete(collection.Name, []string{`a`, `2`}, dal.NewRecord(`b`).Set(`version`, 1)))
+
+	_, err = b.Retrieve(collection.Name, []interface{}{`a`, 2})
+	assert.Error(err)
+
+	_, err = b.Retrieve(collection.Name, []interface{}{`b`, 1})
+	assert.Error(err)
+
+	record, err = b.Retrieve(collection.Name, []interface{}{`b`, 2})
+	assert.NoError(err)
+	assert.Equal(`fourth`, record.Get(`name`))
+
+	assert.Error(b.Delete(collection.Name, []interface{}{`b`, 2, 3}))
+
+	// the whole key is required, so a lone identity deletes nothing
+	assert.Error(b.Delete(collection.Name, `b`))
+
+	_, err = b.Retrieve(collection.Name, []interface{}{`b`, 2})
+	assert.NoError(err)
+}
+
+func TestSqliteRebuildReferencedTable(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary?foreign_keys=true`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	groups := dal.NewCollection(`TestSqliteRebuildGroups`).AddFields(dal.Field{
+		Name:   `name`,
+		Type:   dal.StringType,
+		Length: 32,
+	})
+
+	users := dal.NewCollection(`TestSqliteRebuildUsers`).AddFields(dal.Field{
+		Name: `name`,
+		Type: dal.StringType,
+	}, dal.Field{
+		Name:      `group_id`,
+		Type:      dal.IntType,
+		BelongsTo: groups.Name,
+	})
+
+	assert.NoError(b.CreateCollection(groups))
+	assert.NoError(b.CreateCollection(users))
+	assert.NoError(b.Insert(groups.Name, dal.NewRecordSet(dal.NewRecord(1).Set(`name`, `admins`))))
+	assert.NoError(b.Insert(users.Name, dal.NewRecordSet(dal.NewRecord(1).Set(`name`, `alice`).Set(`group_id`, 1))))
+
+	// changing a column's length rebuilds the referenced table, which must neither fail nor cascade
+	util.EnableFeature(`sql-migrate`)
+	defer util.DisableFeature(`sql-migrate`)
+
+	want := dal.NewCollection(groups.Name).AddFields(dal.Field{
+		Name:   `name`,
+		Type:   dal.StringType,
+		Length: 64,
+	})
+
+	b.RegisterCollection(want)
+	assert.NoError(b.Migrate())
+
+	record, err := b.Retrieve(users.Name, 1)
+	assert.NoError(err)
+	assert.EqualValues(1, record.Get(`group_id`))
+
+	record, err = b.Retrieve(groups.Name, 1)
+	assert.NoError(err)
+	assert.Equal(`admins`, record.Get(`name`))
+
+	// foreign keys are enforced again afterwards
+	assert.Error(b.Insert(users.Name, dal.NewRecordSet(dal.NewRecord(2).Set(`name`, `bob`).Set(`group_id`, 99))))
+}
+
+func TestSqliteExpireRecords(t *testing.T) {
+	assert := require.New(t)
+	b := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`)).(*SqlBackend)
+	assert.NoError(b.Initialize())
+
+	collection := &dal.Collection{
+		Name:              `TestSqliteExpireRecords`,
+		IdentityFieldType: dal.StringType,
+		TimeToLiveField:   `expires_at`,
+		Fields: []dal.Field{
+			{
+				Name: `expires_at`,
+				Type: dal.IntType,
+			},
+		},
+	}
+
+	assert.NoError(b.CreateCollection(collection))
+	assert.NoError(b.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`live`).Set(`expires_at`, time.Now().Add(time.Hour).Unix()),
+		dal.NewRecord(`forever`).Set(`expires_at`, 0),
+		dal.NewRecord(`expired1`).Set(`expires_at`, time.Now().Add(-time.Hour).Unix()),
+		dal.NewRecord(`expired2`).Set(`expires_at`, time.Now().Add(-time.Minute).Unix()),
+	)))
+
+	// the number of records removed comes from the DELETE itself
+	n, err := ExpireRecords(b, collection)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	n, err = ExpireRecords(b, collection)
+	assert.NoError(err)
+	assert.Zero(n)
+
+	assert.True(b.Exists(collection.Name, `live`))
+	assert.True(b.Exists(collection.Name, `forever`))
+	assert.False(b.Exists(collection.Name, `expired1`))
+}
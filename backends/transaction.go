@@ -0,0 +1,55 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// A Transaction is a Backend whose writes are only made durable once Commit is called.  Calling
+// Rollback discards all writes performed since the transaction began.
+type Transaction interface {
+	Backend
+	Commit() error
+	Rollback() error
+}
+
+// Backends that report support for the Transactional feature implement this interface.
+type TransactionalBackend interface {
+	Begin() (Transaction, error)
+}
+
+type TransactionFunc func(tx Backend) error
+
+// Begin a new transaction on the given backend, or return an error if the backend does not
+// support transactions.
+func Begin(backend Backend) (Transaction, error) {
+	if txb, ok := backend.(TransactionalBackend); ok && backend.Supports(Transactional) {
+		return txb.Begin()
+	} else {
+		return nil, fmt.Errorf("backend %v does not support transactions", backend)
+	}
+}
+
+// Runs the given function inside of a transaction.  If the function returns an error (or panics),
+// the transaction is rolled back; otherwise it is committed.
+func WithTransaction(backend Backend, fn TransactionFunc) (err error) {
+	if tx, berr := Begin(backend); berr == nil {
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+				panic(r)
+			}
+		}()
+
+		if err = fn(tx); err == nil {
+			return tx.Commit()
+		} else {
+			if rerr := tx.Rollback(); rerr != nil {
+				querylog.Warningf("[%v] rollback failed: %v", backend, rerr)
+			}
+
+			return err
+		}
+	} else {
+		return berr
+	}
+}
@@ -0,0 +1,169 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func testTransactionCollection(name string) *dal.Collection {
+	return &dal.Collection{
+		Name:              name,
+		IdentityFieldType: dal.StringType,
+		Fields: []dal.Field{
+			{
+				Name: `name`,
+				Type: dal.StringType,
+			},
+		},
+	}
+}
+
+func testTransactions(t *testing.T, backend Backend) {
+	assert := require.New(t)
+	collection := testTransactionCollection(`TestTransactions`)
+
+	assert.True(backend.Supports(Transactional))
+	assert.NoError(backend.CreateCollection(collection))
+
+	// committed writes are visible afterwards
+	assert.NoError(WithTransaction(backend, func(tx Backend) error {
+		if err := tx.Insert(collection.Name, dal.NewRecordSet(
+			dal.NewRecord(`a`).Set(`name`, `first`),
+			dal.NewRecord(`b`).Set(`name`, `second`),
+		)); err != nil {
+			return err
+		}
+
+		// reads inside the transaction see uncommitted writes
+		if !tx.Exists(collection.Name, `a`) {
+			return fmt.Errorf("expected record to exist inside transaction")
+		}
+
+		return tx.Delete(collection.Name, `b`)
+	}))
+
+	assert.True(backend.Exists(collection.Name, `a`))
+	assert.False(backend.Exists(collection.Name, `b`))
+
+	// failed closures roll back all of their writes
+	assert.Error(WithTransaction(backend, func(tx Backend) error {
+		if err := tx.Update(collection.Name, dal.NewRecordSet(
+			dal.NewRecord(`a`).Set(`name`, `changed`),
+		)); err != nil {
+			return err
+		}
+
+		if err := tx.Insert(collection.Name, dal.NewRecordSet(
+			dal.NewRecord(`c`).Set(`name`, `third`),
+		)); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("nope")
+	}))
+
+	record, err := backend.Retrieve(collection.Name, `a`)
+	assert.NoError(err)
+	assert.Equal(`first`, record.Get(`name`))
+	assert.False(backend.Exists(collection.Name, `c`))
+
+	// nested transactions are rejected
+	tx, err := Begin(backend)
+	assert.NoError(err)
+
+	_, err = tx.(TransactionalBackend).Begin()
+	assert.Error(err)
+	assert.NoError(tx.Rollback())
+}
+
+func TestSqlTransactions(t *testing.T) {
+	assert := require.New(t)
+	backend := NewSqlBackend(dal.MustParseConnectionString(`sqlite://temporary`))
+	assert.NoError(backend.Initialize())
+
+	testTransactions(t, backend)
+}
+
+func TestFilesystemTransactions(t *testing.T) {
+	assert := require.New(t)
+	root, err := ioutil.TempDir(``, `pivot-fs-tx-`)
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+
+	backend := NewFilesystemBackend(dal.MustParseConnectionString(`fs:///` + root))
+	assert.NoError(backend.Initialize())
+
+	testTransactions(t, backend)
+
+	collection := testTransactionCollection(`TestFilesystemTransactions`)
+	collection.Fields = append(collection.Fields, dal.Field{
+		Name: `size`,
+		Type: dal.IntType,
+	})
+
+	assert.NoError(backend.CreateCollection(collection))
+	assert.NoError(backend.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`name`, `first`).Set(`size`, 1),
+	)))
+
+	tx, err := Begin(backend)
+	assert.NoError(err)
+
+	assert.NoError(tx.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`b`).Set(`name`, `second`).Set(`size`, 2),
+	)))
+
+	// only the requested fields are returned, whether or not the record is pending
+	for _, id := range []string{`a`, `b`} {
+		record, err := tx.Retrieve(collection.Name, id, `name`)
+		assert.NoError(err)
+		assert.NotEmpty(record.Get(`name`))
+		assert.Nil(record.Get(`size`))
+	}
+
+	record, err := backend.Retrieve(collection.Name, `a`)
+	assert.NoError(err)
+	assert.EqualValues(1, record.Get(`size`))
+
+	// targeted updates can't be journaled
+	assert.Error(tx.Update(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`a`).Set(`size`, 3),
+	), `size`))
+
+	// the same record can't be inserted twice
+	assert.Error(tx.Insert(collection.Name, dal.NewRecordSet(
+		dal.NewRecord(`c`).Set(`name`, `third`),
+		dal.NewRecord(`c`).Set(`name`, `fourth`),
+	)))
+
+	assert.False(tx.Exists(collection.Name, `c`))
+
+	// queries only see committed records
+	results, err := tx.WithSearch(collection).Query(collection, filter.All())
+	assert.NoError(err)
+	assert.Equal([]interface{}{`a`}, results.Pluck(`id`))
+
+	// ...and records deleted by query are journaled rather than removed right away
+	assert.NoError(tx.WithSearch(collection).DeleteQuery(collection, filter.MustParse(`name/first`)))
+	assert.False(tx.Exists(collection.Name, `a`))
+	assert.True(backend.Exists(collection.Name, `a`))
+
+	assert.NoError(tx.Commit())
+
+	results, err = backend.WithSearch(collection).Query(collection, filter.All())
+	assert.NoError(err)
+	assert.Equal([]interface{}{`b`}, results.Pluck(`id`))
+
+	// rolling back discards deletes made by query
+	tx, err = Begin(backend)
+	assert.NoError(err)
+	assert.NoError(tx.WithSearch(collection).DeleteQuery(collection, filter.All()))
+	assert.NoError(tx.Rollback())
+	assert.True(backend.Exists(collection.Name, `b`))
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/PerformLine/go-stockutil/httputil"
 	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
 	"github.com/PerformLine/pivot/v3/util"
 )
 
@@ -19,11 +21,29 @@ type Status = util.Status
 type QueryOptions struct {
 	Limit       int      `json:"limit"`
 	Offset      int      `json:"offset"`
+	Cursor      string   `json:"cursor,omitempty"`
 	Sort        []string `json:"sort,omitempty"`
 	Fields      []string `json:"fields,omitempty"`
 	Conjunction string   `json:"conjunction,omitempty"`
 }
 
+type AggregateOptions struct {
+	GroupBy    []string           `json:"group_by"`
+	Aggregates []filter.Aggregate `json:"aggregates,omitempty"` // defaults to counting records
+	Having     string             `json:"having,omitempty"`     // a filter applied to the groups
+	Sort       []string           `json:"sort,omitempty"`
+	Limit      int                `json:"limit"`
+	Offset     int                `json:"offset"`
+}
+
+type HistogramOptions struct {
+	Interval   string             `json:"interval,omitempty"`   // defaults to "day"
+	TimeZone   string             `json:"tz,omitempty"`         // defaults to "UTC"
+	Start      time.Time          `json:"start,omitempty"`      // if non-zero, the first bucket contains this time
+	End        time.Time          `json:"end,omitempty"`        // if non-zero, the last bucket ends at this time
+	Aggregates []filter.Aggregate `json:"aggregates,omitempty"` // defaults to counting records
+}
+
 type Pivot struct {
 	*httputil.Client
 }
@@ -103,6 +123,10 @@ func (self *Pivot) Query(collection string, query interface{}, options *QueryOpt
 		opts[`limit`] = options.Limit
 		opts[`offset`] = options.Offset
 
+		if options.Cursor != `` {
+			opts[`cursor`] = options.Cursor
+		}
+
 		if len(options.Sort) > 0 {
 			opts[`sort`] = strings.Join(options.Sort, `,`)
 		}
@@ -145,8 +169,128 @@ func (self *Pivot) Query(collection string, query interface{}, options *QueryOpt
 	}
 }
 
-func (self *Pivot) Aggregate(collection string, query interface{}) (*dal.RecordSet, error) {
-	return nil, fmt.Errorf("Not Implemented")
+// Same as GroupBy.  Options are optional so that existing calls continue to compile, but at least
+// one field to group by must be given.
+func (self *Pivot) Aggregate(collection string, query interface{}, options ...*AggregateOptions) (*dal.RecordSet, error) {
+	if len(options) > 0 {
+		return self.GroupBy(collection, query, options[0])
+	} else {
+		return self.GroupBy(collection, query, nil)
+	}
+}
+
+// Groups the records matching the given query by the given fields, returning one record per
+// group containing the values of those fields and the result of each aggregate.
+func (self *Pivot) GroupBy(collection string, query interface{}, options *AggregateOptions) (*dal.RecordSet, error) {
+	if options == nil || len(options.GroupBy) == 0 {
+		return nil, fmt.Errorf("must specify at least one field to group by")
+	}
+
+	q := typeutil.String(query)
+
+	if typeutil.IsArray(query) {
+		q = strings.Join(sliceutil.Stringify(query), `/`)
+	}
+
+	if q == `` {
+		q = `all`
+	}
+
+	opts := map[string]interface{}{
+		`q`:      q,
+		`limit`:  options.Limit,
+		`offset`: options.Offset,
+	}
+
+	if len(options.Aggregates) > 0 {
+		specs := make([]string, len(options.Aggregates))
+
+		for i, aggregate := range options.Aggregates {
+			specs[i] = aggregate.String()
+		}
+
+		opts[`aggregate`] = strings.Join(specs, `,`)
+	}
+
+	if len(options.Sort) > 0 {
+		opts[`sort`] = strings.Join(options.Sort, `,`)
+	}
+
+	if options.Having != `` {
+		opts[`having`] = options.Having
+	}
+
+	if response, err := self.Get(fmt.Sprintf("/api/collections/%s/group/%s", collection, strings.Join(options.GroupBy, `,`)), opts, nil); err == nil {
+		var recordset dal.RecordSet
+
+		if err := self.Decode(response.Body, &recordset); err == nil {
+			return &recordset, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+// Buckets the records matching the given query by the value of a time field, returning one record
+// per bucket containing the start of the bucket and the result of each aggregate.
+func (self *Pivot) Histogram(collection string, field string, query interface{}, options *HistogramOptions) (*dal.RecordSet, error) {
+	if options == nil {
+		options = new(HistogramOptions)
+	}
+
+	q := typeutil.String(query)
+
+	if typeutil.IsArray(query) {
+		q = strings.Join(sliceutil.Stringify(query), `/`)
+	}
+
+	if q == `` {
+		q = `all`
+	}
+
+	opts := map[string]interface{}{
+		`q`: q,
+	}
+
+	if options.Interval != `` {
+		opts[`interval`] = options.Interval
+	}
+
+	if options.TimeZone != `` {
+		opts[`tz`] = options.TimeZone
+	}
+
+	if !options.Start.IsZero() {
+		opts[`start`] = options.Start.Format(time.RFC3339)
+	}
+
+	if !options.End.IsZero() {
+		opts[`end`] = options.End.Format(time.RFC3339)
+	}
+
+	if len(options.Aggregates) > 0 {
+		specs := make([]string, len(options.Aggregates))
+
+		for i, aggregate := range options.Aggregates {
+			specs[i] = aggregate.String()
+		}
+
+		opts[`aggregate`] = strings.Join(specs, `,`)
+	}
+
+	if response, err := self.Get(fmt.Sprintf("/api/collections/%s/histogram/%s", collection, field), opts, nil); err == nil {
+		var recordset dal.RecordSet
+
+		if err := self.Decode(response.Body, &recordset); err == nil {
+			return &recordset, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
 }
 
 func (self *Pivot) GetRecord(collection string, id interface{}) (*dal.Record, error) {
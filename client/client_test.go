@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/PerformLine/pivot/v3/dal"
+	"github.com/PerformLine/pivot/v3/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPivotAggregate(t *testing.T) {
+	assert := require.New(t)
+	var paths []string
+	var queries []url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		queries = append(queries, req.URL.Query())
+
+		json.NewEncoder(w).Encode(dal.NewRecordSet(
+			dal.NewRecord(nil).Set(`team`, `red`).Set(`total`, 40),
+		))
+	}))
+
+	defer server.Close()
+
+	pivot, err := New(server.URL)
+	assert.NoError(err)
+
+	total, _ := filter.ParseAggregate(`total=sum:score`)
+
+	results, err := pivot.Aggregate(`scores`, `score/gt:5`, &AggregateOptions{
+		GroupBy:    []string{`team`},
+		Aggregates: []filter.Aggregate{total},
+		Having:     `total/gte:40`,
+		Sort:       []string{`-total`},
+		Limit:      10,
+	})
+
+	assert.NoError(err)
+	assert.Len(results.Records, 1)
+	assert.Equal(`red`, results.Records[0].Get(`team`))
+	assert.EqualValues(40, results.Records[0].Get(`total`))
+
+	assert.Equal([]string{`/api/collections/scores/group/team`}, paths)
+	assert.Equal(`score/gt:5`, queries[0].Get(`q`))
+	assert.Equal(`total=sum:score`, queries[0].Get(`aggregate`))
+	assert.Equal(`total/gte:40`, queries[0].Get(`having`))
+	assert.Equal(`-total`, queries[0].Get(`sort`))
+	assert.Equal(`10`, queries[0].Get(`limit`))
+
+	// the fields to group by are required
+	_, err = pivot.Aggregate(`scores`, `all`)
+	assert.Error(err)
+	assert.Len(paths, 1)
+}
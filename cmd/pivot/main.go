@@ -136,6 +136,11 @@ func main() {
 				server.Address = c.String(`address`)
 				server.UiDirectory = c.String(`ui-dir`)
 				server.ConnectOptions.Indexer = indexer
+				server.ConnectOptions.AdditionalIndexers = config.AdditionalIndexers
+				server.ConnectOptions.RetrievalStrategy = config.RetrievalStrategy
+				server.ConnectOptions.PersistStrategy = config.PersistStrategy
+				server.ConnectOptions.DeleteStrategy = config.DeleteStrategy
+				server.ConnectOptions.InspectionStrategy = config.InspectionStrategy
 				server.ConnectOptions.AutocreateCollections = config.AutocreateCollections
 				server.Autoexpand = config.Autoexpand
 
@@ -252,6 +257,11 @@ func main() {
 					Name:  `no-schema-check, S`,
 					Usage: `Skip verifying schema equality.`,
 				},
+				cli.IntFlag{
+					Name:  `batch-size, b`,
+					Usage: `The number of records to write to the destination at a time.`,
+					Value: 100,
+				},
 			},
 			Action: func(c *cli.Context) {
 				var source backends.Backend
@@ -318,15 +328,27 @@ func main() {
 
 							if diffs := destCollection.Diff(collection); len(diffs) == 0 || c.Bool(`no-schema-check`) {
 								sourceItem := mapper.NewModel(source, collection)
+								batch := dal.NewRecordSet()
 								var i int
 
+								// records are written in batches, which some backends can do in a single request
+								flush := func() {
+									if len(batch.Records) > 0 {
+										if err := destination.Insert(name, batch); err == nil {
+											i += len(batch.Records)
+											log.Debugf("Copied %d records", len(batch.Records))
+										} else {
+											log.Warningf("failed to write %d records to destination: %v", len(batch.Records), err)
+										}
+
+										batch = dal.NewRecordSet()
+									}
+								}
+
 								if err := sourceItem.Each(&dal.Record{}, func(ptrToInstance interface{}, err error) {
 									if newRecord, ok := ptrToInstance.(*dal.Record); ok && err == nil {
-										if err := destination.Insert(name, dal.NewRecordSet(newRecord)); err == nil {
-											i += 1
-											log.Debugf("Copied record %v", newRecord.ID)
-										} else {
-											log.Warningf("failed to write record to destination: %v", err)
+										if batch.Push(newRecord); len(batch.Records) >= c.Int(`batch-size`) {
+											flush()
 										}
 									} else if !ok {
 										log.Warningf("failed to copy record: invalid return type %T", ptrToInstance)
@@ -334,6 +356,7 @@ func main() {
 										log.Warningf("failed to copy record %d: %v", i, err)
 									}
 								}); err == nil {
+									flush()
 									log.Noticef("Successfully copied %d records from collection %q", i, name)
 								} else {
 									log.Errorf("Failed to copy collection %q: %v", name, err)
@@ -396,6 +419,187 @@ func main() {
 					log.Fatalf("invalid filter: %v", err)
 				}
 			},
+		}, {
+			Name:      `migrate`,
+			Usage:     `Apply, revert, or show the status of versioned schema migrations.`,
+			ArgsUsage: `[CONNECTION_STRING]`,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  `dir, d`,
+					Usage: `A directory (or file) containing migrations to load (can be specified multiple times).`,
+				},
+				cli.BoolFlag{
+					Name:  `dry-run, n`,
+					Usage: `Print the statements that would be executed without making any changes.`,
+				},
+			},
+			Subcommands: cli.Commands{
+				{
+					Name:      `status`,
+					Usage:     `Show which migrations have been applied.`,
+					ArgsUsage: `[CONNECTION_STRING]`,
+					Action: func(c *cli.Context) {
+						if statuses, err := migrationRunner(c).Status(); err == nil {
+							for _, status := range statuses {
+								if status.Applied {
+									fmt.Printf("[x] %v\t%v\t(applied %v)\n", status.Version, status.Description, status.AppliedAt.Format(`2006-01-02 15:04:05`))
+								} else if status.Failed != `` {
+									fmt.Printf("[!] %v\t%v\t(failed at %v)\n", status.Version, status.Description, status.Failed)
+								} else {
+									fmt.Printf("[ ] %v\t%v\n", status.Version, status.Description)
+								}
+							}
+						} else {
+							log.Fatal(err)
+						}
+					},
+				}, {
+					Name:      `up`,
+					Usage:     `Apply all pending migrations.`,
+					ArgsUsage: `[CONNECTION_STRING]`,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  `to, t`,
+							Usage: `Only apply migrations up to and including this version.`,
+						},
+					},
+					Action: func(c *cli.Context) {
+						results, err := migrationRunner(c).Up(c.String(`to`))
+						printMigrationResults(results)
+
+						if err != nil {
+							log.Fatal(err)
+						}
+					},
+				}, {
+					Name:      `down`,
+					Usage:     `Revert the most recently-applied migrations.`,
+					ArgsUsage: `[CONNECTION_STRING]`,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  `steps, s`,
+							Usage: `The number of migrations to revert.`,
+							Value: 1,
+						},
+					},
+					Action: func(c *cli.Context) {
+						results, err := migrationRunner(c).Down(c.Int(`steps`))
+						printMigrationResults(results)
+
+						if err != nil {
+							log.Fatal(err)
+						}
+					},
+				},
+			},
+		}, {
+			Name:      `reindex`,
+			Usage:     `Rebuild the index of one or more collections from the records stored in the backend.`,
+			ArgsUsage: `[CONNECTION_STRING [INDEXER]]`,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  `collection, c`,
+					Usage: `A specific collection to reindex (can be specified multiple times).`,
+				},
+				cli.IntFlag{
+					Name:  `batch-size, b`,
+					Usage: `The number of records to send to the indexer at a time.`,
+					Value: backends.DefaultReindexBatchSize,
+				},
+				cli.BoolFlag{
+					Name:  `prune, p`,
+					Usage: `Remove records from the index that no longer exist in the backend.`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				db := indexedDatabase(c)
+				reindexer := backends.NewReindexer(db.GetBackend())
+				reindexer.BatchSize = c.Int(`batch-size`)
+				reindexer.Prune = c.Bool(`prune`)
+				reindexer.Progress = func(progress backends.ReindexProgress) {
+					log.Infof("[%v] %v: indexed %d/%d, removed %d", progress.Indexer, progress.Collection, progress.Indexed, progress.Total, progress.Removed)
+				}
+
+				for _, collection := range indexedCollections(c, db) {
+					if results, err := reindexer.Reindex(collection); err == nil {
+						for _, result := range results {
+							log.Noticef("[%v] %v: indexed %d records, removed %d", result.Indexer, result.Collection, result.Indexed, result.Removed)
+						}
+					} else {
+						log.Fatalf("Failed to reindex collection %q: %v", collection.Name, err)
+					}
+				}
+			},
+		}, {
+			Name:      `index-check`,
+			Usage:     `Compare the records in one or more collections with those in the index.`,
+			ArgsUsage: `[CONNECTION_STRING [INDEXER]]`,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  `collection, c`,
+					Usage: `A specific collection to check (can be specified multiple times).`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				db := indexedDatabase(c)
+				reindexer := backends.NewReindexer(db.GetBackend())
+				consistent := true
+
+				for _, collection := range indexedCollections(c, db) {
+					if reports, err := reindexer.Check(collection); err == nil {
+						for _, report := range reports {
+							fmt.Printf("%v [%v]: %d in backend, %d in index\n", report.Collection, report.Indexer, report.BackendCount, report.IndexCount)
+
+							for _, id := range report.Missing {
+								fmt.Printf("  missing from index: %v\n", id)
+							}
+
+							for _, id := range report.Extra {
+								fmt.Printf("  not in backend:     %v\n", id)
+							}
+
+							for _, mismatch := range report.Mismatched {
+								fmt.Printf("  %v.%v: backend=%v index=%v\n", mismatch.ID, mismatch.Field, mismatch.BackendValue, mismatch.IndexValue)
+							}
+
+							if !report.Consistent() {
+								consistent = false
+							}
+						}
+					} else {
+						log.Fatalf("Failed to check collection %q: %v", collection.Name, err)
+					}
+				}
+
+				if !consistent {
+					os.Exit(1)
+				}
+			},
+		}, {
+			Name:      `expire`,
+			Usage:     `Remove records whose time-to-live has passed from one or more collections.`,
+			ArgsUsage: `[CONNECTION_STRING [INDEXER]]`,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  `collection, c`,
+					Usage: `A specific collection to expire records from (can be specified multiple times).`,
+				},
+			},
+			Action: func(c *cli.Context) {
+				db := indexedDatabase(c)
+
+				for _, collection := range indexedCollections(c, db) {
+					if collection.TimeToLiveField == `` {
+						continue
+					}
+
+					if removed, err := backends.ExpireRecords(db.GetBackend(), collection); err == nil {
+						log.Noticef("%v: removed %d expired records", collection.Name, removed)
+					} else {
+						log.Fatalf("Failed to expire records from collection %q: %v", collection.Name, err)
+					}
+				}
+			},
 		}, {
 			Name:  `client`,
 			Usage: `Provides an HTTP API client for interacting with a running Pivot instance.`,
@@ -642,6 +846,138 @@ func pivotClient(c *cli.Context) *client.Pivot {
 	}
 }
 
+// connects to the backend given as the first argument (or in the configuration file) and loads
+// the migrations for the migrate subcommands.
+func migrationRunner(c *cli.Context) *backends.MigrationRunner {
+	var backend string
+	var config pivot.Configuration
+
+	if cnf, err := pivot.LoadConfigFile(c.GlobalString(`config`)); err == nil {
+		config = cnf.ForEnv(os.Getenv(`PIVOT_ENV`))
+	} else if !os.IsNotExist(err) {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	if cs := c.Args().First(); cs != `` {
+		backend = cs
+	} else if cs := c.Parent().Args().First(); cs != `` {
+		backend = cs
+	} else {
+		backend = config.Backend
+	}
+
+	if backend == `` {
+		log.Fatalf("Must specify a backend to connect to.")
+	}
+
+	dirs := c.Parent().StringSlice(`dir`)
+
+	if len(dirs) == 0 {
+		dirs = []string{`migrations`}
+	}
+
+	if db, err := pivot.NewDatabaseWithOptions(backend, pivot.ConnectOptions{}); err == nil {
+		if schemata, err := pivot.LoadSchemata(c.GlobalStringSlice(`schema`)...); err == nil {
+			for _, schema := range schemata {
+				db.RegisterCollection(schema)
+			}
+		} else {
+			log.Fatalf("schema: %v", err)
+		}
+
+		if migrations, err := pivot.LoadMigrations(dirs...); err == nil {
+			if runner, err := backends.NewMigrationRunner(db.GetBackend(), migrations...); err == nil {
+				runner.DryRun = c.Parent().Bool(`dry-run`)
+				return runner
+			} else {
+				log.Fatal(err)
+			}
+		} else {
+			log.Fatalf("migrations: %v", err)
+		}
+	} else {
+		log.Fatalf("connect: %v", err)
+	}
+
+	return nil
+}
+
+// connects to the backend and indexer given as arguments (or in the configuration file) for the
+// reindex and index-check subcommands.
+func indexedDatabase(c *cli.Context) pivot.DB {
+	var config pivot.Configuration
+
+	if cnf, err := pivot.LoadConfigFile(c.GlobalString(`config`)); err == nil {
+		config = cnf.ForEnv(os.Getenv(`PIVOT_ENV`))
+	} else if !os.IsNotExist(err) {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	if v := c.Args().Get(0); v != `` {
+		config.Backend = v
+	}
+
+	if v := c.Args().Get(1); v != `` {
+		config.Indexer = v
+	}
+
+	if config.Backend == `` {
+		log.Fatalf("Must specify a backend to connect to.")
+	}
+
+	if db, err := pivot.NewDatabaseWithOptions(config.Backend, pivot.ConnectOptions{
+		Indexer:            config.Indexer,
+		AdditionalIndexers: config.AdditionalIndexers,
+	}); err == nil {
+		if schemata, err := pivot.LoadSchemata(c.GlobalStringSlice(`schema`)...); err == nil {
+			for _, schema := range schemata {
+				db.RegisterCollection(schema)
+			}
+		} else {
+			log.Fatalf("schema: %v", err)
+		}
+
+		return db
+	} else {
+		log.Fatalf("connect: %v", err)
+		return nil
+	}
+}
+
+// returns the collections named by the --collection flag, or all collections if none were given.
+func indexedCollections(c *cli.Context, db pivot.DB) []*dal.Collection {
+	names := c.StringSlice(`collection`)
+	collections := make([]*dal.Collection, 0)
+
+	if len(names) == 0 {
+		if all, err := db.ListCollections(); err == nil {
+			names = all
+		} else {
+			log.Fatalf("failed to list collections: %v", err)
+		}
+	}
+
+	for _, name := range names {
+		if collection, err := db.GetCollection(name); err == nil {
+			collections = append(collections, collection)
+		} else {
+			log.Fatalf("Cannot load collection %q: %v", name, err)
+		}
+	}
+
+	return collections
+}
+
+func printMigrationResults(results []*backends.MigrationResult) {
+	for _, result := range results {
+		fmt.Printf("-- %v (%v)\n", result.Version, result.Direction)
+
+		for _, stmt := range result.Statements {
+			fmt.Println(stmt)
+		}
+	}
+}
+
 func output(c *cli.Context, value interface{}, textFn func() error) error {
 	format := c.String(`format`)
 
@@ -10,6 +10,11 @@ import (
 type Configuration struct {
 	Backend               string                   `json:"backend"`
 	Indexer               string                   `json:"indexer"`
+	AdditionalIndexers    []string                 `json:"additional_indexers"`
+	RetrievalStrategy     string                   `json:"retrieval_strategy"`
+	PersistStrategy       string                   `json:"persist_strategy"`
+	DeleteStrategy        string                   `json:"delete_strategy"`
+	InspectionStrategy    string                   `json:"inspection_strategy"`
 	Autoexpand            bool                     `json:"autoexpand"`
 	AutocreateCollections bool                     `json:"autocreate"`
 	Environments          map[string]Configuration `json:"environments"`
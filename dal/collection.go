@@ -47,6 +47,11 @@ type Collection struct {
 	// Disable automatically dual-writing modified records into the external index.
 	SkipIndexPersistence bool `json:"skip_index_persistence,omitempty"`
 
+	// Maintain a full-text index of this collection's string fields in backends that keep one apart
+	// from the collection itself (e.g.: SQLite FTS5 tables).  Full-text queries against collections
+	// without one fall back to matching terms with LIKE.
+	Fulltext bool `json:"fulltext,omitempty"`
+
 	// The fields that belong to this collection (all except the primary key/identity field/first
 	// field in a composite key)
 	Fields []Field `json:"fields"`
@@ -71,6 +76,10 @@ type Collection struct {
 	// backends that support such guarantees (e.g.: ACID-compliant RDBMS').
 	Constraints []Constraint `json:"constraints,omitempty"`
 
+	// Declares secondary indexes that backends which otherwise only query by key can use to
+	// query other fields (e.g.: DynamoDB global and local secondary indexes).
+	SecondaryIndexes []SecondaryIndex `json:"secondary_indexes,omitempty"`
+
 	// Specifies which fields can be seen when records are from relationships defined on other
 	// Collections.  This can be used to restrict the exposure) of sensitive data in this Collection
 	// be being an embedded field in another Collection.
@@ -421,11 +430,57 @@ func (self *Collection) KeyFieldNames() (names []string) {
 	return
 }
 
+// Retrieve the sets of fields whose combined values must be unique within this Collection: each
+// Unique field on its own, then the fields sharing each UniqueGroup (in the order the groups are
+// first declared.)
+func (self *Collection) UniqueFieldGroups() [][]string {
+	groups := make([][]string, 0)
+	groupIndex := make(map[string]int)
+
+	for _, field := range self.Fields {
+		if field.Unique {
+			groups = append(groups, []string{field.Name})
+		}
+	}
+
+	for _, field := range self.Fields {
+		if field.UniqueGroup != `` && !field.Unique {
+			if i, ok := groupIndex[field.UniqueGroup]; ok {
+				groups[i] = append(groups[i], field.Name)
+			} else {
+				groupIndex[field.UniqueGroup] = len(groups)
+				groups = append(groups, []string{field.Name})
+			}
+		}
+	}
+
+	return groups
+}
+
 // Return the number of keys on that uniquely identify a single record in this Collection.
 func (self *Collection) KeyCount() int {
 	return len(self.KeyFields())
 }
 
+// Expands the given ID into the values of each of this Collection's key fields (in the order
+// returned by KeyFields.)  The ID may be a record, a slice of key values, or (for collections
+// whose only key is the identity field) a single value.
+func (self *Collection) KeyValues(id interface{}) ([]interface{}, error) {
+	var values []interface{}
+
+	if record, ok := id.(*Record); ok {
+		values = record.Keys(self)
+	} else {
+		values = sliceutil.Flatten(id)
+	}
+
+	if n := self.KeyCount(); len(values) != n {
+		return nil, fmt.Errorf("Expected ID to be a slice of length %d, got %d value(s)", n, len(values))
+	}
+
+	return values, nil
+}
+
 // Retrieve the first non-indentity key field, sometimes referred to as the "range", "sort", or "cluster" key.
 func (self *Collection) GetFirstNonIdentityKeyField() (Field, bool) {
 	for _, field := range self.Fields {
@@ -645,7 +700,8 @@ func (self *Collection) StructToRecord(in interface{}) (*Record, error) {
 	if idI, err := self.formatAndValidateId(output.ID, PersistOperation, output); err == nil {
 		output.ID = idI
 
-		if idDesc != nil {
+		// records without an ID (e.g.: those upserted by their unique fields) have nothing to write back
+		if idDesc != nil && output.ID != nil {
 			if err := idDesc.Set(output.ID); err != nil {
 				return nil, fmt.Errorf("failed to writeback ID to input object: %v", err)
 			}
@@ -786,8 +842,37 @@ func (self *Collection) Diff(actual *Collection) []*SchemaDelta {
 		})
 	}
 
-	for _, myField := range self.Fields {
+	renamed := make(map[string]bool)
+
+	for _, f := range self.Fields {
+		myField := f
+
 		if theirField, ok := actual.GetField(myField.Name); ok {
+			if diff := myField.Diff(&theirField); diff != nil {
+				for i, _ := range diff {
+					diff[i].Collection = self.Name
+				}
+
+				differences = append(differences, diff...)
+			}
+		} else if theirField, ok := actual.GetField(myField.RenamedFrom); ok && myField.RenamedFrom != `` {
+			renamed[theirField.Name] = true
+
+			differences = append(differences, &SchemaDelta{
+				Type:           FieldDelta,
+				Issue:          FieldNameIssue,
+				Message:        `was renamed`,
+				Collection:     self.Name,
+				Name:           myField.Name,
+				Parameter:      `Name`,
+				Desired:        myField.Name,
+				Actual:         theirField.Name,
+				ReferenceField: &myField,
+			})
+
+			// compare the remaining properties as though the rename had already happened
+			theirField.Name = myField.Name
+
 			if diff := myField.Diff(&theirField); diff != nil {
 				for i, _ := range diff {
 					diff[i].Collection = self.Name
@@ -807,6 +892,28 @@ func (self *Collection) Diff(actual *Collection) []*SchemaDelta {
 		}
 	}
 
+	// fields that exist in the actual collection but not in this one
+	for _, f := range actual.Fields {
+		theirField := f
+
+		if theirField.Identity || renamed[theirField.Name] {
+			continue
+		} else if actual.IsIdentityField(theirField.Name) || self.IsIdentityField(theirField.Name) {
+			continue
+		} else if _, ok := self.GetField(theirField.Name); ok {
+			continue
+		}
+
+		differences = append(differences, &SchemaDelta{
+			Type:           FieldDelta,
+			Issue:          FieldExtraIssue,
+			Message:        `is not in the schema`,
+			Collection:     self.Name,
+			Name:           theirField.Name,
+			ReferenceField: &theirField,
+		})
+	}
+
 	if len(differences) == 0 {
 		return nil
 	}
@@ -299,3 +299,85 @@ func TestCollectionExtractValueFromRelationship(t *testing.T) {
 	assert.EqualValues(5432, keys)
 
 }
+
+func TestCollectionDiffRenamesAndExtras(t *testing.T) {
+	assert := require.New(t)
+
+	actual := NewCollection(`users`,
+		Field{Name: `name`, Type: StringType},
+		Field{Name: `legacy`, Type: IntType},
+	)
+
+	desired := NewCollection(`users`,
+		Field{Name: `full_name`, Type: StringType, RenamedFrom: `name`},
+	)
+
+	deltas := desired.Diff(actual)
+	assert.Len(deltas, 2)
+
+	assert.Equal(FieldNameIssue, deltas[0].Issue)
+	assert.Equal(`full_name`, deltas[0].Name)
+	assert.Equal(`name`, deltas[0].Actual)
+
+	assert.Equal(FieldExtraIssue, deltas[1].Issue)
+	assert.Equal(`legacy`, deltas[1].Name)
+	assert.EqualValues(IntType, deltas[1].ReferenceField.Type)
+
+	// once renamed, there are no differences
+	actual.Fields[0].Name = `full_name`
+	actual.Fields = actual.Fields[:1]
+	assert.Empty(desired.Diff(actual))
+}
+
+func TestCollectionUniqueFieldGroups(t *testing.T) {
+	assert := require.New(t)
+
+	collection := &Collection{
+		Name: `TestCollectionUniqueFieldGroups`,
+		Fields: []Field{
+			{Name: `account`, UniqueGroup: `account_email`},
+			{Name: `email`, UniqueGroup: `account_email`},
+			{Name: `username`, Unique: true},
+			{Name: `name`},
+			{Name: `slug`, UniqueGroup: `slug`},
+		},
+	}
+
+	assert.Equal([][]string{
+		{`username`},
+		{`account`, `email`},
+		{`slug`},
+	}, collection.UniqueFieldGroups())
+
+	assert.Empty((&Collection{}).UniqueFieldGroups())
+}
+
+func TestCollectionKeyValues(t *testing.T) {
+	assert := require.New(t)
+
+	collection := &Collection{
+		Name: `TestCollectionKeyValues`,
+		Fields: []Field{
+			{Name: `account`, Key: true},
+			{Name: `name`},
+		},
+	}
+
+	values, err := collection.KeyValues([]string{`a`, `b`})
+	assert.NoError(err)
+	assert.Equal([]interface{}{`a`, `b`}, values)
+
+	values, err = collection.KeyValues(NewRecord(`a`).Set(`account`, `b`).Set(`name`, `c`))
+	assert.NoError(err)
+	assert.Equal([]interface{}{`a`, `b`}, values)
+
+	_, err = collection.KeyValues(`a`)
+	assert.Error(err)
+
+	_, err = collection.KeyValues([]interface{}{`a`, `b`, `c`})
+	assert.Error(err)
+
+	values, err = (&Collection{}).KeyValues(42)
+	assert.NoError(err)
+	assert.Equal([]interface{}{42}, values)
+}
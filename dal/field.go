@@ -54,6 +54,10 @@ type Field struct {
 	// Collection (where supported)
 	UniqueGroup string `json:"unique_group,omitempty"`
 
+	// Whether the field's values should be kept in a secondary index, allowing it to be queried on
+	// backends that can only look up records by key otherwise (e.g.: Redis)
+	Indexed bool `json:"indexed,omitempty"`
+
 	// The default value of the field is one is not explicitly specified.  Can be any type or a
 	// function that takes zero arguments and returns a single value.
 	DefaultValue interface{} `json:"default,omitempty"`
@@ -104,6 +108,10 @@ type Field struct {
 
 	// Specifies that the field may not be updated, only read.  Attempts to update the field will be silently discarded.
 	ReadOnly bool `json:"readonly,omitempty"`
+
+	// The previous name of this field.  When comparing schemata, a field that is missing but whose
+	// previous name is present is treated as having been renamed rather than added.
+	RenamedFrom string `json:"renamed_from,omitempty"`
 }
 
 func (self *Field) normalizeType(in interface{}) (interface{}, error) {
@@ -315,8 +323,10 @@ func (self *Field) Diff(other *Field) []*SchemaDelta {
 			//		this is largely for the use of the client application and won't always have a backend-persistent counterpart
 			//  DefaultValue:
 			//		this is a value that is interpreted by the backend and may not be retrievable after definition
+			//  RenamedFrom:
+			//		this is only used to detect renames, which Collection.Diff handles
 			//
-			case `NativeType`, `Description`, `Validator`, `Formatter`, `FormatterConfig`, `ValidatorConfig`, `Key`, `ReadOnly`:
+			case `NativeType`, `Description`, `Validator`, `Formatter`, `FormatterConfig`, `ValidatorConfig`, `Key`, `ReadOnly`, `RenamedFrom`:
 				continue
 			case `DefaultValue`:
 				myDefault := myField.Value()
@@ -367,6 +377,11 @@ func (self *Field) Diff(other *Field) []*SchemaDelta {
 								continue
 							}
 
+							// JSON document columns hold both objects and arrays, and are reported as objects
+							if myT == ArrayType && theirT == ObjectType {
+								continue
+							}
+
 							// some backends store times as integers, so allow that too
 							if myT == TimeType && theirT == IntType {
 								continue
@@ -0,0 +1,218 @@
+package dal
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type MigrationOperation string
+
+const (
+	AddFieldOperation    MigrationOperation = `add-field`
+	RenameFieldOperation                    = `rename-field`
+	DropFieldOperation                      = `drop-field`
+	ChangeTypeOperation                     = `change-type`
+	BackfillOperation                       = `backfill`
+)
+
+type MigrationDirection string
+
+const (
+	MigrateUp   MigrationDirection = `up`
+	MigrateDown                    = `down`
+)
+
+// A MigrationStep describes a single change to a collection's schema or data.
+type MigrationStep struct {
+	// The operation to perform.
+	Operation MigrationOperation `json:"operation"`
+
+	// The name of the collection being modified.
+	Collection string `json:"collection"`
+
+	// The name of the field being renamed, dropped, or having its type changed.
+	Field string `json:"field,omitempty"`
+
+	// The new name of the field (rename-field only).
+	To string `json:"to,omitempty"`
+
+	// The definition of the field being added, or the new definition of the field whose type is
+	// being changed.
+	Definition *Field `json:"definition,omitempty"`
+
+	// A filter spec selecting which records to update (backfill only).  Defaults to all records.
+	Filter string `json:"filter,omitempty"`
+
+	// The values to write to each of the matching records (backfill only).
+	Set map[string]interface{} `json:"set,omitempty"`
+}
+
+// Returns the name of the field this step operates on.
+func (self MigrationStep) FieldName() string {
+	if self.Field != `` {
+		return self.Field
+	} else if self.Definition != nil {
+		return self.Definition.Name
+	}
+
+	return ``
+}
+
+func (self MigrationStep) String() string {
+	switch self.Operation {
+	case RenameFieldOperation:
+		return fmt.Sprintf("%s %s.%s -> %s", self.Operation, self.Collection, self.Field, self.To)
+	case BackfillOperation:
+		return fmt.Sprintf("%s %s", self.Operation, self.Collection)
+	default:
+		return fmt.Sprintf("%s %s.%s", self.Operation, self.Collection, self.FieldName())
+	}
+}
+
+// Verifies that the step specifies everything its operation needs.
+func (self MigrationStep) Validate() error {
+	if self.Collection == `` {
+		return fmt.Errorf("%s: must specify a collection", self.Operation)
+	}
+
+	switch self.Operation {
+	case AddFieldOperation:
+		if self.Definition == nil || self.Definition.Name == `` {
+			return fmt.Errorf("%v: must specify a field definition", self)
+		}
+
+	case ChangeTypeOperation:
+		if self.Definition == nil {
+			return fmt.Errorf("%v: must specify the new field definition", self)
+		} else if self.Definition.Type == `` {
+			return fmt.Errorf("%v: must specify the new field type", self)
+		}
+
+	case RenameFieldOperation:
+		if self.Field == `` || self.To == `` {
+			return fmt.Errorf("%v: must specify the field to rename and its new name", self)
+		}
+
+	case DropFieldOperation:
+		if self.Field == `` {
+			return fmt.Errorf("%v: must specify the field to drop", self)
+		}
+
+	case BackfillOperation:
+		if len(self.Set) == 0 {
+			return fmt.Errorf("%v: must specify at least one value to set", self)
+		}
+
+	default:
+		return fmt.Errorf("unknown migration operation %q", self.Operation)
+	}
+
+	return nil
+}
+
+// Modifies the given collection definition to reflect the changes made by this step.
+func (self MigrationStep) ApplyToCollection(collection *Collection) error {
+	name := self.FieldName()
+
+	switch self.Operation {
+	case AddFieldOperation:
+		if _, ok := collection.GetField(name); ok {
+			return fmt.Errorf("%v: field already exists", self)
+		}
+
+		collection.AddFields(*self.Definition)
+
+	case ChangeTypeOperation:
+		for i, field := range collection.Fields {
+			if field.Name == name {
+				definition := *self.Definition
+				definition.Name = name
+				collection.Fields[i] = definition
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%v: no such field", self)
+
+	case RenameFieldOperation:
+		if _, ok := collection.GetField(self.To); ok {
+			return fmt.Errorf("%v: field %q already exists", self, self.To)
+		}
+
+		for i, field := range collection.Fields {
+			if field.Name == name {
+				collection.Fields[i].Name = self.To
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%v: no such field", self)
+
+	case DropFieldOperation:
+		for i, field := range collection.Fields {
+			if field.Name == name {
+				collection.Fields = append(collection.Fields[:i], collection.Fields[i+1:]...)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%v: no such field", self)
+	}
+
+	return nil
+}
+
+// A Migration is a versioned set of steps that move a schema forward (Up), along with the steps
+// that undo those changes (Down).
+type Migration struct {
+	// Uniquely identifies this migration.  Migrations are applied in order of their versions (see
+	// MigrationVersionLess.)
+	Version string `json:"version"`
+
+	// A human-readable description of what the migration does.
+	Description string `json:"description,omitempty"`
+
+	// The steps to perform when applying this migration.
+	Up []MigrationStep `json:"up"`
+
+	// The steps to perform when reverting this migration.
+	Down []MigrationStep `json:"down,omitempty"`
+}
+
+// Returns the steps to perform when migrating in the given direction.
+func (self *Migration) Steps(direction MigrationDirection) []MigrationStep {
+	if direction == MigrateDown {
+		return self.Down
+	} else {
+		return self.Up
+	}
+}
+
+// Verifies that the migration has a version and that all of its steps are valid.
+func (self *Migration) Validate() error {
+	if self.Version == `` {
+		return fmt.Errorf("migration must specify a version")
+	}
+
+	for _, direction := range []MigrationDirection{MigrateUp, MigrateDown} {
+		for i, step := range self.Steps(direction) {
+			if err := step.Validate(); err != nil {
+				return fmt.Errorf("migration %v: %s step %d: %v", self.Version, direction, i+1, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns whether migration version a sorts before version b.  Versions that are both integers
+// (e.g.: "2" and "10") are compared numerically; all others are compared as strings.
+func MigrationVersionLess(a string, b string) bool {
+	if ai, err := strconv.ParseUint(a, 10, 64); err == nil {
+		if bi, err := strconv.ParseUint(b, 10, 64); err == nil {
+			return ai < bi
+		}
+	}
+
+	return a < b
+}
@@ -0,0 +1,18 @@
+package dal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationVersionLess(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(MigrationVersionLess(`2`, `10`))
+	assert.False(MigrationVersionLess(`10`, `2`))
+	assert.False(MigrationVersionLess(`2`, `2`))
+	assert.True(MigrationVersionLess(`002`, `010`))
+	assert.True(MigrationVersionLess(`20240101120000`, `20240102000000`))
+	assert.True(MigrationVersionLess(`2024-01`, `2024-02`))
+}
@@ -12,6 +12,7 @@ type RecordSet struct {
 	Page           int                    `json:"page,omitempty"`
 	TotalPages     int                    `json:"total_pages,omitempty"`
 	RecordsPerPage int                    `json:"records_per_page,omitempty"`
+	NextCursor     string                 `json:"next_cursor,omitempty"`
 	Records        []*Record              `json:"records"`
 	Options        map[string]interface{} `json:"options"`
 	KnownSize      bool                   `json:"known_size"`
@@ -0,0 +1,27 @@
+package dal
+
+// Describes an additional index on a Collection that lets backends which can otherwise only look
+// up records by their primary key (e.g.: DynamoDB) query other fields efficiently.
+type SecondaryIndex struct {
+	// The name of the index in the underlying database.
+	Name string `json:"name"`
+
+	// The field whose exact value is used to look up records in the index.
+	HashKey string `json:"hash_key"`
+
+	// An optional field the records in the index are sorted by, allowing range queries on it.
+	RangeKey string `json:"range_key,omitempty"`
+
+	// Whether the index shares the hash key of the Collection itself (a DynamoDB "local" secondary
+	// index) instead of being partitioned on its own hash key.
+	Local bool `json:"local,omitempty"`
+}
+
+// Return the names of the key fields of this index.
+func (self SecondaryIndex) KeyFieldNames() []string {
+	if self.RangeKey != `` {
+		return []string{self.HashKey, self.RangeKey}
+	} else {
+		return []string{self.HashKey}
+	}
+}
@@ -79,6 +79,7 @@ const (
 	FieldLengthIssue
 	FieldTypeIssue
 	FieldPropertyIssue
+	FieldExtraIssue
 )
 
 type SchemaDelta struct {
@@ -18,6 +18,7 @@ type DB interface {
 	LoadFixtures(fileOrDirPath string) error
 	GetBackend() Backend
 	SetBackend(Backend)
+	Transaction(fn backends.TransactionFunc) error
 }
 
 type schemaModel struct {
@@ -107,3 +108,9 @@ func (self *db) ApplySchemata(fileOrDirPath string) error {
 func (self *db) LoadFixtures(fileOrDirPath string) error {
 	return LoadFixtures(fileOrDirPath, self)
 }
+
+// Runs the given function inside of a transaction.  If the function returns an error, all
+// changes made through the transaction are rolled back; otherwise they are committed.
+func (self *db) Transaction(fn backends.TransactionFunc) error {
+	return backends.WithTransaction(self.Backend, fn)
+}
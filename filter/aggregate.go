@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var aggregationNames = map[Aggregation]string{
+	First:         `first`,
+	Last:          `last`,
+	Minimum:       `min`,
+	Maximum:       `max`,
+	Sum:           `sum`,
+	Average:       `avg`,
+	Count:         `count`,
+	CountDistinct: `count_distinct`,
+	Cardinality:   `cardinality`,
+	Percentile:    `percentile`,
+	Median:        `median`,
+	StdDev:        `stddev`,
+	Variance:      `variance`,
+}
+
+// Parses the name of an Aggregation (e.g.: "sum", "avg", "count").
+func ParseAggregation(name string) (Aggregation, error) {
+	for aggregation, n := range aggregationNames {
+		if strings.EqualFold(name, n) {
+			return aggregation, nil
+		}
+	}
+
+	return First, fmt.Errorf("Unsupported aggregation %q", name)
+}
+
+func (self Aggregation) String() string {
+	if name, ok := aggregationNames[self]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Aggregation(%d)", int(self))
+}
+
+// Parses an aggregate from a string of the form "[name=]function[:field]", e.g.: "avg:age" or
+// "total=sum:amount".  The field may be omitted for "count", which counts records.  Percentiles
+// are written as "p" followed by the percentile, e.g.: "p95:latency" or "p99.9:latency".
+func ParseAggregate(spec string) (Aggregate, error) {
+	var aggregate Aggregate
+
+	if name, rest, ok := strings.Cut(spec, `=`); ok {
+		aggregate.Name = name
+		spec = rest
+	}
+
+	fn, field, _ := strings.Cut(spec, ModifierDelimiter)
+
+	if p, ok := parsePercentile(fn); ok {
+		if p < 0 || p > 100 {
+			return aggregate, fmt.Errorf("percentile %v must be between 0 and 100", p)
+		}
+
+		aggregate.Aggregation = Percentile
+		aggregate.Percentile = p
+	} else if aggregation, err := ParseAggregation(fn); err == nil && aggregation != Percentile {
+		aggregate.Aggregation = aggregation
+	} else if err == nil {
+		return aggregate, fmt.Errorf("percentile aggregates are written as pNN (e.g.: \"p95:%s\")", field)
+	} else {
+		return aggregate, err
+	}
+
+	if field == `` {
+		if aggregate.Aggregation == Count {
+			field = DefaultIdentityField
+		} else {
+			return aggregate, fmt.Errorf("aggregate %q must specify a field", spec)
+		}
+	}
+
+	aggregate.Field = field
+
+	if aggregate.Name == `` && aggregate.Aggregation == Count && field == DefaultIdentityField {
+		aggregate.Name = `count`
+	}
+
+	return aggregate, nil
+}
+
+// Returns the name of the field that the result of this aggregate is returned as.
+func (self Aggregate) ResultName() string {
+	if self.Name != `` {
+		return self.Name
+	}
+
+	return self.Field
+}
+
+// Returns the fraction (0-1) of values that fall below the result of a Percentile or Median
+// aggregate.
+func (self Aggregate) Quantile() float64 {
+	if self.Aggregation == Median {
+		return 0.5
+	}
+
+	return self.Percentile / 100
+}
+
+func (self Aggregate) String() string {
+	fn := self.Aggregation.String()
+
+	if self.Aggregation == Percentile {
+		fn = `p` + strconv.FormatFloat(self.Percentile, 'f', -1, 64)
+	}
+
+	spec := fn + ModifierDelimiter + self.Field
+
+	if self.Name != `` {
+		spec = self.Name + `=` + spec
+	}
+
+	return spec
+}
+
+func parsePercentile(fn string) (float64, bool) {
+	if len(fn) > 1 && (fn[0] == 'p' || fn[0] == 'P') {
+		if p, err := strconv.ParseFloat(fn[1:], 64); err == nil {
+			return p, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/PerformLine/pivot/v3/dal"
+)
+
+// Setting a filter's Cursor to this value requests the first page of a cursor-paginated query.
+// Subsequent pages are retrieved by setting the Cursor to the NextCursor of the previous page.
+var CursorStart = `start`
+
+var cursorEncoding = base64.RawURLEncoding
+
+// Encodes the given value as an opaque continuation token.
+func EncodeCursor(value interface{}) (string, error) {
+	if data, err := json.Marshal(value); err == nil {
+		return cursorEncoding.EncodeToString(data), nil
+	} else {
+		return ``, err
+	}
+}
+
+// Decodes a continuation token produced by EncodeCursor into the given value.  Numbers are
+// decoded as json.Number so that large integer IDs survive the round trip intact.
+func DecodeCursor(cursor string, into interface{}) error {
+	if data, err := cursorEncoding.DecodeString(cursor); err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(into); err != nil {
+			return fmt.Errorf("invalid cursor: %v", err)
+		}
+
+		return nil
+	} else {
+		return fmt.Errorf("invalid cursor: %v", err)
+	}
+}
+
+// Returns whether this filter is requesting cursor-based (rather than offset-based) pagination.
+func (self *Filter) UsesCursor() bool {
+	return (self.Cursor != ``)
+}
+
+// Returns the fields that determine a record's position in cursor-paginated results: the sort
+// fields, followed by the identity field (as a tiebreaker) if it isn't already being sorted on.
+func (self *Filter) CursorSort() []SortBy {
+	sortBy := self.GetSort()
+	identity := self.IdentityField
+
+	if identity == `` {
+		identity = DefaultIdentityField
+	}
+
+	for _, s := range sortBy {
+		if s.Field == identity {
+			return sortBy
+		}
+	}
+
+	return append(sortBy, SortBy{
+		Field: identity,
+	})
+}
+
+// Returns a cursor pointing just past the given record, suitable for use as the Cursor of the
+// filter that retrieves the next page of results.
+func (self *Filter) CursorFor(record *dal.Record) (string, error) {
+	values := make([]interface{}, 0)
+
+	for _, s := range self.CursorSort() {
+		if s.Field == self.IdentityField || s.Field == DefaultIdentityField {
+			values = append(values, record.ID)
+		} else {
+			values = append(values, record.Get(s.Field))
+		}
+	}
+
+	return EncodeCursor(values)
+}
+
+// Returns the values (one for each of the fields returned by CursorSort) that were encoded in
+// this filter's cursor by CursorFor.  If there is no cursor, or the cursor is CursorStart, nil is
+// returned.
+func (self *Filter) CursorValues() ([]interface{}, error) {
+	if !self.UsesCursor() || self.Cursor == CursorStart {
+		return nil, nil
+	}
+
+	var values []interface{}
+
+	if err := DecodeCursor(self.Cursor, &values); err != nil {
+		return nil, err
+	}
+
+	if expected := len(self.CursorSort()); len(values) != expected {
+		return nil, fmt.Errorf("invalid cursor: expected %d values, got %d", expected, len(values))
+	}
+
+	for i, value := range values {
+		values[i] = cursorValue(value)
+	}
+
+	return values, nil
+}
+
+// converts decoded JSON numbers into int64 if possible, otherwise float64.
+func cursorValue(in interface{}) interface{} {
+	if number, ok := in.(json.Number); ok {
+		if i, err := number.Int64(); err == nil {
+			return i
+		} else if f, err := number.Float64(); err == nil {
+			return f
+		} else {
+			return number.String()
+		}
+	}
+
+	return in
+}
@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"regexp"
@@ -28,6 +29,9 @@ var AllValue = `all`
 var SortAscending = `+`
 var SortDescending = `-`
 var DefaultIdentityField = `id`
+var GroupOpen = `(`
+var GroupClose = `)`
+var GroupMapKeyPrefix = `$`
 var rxCharFilter = regexp.MustCompile(`[\W\s\_]+`)
 
 type NormalizerFunc func(in string) string // {}
@@ -44,6 +48,32 @@ type Criterion struct {
 	Operator    string        `json:"operator,omitempty"`
 	Values      []interface{} `json:"values"`
 	Aggregation Aggregation   `json:"aggregation,omitempty"`
+
+	// If Criteria is non-empty, this criterion is a group whose subcriteria are joined together
+	// using Conjunction, and the other fields are ignored.
+	Conjunction ConjunctionType `json:"conjunction,omitempty"`
+	Criteria    []Criterion     `json:"criteria,omitempty"`
+}
+
+// Returns a group criterion that matches if all of the given criteria match.
+func And(criteria ...Criterion) Criterion {
+	return Criterion{
+		Conjunction: AndConjunction,
+		Criteria:    criteria,
+	}
+}
+
+// Returns a group criterion that matches if any of the given criteria match.
+func Or(criteria ...Criterion) Criterion {
+	return Criterion{
+		Conjunction: OrConjunction,
+		Criteria:    criteria,
+	}
+}
+
+// Returns whether this criterion is a group of other criteria.
+func (self *Criterion) IsGroup() bool {
+	return len(self.Criteria) > 0
 }
 
 func (self *Criterion) IsExactMatch() bool {
@@ -70,21 +100,39 @@ const (
 	Sum
 	Average
 	Count
+	CountDistinct // the exact number of distinct values
+	Cardinality   // the number of distinct values; may be approximated by backends that support it
+	Percentile    // the value below which Aggregate.Percentile percent of values fall
+	Median
+	StdDev   // the population standard deviation
+	Variance // the population variance
 )
 
 type ConjunctionType string
 
 const (
 	AndConjunction ConjunctionType = ``
-	OrConjunction                  = `or`
+	OrConjunction  ConjunctionType = `or`
 )
 
 type Aggregate struct {
 	Aggregation Aggregation
 	Field       string
+	Name        string  // the field the result is returned as; defaults to Field
+	Percentile  float64 // for Percentile aggregations, the percentile (0-100) to calculate
 }
 
 func (self *Criterion) String() string {
+	if self.IsGroup() {
+		parts := []string{string(self.Conjunction) + GroupOpen}
+
+		for _, criterion := range self.Criteria {
+			parts = append(parts, criterion.String())
+		}
+
+		return strings.Join(append(parts, GroupClose), CriteriaSeparator)
+	}
+
 	rv := ``
 
 	if self.Type != `` {
@@ -123,6 +171,7 @@ type Filter struct {
 	MatchAll      bool
 	Offset        int
 	Limit         int
+	Cursor        string
 	Criteria      []Criterion
 	Sort          []string
 	Fields        []string
@@ -173,7 +222,103 @@ func Copy(other *Filter) Filter {
 func FromMap(in map[string]interface{}) (*Filter, error) {
 	rv := MakeFilter()
 
-	for typeField, opValue := range in {
+	if criteria, err := criteriaFromMap(in); err == nil {
+		rv.AddCriteria(criteria...)
+	} else {
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+// Parse a filter from its structured JSON form, e.g.:
+//
+//	{
+//	    "conjunction": "or",
+//	    "criteria": [
+//	        {"field": "status", "values": ["active"]},
+//	        {"conjunction": "and", "criteria": [...]}
+//	    ]
+//	}
+func FromJSON(data []byte) (*Filter, error) {
+	rv := MakeFilter()
+
+	if err := json.Unmarshal(data, &rv); err != nil {
+		return nil, err
+	}
+
+	if conjunction, err := parseConjunction(string(rv.Conjunction)); err == nil {
+		rv.Conjunction = conjunction
+	} else {
+		return nil, err
+	}
+
+	for i, criterion := range rv.Criteria {
+		if c, err := normalizeCriterion(criterion); err == nil {
+			rv.Criteria[i] = c
+		} else {
+			return nil, err
+		}
+	}
+
+	if len(rv.Criteria) == 0 {
+		rv.MatchAll = true
+	}
+
+	return &rv, nil
+}
+
+// converts a map of field names to values into criteria.  Keys naming a conjunction (e.g.: "$or")
+// produce groups from their values, which may be a map or a list of maps.
+func criteriaFromMap(in map[string]interface{}) ([]Criterion, error) {
+	criteria := make([]Criterion, 0)
+
+	for _, typeField := range maputil.StringKeys(in) {
+		opValue := in[typeField]
+
+		if strings.HasPrefix(typeField, GroupMapKeyPrefix) {
+			if conjunction, err := parseConjunction(strings.TrimPrefix(typeField, GroupMapKeyPrefix)); err == nil {
+				group := Criterion{
+					Conjunction: conjunction,
+				}
+
+				if typeutil.IsMap(opValue) {
+					if subcriteria, err := criteriaFromMap(maputil.M(opValue).MapNative()); err == nil {
+						group.Criteria = subcriteria
+					} else {
+						return nil, err
+					}
+				} else if typeutil.IsArray(opValue) {
+					for _, item := range sliceutil.Sliceify(opValue) {
+						if !typeutil.IsMap(item) {
+							return nil, fmt.Errorf("%v: expected a map, got %T", typeField, item)
+						}
+
+						if subcriteria, err := criteriaFromMap(maputil.M(item).MapNative()); err == nil {
+							if len(subcriteria) == 1 {
+								group.Criteria = append(group.Criteria, subcriteria[0])
+							} else {
+								group.Criteria = append(group.Criteria, And(subcriteria...))
+							}
+						} else {
+							return nil, err
+						}
+					}
+				} else {
+					return nil, fmt.Errorf("%v: expected a map or list of maps, got %T", typeField, opValue)
+				}
+
+				if !group.IsGroup() {
+					return nil, fmt.Errorf("%v: group must contain at least one criterion", typeField)
+				}
+
+				criteria = append(criteria, group)
+				continue
+			} else {
+				return nil, err
+			}
+		}
+
 		fType, fName := SplitModifierToken(typeField)
 
 		var vOper string
@@ -192,7 +337,7 @@ func FromMap(in map[string]interface{}) (*Filter, error) {
 			}
 		}
 
-		rv.AddCriteria(Criterion{
+		criteria = append(criteria, Criterion{
 			Type:     dal.Type(fType),
 			Field:    fName,
 			Operator: vOper,
@@ -200,7 +345,41 @@ func FromMap(in map[string]interface{}) (*Filter, error) {
 		})
 	}
 
-	return &rv, nil
+	return criteria, nil
+}
+
+// validates the conjunction of the given criterion (and those of any subcriteria).
+func normalizeCriterion(criterion Criterion) (Criterion, error) {
+	if criterion.IsGroup() {
+		if conjunction, err := parseConjunction(string(criterion.Conjunction)); err == nil {
+			criterion.Conjunction = conjunction
+		} else {
+			return criterion, err
+		}
+
+		for i, subcriterion := range criterion.Criteria {
+			if c, err := normalizeCriterion(subcriterion); err == nil {
+				criterion.Criteria[i] = c
+			} else {
+				return criterion, err
+			}
+		}
+	} else if criterion.Field == `` {
+		return criterion, fmt.Errorf("criterion must specify a field or a non-empty list of criteria")
+	}
+
+	return criterion, nil
+}
+
+func parseConjunction(in string) (ConjunctionType, error) {
+	switch strings.ToLower(in) {
+	case ``, `and`:
+		return AndConjunction, nil
+	case `or`:
+		return OrConjunction, nil
+	default:
+		return AndConjunction, fmt.Errorf("Unknown conjunction %q", in)
+	}
 }
 
 func Null() *Filter {
@@ -222,7 +401,13 @@ func Parse(in interface{}) (*Filter, error) {
 		return FromMap(typeutil.V(elem).MapNative(util.RecordStructTag))
 	} else if typeutil.IsMap(in) {
 		return FromMap(maputil.M(in).MapNative())
+	} else if data, ok := in.([]byte); ok {
+		return FromJSON(data)
 	} else if fStr, ok := in.(string); ok {
+		if strings.HasPrefix(strings.TrimSpace(fStr), `{`) {
+			return FromJSON([]byte(fStr))
+		}
+
 		return ParseSpec(fStr)
 	} else {
 		return Null(), fmt.Errorf("Expected filter.Filter, map, or string; got: %T", in)
@@ -271,8 +456,44 @@ func ParseSpec(spec string) (*Filter, error) {
 		return rv, nil
 
 	case len(criteria) >= 2:
-		for i, token := range criteria {
-			if (i % 2) == 0 {
+		var expectValue bool
+		var groups []*Criterion
+
+		// adds a criterion to the innermost open group, or to the filter itself
+		addCriterion := func(c Criterion) {
+			if len(groups) > 0 {
+				groups[len(groups)-1].Criteria = append(groups[len(groups)-1].Criteria, c)
+			} else {
+				rv.Criteria = append(rv.Criteria, c)
+			}
+		}
+
+		for _, token := range criteria {
+			if !expectValue {
+				if conjunction, ok := parseGroupOpenToken(token); ok {
+					groups = append(groups, &Criterion{
+						Conjunction: conjunction,
+					})
+
+					continue
+				} else if token == GroupClose {
+					if len(groups) == 0 {
+						return rv, fmt.Errorf("Invalid filter spec: unexpected %q", GroupClose)
+					}
+
+					group := groups[len(groups)-1]
+					groups = groups[:len(groups)-1]
+
+					if !group.IsGroup() {
+						return rv, fmt.Errorf("Invalid filter spec: empty group")
+					}
+
+					addCriterion(*group)
+					continue
+				}
+
+				expectValue = true
+
 				var addSortAsc *bool
 
 				if strings.HasPrefix(token, SortAscending) {
@@ -365,9 +586,14 @@ func ParseSpec(spec string) (*Filter, error) {
 					}
 				}
 
-				rv.Criteria = append(rv.Criteria, criterion)
+				addCriterion(criterion)
+				expectValue = false
 			}
 		}
+
+		if len(groups) > 0 {
+			return rv, fmt.Errorf("Invalid filter spec: unclosed group")
+		}
 	default:
 		return rv, fmt.Errorf("Invalid filter spec: %s", spec)
 	}
@@ -375,6 +601,18 @@ func ParseSpec(spec string) (*Filter, error) {
 	return rv, nil
 }
 
+// returns the conjunction of a token that opens a group (e.g.: "(", "and(", "or("), and whether
+// the token is one.
+func parseGroupOpenToken(token string) (ConjunctionType, bool) {
+	if strings.HasSuffix(token, GroupOpen) {
+		if conjunction, err := parseConjunction(strings.TrimSuffix(token, GroupOpen)); err == nil {
+			return conjunction, true
+		}
+	}
+
+	return AndConjunction, false
+}
+
 func (self *Filter) AddCriteria(criteria ...Criterion) *Filter {
 	self.MatchAll = false
 	self.Criteria = append(self.Criteria, criteria...)
@@ -409,16 +647,56 @@ func (self *Filter) BoundedBy(limit int, offset int) *Filter {
 	return self
 }
 
+// Returns the names of the fields that criteria in this filter (including those in groups) apply to.
 func (self *Filter) CriteriaFields() []string {
-	fields := make([]string, len(self.Criteria))
+	return criteriaFields(self.Criteria)
+}
+
+func criteriaFields(criteria []Criterion) []string {
+	fields := make([]string, 0, len(criteria))
 
-	for i, criterion := range self.Criteria {
-		fields[i] = criterion.Field
+	for _, criterion := range criteria {
+		if criterion.IsGroup() {
+			fields = append(fields, criteriaFields(criterion.Criteria)...)
+		} else {
+			fields = append(fields, criterion.Field)
+		}
 	}
 
 	return fields
 }
 
+// Returns the criteria that every matching record must satisfy (including those in AND groups), and
+// whether those are all of this filter's criteria.  Filters that have any criteria joined by OR are
+// not simple lookups, so nothing is returned for them.
+func (self *Filter) requiredCriteria() ([]Criterion, bool) {
+	if self.Conjunction == OrConjunction && len(self.Criteria) > 1 {
+		return nil, false
+	}
+
+	return requiredCriteria(self.Criteria)
+}
+
+func requiredCriteria(criteria []Criterion) ([]Criterion, bool) {
+	required := make([]Criterion, 0, len(criteria))
+
+	for _, criterion := range criteria {
+		if criterion.IsGroup() {
+			if criterion.Conjunction == OrConjunction && len(criterion.Criteria) > 1 {
+				return nil, false
+			} else if subcriteria, ok := requiredCriteria(criterion.Criteria); ok {
+				required = append(required, subcriteria...)
+			} else {
+				return nil, false
+			}
+		} else {
+			required = append(required, criterion)
+		}
+	}
+
+	return required, true
+}
+
 func (self *Filter) IdOnly() bool {
 	if self.Fields != nil && len(self.Fields) == 1 && self.Fields[0] == self.IdentityField {
 		return true
@@ -427,30 +705,40 @@ func (self *Filter) IdOnly() bool {
 	return false
 }
 
+// Returns the values of the first criterion on the given field.  Filters that join criteria with OR
+// don't require any particular value, and return false.
 func (self *Filter) GetValues(field string) ([]interface{}, bool) {
-	for _, criterion := range self.Criteria {
-		if criterion.Field == field {
-			return criterion.Values, true
+	if criteria, ok := self.requiredCriteria(); ok {
+		for _, criterion := range criteria {
+			if criterion.Field == field {
+				return criterion.Values, true
+			}
 		}
 	}
 
 	return nil, false
 }
 
+// Returns the first value of the first criterion.  Filters that join criteria with OR don't require
+// any particular value, and return false.
 func (self *Filter) GetFirstValue() (interface{}, bool) {
-	if len(self.Criteria) > 0 {
-		if len(self.Criteria[0].Values) > 0 {
-			return self.Criteria[0].Values[0], true
+	if criteria, ok := self.requiredCriteria(); ok && len(criteria) > 0 {
+		if len(criteria[0].Values) > 0 {
+			return criteria[0].Values[0], true
 		}
 	}
 
 	return nil, false
 }
 
+// Returns the first value given for the identity field.  Filters that join criteria with OR don't
+// require any particular value, and return false.
 func (self *Filter) GetIdentityValue() (interface{}, bool) {
-	for _, criterion := range self.Criteria {
-		if criterion.Field == self.IdentityField {
-			return sliceutil.At(criterion.Values, 0)
+	if criteria, ok := self.requiredCriteria(); ok {
+		for _, criterion := range criteria {
+			if criterion.Field == self.IdentityField {
+				return sliceutil.At(criterion.Values, 0)
+			}
 		}
 	}
 
@@ -472,13 +760,7 @@ func (self *Filter) String() string {
 	if self.IsMatchAll() {
 		return AllValue
 	} else {
-		criteria := make([]string, 0)
-
-		for _, criterion := range self.Criteria {
-			criteria = append(criteria, criterion.String())
-		}
-
-		return strings.Join(criteria, CriteriaSeparator)
+		return strings.Join(self.criteriaSpecs(), CriteriaSeparator)
 	}
 }
 
@@ -515,13 +797,26 @@ func (self *Filter) ApplyOptions(in interface{}) error {
 	return nil
 }
 
-func (self *Filter) NewFromMap(in map[string]interface{}) (*Filter, error) {
+// Returns the criteria of this filter as specs, with OR conjunctions kept in a group so that more
+// criteria can be appended to them.
+func (self *Filter) criteriaSpecs() []string {
 	criteria := make([]string, 0)
 
-	for _, criterion := range self.Criteria {
-		criteria = append(criteria, criterion.String())
+	if self.Conjunction == OrConjunction && len(self.Criteria) > 1 {
+		group := Or(self.Criteria...)
+		criteria = append(criteria, group.String())
+	} else {
+		for _, criterion := range self.Criteria {
+			criteria = append(criteria, criterion.String())
+		}
 	}
 
+	return criteria
+}
+
+func (self *Filter) NewFromMap(in map[string]interface{}) (*Filter, error) {
+	criteria := self.criteriaSpecs()
+
 	for typeField, opValue := range in {
 		criteria = append(criteria, fmt.Sprintf("%s%s%v", typeField, FieldTermSeparator, opValue))
 	}
@@ -530,22 +825,12 @@ func (self *Filter) NewFromMap(in map[string]interface{}) (*Filter, error) {
 }
 
 func (self *Filter) NewFromSpec(specs ...string) (*Filter, error) {
-	criteria := make([]string, 0)
-
-	for _, criterion := range self.Criteria {
-		criteria = append(criteria, criterion.String())
-	}
-
-	criteria = append(criteria, specs...)
+	criteria := append(self.criteriaSpecs(), specs...)
 
 	return Parse(strings.Join(criteria, CriteriaSeparator))
 }
 
 func (self *Filter) MatchesRecord(record *dal.Record) bool {
-	if self.Conjunction == OrConjunction {
-		panic("OR conjunction is not yet supported in filter.MatchesRecord()")
-	}
-
 	if self.IsMatchAll() {
 		return true
 	}
@@ -554,132 +839,166 @@ func (self *Filter) MatchesRecord(record *dal.Record) bool {
 		return false
 	}
 
-	for _, criterion := range self.Criteria {
-		var anyMatched bool
+	return self.matchesCriteria(record, self.Conjunction, self.Criteria)
+}
 
-	ValuesLoop:
-		for _, vI := range criterion.Values {
-			vStr := typeutil.String(vI)
+func (self *Filter) matchesCriteria(record *dal.Record, conjunction ConjunctionType, criteria []Criterion) bool {
+	for _, criterion := range criteria {
+		matched := self.matchesCriterion(record, criterion)
 
-			// if the operator isn't of the exact match sort, normalize the criterion value
-			if !IsExactMatchOperator(criterion.Operator) {
-				vStr = self.Normalizer(vStr)
+		if conjunction == OrConjunction {
+			if matched {
+				return true
 			}
+		} else if !matched {
+			return false
+		}
+	}
 
-			// treat unset criterion values and the literal value "null" as nil
-			switch vStr {
-			case `null`, ``:
-				vI = nil
-			}
+	// an OR with no matching criteria is false, an AND with no failing criteria is true
+	return (conjunction != OrConjunction || len(criteria) == 0)
+}
 
-			var invertQuery bool
-			var cmpValue interface{}
-			var cmpValueS string
+func (self *Filter) matchesCriterion(record *dal.Record, criterion Criterion) bool {
+	if criterion.IsGroup() {
+		return self.matchesCriteria(record, criterion.Conjunction, criterion.Criteria)
+	}
 
-			if criterion.Field == self.IdentityField || criterion.Field == `id` {
-				cmpValue = record.ID
-			} else {
-				cmpValue = record.Get(criterion.Field)
+	// full-text matches are performed against the terms in the text, so skip normalization
+	if criterion.Operator == FulltextOperator {
+		return (criterionScore(record, criterion) > 0)
+	}
+
+	var anyMatched bool
+
+ValuesLoop:
+	for _, vI := range criterion.Values {
+		vStr := typeutil.String(vI)
+
+		// if the operator isn't of the exact match sort, normalize the criterion value
+		if !IsExactMatchOperator(criterion.Operator) {
+			vStr = self.Normalizer(vStr)
+		}
+
+		// treat unset criterion values and the literal value "null" as nil
+		switch vStr {
+		case `null`, ``:
+			vI = nil
+		}
+
+		var invertQuery bool
+		var cmpValue interface{}
+		var cmpValueS string
+
+		if criterion.Field == self.IdentityField || criterion.Field == `id` {
+			cmpValue = record.ID
+		} else {
+			cmpValue = record.Get(criterion.Field)
+		}
+
+		if cmpValue != nil {
+			cmpValueS = typeutil.String(cmpValue)
+
+			// if the operator isn't of the exact match sort, normalize the record field value
+			if !IsExactMatchOperator(criterion.Operator) {
+				cmpValueS = self.Normalizer(cmpValueS)
 			}
+		}
+
+		// fmt.Printf("term:%v value:%v\n", vStr, cmpValueS)
+
+		switch criterion.Operator {
+		case `is`, ``, `not`, `like`, `unlike`:
+			var isEqual bool
 
-			if cmpValue != nil {
-				cmpValueS = typeutil.String(cmpValue)
+			invertQuery = IsInvertingOperator(criterion.Operator)
 
-				// if the operator isn't of the exact match sort, normalize the record field value
-				if !IsExactMatchOperator(criterion.Operator) {
-					cmpValueS = self.Normalizer(cmpValueS)
+			switch criterion.Type {
+			case dal.AutoType:
+				if e, err := stringutil.RelaxedEqual(vStr, cmpValueS); err == nil {
+					isEqual = e
+				} else {
+					return false
 				}
-			}
+			case dal.FloatType:
+				isEqual = (typeutil.Float(vI) == typeutil.Float(cmpValue))
 
-			// fmt.Printf("term:%v value:%v\n", vStr, cmpValueS)
+			case dal.IntType:
+				isEqual = (typeutil.Int(vI) == typeutil.Int(cmpValue))
 
-			switch criterion.Operator {
-			case `is`, ``, `not`, `like`, `unlike`:
-				var isEqual bool
+			case dal.BooleanType:
+				isEqual = (typeutil.Bool(vI) == typeutil.Bool(cmpValue))
 
-				invertQuery = IsInvertingOperator(criterion.Operator)
+			default:
+				isEqual = (vI == cmpValue)
+			}
 
-				switch criterion.Type {
-				case dal.AutoType:
-					if e, err := stringutil.RelaxedEqual(vStr, cmpValueS); err == nil {
-						isEqual = e
-					} else {
-						return false
-					}
-				case dal.FloatType:
-					isEqual = (typeutil.Float(vI) == typeutil.Float(cmpValue))
+			if !invertQuery && isEqual || invertQuery && !isEqual {
+				anyMatched = true
+				break ValuesLoop
+			}
+
+		case `prefix`:
+			if strings.HasPrefix(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+				anyMatched = true
+				break ValuesLoop
+			}
+
+		case `suffix`:
+			if strings.HasSuffix(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+				anyMatched = true
+				break ValuesLoop
+			}
 
-				case dal.IntType:
-					isEqual = (typeutil.Int(vI) == typeutil.Int(cmpValue))
+		case `contains`:
+			if strings.Contains(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+				anyMatched = true
+				break ValuesLoop
+			}
 
-				case dal.BooleanType:
-					isEqual = (typeutil.Bool(vI) == typeutil.Bool(cmpValue))
+		case `gt`, `lt`, `gte`, `lte`:
+			cmpValueF := typeutil.Float(cmpValue)
+			vF := typeutil.Float(vI)
 
-				default:
-					isEqual = (vI == cmpValue)
+			// times are compared by their position on the timeline, and unset times never match
+			if criterion.Type == dal.TimeType {
+				if cmpTime := typeutil.V(cmpValue).Time(); !cmpTime.IsZero() {
+					cmpValueF = float64(cmpTime.UnixNano())
+					vF = float64(typeutil.V(vI).Time().UnixNano())
+				} else {
+					continue
 				}
+			}
 
-				if !invertQuery && isEqual || invertQuery && !isEqual {
+			switch criterion.Operator {
+			case `gt`:
+				if cmpValueF > vF {
 					anyMatched = true
 					break ValuesLoop
 				}
-
-			case `prefix`:
-				if strings.HasPrefix(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+			case `gte`:
+				if cmpValueF >= vF {
 					anyMatched = true
 					break ValuesLoop
 				}
-
-			case `suffix`:
-				if strings.HasSuffix(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+			case `lt`:
+				if cmpValueF < vF {
 					anyMatched = true
 					break ValuesLoop
 				}
-
-			case `contains`:
-				if strings.Contains(strings.ToLower(cmpValueS), strings.ToLower(vStr)) {
+			case `lte`:
+				if cmpValueF <= vF {
 					anyMatched = true
 					break ValuesLoop
 				}
-
-			case `gt`, `lt`, `gte`, `lte`:
-				cmpValueF := typeutil.Float(cmpValue)
-				vF := typeutil.Float(vI)
-
-				switch criterion.Operator {
-				case `gt`:
-					if cmpValueF > vF {
-						anyMatched = true
-						break ValuesLoop
-					}
-				case `gte`:
-					if cmpValueF >= vF {
-						anyMatched = true
-						break ValuesLoop
-					}
-				case `lt`:
-					if cmpValueF < vF {
-						anyMatched = true
-						break ValuesLoop
-					}
-				case `lte`:
-					if cmpValueF <= vF {
-						anyMatched = true
-						break ValuesLoop
-					}
-				}
-			default:
-				return false
 			}
-		}
-
-		// if none of the values matched, the criterion is false
-		if !anyMatched {
+		default:
 			return false
 		}
 	}
 
-	return true
+	// if none of the values matched, the criterion is false
+	return anyMatched
 }
 
 func IsExactMatchOperator(operator string) bool {
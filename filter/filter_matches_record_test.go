@@ -2,6 +2,7 @@ package filter
 
 import (
 	"testing"
+	"time"
 
 	"github.com/PerformLine/pivot/v3/dal"
 	"github.com/stretchr/testify/require"
@@ -47,6 +48,16 @@ func TestFilterMatchesRecord(t *testing.T) {
 	assert.True(MustParse(`id/lte:1`).MatchesRecord(dal.NewRecord(1)))
 	assert.True(MustParse(`id/lte:1`).MatchesRecord(dal.NewRecord(0)))
 
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	assert.True(MustParse(`time:expires_at/lt:-1m`).MatchesRecord(dal.NewRecord(1).Set(`expires_at`, past)))
+	assert.True(MustParse(`time:expires_at/lt:-1m`).MatchesRecord(dal.NewRecord(1).Set(`expires_at`, past.Format(time.RFC3339))))
+	assert.False(MustParse(`time:expires_at/lt:-1m`).MatchesRecord(dal.NewRecord(1).Set(`expires_at`, future)))
+	assert.False(MustParse(`time:expires_at/lt:-1m`).MatchesRecord(dal.NewRecord(1)))
+	assert.True(MustParse(`time:expires_at/gte:-1m`).MatchesRecord(dal.NewRecord(1).Set(`expires_at`, future)))
+	assert.False(MustParse(`time:expires_at/gte:-1m`).MatchesRecord(dal.NewRecord(1).Set(`expires_at`, past)))
+
 	assert.True(MustParse(`name/contains:old`).MatchesRecord(dal.NewRecord(1).Set(`name`, `Goldenrod`)))
 	assert.True(MustParse(`name/prefix:gold`).MatchesRecord(dal.NewRecord(1).Set(`name`, `Gold`)))
 	assert.True(MustParse(`name/prefix:Gold`).MatchesRecord(dal.NewRecord(1).Set(`name`, `Gold`)))
@@ -57,3 +68,50 @@ func TestFilterMatchesRecord(t *testing.T) {
 	assert.True(MustParse(`name/Golden rod`).MatchesRecord(dal.NewRecord(1).Set(`name`, `Golden rod`)))
 	assert.True(MustParse(`name/like:golden rod`).MatchesRecord(dal.NewRecord(1).Set(`name`, `Golden rod`)))
 }
+
+func TestFilterMatchesRecordGroups(t *testing.T) {
+	assert := require.New(t)
+
+	f := MustParse(`status/active/or(/age/gt:30/vip/true/)`)
+
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`status`, `active`).Set(`age`, 40).Set(`vip`, false)))
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`status`, `active`).Set(`age`, 20).Set(`vip`, true)))
+	assert.False(f.MatchesRecord(dal.NewRecord(1).Set(`status`, `active`).Set(`age`, 20).Set(`vip`, false)))
+	assert.False(f.MatchesRecord(dal.NewRecord(1).Set(`status`, `inactive`).Set(`age`, 40).Set(`vip`, true)))
+
+	f = MustParse(`a/1/b/2`)
+	f.Conjunction = OrConjunction
+
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`a`, 1).Set(`b`, 3)))
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`a`, 3).Set(`b`, 2)))
+	assert.False(f.MatchesRecord(dal.NewRecord(1).Set(`a`, 3).Set(`b`, 3)))
+
+	f = MustParse(`or(/a/1/and(/b/2/c/3/)/)`)
+
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`a`, 1)))
+	assert.True(f.MatchesRecord(dal.NewRecord(1).Set(`b`, 2).Set(`c`, 3)))
+	assert.False(f.MatchesRecord(dal.NewRecord(1).Set(`b`, 2).Set(`c`, 4)))
+}
+
+func TestFilterMatchesRecordFulltext(t *testing.T) {
+	assert := require.New(t)
+	record := dal.NewRecord(1).Set(`body`, `The quick brown fox jumps over the lazy dog.`)
+
+	assert.True(MustParse(`body/fulltext:quick fox`).MatchesRecord(record))
+	assert.True(MustParse(`body/fulltext:LAZY`).MatchesRecord(record))
+	assert.True(MustParse(`body/fulltext:cat|dog`).MatchesRecord(record))
+	assert.False(MustParse(`body/fulltext:quick cat`).MatchesRecord(record))
+	assert.False(MustParse(`body/fulltext:fo`).MatchesRecord(record))
+	assert.False(MustParse(`title/fulltext:fox`).MatchesRecord(record))
+
+	f := MustParse(`body/fulltext:fox`)
+	assert.True(f.UsesFulltext())
+	assert.False(MustParse(`body/contains:fox`).UsesFulltext())
+	assert.Zero(f.Score(dal.NewRecord(2).Set(`body`, `a dog`)))
+
+	// shorter texts with the same matches are more relevant
+	assert.Greater(f.Score(dal.NewRecord(2).Set(`body`, `a fox`)), f.Score(record))
+	assert.Greater(f.Score(dal.NewRecord(2).Set(`body`, `fox fox jumps over the lazy dog`)), f.Score(record))
+
+	assert.Equal([]string{`the`, `quick`, `brown`, `fox`, `42`}, Tokenize(`The  quick-brown "fox", 42!`))
+}
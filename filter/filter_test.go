@@ -266,3 +266,280 @@ func TestFilterParsePtrToStruct(t *testing.T) {
 	assert.False(ok)
 	assert.Nil(values)
 }
+
+func TestFilterParseGroups(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := Parse(`status/active/or(/age/gt:30/vip/true/)`)
+	assert.Nil(err)
+	assert.Equal(2, len(f.Criteria))
+	assert.Equal(`status`, f.Criteria[0].Field)
+	assert.False(f.Criteria[0].IsGroup())
+
+	group := f.Criteria[1]
+	assert.True(group.IsGroup())
+	assert.Equal(OrConjunction, group.Conjunction)
+	assert.Equal(2, len(group.Criteria))
+	assert.Equal(`age`, group.Criteria[0].Field)
+	assert.Equal(`gt`, group.Criteria[0].Operator)
+	assert.Equal(`vip`, group.Criteria[1].Field)
+
+	assert.Equal(`auto:status/active/or(/auto:age/gt:30/auto:vip/true/)`, f.String())
+
+	// groups can be nested
+	f, err = Parse(`or(/a/1/and(/b/2/c/3/)/)`)
+	assert.Nil(err)
+	assert.Equal(1, len(f.Criteria))
+	assert.Equal(2, len(f.Criteria[0].Criteria))
+	assert.Equal(AndConjunction, f.Criteria[0].Criteria[1].Conjunction)
+	assert.Equal(`or(/auto:a/1/(/auto:b/2/auto:c/3/)/)`, f.String())
+
+	roundtrip, err := Parse(f.String())
+	assert.Nil(err)
+	assert.Equal(f.Criteria, roundtrip.Criteria)
+
+	_, err = Parse(`a/1/or(/b/2`)
+	assert.Error(err)
+
+	_, err = Parse(`a/1/)`)
+	assert.Error(err)
+
+	_, err = Parse(`a/1/or(/)`)
+	assert.Error(err)
+}
+
+func TestFilterGroupsFromMap(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := FromMap(map[string]interface{}{
+		`status`: `active`,
+		`$or`: []map[string]interface{}{
+			{`int:age`: `gt:30`},
+			{`vip`: true, `plan`: `gold`},
+		},
+	})
+
+	assert.Nil(err)
+	assert.Equal(2, len(f.Criteria))
+
+	group := f.Criteria[0]
+	assert.True(group.IsGroup())
+	assert.Equal(OrConjunction, group.Conjunction)
+	assert.Equal(2, len(group.Criteria))
+	assert.Equal(`age`, group.Criteria[0].Field)
+	assert.True(group.Criteria[1].IsGroup())
+	assert.Equal(AndConjunction, group.Criteria[1].Conjunction)
+
+	assert.Equal(`status`, f.Criteria[1].Field)
+}
+
+func TestFilterFromJSON(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := FromJSON([]byte(`{
+		"conjunction": "or",
+		"criteria": [
+			{"field": "status", "values": ["active"]},
+			{"conjunction": "and", "criteria": [
+				{"field": "age", "operator": "gte", "values": [30]},
+				{"field": "vip", "values": [true]}
+			]}
+		]
+	}`))
+
+	assert.Nil(err)
+	assert.Equal(OrConjunction, f.Conjunction)
+	assert.Equal(2, len(f.Criteria))
+	assert.Equal(`status`, f.Criteria[0].Field)
+	assert.True(f.Criteria[1].IsGroup())
+	assert.Equal(AndConjunction, f.Criteria[1].Conjunction)
+	assert.Equal(`gte`, f.Criteria[1].Criteria[0].Operator)
+
+	f, err = Parse(`{"criteria": [{"field": "name", "values": ["test"]}]}`)
+	assert.Nil(err)
+	assert.Equal(1, len(f.Criteria))
+	assert.Equal(`name`, f.Criteria[0].Field)
+
+	_, err = FromJSON([]byte(`{"conjunction": "xor"}`))
+	assert.Error(err)
+}
+
+func TestFilterGroupHelpers(t *testing.T) {
+	assert := require.New(t)
+
+	orFilter, err := FromJSON([]byte(`{
+		"conjunction": "or",
+		"criteria": [
+			{"field": "id", "values": [1]},
+			{"field": "name", "values": ["test"]}
+		]
+	}`))
+	assert.Nil(err)
+
+	orGroup, err := Parse(`or(/id/1/name/test/)`)
+	assert.Nil(err)
+
+	andGroup, err := Parse(`and(/id/1/name/test/)/age/42`)
+	assert.Nil(err)
+
+	// fields are listed whether or not they're in a group
+	assert.Equal([]string{`id`, `name`}, orFilter.CriteriaFields())
+	assert.Equal([]string{`id`, `name`}, orGroup.CriteriaFields())
+	assert.Equal([]string{`id`, `name`, `age`}, andGroup.CriteriaFields())
+
+	// values aren't required by filters that OR their criteria together...
+	for _, f := range []*Filter{orFilter, orGroup} {
+		_, ok := f.GetIdentityValue()
+		assert.False(ok, f.String())
+
+		_, ok = f.GetFirstValue()
+		assert.False(ok, f.String())
+
+		_, ok = f.GetValues(`name`)
+		assert.False(ok, f.String())
+	}
+
+	// ...but are by those that AND them
+	id, ok := andGroup.GetIdentityValue()
+	assert.True(ok)
+	assert.Equal(`1`, id)
+
+	first, ok := andGroup.GetFirstValue()
+	assert.True(ok)
+	assert.Equal(`1`, first)
+
+	values, ok := andGroup.GetValues(`name`)
+	assert.True(ok)
+	assert.Equal([]interface{}{`test`}, values)
+
+	values, ok = andGroup.GetValues(`age`)
+	assert.True(ok)
+	assert.Equal([]interface{}{`42`}, values)
+
+	// deriving a filter keeps the OR conjunction, and requires the new criteria as well
+	for _, derived := range []func() (*Filter, error){
+		func() (*Filter, error) {
+			return orFilter.NewFromSpec(`age/42`)
+		},
+		func() (*Filter, error) {
+			return orFilter.NewFromMap(map[string]interface{}{
+				`age`: 42,
+			})
+		},
+	} {
+		f, err := derived()
+		assert.Nil(err)
+		assert.Equal(2, len(f.Criteria))
+		assert.True(f.Criteria[0].IsGroup())
+		assert.Equal(OrConjunction, f.Criteria[0].Conjunction)
+		assert.Equal([]string{`id`, `name`, `age`}, f.CriteriaFields())
+
+		_, ok := f.GetIdentityValue()
+		assert.False(ok)
+	}
+}
+
+func TestFilterCursor(t *testing.T) {
+	assert := require.New(t)
+
+	f := MustParse(`all`)
+	f.Sort = []string{`-age`}
+	assert.False(f.UsesCursor())
+	assert.Equal([]SortBy{
+		{Field: `age`, Descending: true},
+		{Field: `id`},
+	}, f.CursorSort())
+
+	f.Cursor = CursorStart
+	assert.True(f.UsesCursor())
+
+	values, err := f.CursorValues()
+	assert.NoError(err)
+	assert.Nil(values)
+
+	cursor, err := f.CursorFor(dal.NewRecord(int64(9007199254740993)).Set(`age`, 42))
+	assert.NoError(err)
+
+	f.Cursor = cursor
+	values, err = f.CursorValues()
+	assert.NoError(err)
+	assert.Equal([]interface{}{int64(42), int64(9007199254740993)}, values)
+
+	// cursors must have one value per sort field
+	f.Sort = nil
+	_, err = f.CursorValues()
+	assert.Error(err)
+
+	f.Cursor = `not a cursor`
+	_, err = f.CursorValues()
+	assert.Error(err)
+}
+
+func TestParseAggregate(t *testing.T) {
+	assert := require.New(t)
+
+	for spec, expected := range map[string]Aggregate{
+		`avg:age`: {
+			Aggregation: Average,
+			Field:       `age`,
+		},
+		`total=sum:amount`: {
+			Aggregation: Sum,
+			Field:       `amount`,
+			Name:        `total`,
+		},
+		`count`: {
+			Aggregation: Count,
+			Field:       `id`,
+			Name:        `count`,
+		},
+		`MAX:age`: {
+			Aggregation: Maximum,
+			Field:       `age`,
+		},
+		`uniques=count_distinct:email`: {
+			Aggregation: CountDistinct,
+			Field:       `email`,
+			Name:        `uniques`,
+		},
+		`p99.9:latency`: {
+			Aggregation: Percentile,
+			Field:       `latency`,
+			Percentile:  99.9,
+		},
+		`median:latency`: {
+			Aggregation: Median,
+			Field:       `latency`,
+		},
+		`stddev:latency`: {
+			Aggregation: StdDev,
+			Field:       `latency`,
+		},
+	} {
+		aggregate, err := ParseAggregate(spec)
+		assert.NoError(err, spec)
+		assert.Equal(expected, aggregate, spec)
+
+		reparsed, err := ParseAggregate(aggregate.String())
+		assert.NoError(err, spec)
+		assert.Equal(aggregate, reparsed, spec)
+	}
+
+	assert.Equal(`total`, Aggregate{Field: `amount`, Name: `total`}.ResultName())
+	assert.Equal(`amount`, Aggregate{Field: `amount`}.ResultName())
+
+	_, err := ParseAggregate(`sum`)
+	assert.Error(err)
+
+	_, err = ParseAggregate(`mode:age`)
+	assert.Error(err)
+
+	_, err = ParseAggregate(`p101:age`)
+	assert.Error(err)
+
+	_, err = ParseAggregate(`percentile:age`)
+	assert.Error(err)
+
+	assert.Equal(0.95, Aggregate{Aggregation: Percentile, Percentile: 95}.Quantile())
+	assert.Equal(0.5, Aggregate{Aggregation: Median}.Quantile())
+}
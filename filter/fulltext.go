@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/PerformLine/go-stockutil/typeutil"
+	"github.com/PerformLine/pivot/v3/dal"
+)
+
+// The name of the field that full-text relevance scores are exposed as on records returned from
+// queries containing fulltext criteria.  Results can be sorted by this field (e.g.: "-_score").
+var ScoreField = `_score`
+
+// The operator used to perform full-text searches against a field.
+var FulltextOperator = `fulltext`
+
+// Splits the given text into lowercase terms for the purpose of performing full-text matches.
+func Tokenize(in string) []string {
+	return strings.FieldsFunc(strings.ToLower(in), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Returns a relevance score describing how well the given text matches the terms in the given
+// query.  All query terms must appear in the text, otherwise the score is zero.
+func FulltextScore(text string, query string) float64 {
+	terms := Tokenize(query)
+	tokens := Tokenize(text)
+
+	if len(terms) == 0 || len(tokens) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int)
+
+	for _, token := range tokens {
+		counts[token] += 1
+	}
+
+	var score float64
+
+	for _, term := range terms {
+		if count, ok := counts[term]; ok {
+			score += float64(count)
+		} else {
+			return 0
+		}
+	}
+
+	// favor shorter texts containing the same number of matching terms
+	return score / math.Sqrt(float64(len(tokens)))
+}
+
+// Returns whether the filter contains any fulltext criteria.
+func (self *Filter) UsesFulltext() bool {
+	return criteriaUseFulltext(self.Criteria)
+}
+
+// Returns the full-text relevance score of the given record against all of the fulltext criteria
+// in the filter.
+func (self *Filter) Score(record *dal.Record) float64 {
+	return self.scoreCriteria(record, self.Criteria)
+}
+
+func (self *Filter) scoreCriteria(record *dal.Record, criteria []Criterion) float64 {
+	var score float64
+
+	for _, criterion := range criteria {
+		if criterion.IsGroup() {
+			score += self.scoreCriteria(record, criterion.Criteria)
+		} else if criterion.Operator == FulltextOperator {
+			score += criterionScore(record, criterion)
+		}
+	}
+
+	return score
+}
+
+// returns the best score of any of the criterion's values against the given record.
+func criterionScore(record *dal.Record, criterion Criterion) float64 {
+	var best float64
+
+	if record == nil {
+		return 0
+	}
+
+	text := typeutil.String(record.Get(criterion.Field))
+
+	for _, vI := range criterion.Values {
+		if score := FulltextScore(text, typeutil.String(vI)); score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+func criteriaUseFulltext(criteria []Criterion) bool {
+	for _, criterion := range criteria {
+		if criterion.IsGroup() {
+			if criteriaUseFulltext(criterion.Criteria) {
+				return true
+			}
+		} else if criterion.Operator == FulltextOperator {
+			return true
+		}
+	}
+
+	return false
+}
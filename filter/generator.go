@@ -46,9 +46,7 @@ func Render(generator IGenerator, collectionName string, filter *Filter) ([]byte
 
 	//  add criteria
 	for _, criterion := range filter.Criteria {
-		if filter.IdentityField != `` && criterion.Field == `id` {
-			criterion.Field = filter.IdentityField
-		}
+		criterion = withIdentityField(criterion, filter.IdentityField)
 
 		if err := generator.WithCriterion(criterion); err != nil {
 			return nil, err
@@ -64,6 +62,28 @@ func Render(generator IGenerator, collectionName string, filter *Filter) ([]byte
 	return generator.Payload(), nil
 }
 
+// replaces references to the `id` field with the filter's identity field, including those
+// within any nested criteria groups.
+func withIdentityField(criterion Criterion, identityField string) Criterion {
+	if identityField == `` {
+		return criterion
+	}
+
+	if criterion.IsGroup() {
+		children := make([]Criterion, len(criterion.Criteria))
+
+		for i, child := range criterion.Criteria {
+			children[i] = withIdentityField(child, identityField)
+		}
+
+		criterion.Criteria = children
+	} else if criterion.Field == `id` {
+		criterion.Field = identityField
+	}
+
+	return criterion
+}
+
 func (self *Generator) Set(data []byte) {
 	self.payload = data
 }
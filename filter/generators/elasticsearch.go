@@ -68,7 +68,19 @@ func (self *Elasticsearch) Finalize(flt *filter.Filter) error {
 	payload := map[string]interface{}{
 		`query`: query,
 		`size`:  flt.Limit,
-		`from`:  flt.Offset,
+	}
+
+	// cursor pagination uses search_after instead of an offset
+	if flt.UsesCursor() {
+		if values, err := flt.CursorValues(); err == nil {
+			if values != nil {
+				payload[`search_after`] = values
+			}
+		} else {
+			return err
+		}
+	} else {
+		payload[`from`] = flt.Offset
 	}
 
 	if len(flt.Fields) > 0 {
@@ -81,7 +93,24 @@ func (self *Elasticsearch) Finalize(flt *filter.Filter) error {
 		}
 	}
 
-	if len(flt.Sort) > 0 {
+	if flt.UsesCursor() {
+		// search_after requires a total ordering, so the identity field is always included
+		sorts := make([]interface{}, 0)
+
+		for _, sort := range flt.CursorSort() {
+			direction := `asc`
+
+			if sort.Descending {
+				direction = `desc`
+			}
+
+			sorts = append(sorts, map[string]interface{}{
+				sort.Field: direction,
+			})
+		}
+
+		payload[`sort`] = sorts
+	} else if len(flt.Sort) > 0 {
 		sorts := make([]interface{}, 0)
 
 		for _, sort := range flt.Sort {
@@ -139,9 +168,42 @@ func (self *Elasticsearch) GetValues() []interface{} {
 }
 
 func (self *Elasticsearch) WithCriterion(criterion filter.Criterion) error {
+	if c, err := self.criterionToMap(criterion); err == nil {
+		self.criteria = append(self.criteria, c)
+	} else {
+		return err
+	}
+
+	return nil
+}
+
+func (self *Elasticsearch) criterionToMap(criterion filter.Criterion) (map[string]interface{}, error) {
 	var c map[string]interface{}
 	var err error
 
+	if criterion.IsGroup() {
+		conjunction := `must`
+		children := make([]map[string]interface{}, 0)
+
+		if criterion.Conjunction == filter.OrConjunction {
+			conjunction = `should`
+		}
+
+		for _, child := range criterion.Criteria {
+			if cc, err := self.criterionToMap(child); err == nil {
+				children = append(children, cc)
+			} else {
+				return nil, err
+			}
+		}
+
+		return map[string]interface{}{
+			`bool`: map[string]interface{}{
+				conjunction: children,
+			},
+		}, nil
+	}
+
 	switch criterion.Operator {
 	case `is`, ``, `like`:
 		c, err = esCriterionOperatorIs(self, criterion)
@@ -156,14 +218,8 @@ func (self *Elasticsearch) WithCriterion(criterion filter.Criterion) error {
 	case `range`:
 		c, err = esCriterionOperatorPivotRange(self, criterion)
 	default:
-		return fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
+		return nil, fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
 	}
 
-	if err != nil {
-		return err
-	} else {
-		self.criteria = append(self.criteria, c)
-	}
-
-	return nil
+	return c, err
 }
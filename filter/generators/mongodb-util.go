@@ -3,8 +3,11 @@ package generators
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
+	"github.com/PerformLine/go-stockutil/sliceutil"
 	"github.com/PerformLine/go-stockutil/stringutil"
+	"github.com/PerformLine/go-stockutil/typeutil"
 	"github.com/PerformLine/pivot/v3/filter"
 )
 
@@ -139,6 +142,37 @@ func mongoCriterionOperatorPattern(gen *MongoDB, opname string, criterion filter
 	return c, nil
 }
 
+// MongoDB text searches are performed against the collection's text index, which covers all of the
+// fields it was created with, so the criterion field isn't part of the query.
+func mongoCriterionOperatorFulltext(gen *MongoDB, criterion filter.Criterion) (map[string]interface{}, error) {
+	var search string
+
+	switch len(criterion.Values) {
+	case 0:
+		return nil, fmt.Errorf("The fulltext criterion must have at least one value")
+	case 1:
+		// quoting each term requires all of them to be present
+		terms := filter.Tokenize(typeutil.String(criterion.Values[0]))
+
+		for i, term := range terms {
+			terms[i] = `"` + term + `"`
+		}
+
+		search = strings.Join(terms, ` `)
+	default:
+		// unquoted terms match documents containing any of them
+		search = strings.Join(sliceutil.Stringify(criterion.Values), ` `)
+	}
+
+	gen.values = append(gen.values, search)
+
+	return map[string]interface{}{
+		`$text`: map[string]interface{}{
+			`$search`: search,
+		},
+	}, nil
+}
+
 func mongoCriterionOperatorRange(gen *MongoDB, criterion filter.Criterion, operator string) (map[string]interface{}, error) {
 	c := make(map[string]interface{})
 
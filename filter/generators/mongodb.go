@@ -107,9 +107,40 @@ func (self *MongoDB) GetValues() []interface{} {
 }
 
 func (self *MongoDB) WithCriterion(criterion filter.Criterion) error {
+	if c, err := self.criterionToMap(criterion); err == nil {
+		self.criteria = append(self.criteria, c)
+	} else {
+		return err
+	}
+
+	return nil
+}
+
+func (self *MongoDB) criterionToMap(criterion filter.Criterion) (map[string]interface{}, error) {
 	var c map[string]interface{}
 	var err error
 
+	if criterion.IsGroup() {
+		conjunction := `$and`
+		children := make([]map[string]interface{}, 0)
+
+		if criterion.Conjunction == filter.OrConjunction {
+			conjunction = `$or`
+		}
+
+		for _, child := range criterion.Criteria {
+			if cc, err := self.criterionToMap(child); err == nil {
+				children = append(children, cc)
+			} else {
+				return nil, err
+			}
+		}
+
+		return map[string]interface{}{
+			conjunction: children,
+		}, nil
+	}
+
 	if criterion.Field == `id` {
 		criterion.Field = `_id`
 	}
@@ -130,15 +161,11 @@ func (self *MongoDB) WithCriterion(criterion filter.Criterion) error {
 		c, err = mongoCriterionOperatorPattern(self, criterion.Operator, criterion)
 	case `gt`, `gte`, `lt`, `lte`, `range`:
 		c, err = mongoCriterionOperatorRange(self, criterion, criterion.Operator)
+	case `fulltext`:
+		c, err = mongoCriterionOperatorFulltext(self, criterion)
 	default:
-		return fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
-	}
-
-	if err != nil {
-		return err
-	} else {
-		self.criteria = append(self.criteria, c)
+		return nil, fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
 	}
 
-	return nil
+	return c, err
 }
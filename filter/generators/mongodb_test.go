@@ -197,6 +197,42 @@ func TestMongodb(t *testing.T) {
 			},
 			values: []interface{}{int64(7), `ted`},
 		},
+		`age/7/or(/name/ted/name/bob/)`: {
+			query: map[string]interface{}{
+				`$and`: []interface{}{
+					map[string]interface{}{
+						`age`: float64(7),
+					},
+					map[string]interface{}{
+						`$or`: []interface{}{
+							map[string]interface{}{
+								`name`: `ted`,
+							},
+							map[string]interface{}{
+								`name`: `bob`,
+							},
+						},
+					},
+				},
+			},
+			values: []interface{}{int64(7), `ted`, `bob`},
+		},
+		`body/fulltext:quick fox`: {
+			query: map[string]interface{}{
+				`$text`: map[string]interface{}{
+					`$search`: `"quick" "fox"`,
+				},
+			},
+			values: []interface{}{`"quick" "fox"`},
+		},
+		`body/fulltext:cat|dog`: {
+			query: map[string]interface{}{
+				`$text`: map[string]interface{}{
+					`$search`: `cat dog`,
+				},
+			},
+			values: []interface{}{`cat dog`},
+		},
 	}
 
 	for spec, expected := range tests {
@@ -33,6 +33,20 @@ type SqlObjectTypeEncodeFunc func(in interface{}) ([]byte, error)
 type SqlObjectTypeDecodeFunc func(in []byte, out interface{}) error
 type SqlArrayTypeEncodeFunc func(in interface{}) ([]byte, error)
 type SqlArrayTypeDecodeFunc func(in []byte, out interface{}) error
+type SqlNestedFieldFunc func(column string, path []string, cast dal.Type) string
+type SqlArrayContainsFunc func(field string, placeholder string, value interface{}) (string, interface{}, error)
+
+// Full-text functions receive the unformatted table name and the formatted field name, and return
+// the expression along with the value to bind to its placeholder.
+type SqlFulltextFunc func(table string, field string, placeholder string, query string) (string, interface{})
+
+// Aggregate functions receive the formatted field name, and return the expression that calculates
+// the aggregate (or false if the dialect cannot calculate it).
+type SqlAggregateFunc func(aggregate filter.Aggregate, field string) (string, bool)
+
+// Upsert functions receive the formatted names of the fields that identify an existing row and of
+// the fields to update in it, and return the clause that turns an INSERT statement into an upsert.
+type SqlUpsertFunc func(conflictFields []string, updateFields []string) string
 
 var SqlJsonTypeEncoder = func(in interface{}) ([]byte, error) {
 	var buf bytes.Buffer
@@ -53,6 +67,7 @@ const (
 	SqlInsertStatement
 	SqlUpdateStatement
 	SqlDeleteStatement
+	SqlUpsertStatement
 )
 
 type SqlTypeMapping struct {
@@ -82,6 +97,13 @@ type SqlTypeMapping struct {
 	ObjectTypeDecodeFunc  SqlObjectTypeDecodeFunc // function used for decoding objects from native into a destination map
 	ArrayTypeEncodeFunc   SqlArrayTypeEncodeFunc  // function used for encoding arrays to a native representation
 	ArrayTypeDecodeFunc   SqlArrayTypeDecodeFunc  // function used for decoding arrays from native into a destination map
+	NestedFieldFunc       SqlNestedFieldFunc      // function used to build expressions addressing nested map keys. supercedes NestedFieldNameFormat
+	ArrayContainsFunc     SqlArrayContainsFunc    // function used to build expressions testing whether an array field contains a value
+	FulltextFunc          SqlFulltextFunc         // function used to build full-text match expressions. if not set, terms are matched using LIKE
+	FulltextScoreFunc     SqlFulltextFunc         // function used to build expressions returning the relevance of a full-text match (higher is more relevant)
+	AggregateFunc         SqlAggregateFunc        // function used to build statistical aggregates (percentiles, standard deviation, variance). if not set, they are unsupported
+	UpsertFunc            SqlUpsertFunc           // function used to build the clause that updates rows an INSERT conflicts with. if not set, upserts are unsupported
+	RowValues             bool                    // whether row values can be compared, e.g.: (a, b) IN ((1, 2), (3, 4))
 }
 
 func (self SqlTypeMapping) String() string {
@@ -151,6 +173,9 @@ var MysqlTypeMapping = SqlTypeMapping{
 	FieldNameFormat:      "`%s`",
 	NestedFieldSeparator: `.`,
 	NestedFieldJoiner:    `.`,
+	AggregateFunc:        MysqlAggregate,
+	UpsertFunc:           MysqlUpsert,
+	RowValues:            true,
 }
 
 var PostgresTypeMapping = SqlTypeMapping{
@@ -169,18 +194,22 @@ var PostgresTypeMapping = SqlTypeMapping{
 	FieldNameFormat:      "%q",
 	NestedFieldSeparator: `.`,
 	NestedFieldJoiner:    `.`,
+	FulltextFunc:         PostgresFulltextMatch,
+	FulltextScoreFunc:    PostgresFulltextScore,
+	AggregateFunc:        PostgresAggregate,
+	UpsertFunc:           OnConflictUpsert,
+	RowValues:            true,
 }
 
 var PostgresJsonTypeMapping = SqlTypeMapping{
-	Name:         `postgres-json`,
-	StringType:   `TEXT`,
-	IntegerType:  `BIGINT`,
-	FloatType:    `NUMERIC`,
-	BooleanType:  `BOOLEAN`,
-	DateTimeType: `TIMESTAMP`,
-	// ObjectType:   `JSONB`, // TODO: implement the JSONB functionality in PostgreSQL 9.2+
-	ObjectType:           `VARCHAR`,
-	ArrayType:            `VARCHAR`,
+	Name:                 `postgres-json`,
+	StringType:           `TEXT`,
+	IntegerType:          `BIGINT`,
+	FloatType:            `NUMERIC`,
+	BooleanType:          `BOOLEAN`,
+	DateTimeType:         `TIMESTAMP`,
+	ObjectType:           `JSONB`,
+	ArrayType:            `JSONB`,
 	RawType:              `BYTEA`,
 	PlaceholderFormat:    `$%d`,
 	PlaceholderArgument:  `index1`,
@@ -188,6 +217,13 @@ var PostgresJsonTypeMapping = SqlTypeMapping{
 	FieldNameFormat:      "%q",
 	NestedFieldSeparator: `.`,
 	NestedFieldJoiner:    `.`,
+	NestedFieldFunc:      PostgresJsonPath,
+	ArrayContainsFunc:    PostgresJsonArrayContains,
+	FulltextFunc:         PostgresFulltextMatch,
+	FulltextScoreFunc:    PostgresFulltextScore,
+	AggregateFunc:        PostgresAggregate,
+	UpsertFunc:           OnConflictUpsert,
+	RowValues:            true,
 }
 
 var SqliteTypeMapping = SqlTypeMapping{
@@ -207,10 +243,184 @@ var SqliteTypeMapping = SqlTypeMapping{
 	FieldNameFormat:      "%q",
 	NestedFieldSeparator: `.`,
 	NestedFieldJoiner:    `.`,
+	NestedFieldFunc:      SqliteJsonPath,
+	ArrayContainsFunc:    SqliteJsonArrayContains,
+	UpsertFunc:           OnConflictUpsert,
+	RowValues:            true,
 }
 
 var DefaultSqlTypeMapping = GenericTypeMapping
 
+// Addresses nested keys in a PostgreSQL JSONB column using the -> and ->> operators, casting
+// the extracted text to the given type so that it can be compared against typed values.
+func PostgresJsonPath(column string, path []string, cast dal.Type) string {
+	expr := column
+
+	for i, key := range path {
+		if i < len(path)-1 {
+			expr += `->`
+		} else {
+			expr += `->>`
+		}
+
+		expr += `'` + strings.Replace(key, `'`, `''`, -1) + `'`
+	}
+
+	switch cast {
+	case dal.IntType:
+		return fmt.Sprintf("(%s)::bigint", expr)
+	case dal.FloatType:
+		return fmt.Sprintf("(%s)::numeric", expr)
+	case dal.BooleanType:
+		return fmt.Sprintf("(%s)::boolean", expr)
+	case dal.TimeType:
+		return fmt.Sprintf("(%s)::timestamp", expr)
+	default:
+		return expr
+	}
+}
+
+// Tests whether a PostgreSQL JSONB array contains the given value using the @> operator.
+func PostgresJsonArrayContains(field string, placeholder string, value interface{}) (string, interface{}, error) {
+	if data, err := json.Marshal([]interface{}{value}); err == nil {
+		return fmt.Sprintf("%s @> %s::jsonb", field, placeholder), string(data), nil
+	} else {
+		return ``, nil, err
+	}
+}
+
+// Addresses nested keys in a SQLite column containing JSON using the JSON1 json_extract function.
+// Values extracted this way retain their JSON types, so no cast is necessary.
+func SqliteJsonPath(column string, path []string, _ dal.Type) string {
+	keys := make([]string, len(path))
+
+	for i, key := range path {
+		keys[i] = `"` + strings.Replace(key, `'`, `''`, -1) + `"`
+	}
+
+	return fmt.Sprintf("json_extract(CAST(%s AS TEXT), '$.%s')", column, strings.Join(keys, `.`))
+}
+
+// Tests whether a SQLite column containing a JSON array contains the given value using the
+// JSON1 json_each table-valued function.
+func SqliteJsonArrayContains(field string, placeholder string, value interface{}) (string, interface{}, error) {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(CAST(%s AS TEXT)) WHERE json_each.value = %s)", field, placeholder), value, nil
+}
+
+// The format string used to name the SQLite FTS5 table containing the full-text index for a table.
+var SqliteFulltextTableFormat = `%s__fulltext`
+
+// Performs full-text matches in PostgreSQL using the database's default text search configuration.
+func PostgresFulltextMatch(_ string, field string, placeholder string, query string) (string, interface{}) {
+	return fmt.Sprintf("to_tsvector(%s) @@ plainto_tsquery(%s)", field, placeholder), query
+}
+
+// Ranks PostgreSQL full-text matches using ts_rank.
+func PostgresFulltextScore(_ string, field string, placeholder string, query string) (string, interface{}) {
+	return fmt.Sprintf("ts_rank(to_tsvector(%s), plainto_tsquery(%s))", field, placeholder), query
+}
+
+// Calculates percentiles with percentile_cont, and the population standard deviation and variance.
+func PostgresAggregate(aggregate filter.Aggregate, field string) (string, bool) {
+	switch aggregate.Aggregation {
+	case filter.Percentile, filter.Median:
+		return fmt.Sprintf("percentile_cont(%v) WITHIN GROUP (ORDER BY %s)", aggregate.Quantile(), field), true
+	case filter.StdDev:
+		return fmt.Sprintf("stddev_pop(%s)", field), true
+	case filter.Variance:
+		return fmt.Sprintf("var_pop(%s)", field), true
+	default:
+		return ``, false
+	}
+}
+
+// Calculates the population standard deviation and variance.  MySQL has no percentile functions.
+func MysqlAggregate(aggregate filter.Aggregate, field string) (string, bool) {
+	switch aggregate.Aggregation {
+	case filter.StdDev:
+		return fmt.Sprintf("STDDEV_POP(%s)", field), true
+	case filter.Variance:
+		return fmt.Sprintf("VAR_POP(%s)", field), true
+	default:
+		return ``, false
+	}
+}
+
+// Updates rows conflicting with the given fields using ON CONFLICT, which PostgreSQL and SQLite
+// (3.24+) both support.  The conflicting fields must be covered by a primary key or unique index.
+func OnConflictUpsert(conflictFields []string, updateFields []string) string {
+	clause := fmt.Sprintf("ON CONFLICT (%s) ", strings.Join(conflictFields, `, `))
+
+	if len(updateFields) == 0 {
+		return clause + `DO NOTHING`
+	}
+
+	pairs := make([]string, len(updateFields))
+
+	for i, field := range updateFields {
+		pairs[i] = fmt.Sprintf("%s = excluded.%s", field, field)
+	}
+
+	return clause + `DO UPDATE SET ` + strings.Join(pairs, `, `)
+}
+
+// Updates rows conflicting with any primary key or unique index using ON DUPLICATE KEY UPDATE.
+// MySQL cannot be told which of those to check, so the conflicting fields only matter when there
+// is nothing else to update.
+func MysqlUpsert(conflictFields []string, updateFields []string) string {
+	// an update is required, so a row that only consists of its keys is "updated" to itself
+	if len(updateFields) == 0 {
+		updateFields = conflictFields[:1]
+	}
+
+	pairs := make([]string, len(updateFields))
+
+	for i, field := range updateFields {
+		pairs[i] = fmt.Sprintf("%s = VALUES(%s)", field, field)
+	}
+
+	return `ON DUPLICATE KEY UPDATE ` + strings.Join(pairs, `, `)
+}
+
+// Performs full-text matches in SQLite against the FTS5 table maintained alongside the given table.
+func SqliteFulltextMatch(table string, field string, placeholder string, query string) (string, interface{}) {
+	return fmt.Sprintf(
+		"%q.rowid IN (SELECT rowid FROM %q WHERE %s MATCH %s)",
+		table,
+		fmt.Sprintf(SqliteFulltextTableFormat, table),
+		field,
+		placeholder,
+	), sqliteFulltextQuery(query)
+}
+
+// Ranks SQLite full-text matches using the FTS5 bm25 function (which returns more relevant
+// matches as lower values, so it is inverted here.)
+func SqliteFulltextScore(table string, field string, placeholder string, query string) (string, interface{}) {
+	fts := fmt.Sprintf(SqliteFulltextTableFormat, table)
+
+	return fmt.Sprintf(
+		"COALESCE((SELECT -bm25(%q) FROM %q WHERE %q.rowid = %q.rowid AND %s MATCH %s), 0)",
+		fts,
+		fts,
+		fts,
+		table,
+		field,
+		placeholder,
+	), sqliteFulltextQuery(query)
+}
+
+// quotes each term in the given query so that it is matched literally rather than being
+// interpreted as FTS5 query syntax.
+func sqliteFulltextQuery(query string) string {
+	terms := strings.Fields(query)
+
+	for i, term := range terms {
+		terms[i] = `"` + strings.Replace(term, `"`, `""`, -1) + `"`
+	}
+
+	return strings.Join(terms, ` `)
+}
+
 func GetSqlTypeMapping(name string) (SqlTypeMapping, error) {
 	switch name {
 	case `postgresql`, `pgsql`:
@@ -234,6 +444,7 @@ type Sql struct {
 	filter.Generator
 	FieldWrappers    map[string]string      // map of field name-format strings to wrap specific fields in after FieldNameFormat is applied
 	NormalizeFields  []string               // a list of field names that should have the NormalizerFormat applied to them and their corresponding values
+	ArrayFields      []string               // a list of field names containing arrays, which are tested for containment (if supported by the TypeMapping)
 	NormalizerFormat string                 // format string used to wrap fields and value clauses for the purpose of doing fuzzy searches
 	UseInStatement   bool                   // whether multiple values in a criterion should be tested using an IN() statement
 	Distinct         bool                   // whether a DISTINCT clause should be used in SELECT statements
@@ -241,14 +452,21 @@ type Sql struct {
 	TypeMapping      SqlTypeMapping         // provides mapping information between DAL types and native SQL types
 	Type             SqlStatementType       // what type of SQL statement is being generated
 	InputData        map[string]interface{} // key-value data for statement types that require input data (e.g.: inserts, updates)
+	ConflictFields   []string               // for upserts, the fields that identify an existing row to update instead of inserting a new one
 	collection       string
+	collectionName   string
 	fields           []string
 	criteria         []string
 	inputValues      []interface{}
+	scoreValues      []interface{}
 	values           []interface{}
+	fulltext         []filter.Criterion
 	groupBy          []string
 	aggregateBy      []filter.Aggregate
+	having           *filter.Filter
+	aggregateFields  map[string]string
 	conjunction      filter.ConjunctionType
+	keyset           string
 	placeholderIndex int
 }
 
@@ -269,11 +487,15 @@ func (self *Sql) Initialize(collectionName string) error {
 	self.Reset()
 	self.placeholderIndex = 0
 	self.collection = self.ToTableName(collectionName)
+	self.collectionName = collectionName
 	self.fields = make([]string, 0)
 	self.criteria = make([]string, 0)
 	self.inputValues = make([]interface{}, 0)
+	self.scoreValues = make([]interface{}, 0)
 	self.values = make([]interface{}, 0)
+	self.fulltext = make([]filter.Criterion, 0)
 	self.conjunction = filter.AndConjunction
+	self.keyset = ``
 
 	return nil
 }
@@ -307,6 +529,10 @@ func (self *Sql) Finalize(f *filter.Filter) error {
 
 			if len(self.fields) == 0 && len(self.groupBy) == 0 && len(self.aggregateBy) == 0 {
 				self.Push([]byte(`*`))
+
+				if score := self.scoreField(); score != `` {
+					self.Push([]byte(`, ` + score))
+				}
 			} else {
 				fieldNames := make([]string, 0)
 
@@ -329,9 +555,16 @@ func (self *Sql) Finalize(f *filter.Filter) error {
 
 				// add aggregation function calls
 				for _, aggpair := range self.aggregateBy {
-					fName := self.ToAggregatedFieldName(aggpair.Aggregation, aggpair.Field)
-					fName = fmt.Sprintf("%v AS "+self.TypeMapping.FieldNameFormat, fName, aggpair.Field)
-					fieldNames = append(fieldNames, fName)
+					if fName, err := self.ToAggregateExpression(aggpair); err == nil {
+						fName = fmt.Sprintf("%v AS "+self.TypeMapping.FieldNameFormat, fName, aggpair.ResultName())
+						fieldNames = append(fieldNames, fName)
+					} else {
+						return err
+					}
+				}
+
+				if score := self.scoreField(); score != `` {
+					fieldNames = append(fieldNames, score)
 				}
 
 				self.Push([]byte(strings.Join(fieldNames, `, `)))
@@ -341,15 +574,27 @@ func (self *Sql) Finalize(f *filter.Filter) error {
 		self.Push([]byte(` FROM `))
 		self.Push([]byte(self.collection))
 
+		if f != nil && f.UsesCursor() && !self.Count {
+			if keyset, err := self.keysetClause(f); err == nil {
+				self.keyset = keyset
+			} else {
+				return err
+			}
+		}
+
 		self.populateWhereClause()
 		self.populateGroupBy()
 
+		if err := self.populateHaving(); err != nil {
+			return err
+		}
+
 		if !self.Count {
 			self.populateOrderBy(f)
 			self.populateLimitOffset(f)
 		}
 
-	case SqlInsertStatement:
+	case SqlInsertStatement, SqlUpsertStatement:
 		if len(self.InputData) == 0 {
 			return fmt.Errorf("INSERT statements must specify input data")
 		}
@@ -372,6 +617,29 @@ func (self *Sql) Finalize(f *filter.Filter) error {
 
 		self.Push([]byte(strings.Join(inputValues, `, `)))
 		self.Push([]byte(`)`))
+
+		// without any conflicting fields, there is no existing row to update
+		if self.Type == SqlUpsertStatement && len(self.ConflictFields) > 0 {
+			if self.TypeMapping.UpsertFunc == nil {
+				return fmt.Errorf("upserts are not supported by the %v type mapping", self.TypeMapping)
+			}
+
+			conflictFields := make([]string, len(self.ConflictFields))
+			updateFields := make([]string, 0)
+
+			for i, f := range self.ConflictFields {
+				conflictFields[i] = self.ToFieldName(f)
+			}
+
+			for _, f := range maputil.StringKeys(self.InputData) {
+				if !sliceutil.ContainsString(self.ConflictFields, f) {
+					updateFields = append(updateFields, self.ToFieldName(f))
+				}
+			}
+
+			self.Push([]byte(` `))
+			self.Push([]byte(self.TypeMapping.UpsertFunc(conflictFields, updateFields)))
+		}
 	case SqlUpdateStatement:
 		if len(self.InputData) == 0 {
 			return fmt.Errorf("UPDATE statements must specify input data")
@@ -427,6 +695,11 @@ func (self *Sql) populateInputValues() ([]string, error) {
 }
 
 func (self *Sql) WithField(field string) error {
+	// relevance scores are selected automatically for queries containing fulltext criteria
+	if field == filter.ScoreField {
+		return nil
+	}
+
 	self.fields = append(self.fields, field)
 	return nil
 }
@@ -441,16 +714,32 @@ func (self *Sql) GroupByField(field string) error {
 }
 
 func (self *Sql) AggregateByField(agg filter.Aggregation, field string) error {
-	self.aggregateBy = append(self.aggregateBy, filter.Aggregate{
+	return self.AggregateBy(filter.Aggregate{
 		Aggregation: agg,
 		Field:       field,
 	})
+}
+
+// Same as AggregateByField, but the result is selected as the aggregate's ResultName.
+func (self *Sql) AggregateBy(aggregate filter.Aggregate) error {
+	self.aggregateBy = append(self.aggregateBy, aggregate)
+	return nil
+}
 
+// Restricts grouped results to those matching the given filter.  Criteria may refer to the fields
+// being grouped by or to the ResultName of any aggregate being calculated.
+func (self *Sql) HavingBy(f *filter.Filter) error {
+	self.having = f
 	return nil
 }
 
 func (self *Sql) GetValues() []interface{} {
-	return append(self.inputValues, self.values...)
+	values := make([]interface{}, 0, len(self.inputValues)+len(self.scoreValues)+len(self.values))
+	values = append(values, self.inputValues...)
+	values = append(values, self.scoreValues...)
+	values = append(values, self.values...)
+
+	return values
 }
 
 // Okay...so.
@@ -484,17 +773,49 @@ func (self *Sql) applyPlaceholders() {
 }
 
 func (self *Sql) WithCriterion(criterion filter.Criterion) error {
-	criterionStr := ``
-
-	if len(self.criteria) == 0 {
-		criterionStr = `WHERE (`
-	} else if self.conjunction == filter.OrConjunction {
-		criterionStr = `OR (`
+	if criterionStr, err := self.criterionToSql(criterion); err == nil {
+		self.criteria = append(self.criteria, criterionStr)
+		return nil
 	} else {
-		criterionStr = `AND (`
+		return err
+	}
+}
+
+// renders a single criterion (or a group of criteria) as a parenthesized SQL expression.
+func (self *Sql) criterionToSql(criterion filter.Criterion) (string, error) {
+	if criterion.IsGroup() {
+		if rowValues, ok := self.rowValuesToSql(criterion); ok {
+			return rowValues, nil
+		}
+
+		parts := make([]string, 0, len(criterion.Criteria))
+
+		for _, subcriterion := range criterion.Criteria {
+			if part, err := self.criterionToSql(subcriterion); err == nil {
+				parts = append(parts, part)
+			} else {
+				return ``, err
+			}
+		}
+
+		return `(` + strings.Join(parts, self.conjunctionOperator(criterion.Conjunction)) + `)`, nil
 	}
 
+	// is: and not: queries against array fields test whether the array contains the given values
+	if fn := self.TypeMapping.ArrayContainsFunc; fn != nil && sliceutil.ContainsString(self.ArrayFields, criterion.Field) {
+		switch criterion.Operator {
+		case ``, `is`, `not`:
+			return self.arrayCriterionToSql(criterion, fn)
+		}
+	}
+
+	if criterion.Operator == filter.FulltextOperator {
+		return self.fulltextCriterionToSql(criterion)
+	}
+
+	criterionStr := `(`
 	outValues := make([]string, 0)
+	cast := self.nestedFieldCast(criterion)
 
 	// whether to wrap is: and not: queries containing multiple values in an IN() group
 	// rather than producing "f = x OR f = y OR f = x ..."
@@ -526,7 +847,7 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 	// range queries are particular about the number of values
 	if criterion.Operator == `range` {
 		if len(criterion.Values) != 2 {
-			return fmt.Errorf("The 'range' operator must be given exactly two values")
+			return ``, fmt.Errorf("The 'range' operator must be given exactly two values")
 		}
 
 		if lowerValue, err := self.valueToNativeRepresentation(criterion.Type, criterion.Values[0]); err == nil {
@@ -538,17 +859,17 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 					},
 				}
 			} else {
-				return fmt.Errorf("invalid range upper bound: %v", err)
+				return ``, fmt.Errorf("invalid range upper bound: %v", err)
 			}
 		} else {
-			return fmt.Errorf("invalid range lower bound: %v", err)
+			return ``, fmt.Errorf("invalid range lower bound: %v", err)
 		}
 
 	}
 
 	if criterion.Operator == `or` {
 		if !strings.Contains(criterion.Field, filter.ValueSeparator) {
-			return fmt.Errorf("The 'or' operator must be given with two or more fields")
+			return ``, fmt.Errorf("The 'or' operator must be given with two or more fields")
 		}
 	}
 
@@ -591,7 +912,7 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 				outVal := ``
 
 				if !useInStatement && criterion.Operator != `or` {
-					outFieldName = self.ToFieldName(criterion.Field)
+					outFieldName = self.toFieldExpression(criterion.Field, cast)
 					outVal = outFieldName
 				}
 
@@ -663,7 +984,7 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 							self.ApplyNormalizer(criterion.Field, value),
 						)
 					} else {
-						return fmt.Errorf("Invalid value for 'range' operator")
+						return ``, fmt.Errorf("Invalid value for 'range' operator")
 					}
 				case `or`:
 					fields := strings.Split(criterion.Field, filter.ValueSeparator)
@@ -677,20 +998,24 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 						}
 					}
 				default:
-					return fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
+					return ``, fmt.Errorf("Unimplemented operator '%s'", criterion.Operator)
 				}
 
 				outValues = append(outValues, outVal)
 			} else {
-				return err
+				return ``, err
 			}
 		} else {
-			return err
+			return ``, err
 		}
 	}
 
 	if useInStatement {
-		criterionStr = criterionStr + self.ToFieldName(outFieldName) + ` `
+		if outFieldName == criterion.Field {
+			criterionStr = criterionStr + self.toFieldExpression(outFieldName, cast) + ` `
+		} else {
+			criterionStr = criterionStr + self.ToFieldName(outFieldName) + ` `
+		}
 
 		if criterion.Operator == `not` || criterion.Operator == `unlike` {
 			criterionStr = criterionStr + `NOT `
@@ -701,9 +1026,229 @@ func (self *Sql) WithCriterion(criterion filter.Criterion) error {
 		criterionStr = criterionStr + strings.Join(outValues, ` OR `) + `)`
 	}
 
-	self.criteria = append(self.criteria, criterionStr)
+	return criterionStr, nil
+}
 
-	return nil
+// renders an is: or not: criterion against an array field as a set of containment tests.
+func (self *Sql) arrayCriterionToSql(criterion filter.Criterion, fn SqlArrayContainsFunc) (string, error) {
+	field := self.ToFieldName(criterion.Field)
+	coerce := criterion.Type
+	parts := make([]string, 0, len(criterion.Values))
+
+	// the criterion type describes the field, but we're comparing against individual elements
+	if coerce == dal.ArrayType {
+		coerce = ``
+	}
+
+	for _, vI := range criterion.Values {
+		if typedValue, err := self.valueToNativeRepresentation(coerce, vI); err == nil {
+			var part string
+
+			if typedValue == nil {
+				if criterion.Operator == `not` {
+					part = field + ` IS NOT NULL`
+				} else {
+					part = field + ` IS NULL`
+				}
+			} else if expr, value, err := fn(field, fmt.Sprintf("\u2983%s\u2984", criterion.Field), typedValue); err == nil {
+				self.values = append(self.values, value)
+
+				if criterion.Operator == `not` {
+					part = `NOT ` + expr
+				} else {
+					part = expr
+				}
+			} else {
+				return ``, err
+			}
+
+			parts = append(parts, part)
+		} else {
+			return ``, err
+		}
+	}
+
+	if criterion.Operator == `not` {
+		return `(` + strings.Join(parts, ` AND `) + `)`, nil
+	} else {
+		return `(` + strings.Join(parts, ` OR `) + `)`, nil
+	}
+}
+
+// renders a fulltext criterion using the TypeMapping's full-text functions, or as a set of LIKE
+// statements requiring all of the terms in a value to appear in the field if those aren't available.
+func (self *Sql) fulltextCriterionToSql(criterion filter.Criterion) (string, error) {
+	field := self.ToFieldName(criterion.Field)
+	placeholder := fmt.Sprintf("\u2983%s\u2984", criterion.Field)
+	parts := make([]string, 0, len(criterion.Values))
+
+	for _, vI := range criterion.Values {
+		query := typeutil.String(vI)
+
+		if fn := self.TypeMapping.FulltextFunc; fn != nil {
+			expr, value := fn(self.collectionName, field, placeholder, query)
+			parts = append(parts, expr)
+			self.values = append(self.values, value)
+		} else if terms := filter.Tokenize(query); len(terms) > 0 {
+			likes := make([]string, len(terms))
+
+			for i, term := range terms {
+				likes[i] = self.ApplyNormalizer(criterion.Field, field) + ` LIKE ` + self.ApplyNormalizer(criterion.Field, placeholder)
+				self.values = append(self.values, `%%`+term+`%%`)
+			}
+
+			parts = append(parts, `(`+strings.Join(likes, ` AND `)+`)`)
+		}
+	}
+
+	if len(parts) == 0 {
+		return ``, fmt.Errorf("The 'fulltext' operator must be given at least one term")
+	}
+
+	self.fulltext = append(self.fulltext, criterion)
+
+	return `(` + strings.Join(parts, ` OR `) + `)`, nil
+}
+
+// returns whether a relevance score will be selected along with the results of this query.
+func (self *Sql) scoresResults() bool {
+	if self.Type != SqlSelectStatement || self.Count || self.TypeMapping.FulltextScoreFunc == nil {
+		return false
+	} else if len(self.groupBy) > 0 || len(self.aggregateBy) > 0 {
+		return false
+	}
+
+	return (len(self.fulltext) > 0)
+}
+
+// builds the expression that selects the sum of the relevance scores of all fulltext criteria in
+// this query (if any).
+func (self *Sql) scoreField() string {
+	if !self.scoresResults() {
+		return ``
+	}
+
+	scores := make([]string, 0)
+
+	for _, criterion := range self.fulltext {
+		for _, vI := range criterion.Values {
+			expr, value := self.TypeMapping.FulltextScoreFunc(
+				self.collectionName,
+				self.ToFieldName(criterion.Field),
+				fmt.Sprintf("\u2983%s\u2984", criterion.Field),
+				typeutil.String(vI),
+			)
+
+			scores = append(scores, expr)
+			self.scoreValues = append(self.scoreValues, value)
+		}
+	}
+
+	return fmt.Sprintf("%s AS "+self.TypeMapping.FieldNameFormat, strings.Join(scores, ` + `), filter.ScoreField)
+}
+
+// determines the type that values extracted from nested fields should be cast to in order to
+// be compared against the values in the given criterion.
+func (self *Sql) nestedFieldCast(criterion filter.Criterion) dal.Type {
+	switch criterion.Operator {
+	case ``, `is`, `not`, `gt`, `gte`, `lt`, `lte`, `range`:
+		if criterion.Type != `` && criterion.Type != dal.AutoType {
+			return criterion.Type
+		}
+
+		for _, vI := range criterion.Values {
+			if vI == nil || strings.ToUpper(fmt.Sprintf("%v", vI)) == `NULL` {
+				continue
+			}
+
+			switch stringutil.Autotype(vI).(type) {
+			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+				return dal.IntType
+			case float32, float64:
+				return dal.FloatType
+			case bool:
+				return dal.BooleanType
+			case time.Time:
+				return dal.TimeType
+			default:
+				return ``
+			}
+		}
+	}
+
+	return ``
+}
+
+// renders an OR group of AND groups that each match the same fields exactly (e.g.: a list of
+// composite keys) as a single row value comparison: ((a, b) IN ((1, 2), (3, 4))).  Returns false
+// if the TypeMapping doesn't support row values or the group isn't of that shape.
+func (self *Sql) rowValuesToSql(criterion filter.Criterion) (string, bool) {
+	if !self.TypeMapping.RowValues || criterion.Conjunction != filter.OrConjunction || len(criterion.Criteria) < 2 {
+		return ``, false
+	}
+
+	var fields []string
+	var values []interface{}
+
+	for _, row := range criterion.Criteria {
+		if !row.IsGroup() || row.Conjunction != filter.AndConjunction || len(row.Criteria) < 2 {
+			return ``, false
+		}
+
+		rowFields := make([]string, 0, len(row.Criteria))
+
+		for _, subcriterion := range row.Criteria {
+			if subcriterion.IsGroup() || !subcriterion.IsExactMatch() || len(subcriterion.Values) != 1 {
+				return ``, false
+			} else if sliceutil.ContainsString(self.ArrayFields, subcriterion.Field) {
+				return ``, false
+			} else if sep := self.TypeMapping.NestedFieldSeparator; sep != `` && strings.Contains(subcriterion.Field, sep) {
+				return ``, false
+			}
+
+			// NULLs never compare equal, so they can't be matched this way
+			if typedValue, err := self.valueToNativeRepresentation(subcriterion.Type, subcriterion.Values[0]); err == nil && typedValue != nil {
+				values = append(values, typedValue)
+			} else {
+				return ``, false
+			}
+
+			rowFields = append(rowFields, subcriterion.Field)
+		}
+
+		if fields == nil {
+			fields = rowFields
+		} else if !reflect.DeepEqual(fields, rowFields) {
+			return ``, false
+		}
+	}
+
+	fieldExprs := make([]string, len(fields))
+	placeholders := make([]string, len(fields))
+
+	for i, field := range fields {
+		fieldExprs[i] = self.toFieldExpression(field, ``)
+		placeholders[i] = fmt.Sprintf("\u2983%s\u2984", field)
+	}
+
+	rows := make([]string, len(criterion.Criteria))
+	tuple := `(` + strings.Join(placeholders, `, `) + `)`
+
+	for i := range rows {
+		rows[i] = tuple
+	}
+
+	self.values = append(self.values, values...)
+
+	return fmt.Sprintf("((%s) IN (%s))", strings.Join(fieldExprs, `, `), strings.Join(rows, `, `)), true
+}
+
+func (self *Sql) conjunctionOperator(conjunction filter.ConjunctionType) string {
+	if conjunction == filter.OrConjunction {
+		return ` OR `
+	} else {
+		return ` AND `
+	}
 }
 
 func (self *Sql) ToTableName(table string) string {
@@ -711,12 +1256,27 @@ func (self *Sql) ToTableName(table string) string {
 }
 
 func (self *Sql) ToFieldName(field string) string {
+	return self.toFieldExpression(field, ``)
+}
+
+// formats the given field name, casting values addressed by nested fields to the given type
+// (if the TypeMapping supports it).
+func (self *Sql) toFieldExpression(field string, cast dal.Type) string {
 	var formattedField string
 
+	// within a HAVING clause, aggregate results are referred to by the expressions that calculate them
+	if expr, ok := self.aggregateFields[field]; ok {
+		return expr
+	}
+
 	if field != `` {
-		if nestFmt := self.TypeMapping.NestedFieldNameFormat; nestFmt != `` {
-			if parts := strings.Split(field, self.TypeMapping.NestedFieldSeparator); len(parts) > 1 {
-				formattedField = fmt.Sprintf(nestFmt, parts[0], strings.Join(parts[1:], self.TypeMapping.NestedFieldJoiner))
+		if sep := self.TypeMapping.NestedFieldSeparator; sep != `` {
+			if parts := strings.Split(field, sep); len(parts) > 1 {
+				if fn := self.TypeMapping.NestedFieldFunc; fn != nil {
+					formattedField = fn(fmt.Sprintf(self.TypeMapping.FieldNameFormat, parts[0]), parts[1:], cast)
+				} else if nestFmt := self.TypeMapping.NestedFieldNameFormat; nestFmt != `` {
+					formattedField = fmt.Sprintf(nestFmt, parts[0], strings.Join(parts[1:], self.TypeMapping.NestedFieldJoiner))
+				}
 			}
 		}
 
@@ -750,11 +1310,30 @@ func (self *Sql) ToAggregatedFieldName(agg filter.Aggregation, field string) str
 		return fmt.Sprintf("AVG(%v)", field)
 	case filter.Count:
 		return fmt.Sprintf("COUNT(%v)", field)
+	case filter.CountDistinct, filter.Cardinality:
+		return fmt.Sprintf("COUNT(DISTINCT %v)", field)
 	default:
 		return field
 	}
 }
 
+// Returns the expression that calculates the given aggregate, or an error if this dialect cannot
+// calculate it.
+func (self *Sql) ToAggregateExpression(aggregate filter.Aggregate) (string, error) {
+	switch aggregate.Aggregation {
+	case filter.Percentile, filter.Median, filter.StdDev, filter.Variance:
+		if fn := self.TypeMapping.AggregateFunc; fn != nil {
+			if expr, ok := fn(aggregate, self.ToFieldName(aggregate.Field)); ok {
+				return expr, nil
+			}
+		}
+
+		return ``, fmt.Errorf("%v does not support %v aggregates", self.TypeMapping, aggregate.Aggregation)
+	default:
+		return self.ToAggregatedFieldName(aggregate.Aggregation, aggregate.Field), nil
+	}
+}
+
 func (self *Sql) ToNativeValue(t dal.Type, subtypes []dal.Type, in interface{}) string {
 	if in == nil {
 		return `NULL`
@@ -864,6 +1443,11 @@ func (self *Sql) ToNativeType(in dal.Type, subtypes []dal.Type, length int) (str
 		out = strings.ToUpper(in.String())
 	}
 
+	// JSON document types don't take a length
+	if isJsonNativeType(out) {
+		length = 0
+	}
+
 	if length > 0 {
 		if precision > 0 {
 			out = out + fmt.Sprintf("(%d,%d)", length, precision)
@@ -875,6 +1459,16 @@ func (self *Sql) ToNativeType(in dal.Type, subtypes []dal.Type, length int) (str
 	return strings.ToUpper(out), nil
 }
 
+// returns whether the given native type stores JSON documents.
+func isJsonNativeType(nativeType string) bool {
+	switch strings.ToUpper(nativeType) {
+	case `JSON`, `JSONB`:
+		return true
+	default:
+		return false
+	}
+}
+
 func (self *Sql) SplitTypeLength(in string) (string, int, int) {
 	var length int
 	var precision int
@@ -934,7 +1528,16 @@ func (self *Sql) PrepareInputValue(f string, value interface{}) (interface{}, er
 
 	switch reflect.ValueOf(value).Kind() {
 	case reflect.Struct, reflect.Map, reflect.Ptr, reflect.Array, reflect.Slice:
-		return SqlJsonTypeEncoder(value)
+		if data, err := SqlJsonTypeEncoder(value); err == nil {
+			// JSON columns take their input as text rather than as binary data
+			if isJsonNativeType(self.TypeMapping.ObjectType) {
+				return string(data), nil
+			} else {
+				return data, nil
+			}
+		} else {
+			return nil, err
+		}
 	default:
 		return value, nil
 	}
@@ -990,16 +1593,107 @@ func (self *Sql) ArrayTypeDecode(in []byte, out interface{}) error {
 
 func (self *Sql) populateWhereClause() {
 	if len(self.criteria) > 0 {
-		self.Push([]byte(` `))
+		where := strings.Join(self.criteria, self.conjunctionOperator(self.conjunction))
+
+		if self.keyset != `` {
+			if len(self.criteria) > 1 && self.conjunction == filter.OrConjunction {
+				where = `(` + where + `)`
+			}
+
+			where += ` AND ` + self.keyset
+		}
+
+		self.Push([]byte(` WHERE `))
+		self.Push([]byte(where))
+	} else if self.keyset != `` {
+		self.Push([]byte(` WHERE `))
+		self.Push([]byte(self.keyset))
+	}
+}
+
+// Renders a clause that only matches rows that sort after the position encoded in the filter's
+// cursor.  If all sort fields are in the same direction, this is a row value comparison like
+// "(a, b) > (x, y)"; otherwise it is expanded into "(a > x) OR (a = x AND b < y) ...".
+func (self *Sql) keysetClause(f *filter.Filter) (string, error) {
+	values, err := f.CursorValues()
+
+	if err != nil {
+		return ``, err
+	} else if values == nil {
+		return ``, nil
+	}
 
-		for i, criterionStr := range self.criteria {
-			self.Push([]byte(criterionStr))
+	sortBy := f.CursorSort()
+	uniform := true
 
-			// do this for all but the last criterion
-			if i+1 < len(self.criteria) {
-				self.Push([]byte(` `))
+	for _, s := range sortBy {
+		if s.Descending != sortBy[0].Descending {
+			uniform = false
+			break
+		}
+	}
+
+	afterOperator := func(s filter.SortBy) string {
+		if s.Descending {
+			return `<`
+		} else {
+			return `>`
+		}
+	}
+
+	addValue := func(s filter.SortBy, value interface{}) (string, error) {
+		if typedValue, err := self.valueToNativeRepresentation(dal.AutoType, value); err == nil {
+			self.values = append(self.values, typedValue)
+			return fmt.Sprintf("\u2983%s\u2984", s.Field), nil
+		} else {
+			return ``, err
+		}
+	}
+
+	if uniform {
+		fields := make([]string, len(sortBy))
+		placeholders := make([]string, len(sortBy))
+
+		for i, s := range sortBy {
+			fields[i] = self.ToFieldName(s.Field)
+
+			if placeholder, err := addValue(s, values[i]); err == nil {
+				placeholders[i] = placeholder
+			} else {
+				return ``, err
 			}
 		}
+
+		return fmt.Sprintf(
+			"((%s) %s (%s))",
+			strings.Join(fields, `, `),
+			afterOperator(sortBy[0]),
+			strings.Join(placeholders, `, `),
+		), nil
+	} else {
+		ors := make([]string, len(sortBy))
+
+		for i := range sortBy {
+			ands := make([]string, i+1)
+
+			for j := 0; j <= i; j++ {
+				operator := `=`
+
+				if j == i {
+					operator = afterOperator(sortBy[j])
+				}
+
+				if placeholder, err := addValue(sortBy[j], values[j]); err == nil {
+					ands[j] = fmt.Sprintf("%s %s %s", self.ToFieldName(sortBy[j].Field), operator, placeholder)
+				} else {
+					return ``, err
+				}
+			}
+
+			ors[i] = `(` + strings.Join(ands, ` AND `) + `)`
+		}
+
+		return `(` + strings.Join(ors, ` OR `) + `)`, nil
 	}
 }
 
@@ -1015,23 +1709,72 @@ func (self *Sql) populateGroupBy() {
 	}
 }
 
+func (self *Sql) populateHaving() error {
+	if self.having == nil || len(self.having.Criteria) == 0 || len(self.groupBy) == 0 {
+		return nil
+	}
+
+	self.aggregateFields = make(map[string]string)
+
+	defer func() {
+		self.aggregateFields = nil
+	}()
+
+	for _, aggregate := range self.aggregateBy {
+		if expr, err := self.ToAggregateExpression(aggregate); err == nil {
+			self.aggregateFields[aggregate.ResultName()] = expr
+		} else {
+			return err
+		}
+	}
+
+	parts := make([]string, 0, len(self.having.Criteria))
+
+	for _, criterion := range self.having.Criteria {
+		if part, err := self.criterionToSql(criterion); err == nil {
+			parts = append(parts, part)
+		} else {
+			return err
+		}
+	}
+
+	self.Push([]byte(` HAVING `))
+	self.Push([]byte(strings.Join(parts, self.conjunctionOperator(self.having.Conjunction))))
+
+	return nil
+}
+
 func (self *Sql) populateOrderBy(f *filter.Filter) {
-	if sortFields := sliceutil.CompactString(f.Sort); len(sortFields) > 0 {
-		self.Push([]byte(` ORDER BY `))
-		orderByFields := make([]string, len(sortFields))
+	sorts := f.GetSort()
 
-		for i, sortBy := range f.GetSort() {
-			v := self.ToFieldName(sortBy.Field)
+	// cursor pagination requires a total ordering, so the identity field is always included
+	if f.UsesCursor() {
+		sorts = f.CursorSort()
+	} else if len(sliceutil.CompactString(f.Sort)) == 0 {
+		sorts = nil
+	}
 
-			if !sortBy.Descending {
-				v += ` ASC`
-			} else {
-				v += ` DESC`
-			}
+	orderByFields := make([]string, 0, len(sorts))
 
-			orderByFields[i] = v
+	for _, sortBy := range sorts {
+		// sorting by relevance is only possible if scores are being selected
+		if sortBy.Field == filter.ScoreField && !self.scoresResults() {
+			continue
 		}
 
+		v := self.ToFieldName(sortBy.Field)
+
+		if !sortBy.Descending {
+			v += ` ASC`
+		} else {
+			v += ` DESC`
+		}
+
+		orderByFields = append(orderByFields, v)
+	}
+
+	if len(orderByFields) > 0 {
+		self.Push([]byte(` ORDER BY `))
 		self.Push([]byte(strings.Join(orderByFields, `, `)))
 	}
 }
@@ -1040,7 +1783,7 @@ func (self *Sql) populateLimitOffset(f *filter.Filter) {
 	if f.Limit > 0 {
 		self.Push([]byte(fmt.Sprintf(" LIMIT %d", f.Limit)))
 
-		if f.Offset > 0 {
+		if f.Offset > 0 && !f.UsesCursor() {
 			self.Push([]byte(fmt.Sprintf(" OFFSET %d", f.Offset)))
 		}
 	}
@@ -301,6 +301,74 @@ func TestSqlInserts(t *testing.T) {
 	}
 }
 
+func TestSqlUpserts(t *testing.T) {
+	assert := require.New(t)
+
+	input := map[string]interface{}{
+		`id`:   1,
+		`name`: `ted`,
+		`age`:  7,
+	}
+
+	tests := map[string]string{
+		`postgresql`: `INSERT INTO "foo" ("age", "id", "name") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "age" = excluded."age", "name" = excluded."name"`,
+		`sqlite`:     `INSERT INTO "foo" ("age", "id", "name") VALUES (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "age" = excluded."age", "name" = excluded."name"`,
+		`mysql`:      "INSERT INTO `foo` (`age`, `id`, `name`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `age` = VALUES(`age`), `name` = VALUES(`name`)",
+	}
+
+	for mapping, expected := range tests {
+		gen := NewSqlGenerator()
+		gen.TypeMapping, _ = GetSqlTypeMapping(mapping)
+		gen.Type = SqlUpsertStatement
+		gen.InputData = input
+		gen.ConflictFields = []string{`id`}
+
+		actual, err := filter.Render(gen, `foo`, filter.Null())
+		assert.NoError(err)
+		assert.Equal(expected, string(actual[:]), mapping)
+		assert.EqualValues([]interface{}{7, 1, `ted`}, gen.GetValues(), mapping)
+	}
+
+	// rows consisting only of their keys have nothing to update
+	gen := NewSqlGenerator()
+	gen.TypeMapping = PostgresTypeMapping
+	gen.Type = SqlUpsertStatement
+	gen.InputData = map[string]interface{}{`a`: 1, `b`: 2}
+	gen.ConflictFields = []string{`a`, `b`}
+
+	actual, err := filter.Render(gen, `foo`, filter.Null())
+	assert.NoError(err)
+	assert.Equal(`INSERT INTO "foo" ("a", "b") VALUES ($1, $2) ON CONFLICT ("a", "b") DO NOTHING`, string(actual[:]))
+
+	gen = NewSqlGenerator()
+	gen.TypeMapping = MysqlTypeMapping
+	gen.Type = SqlUpsertStatement
+	gen.InputData = map[string]interface{}{`a`: 1, `b`: 2}
+	gen.ConflictFields = []string{`a`, `b`}
+
+	actual, err = filter.Render(gen, `foo`, filter.Null())
+	assert.NoError(err)
+	assert.Equal("INSERT INTO `foo` (`a`, `b`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `a` = VALUES(`a`)", string(actual[:]))
+
+	// without conflicting fields, upserts are plain inserts
+	gen = NewSqlGenerator()
+	gen.Type = SqlUpsertStatement
+	gen.InputData = map[string]interface{}{`name`: `ted`}
+
+	actual, err = filter.Render(gen, `foo`, filter.Null())
+	assert.NoError(err)
+	assert.Equal(`INSERT INTO foo (name) VALUES (?)`, string(actual[:]))
+
+	// the generic mapping has no upsert syntax
+	gen = NewSqlGenerator()
+	gen.Type = SqlUpsertStatement
+	gen.InputData = input
+	gen.ConflictFields = []string{`id`}
+
+	_, err = filter.Render(gen, `foo`, filter.Null())
+	assert.Error(err)
+}
+
 type updateTestData struct {
 	Input  map[string]interface{}
 	Filter string
@@ -805,6 +873,219 @@ func TestSqlMultipleValues(t *testing.T) {
 	}, false)
 }
 
+func TestSqlCriteriaGroups(t *testing.T) {
+	assert := require.New(t)
+
+	tests := map[string]qv{
+		`age/7/or(/name/ted/name/bob/)`: {
+			query: `SELECT * FROM foo WHERE (age = ?) AND ((name = ?) OR (name = ?))`,
+			values: []interface{}{
+				int64(7),
+				`ted`,
+				`bob`,
+			},
+		},
+		`or(/age/lt:7/and(/name/ted/age/gt:9/)/)`: {
+			query: `SELECT * FROM foo WHERE ((age < ?) OR ((name = ?) AND (age > ?)))`,
+			values: []interface{}{
+				int64(7),
+				`ted`,
+				int64(9),
+			},
+		},
+	}
+
+	for spec, expected := range tests {
+		f, err := filter.Parse(spec)
+		assert.Nil(err)
+
+		gen := NewSqlGenerator()
+		actual, err := filter.Render(gen, `foo`, f)
+		assert.Nil(err)
+		assert.Equal(expected.query, string(actual[:]), "filter: %v", spec)
+		assert.Equal(expected.values, gen.GetValues(), "filter: %v", spec)
+	}
+
+	// a top-level OR conjunction joins all criteria
+	f := filter.MustParse(`age/7/name/ted`)
+	f.Conjunction = filter.OrConjunction
+
+	gen := NewSqlGenerator()
+	actual, err := filter.Render(gen, `foo`, f)
+	assert.Nil(err)
+	assert.Equal(`SELECT * FROM foo WHERE (age = ?) OR (name = ?)`, string(actual[:]))
+}
+
+func TestSqlNestedFields(t *testing.T) {
+	assert := require.New(t)
+
+	fn := func(mapping SqlTypeMapping, tests map[string]qv) {
+		for spec, expected := range tests {
+			f, err := filter.Parse(spec)
+			assert.Nil(err)
+
+			gen := NewSqlGenerator()
+			gen.TypeMapping = mapping
+			gen.ArrayFields = []string{`tags`}
+
+			actual, err := filter.Render(gen, `foo`, f)
+			assert.Nil(err)
+			assert.Equal(expected.query, string(actual[:]), "filter: %v", spec)
+			assert.Equal(expected.values, gen.GetValues(), "filter: %v", spec)
+		}
+	}
+
+	fn(PostgresJsonTypeMapping, map[string]qv{
+		`metadata.customer.tier/gold`: {
+			query: `SELECT * FROM "foo" WHERE ("metadata"->'customer'->>'tier' = $1)`,
+			values: []interface{}{
+				`gold`,
+			},
+		},
+		`metadata.customer.age/gte:21`: {
+			query: `SELECT * FROM "foo" WHERE (("metadata"->'customer'->>'age')::bigint >= $1)`,
+			values: []interface{}{
+				int64(21),
+			},
+		},
+		`metadata.score/range:1.5|2.5`: {
+			query: `SELECT * FROM "foo" WHERE (("metadata"->>'score')::numeric BETWEEN $1 AND $2)`,
+			values: []interface{}{
+				float64(1.5),
+				float64(2.5),
+			},
+		},
+		`metadata.active/true`: {
+			query: `SELECT * FROM "foo" WHERE (("metadata"->>'active')::boolean = $1)`,
+			values: []interface{}{
+				true,
+			},
+		},
+		`metadata.name/prefix:ted`: {
+			query: `SELECT * FROM "foo" WHERE ("metadata"->>'name' LIKE $1)`,
+			values: []interface{}{
+				`ted%%`,
+			},
+		},
+		`tags/red|blue`: {
+			query: `SELECT * FROM "foo" WHERE ("tags" @> $1::jsonb OR "tags" @> $2::jsonb)`,
+			values: []interface{}{
+				`["red"]`,
+				`["blue"]`,
+			},
+		},
+		`tags/not:3`: {
+			query: `SELECT * FROM "foo" WHERE (NOT "tags" @> $1::jsonb)`,
+			values: []interface{}{
+				`[3]`,
+			},
+		},
+	})
+
+	fn(SqliteTypeMapping, map[string]qv{
+		`metadata.customer.tier/gold`: {
+			query: `SELECT * FROM "foo" WHERE (json_extract(CAST("metadata" AS TEXT), '$."customer"."tier"') = ?)`,
+			values: []interface{}{
+				`gold`,
+			},
+		},
+		`metadata.customer.age/lt:21`: {
+			query: `SELECT * FROM "foo" WHERE (json_extract(CAST("metadata" AS TEXT), '$."customer"."age"') < ?)`,
+			values: []interface{}{
+				int64(21),
+			},
+		},
+		`tags/red`: {
+			query: `SELECT * FROM "foo" WHERE (EXISTS (SELECT 1 FROM json_each(CAST("tags" AS TEXT)) WHERE json_each.value = ?))`,
+			values: []interface{}{
+				`red`,
+			},
+		},
+	})
+
+	// JSON document types are created without a length
+	gen := NewSqlGenerator()
+	gen.TypeMapping = PostgresJsonTypeMapping
+	nativeType, err := gen.ToNativeType(dal.ObjectType, nil, 131071)
+	assert.NoError(err)
+	assert.Equal(`JSONB`, nativeType)
+
+	value, err := gen.PrepareInputValue(`metadata`, map[string]interface{}{`a`: 1})
+	assert.NoError(err)
+	assert.Equal("{\"a\":1}\n", value)
+}
+
+func TestSqlFulltext(t *testing.T) {
+	assert := require.New(t)
+
+	fn := func(mapping SqlTypeMapping, tests map[string]qv) {
+		for spec, expected := range tests {
+			f, err := filter.Parse(spec)
+			assert.Nil(err)
+
+			gen := NewSqlGenerator()
+			gen.TypeMapping = mapping
+
+			actual, err := filter.Render(gen, `foo`, f)
+			assert.Nil(err)
+			assert.Equal(expected.query, string(actual[:]), "filter: %v", spec)
+			assert.Equal(expected.values, gen.GetValues(), "filter: %v", spec)
+		}
+	}
+
+	// without native full-text support, all terms must appear in the field
+	fn(GenericTypeMapping, map[string]qv{
+		`body/fulltext:quick fox`: {
+			query: `SELECT * FROM foo WHERE ((body LIKE ? AND body LIKE ?))`,
+			values: []interface{}{
+				`%%quick%%`,
+				`%%fox%%`,
+			},
+		},
+	})
+
+	fn(PostgresTypeMapping, map[string]qv{
+		`body/fulltext:quick fox/age/7`: {
+			query: `SELECT *, ts_rank(to_tsvector("body"), plainto_tsquery($1)) AS "_score" FROM "foo" ` +
+				`WHERE (to_tsvector("body") @@ plainto_tsquery($2)) AND ("age" = $3)`,
+			values: []interface{}{
+				`quick fox`,
+				`quick fox`,
+				int64(7),
+			},
+		},
+	})
+
+	// relevance scores can be sorted on, but only if they're being selected
+	gen := NewSqlGenerator()
+	gen.TypeMapping = PostgresTypeMapping
+
+	f := filter.MustParse(`body/fulltext:fox`).SortBy(`-_score`).WithFields(`id`, `_score`)
+	actual, err := filter.Render(gen, `foo`, f)
+	assert.Nil(err)
+	assert.Equal(`SELECT "id", ts_rank(to_tsvector("body"), plainto_tsquery($1)) AS "_score" FROM "foo" `+
+		`WHERE (to_tsvector("body") @@ plainto_tsquery($2)) ORDER BY "_score" DESC`, string(actual[:]))
+
+	actual, err = filter.Render(gen, `foo`, filter.MustParse(`age/7`).SortBy(`-_score`))
+	assert.Nil(err)
+	assert.Equal(`SELECT * FROM "foo" WHERE ("age" = $1)`, string(actual[:]))
+
+	sqlite := SqliteTypeMapping
+	sqlite.FulltextFunc = SqliteFulltextMatch
+	sqlite.FulltextScoreFunc = SqliteFulltextScore
+
+	fn(sqlite, map[string]qv{
+		`body/fulltext:quick "fox"`: {
+			query: `SELECT *, COALESCE((SELECT -bm25("foo__fulltext") FROM "foo__fulltext" WHERE "foo__fulltext".rowid = "foo".rowid AND "body" MATCH ?), 0) AS "_score" ` +
+				`FROM "foo" WHERE ("foo".rowid IN (SELECT rowid FROM "foo__fulltext" WHERE "body" MATCH ?))`,
+			values: []interface{}{
+				`"quick" """fox"""`,
+				`"quick" """fox"""`,
+			},
+		},
+	})
+}
+
 func TestSqlMultipleValuesWithNormalizer(t *testing.T) {
 	assert := require.New(t)
 
@@ -892,6 +1173,67 @@ func TestSqlLimitOffset(t *testing.T) {
 	assert.Equal(`SELECT * FROM foo LIMIT 4 OFFSET 12`, string(sql[:]))
 }
 
+func TestSqlCursorPagination(t *testing.T) {
+	assert := require.New(t)
+
+	cursorFilter := func(spec string, sort []string, after ...interface{}) *filter.Filter {
+		f := filter.MustParse(spec)
+		f.Sort = sort
+		f.Limit = 10
+		f.Offset = 20
+		f.Cursor = filter.CursorStart
+
+		if len(after) > 0 {
+			cursor, err := filter.EncodeCursor(after)
+			assert.NoError(err)
+			f.Cursor = cursor
+		}
+
+		return f
+	}
+
+	tests := []struct {
+		filter *filter.Filter
+		query  string
+		values []interface{}
+	}{
+		{
+			filter: cursorFilter(`all`, nil),
+			query:  `SELECT * FROM foo ORDER BY id ASC LIMIT 10`,
+			values: []interface{}{},
+		}, {
+			filter: cursorFilter(`all`, nil, 5),
+			query:  `SELECT * FROM foo WHERE ((id) > (?)) ORDER BY id ASC LIMIT 10`,
+			values: []interface{}{int64(5)},
+		}, {
+			filter: cursorFilter(`age/gt:7`, []string{`-age`, `-id`}, 30, 5),
+			query:  `SELECT * FROM foo WHERE (age > ?) AND ((age, id) < (?, ?)) ORDER BY age DESC, id DESC LIMIT 10`,
+			values: []interface{}{int64(7), int64(30), int64(5)},
+		}, {
+			filter: cursorFilter(`all`, []string{`-age`}, 30, 5),
+			query:  `SELECT * FROM foo WHERE ((age < ?) OR (age = ? AND id > ?)) ORDER BY age DESC, id ASC LIMIT 10`,
+			values: []interface{}{int64(30), int64(30), int64(5)},
+		},
+	}
+
+	for _, expected := range tests {
+		gen := NewSqlGenerator()
+		actual, err := filter.Render(gen, `foo`, expected.filter)
+		assert.NoError(err)
+		assert.Equal(expected.query, string(actual[:]))
+		assert.Equal(expected.values, gen.GetValues())
+	}
+
+	// a top-level OR is grouped separately from the cursor position
+	f := cursorFilter(`age/7/name/ted`, nil, 5)
+	f.Conjunction = filter.OrConjunction
+
+	gen := NewSqlGenerator()
+	actual, err := filter.Render(gen, `foo`, f)
+	assert.NoError(err)
+	assert.Equal(`SELECT * FROM foo WHERE ((age = ?) OR (name = ?)) AND ((id) > (?)) ORDER BY id ASC LIMIT 10`, string(actual[:]))
+}
+
 func TestSqlSelectFull(t *testing.T) {
 	assert := require.New(t)
 
@@ -1014,6 +1356,76 @@ func TestSqlSelectGroupBy(t *testing.T) {
 	)
 }
 
+func TestSqlSelectGroupByHaving(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := filter.Parse(`age/gt:18`)
+	assert.Nil(err)
+	f.Sort = []string{`-total`, `state`}
+	f.Limit = 5
+	f.Offset = 10
+
+	total, _ := filter.ParseAggregate(`total=count:id`)
+
+	gen := NewSqlGenerator()
+	gen.TypeMapping = PostgresTypeMapping
+	gen.GroupByField(`state`)
+	gen.AggregateBy(total)
+	gen.HavingBy(filter.MustParse(`total/gte:100/state/not:TX`))
+
+	sql, err := filter.Render(gen, `people`, f)
+	assert.Nil(err)
+
+	assert.Equal(
+		`SELECT "state", COUNT("id") AS "total" FROM "people" `+
+			`WHERE ("age" > $1) `+
+			`GROUP BY "state" `+
+			`HAVING (COUNT("id") >= $2) AND ("state" <> $3) `+
+			`ORDER BY "total" DESC, "state" ASC LIMIT 5 OFFSET 10`,
+		string(sql[:]),
+	)
+
+	assert.Equal([]interface{}{int64(18), int64(100), `TX`}, gen.GetValues())
+}
+
+func TestSqlSelectStatisticalAggregates(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := filter.Parse(`all`)
+	assert.Nil(err)
+
+	p95, _ := filter.ParseAggregate(`p95=p95:latency`)
+	spread, _ := filter.ParseAggregate(`spread=stddev:latency`)
+	users, _ := filter.ParseAggregate(`users=count_distinct:user`)
+
+	gen := NewSqlGenerator()
+	gen.TypeMapping = PostgresTypeMapping
+	gen.GroupByField(`host`)
+	gen.AggregateBy(p95)
+	gen.AggregateBy(spread)
+	gen.AggregateBy(users)
+
+	sql, err := filter.Render(gen, `requests`, f)
+	assert.Nil(err)
+
+	assert.Equal(
+		`SELECT "host", `+
+			`percentile_cont(0.95) WITHIN GROUP (ORDER BY "latency") AS "p95", `+
+			`stddev_pop("latency") AS "spread", `+
+			`COUNT(DISTINCT "user") AS "users" `+
+			`FROM "requests" GROUP BY "host"`,
+		string(sql[:]),
+	)
+
+	// dialects without the necessary functions refuse to render the query
+	gen = NewSqlGenerator()
+	gen.TypeMapping = SqliteTypeMapping
+	gen.AggregateBy(spread)
+
+	_, err = filter.Render(gen, `requests`, f)
+	assert.Error(err)
+}
+
 func TestSqlBulkDelete(t *testing.T) {
 	assert := require.New(t)
 
@@ -1064,6 +1476,67 @@ func TestSqlBulkDeleteWithNormalizers(t *testing.T) {
 	}, gen.GetValues())
 }
 
+func TestSqlCompositeKeyDelete(t *testing.T) {
+	assert := require.New(t)
+
+	f := filter.New()
+	f.AddCriteria(filter.Or(
+		filter.And(
+			filter.Criterion{Field: `id`, Operator: `is`, Values: []interface{}{`a`}},
+			filter.Criterion{Field: `version`, Operator: `is`, Values: []interface{}{1}},
+		),
+		filter.And(
+			filter.Criterion{Field: `id`, Operator: `is`, Values: []interface{}{`b`}},
+			filter.Criterion{Field: `version`, Operator: `is`, Values: []interface{}{2}},
+		),
+	))
+
+	tests := map[string]string{
+		`generic`:  `DELETE FROM foo WHERE (((id = ?) AND (version = ?)) OR ((id = ?) AND (version = ?)))`,
+		`postgres`: `DELETE FROM "foo" WHERE (("id", "version") IN (($1, $2), ($3, $4)))`,
+		`sqlite`:   `DELETE FROM "foo" WHERE (("id", "version") IN ((?, ?), (?, ?)))`,
+		`mysql`:    "DELETE FROM `foo` WHERE ((`id`, `version`) IN ((?, ?), (?, ?)))",
+	}
+
+	for _, mapping := range []SqlTypeMapping{
+		GenericTypeMapping,
+		PostgresTypeMapping,
+		SqliteTypeMapping,
+		MysqlTypeMapping,
+	} {
+		expected := tests[mapping.Name]
+		gen := NewSqlGenerator()
+		gen.TypeMapping = mapping
+		gen.Type = SqlDeleteStatement
+
+		sql, err := filter.Render(gen, `foo`, f)
+		assert.NoError(err)
+		assert.Equal(expected, string(sql[:]), mapping.Name)
+		assert.Equal([]interface{}{`a`, int64(1), `b`, int64(2)}, gen.GetValues(), mapping.Name)
+	}
+
+	// rows that don't all match the same fields are joined with OR
+	mixed := filter.New()
+	mixed.AddCriteria(filter.Or(
+		filter.And(
+			filter.Criterion{Field: `id`, Operator: `is`, Values: []interface{}{`a`}},
+			filter.Criterion{Field: `version`, Operator: `is`, Values: []interface{}{1}},
+		),
+		filter.And(
+			filter.Criterion{Field: `id`, Operator: `is`, Values: []interface{}{`b`}},
+			filter.Criterion{Field: `version`, Operator: `gt`, Values: []interface{}{2}},
+		),
+	))
+
+	gen := NewSqlGenerator()
+	gen.TypeMapping = SqliteTypeMapping
+	gen.Type = SqlDeleteStatement
+
+	sql, err := filter.Render(gen, `foo`, mixed)
+	assert.NoError(err)
+	assert.Equal(`DELETE FROM "foo" WHERE ((("id" = ?) AND ("version" = ?)) OR (("id" = ?) AND ("version" > ?)))`, string(sql[:]))
+}
+
 func TestSqlToNativeType(t *testing.T) {
 	assert := require.New(t)
 
@@ -4,6 +4,7 @@ package mapper
 // interacting with database objects.
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
@@ -93,7 +94,19 @@ func (self *Model) Migrate() error {
 	// 	return migratable.Migrate()
 	// }
 
-	if diffs := self.collection.Diff(actualCollection); diffs != nil {
+	var diffs []*dal.SchemaDelta
+
+	for _, diff := range self.collection.Diff(actualCollection) {
+		// fields that exist in the backend but not in the schema don't prevent us from working
+		// with the collection
+		if diff.Issue == dal.FieldExtraIssue {
+			log.Debugf("Collection %q: %v", self.collection.Name, diff)
+		} else {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	if len(diffs) > 0 {
 		merr := fmt.Errorf("Actual schema for collection '%s' differs from desired schema", self.collection.Name)
 
 		for _, diff := range diffs {
@@ -148,12 +161,15 @@ func (self *Model) Update(from interface{}) error {
 	}
 }
 
-// Creates or updates an instance of the model depending on whether it exists or not.
+// Creates or updates an instance of the model depending on whether it exists or not.  Instances
+// with an ID are written with a single upsert, rather than by checking for them first.
 func (self *Model) CreateOrUpdate(id interface{}, from interface{}) error {
-	if id == nil || !self.Exists(id) {
+	if id == nil {
 		return self.Create(from)
+	} else if record, err := self.collection.StructToRecord(from); err == nil {
+		return self.db.Upsert(self.collection.Name, dal.NewRecordSet(record))
 	} else {
-		return self.Update(from)
+		return err
 	}
 }
 
@@ -368,6 +384,91 @@ func (self *Model) GroupBy(fields []string, aggregates []filter.Aggregate, flt i
 	}
 }
 
+// Returns the number of distinct values of the given field among the records matching the filter.
+func (self *Model) CountDistinct(field string, flt interface{}) (uint64, error) {
+	if value, err := self.Aggregate(filter.Aggregate{
+		Aggregation: filter.CountDistinct,
+		Field:       field,
+	}, flt); err == nil {
+		return uint64(typeutil.Int(value)), nil
+	} else {
+		return 0, err
+	}
+}
+
+// Returns the value of the given field below which the given percentile (0-100) of the records
+// matching the filter fall.
+func (self *Model) Percentile(field string, percentile float64, flt interface{}) (float64, error) {
+	return self.aggregateFloat(filter.Aggregate{
+		Aggregation: filter.Percentile,
+		Field:       field,
+		Percentile:  percentile,
+	}, flt)
+}
+
+func (self *Model) Median(field string, flt interface{}) (float64, error) {
+	return self.aggregateFloat(filter.Aggregate{
+		Aggregation: filter.Median,
+		Field:       field,
+	}, flt)
+}
+
+// Returns the population standard deviation of the given field.
+func (self *Model) StdDev(field string, flt interface{}) (float64, error) {
+	return self.aggregateFloat(filter.Aggregate{
+		Aggregation: filter.StdDev,
+		Field:       field,
+	}, flt)
+}
+
+// Returns the population variance of the given field.
+func (self *Model) Variance(field string, flt interface{}) (float64, error) {
+	return self.aggregateFloat(filter.Aggregate{
+		Aggregation: filter.Variance,
+		Field:       field,
+	}, flt)
+}
+
+// Calculates the given aggregate across all records matching the filter.
+func (self *Model) Aggregate(aggregate filter.Aggregate, flt interface{}) (interface{}, error) {
+	if f, err := filter.Parse(flt); err == nil {
+		f.IdentityField = self.collection.IdentityField
+		f.Paginate = false
+
+		if aggregate.Field == `` {
+			aggregate.Field = f.IdentityField
+		}
+
+		if agg := self.db.WithAggregator(self.collection); agg != nil {
+			return backends.AggregateValue(context.Background(), agg, self.collection, aggregate, f)
+		} else {
+			return nil, fmt.Errorf("backend %T does not support aggregation", self.db)
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func (self *Model) aggregateFloat(aggregate filter.Aggregate, flt interface{}) (float64, error) {
+	if value, err := self.Aggregate(aggregate, flt); err == nil {
+		return typeutil.Float(value), nil
+	} else {
+		return 0, err
+	}
+}
+
+// Runs the given function inside of a transaction.  The Mapper passed to the function performs
+// all of its operations within the transaction, which is committed if the function returns nil
+// and rolled back otherwise.
+func (self *Model) Transaction(fn func(tx Mapper) error) error {
+	return backends.WithTransaction(self.db, func(tx backends.Backend) error {
+		return fn(&Model{
+			db:         tx,
+			collection: self.collection,
+		})
+	})
+}
+
 func (self *Model) populateOutputParameter(f *filter.Filter, recordset *dal.RecordSet, into interface{}) error {
 	// for each resulting record...
 	for _, record := range recordset.Records {
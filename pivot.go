@@ -43,24 +43,59 @@ func NewDatabaseWithOptions(connection string, options ConnectOptions) (DB, erro
 		}
 
 		if backend, err := backends.MakeBackend(cs); err == nil {
+			var primary backends.Indexer
+
 			// set indexer
 			if options.Indexer != `` {
-				if ics, err := dal.ParseConnectionString(options.Indexer); err == nil {
-					if NetrcFile != `` {
-						if err := ics.LoadCredentialsFromNetrc(NetrcFile); err != nil {
+				if ics, err := indexerConnectionString(options.Indexer); err == nil {
+					if len(options.AdditionalIndexers) > 0 {
+						if indexer, err := backends.MakeIndexer(ics); err == nil {
+							primary = indexer
+						} else {
 							return nil, err
 						}
-					}
-
-					if err := backend.SetIndexer(ics); err != nil {
+					} else if err := backend.SetIndexer(ics); err != nil {
 						return nil, err
 					}
 				} else {
 					return nil, err
 				}
+			} else if indexer, ok := backend.(backends.Indexer); ok {
+				primary = indexer
 			}
 
-			// TODO: add MultiIndexer if AdditionalIndexers is present
+			// put the primary indexer and any additional ones behind a MultiIndex
+			if len(options.AdditionalIndexers) > 0 {
+				multi := backends.NewMultiIndex()
+
+				if err := multi.SetStrategies(options); err != nil {
+					return nil, err
+				}
+
+				if primary != nil {
+					if err := multi.AddIndexer(primary); err != nil {
+						return nil, err
+					}
+				}
+
+				for _, additional := range options.AdditionalIndexers {
+					if ics, err := indexerConnectionString(additional); err == nil {
+						if indexer, err := backends.MakeIndexer(ics); err == nil {
+							if err := multi.AddIndexer(indexer); err != nil {
+								return nil, err
+							}
+						} else {
+							return nil, err
+						}
+					} else {
+						return nil, err
+					}
+				}
+
+				if err := backends.AttachIndexer(backend, multi); err != nil {
+					return nil, err
+				}
+			}
 
 			if !options.SkipInitialize {
 				if err := backend.Initialize(); err != nil {
@@ -77,6 +112,21 @@ func NewDatabaseWithOptions(connection string, options ConnectOptions) (DB, erro
 	}
 }
 
+// parses an indexer connection string, loading its credentials from the netrc file (if set).
+func indexerConnectionString(connection string) (dal.ConnectionString, error) {
+	if ics, err := dal.ParseConnectionString(connection); err == nil {
+		if NetrcFile != `` {
+			if err := ics.LoadCredentialsFromNetrc(NetrcFile); err != nil {
+				return ics, err
+			}
+		}
+
+		return ics, nil
+	} else {
+		return ics, err
+	}
+}
+
 // Create a new database connection with the default options.
 func NewDatabase(connection string) (DB, error) {
 	return NewDatabaseWithOptions(connection, ConnectOptions{})
@@ -156,6 +206,83 @@ func LoadSchemata(fileOrDirPaths ...string) ([]*dal.Collection, error) {
 	return loaded, nil
 }
 
+// Loads a single JSON- or YAML-encoded dal.Migration from a file.  If the migration does not
+// specify a version, the portion of the filename preceding the first "_" or "-" is used (e.g.:
+// "0003_add_email.yaml" has version "0003").
+func LoadMigrationFromFile(filename string) (*dal.Migration, error) {
+	var migration dal.Migration
+
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		switch ext := path.Ext(filename); ext {
+		case `.json`:
+			if err := json.Unmarshal(data, &migration); err != nil {
+				return nil, fmt.Errorf("decode error: %v", err)
+			}
+
+		case `.yml`, `.yaml`:
+			if err := yaml.Unmarshal(data, &migration); err != nil {
+				return nil, fmt.Errorf("decode error: %v", err)
+			}
+
+		default:
+			return nil, nil
+		}
+	} else {
+		return nil, err
+	}
+
+	if migration.Version == `` {
+		base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+		if i := strings.IndexAny(base, `_-`); i > 0 {
+			migration.Version = base[:i]
+		} else {
+			migration.Version = base
+		}
+	}
+
+	return &migration, migration.Validate()
+}
+
+// Calls LoadMigrationFromFile on all *.json, *.yml, and *.yaml files in the given directories,
+// returning the migrations ordered by version.
+func LoadMigrations(fileOrDirPaths ...string) ([]*dal.Migration, error) {
+	var loaded []*dal.Migration
+	var filenames []string
+
+	for _, fileOrDirPath := range fileOrDirPaths {
+		if fileutil.DirExists(fileOrDirPath) {
+			for _, pattern := range []string{`*.json`, `*.yml`, `*.yaml`} {
+				if fns, err := filepath.Glob(filepath.Join(fileOrDirPath, pattern)); err == nil {
+					filenames = append(filenames, fns...)
+				} else {
+					return nil, fmt.Errorf("Cannot list directory %q: %v", fileOrDirPath, err)
+				}
+			}
+		} else if fileutil.IsNonemptyFile(fileOrDirPath) {
+			filenames = append(filenames, fileOrDirPath)
+		} else {
+			return nil, fmt.Errorf("Cannot load migrations from %q", fileOrDirPath)
+		}
+	}
+
+	for _, filename := range filenames {
+		if migration, err := LoadMigrationFromFile(filename); err == nil {
+			if migration != nil {
+				loaded = append(loaded, migration)
+			}
+		} else {
+			return nil, fmt.Errorf("Cannot load migration file %q: %v", filename, err)
+		}
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return dal.MigrationVersionLess(loaded[i].Version, loaded[j].Version)
+	})
+
+	return loaded, nil
+}
+
 // Creates all non-existent schemata in the given directory.
 func ApplySchemata(fileOrDirPath string, db Backend) error {
 	if collections, err := LoadSchemata(fileOrDirPath); err == nil {
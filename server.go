@@ -186,6 +186,10 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 
 			if indexer := backend.WithSearch(nil, nil); indexer != nil {
 				status.Indexer = indexer.IndexConnectionString().String()
+
+				if multi, ok := indexer.(*backends.MultiIndex); ok {
+					status.Indexers = multi.Status()
+				}
 			}
 
 			httputil.RespondJSON(w, &status)
@@ -274,7 +278,7 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 						}
 					}
 
-					if recordset, err := queryInterface.Query(collection, f); err == nil {
+					if recordset, err := backends.QueryContext(req.Context(), queryInterface, collection, f); err == nil {
 						httputil.RespondJSON(w, recordset)
 					} else {
 						httputil.RespondJSON(w, err)
@@ -329,8 +333,13 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 								case `avg`:
 									value, err = aggregator.Average(collection, field, f)
 								default:
-									httputil.RespondJSON(w, fmt.Errorf("Unsupported aggregator '%s'", aggregation), http.StatusBadRequest)
-									return
+									// everything else (e.g.: "count_distinct", "median", "p95") is calculated as a group of one
+									if aggregate, perr := filter.ParseAggregate(aggregation + filter.ModifierDelimiter + field); perr == nil {
+										value, err = backends.AggregateValue(req.Context(), aggregator, collection, aggregate, f)
+									} else {
+										httputil.RespondJSON(w, fmt.Errorf("Unsupported aggregator '%s'", aggregation), http.StatusBadRequest)
+										return
+									}
 								}
 
 								if err != nil {
@@ -358,6 +367,136 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 			}
 		})
 
+	router.Get(`/api/collections/:collection/group/:fields`,
+		func(w http.ResponseWriter, req *http.Request) {
+			name := vestigo.Param(req, `collection`)
+			backend := backendForRequest(self, req, self.backend)
+			query := &backends.GroupByQuery{
+				Fields: strings.Split(vestigo.Param(req, `fields`), `,`),
+			}
+
+			for _, specs := range req.URL.Query()[`aggregate`] {
+				for _, spec := range strings.Split(specs, `,`) {
+					if aggregate, err := filter.ParseAggregate(spec); err == nil {
+						query.Aggregates = append(query.Aggregates, aggregate)
+					} else {
+						httputil.RespondJSON(w, err, http.StatusBadRequest)
+						return
+					}
+				}
+			}
+
+			// count the records in each group by default
+			if len(query.Aggregates) == 0 {
+				aggregate, _ := filter.ParseAggregate(`count`)
+				query.Aggregates = append(query.Aggregates, aggregate)
+			}
+
+			if having := httputil.Q(req, `having`); having != `` {
+				if f, err := filter.Parse(having); err == nil {
+					query.Having = f
+				} else {
+					httputil.RespondJSON(w, fmt.Errorf("having: %v", err), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if f, err := filterFromRequest(req, httputil.Q(req, `q`, `all`), 0); err == nil {
+				query.Filter = f
+				query.Sort = f.Sort
+				query.Limit = f.Limit
+				query.Offset = f.Offset
+
+				if collection, err := backend.GetCollection(name); err == nil {
+					collection = injectRequestParamsIntoCollection(req, collection)
+
+					if aggregator := backend.WithAggregator(collection); aggregator != nil {
+						if recordset, err := backends.GroupByQueryContext(req.Context(), aggregator, collection, query); err == nil {
+							httputil.RespondJSON(w, recordset)
+						} else {
+							httputil.RespondJSON(w, err)
+						}
+					} else {
+						httputil.RespondJSON(w, fmt.Errorf("Backend %T does not support aggregations.", self.backend), http.StatusBadRequest)
+					}
+				} else if dal.IsCollectionNotFoundErr(err) {
+					httputil.RespondJSON(w, err, http.StatusNotFound)
+				} else {
+					httputil.RespondJSON(w, err)
+				}
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+			}
+		})
+
+	router.Get(`/api/collections/:collection/histogram/:field`,
+		func(w http.ResponseWriter, req *http.Request) {
+			name := vestigo.Param(req, `collection`)
+			backend := backendForRequest(self, req, self.backend)
+			query := &backends.DateHistogramQuery{
+				Field: vestigo.Param(req, `field`),
+			}
+
+			if interval, err := backends.ParseHistogramInterval(httputil.Q(req, `interval`, `day`)); err == nil {
+				query.Interval = interval
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+				return
+			}
+
+			if loc, err := time.LoadLocation(httputil.Q(req, `tz`, `UTC`)); err == nil {
+				query.Location = loc
+			} else {
+				httputil.RespondJSON(w, fmt.Errorf("tz: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			for param, bound := range map[string]*time.Time{
+				`start`: &query.Start,
+				`end`:   &query.End,
+			} {
+				if v := httputil.Q(req, param); v != `` {
+					if t, err := time.Parse(time.RFC3339, v); err == nil {
+						*bound = t
+					} else {
+						httputil.RespondJSON(w, fmt.Errorf("%s: %v", param, err), http.StatusBadRequest)
+						return
+					}
+				}
+			}
+
+			for _, specs := range req.URL.Query()[`aggregate`] {
+				for _, spec := range strings.Split(specs, `,`) {
+					if aggregate, err := filter.ParseAggregate(spec); err == nil {
+						query.Aggregates = append(query.Aggregates, aggregate)
+					} else {
+						httputil.RespondJSON(w, err, http.StatusBadRequest)
+						return
+					}
+				}
+			}
+
+			if f, err := filterFromRequest(req, httputil.Q(req, `q`, `all`), 0); err == nil {
+				query.Filter = f
+
+				if collection, err := backend.GetCollection(name); err == nil {
+					collection = injectRequestParamsIntoCollection(req, collection)
+
+					if recordset, err := backends.DateHistogram(req.Context(), backend, collection, query); err == nil {
+						httputil.RespondJSON(w, recordset)
+					} else {
+						httputil.RespondJSON(w, err)
+					}
+				} else if dal.IsCollectionNotFoundErr(err) {
+					httputil.RespondJSON(w, err, http.StatusNotFound)
+				} else {
+					httputil.RespondJSON(w, err)
+				}
+			} else {
+				httputil.RespondJSON(w, err, http.StatusBadRequest)
+			}
+		})
+
 	router.Get(`/api/collections/:collection/list/*fields`,
 		func(w http.ResponseWriter, req *http.Request) {
 			name := vestigo.Param(req, `collection`)
@@ -371,7 +510,21 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 					if search := backend.WithSearch(collection); search != nil {
 						fields := strings.TrimPrefix(fieldNames, `/`)
 
-						if recordset, err := search.ListValues(collection, strings.Split(fields, `/`), f); err == nil {
+						// with facets=true, each value is returned with the number of records having it
+						if httputil.QBool(req, `facets`) {
+							query := &backends.FacetQuery{
+								Fields: strings.Split(fields, `/`),
+								Sort:   backends.FacetSort(httputil.Q(req, `sort`)),
+								Limit:  f.Limit,
+								Filter: f,
+							}
+
+							if facets, err := backends.Facets(req.Context(), search, collection, query); err == nil {
+								httputil.RespondJSON(w, facets)
+							} else {
+								httputil.RespondJSON(w, err)
+							}
+						} else if recordset, err := search.ListValues(collection, strings.Split(fields, `/`), f); err == nil {
 							httputil.RespondJSON(w, recordset)
 						} else {
 							httputil.RespondJSON(w, err)
@@ -414,6 +567,44 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 			}
 		})
 
+	// Index Administration
+	// ---------------------------------------------------------------------------------------------
+	indexAdminHandler := func(w http.ResponseWriter, req *http.Request) {
+		backend := self.backend
+		name := vestigo.Param(req, `collection`)
+
+		// the reindexer reads records from the backend itself, not the DB wrapping it
+		if db, ok := backend.(DB); ok {
+			backend = db.GetBackend()
+		}
+
+		if collection, err := backend.GetCollection(name); err == nil {
+			reindexer := backends.NewReindexer(backend)
+
+			if req.Method == `POST` {
+				reindexer.BatchSize = int(httputil.QInt(req, `batch_size`, int64(backends.DefaultReindexBatchSize)))
+				reindexer.Prune = httputil.QBool(req, `prune`)
+
+				if results, err := reindexer.ReindexContext(req.Context(), collection); err == nil {
+					httputil.RespondJSON(w, results)
+				} else {
+					httputil.RespondJSON(w, err)
+				}
+			} else if reports, err := reindexer.CheckContext(req.Context(), collection); err == nil {
+				httputil.RespondJSON(w, reports)
+			} else {
+				httputil.RespondJSON(w, err)
+			}
+		} else if dal.IsCollectionNotFoundErr(err) {
+			httputil.RespondJSON(w, err, http.StatusNotFound)
+		} else {
+			httputil.RespondJSON(w, err)
+		}
+	}
+
+	router.Post(`/api/admin/reindex/:collection`, indexAdminHandler)
+	router.Get(`/api/admin/index-check/:collection`, indexAdminHandler)
+
 	// Record CRUD
 	// ---------------------------------------------------------------------------------------------
 
@@ -440,9 +631,9 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 			var err error
 
 			if req.Method == `PUT` || httputil.QBool(req, `update`) {
-				err = backend.Update(name, &recordset)
+				err = backends.UpdateContext(req.Context(), backend, name, &recordset)
 			} else {
-				err = backend.Insert(name, &recordset)
+				err = backends.InsertContext(req.Context(), backend, name, &recordset)
 				status = http.StatusCreated
 			}
 
@@ -481,7 +672,7 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 				fields = strings.Split(v, `,`)
 			}
 
-			if record, err := backend.Retrieve(name, id, fields...); err == nil {
+			if record, err := backends.RetrieveContext(req.Context(), backend, name, id, fields...); err == nil {
 				httputil.RespondJSON(w, record)
 			} else if strings.HasSuffix(err.Error(), `does not exist`) {
 				httputil.RespondJSON(w, err, http.StatusNotFound)
@@ -502,9 +693,9 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 				var err error
 
 				if backend.Exists(name, record.ID) {
-					err = backend.Update(name, recordset)
+					err = backends.UpdateContext(req.Context(), backend, name, recordset)
 				} else {
-					err = backend.Insert(name, recordset)
+					err = backends.InsertContext(req.Context(), backend, name, recordset)
 				}
 
 				if err == nil {
@@ -519,18 +710,22 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 
 	router.Delete(`/api/collections/:collection/records/*id`,
 		func(w http.ResponseWriter, req *http.Request) {
-			var id interface{}
+			var ids []interface{}
 
 			name := vestigo.Param(req, `collection`)
 			backend := backendForRequest(self, req, self.backend)
 
-			if ids := strings.Split(vestigo.Param(req, `_name`), `/`); len(ids) == 1 {
-				id = ids[0]
-			} else {
-				id = ids
+			// each path segment is a record ID, which (as with retrieval) may be a colon-separated
+			// composite key
+			for _, segment := range strings.Split(vestigo.Param(req, `_name`), `/`) {
+				if keys := strings.Split(segment, `:`); len(keys) == 1 {
+					ids = append(ids, keys[0])
+				} else {
+					ids = append(ids, keys)
+				}
 			}
 
-			if err := backend.Delete(name, id); err == nil {
+			if err := backends.DeleteContext(req.Context(), backend, name, ids...); err == nil {
 				httputil.RespondJSON(w, nil)
 			} else {
 				httputil.RespondJSON(w, err)
@@ -561,7 +756,7 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 			backend := backendForRequest(self, req, self.backend)
 
 			if err := httputil.ParseRequest(req, &recordset); err == nil {
-				if err := backend.Insert(name, &recordset); err == nil {
+				if err := backends.InsertContext(req.Context(), backend, name, &recordset); err == nil {
 					httputil.RespondJSON(w, nil)
 				} else {
 					httputil.RespondJSON(w, err)
@@ -579,7 +774,7 @@ func (self *Server) setupRoutes(router *vestigo.Router) error {
 			backend := backendForRequest(self, req, self.backend)
 
 			if err := httputil.ParseRequest(req, &recordset); err == nil {
-				if err := backend.Update(name, &recordset); err == nil {
+				if err := backends.UpdateContext(req.Context(), backend, name, &recordset); err == nil {
 					httputil.RespondJSON(w, nil)
 				} else {
 					httputil.RespondJSON(w, err)
@@ -731,6 +926,10 @@ func filterFromRequest(req *http.Request, filterIn interface{}, defaultLimit int
 	f.Limit = limit
 	f.Offset = offset
 
+	if v := httputil.Q(req, `cursor`); v != `` {
+		f.Cursor = v
+	}
+
 	if v := httputil.Q(req, `sort`); v != `` {
 		f.Sort = strings.Split(v, `,`)
 	}
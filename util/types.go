@@ -1,11 +1,27 @@
 package util
 
+import (
+	"time"
+)
+
 var RecordStructTag = `pivot`
 
 type Status struct {
-	OK          bool   `json:"ok"`
-	Application string `json:"application"`
-	Version     string `json:"version"`
-	Backend     string `json:"backend,omitempty"`
-	Indexer     string `json:"indexer,omitempty"`
+	OK          bool            `json:"ok"`
+	Application string          `json:"application"`
+	Version     string          `json:"version"`
+	Backend     string          `json:"backend,omitempty"`
+	Indexer     string          `json:"indexer,omitempty"`
+	Indexers    []IndexerStatus `json:"indexers,omitempty"`
+}
+
+type IndexerStatus struct {
+	Index       int        `json:"index"`
+	Indexer     string     `json:"indexer"`
+	Primary     bool       `json:"primary"`
+	Healthy     bool       `json:"healthy"`
+	Errors      int        `json:"errors"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	LastOkAt    *time.Time `json:"last_ok_at,omitempty"`
 }